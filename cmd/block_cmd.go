@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/lugnut42/openipam/internal/ipam"
 	"github.com/spf13/cobra"
@@ -19,19 +20,34 @@ var blockCreateCmd = &cobra.Command{
 	Use:   "create",
 	Short: "Create a new IP address block",
 	Long: `Create a new IP address block with a specified CIDR range.
+
+Blocks overlapping reserved special-purpose ranges (loopback, link-local,
+multicast, documentation, ...) are rejected. Blocks in public address space
+are rejected unless --allow-public is given. --provider sets the cloud
+provider the block is deployed in, which determines the addresses reserved
+in each of its subnets.
 	
 Example:
-  ipam block create --cidr 10.0.0.0/16 --description "Production Network" --file prod`,
+  ipam block create --cidr 10.0.0.0/16 --description "Production Network" --file prod
+  ipam block create --cidr 10.1.0.0/16 --provider aws --file prod
+  ipam block create --cidr 203.0.112.0/24 --allow-public --file prod`,
 	Run: func(cmd *cobra.Command, args []string) {
 		cidr, _ := cmd.Flags().GetString("cidr")
 		description, _ := cmd.Flags().GetString("description")
+		provider, _ := cmd.Flags().GetString("provider")
 		fileKey, _ := cmd.Flags().GetString("file")
+		allowPublic, _ := cmd.Flags().GetBool("allow-public")
 
-		err := ipam.AddBlock(cfg, cidr, description, fileKey)
+		mgr, err := newManager()
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error:", err)
-			os.Exit(1)
+			exitWithError(err)
+		}
+
+		warnings, err := mgr.AddBlock(cidr, description, provider, fileKey, allowPublic)
+		if err != nil {
+			exitWithError(err)
 		}
+		printWarnings(warnings)
 
 		fmt.Printf("Created block %s in %s file\n", cidr, fileKey)
 	},
@@ -49,10 +65,18 @@ Example:
 	Run: func(cmd *cobra.Command, args []string) {
 		fileKey, _ := cmd.Flags().GetString("file")
 
-		err := ipam.ListBlocks(cfg, fileKey)
+		mgr, err := newManager()
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error:", err)
-			os.Exit(1)
+			exitWithError(err)
+		}
+
+		entries, err := mgr.ListBlocks(fileKey)
+		if err != nil {
+			exitWithError(err)
+		}
+
+		if err := ipam.PrintBlocks(entries); err != nil {
+			exitWithError(err)
 		}
 	},
 }
@@ -66,15 +90,24 @@ var blockShowCmd = &cobra.Command{
 Example:
   ipam block show 10.0.0.0/16
   ipam block show 10.0.0.0/16 --file prod`,
-	Args: cobra.ExactArgs(1),
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeBlockArgs,
 	Run: func(cmd *cobra.Command, args []string) {
 		cidr := args[0]
 		fileKey, _ := cmd.Flags().GetString("file")
 
-		err := ipam.ShowBlock(cfg, cidr, fileKey)
+		mgr, err := newManager()
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error:", err)
-			os.Exit(1)
+			exitWithError(err)
+		}
+
+		block, err := mgr.GetBlock(cidr, fileKey)
+		if err != nil {
+			exitWithError(err)
+		}
+
+		if err := ipam.PrintBlock(block); err != nil {
+			exitWithError(err)
 		}
 	},
 }
@@ -89,16 +122,20 @@ Example:
   ipam block delete 10.0.0.0/16
   ipam block delete 10.0.0.0/16 --force
   ipam block delete 10.0.0.0/16 --file prod`,
-	Args: cobra.ExactArgs(1),
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeBlockArgs,
 	Run: func(cmd *cobra.Command, args []string) {
 		cidr := args[0]
 		force, _ := cmd.Flags().GetBool("force")
 		fileKey, _ := cmd.Flags().GetString("file")
 
-		err := ipam.DeleteBlock(cfg, cidr, force, fileKey)
+		mgr, err := newManager()
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error:", err)
-			os.Exit(1)
+			exitWithError(err)
+		}
+
+		if err := mgr.DeleteBlock(cidr, fileKey, force); err != nil {
+			exitWithError(err)
 		}
 
 		fmt.Printf("Deleted block %s from %s file\n", cidr, fileKey)
@@ -114,15 +151,24 @@ var blockAvailableCmd = &cobra.Command{
 Example:
   ipam block available 10.0.0.0/16
   ipam block available 10.0.0.0/16 --file prod`,
-	Args: cobra.ExactArgs(1),
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeBlockArgs,
 	Run: func(cmd *cobra.Command, args []string) {
 		cidr := args[0]
 		fileKey, _ := cmd.Flags().GetString("file")
 
-		err := ipam.ListAvailableCIDRs(cfg, cidr, fileKey)
+		mgr, err := newManager()
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error:", err)
-			os.Exit(1)
+			exitWithError(err)
+		}
+
+		availableCIDRs, err := mgr.AvailableCIDRs(cidr, fileKey)
+		if err != nil {
+			exitWithError(err)
+		}
+
+		if err := ipam.PrintAvailableCIDRs(availableCIDRs); err != nil {
+			exitWithError(err)
 		}
 	},
 }
@@ -144,16 +190,21 @@ This command performs comprehensive validation on your block configuration files
 
 If a file-key is provided, it validates only that specific block file.
 Without a file-key, it validates the default block file.`,
+	ValidArgsFunction: completeFileKeyArgs,
 	Run: func(cmd *cobra.Command, args []string) {
 		fileKey := "default"
 		if len(args) > 0 {
 			fileKey = args[0]
 		}
 
-		results, err := ipam.ValidateBlockFile(cfg, fileKey)
+		mgr, err := newManager()
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error:", err)
-			os.Exit(1)
+			exitWithError(err)
+		}
+
+		results, err := mgr.Validate(fileKey)
+		if err != nil {
+			exitWithError(err)
 		}
 
 		fmt.Printf("=== Validating Block File: %s ===\n", fileKey)
@@ -180,36 +231,252 @@ This command calculates IP address utilization statistics, showing:
 - Available IP addresses
 - Utilization percentage
 - Subnet breakdown with allocation percentages
+- Fragmentation: the largest free range, a histogram of free ranges by prefix
+  length, how many subnets of each pattern's size still fit, and a
+  fragmentation score from 0 (all free space contiguous) to 1
 
 To show utilization for a specific block, provide its CIDR.
 To show utilization for all blocks, omit the CIDR parameter.
 
+With --threshold, the command checks the blocks of all block files, or of the
+one given with --file, instead of printing the report. It exits with status 6
+if any block's utilization exceeds the threshold percentage, or if the largest
+free range of a block is smaller than the subnet size of a pattern allocating
+from it. This is meant for cron-based alerting.
+
 Example:
   ipam block util 10.0.0.0/16   # Show utilization for a specific block
   ipam block util                # Show utilization for all blocks
+  ipam block util --threshold 80 # Alert when a block is over 80% utilized
+  ipam block util -o json        # Machine-readable report
 `,
+	ValidArgsFunction: completeBlockArgs,
 	Run: func(cmd *cobra.Command, args []string) {
 		fileKey, _ := cmd.Flags().GetString("file")
 
+		if cmd.Flags().Changed("threshold") {
+			threshold, _ := cmd.Flags().GetFloat64("threshold")
+			blockCIDR := ""
+			if len(args) > 0 {
+				blockCIDR = args[0]
+			}
+
+			// Alerting covers every block file unless one is given
+			if !cmd.Flags().Changed("file") {
+				fileKey = ""
+			}
+
+			mgr, err := newManager()
+			if err != nil {
+				exitWithError(err)
+			}
+			violations, err := mgr.CheckThresholds(blockCIDR, fileKey, threshold)
+			if err != nil {
+				exitWithError(err)
+			}
+			if len(violations) == 0 {
+				fmt.Println("All blocks are within thresholds")
+				return
+			}
+			for _, v := range violations {
+				fmt.Fprintf(os.Stderr, "ALERT: block %s in %s file: %s\n", v.CIDR, v.FileKey, v.Reason)
+			}
+			os.Exit(ExitThreshold)
+		}
+
+		output, _ := cmd.Flags().GetString("output")
+		if output != "json" && output != "table" {
+			fmt.Fprintf(os.Stderr, "Error: unsupported output format %q (use table or json)\n", output)
+			os.Exit(ExitError)
+		}
+
+		mgr, err := newManager()
+		if err != nil {
+			exitWithError(err)
+		}
+
 		if len(args) > 0 {
 			// Show utilization for a specific block
-			cidr := args[0]
-			err := ipam.PrintBlockUtilization(cfg, cidr, fileKey)
+			report, err := mgr.Utilization(args[0], fileKey)
 			if err != nil {
-				fmt.Fprintln(os.Stderr, "Error:", err)
-				os.Exit(1)
+				exitWithError(err)
+			}
+			if output == "json" {
+				err = ipam.PrintJSON(report)
+			} else {
+				err = ipam.PrintBlockUtilization(report)
+			}
+			if err != nil {
+				exitWithError(err)
 			}
 		} else {
 			// Show utilization for all blocks
-			err := ipam.PrintAllBlocksUtilization(cfg, fileKey)
+			reports, err := mgr.FileUtilization(fileKey)
+			if err != nil {
+				exitWithError(err)
+			}
+			if output == "json" {
+				err = ipam.PrintJSON(reports)
+			} else {
+				err = ipam.PrintAllBlocksUtilization(reports)
+			}
 			if err != nil {
-				fmt.Fprintln(os.Stderr, "Error:", err)
-				os.Exit(1)
+				exitWithError(err)
+			}
+		}
+	},
+}
+
+// blockForecastCmd represents the forecast command
+var blockForecastCmd = &cobra.Command{
+	Use:   "forecast",
+	Short: "Forecast when a block runs out of capacity",
+	Long: `Project when a block runs out of capacity based on its recent allocation rate.
+
+The allocation rate is the number of addresses allocated per day over the
+forecast window, taken from the creation time recorded on each subnet. The
+forecast covers the block as a whole and the subnet size of every pattern that
+allocates from the block; fragmentation is taken into account, so a pattern
+runs out once no free range of its size is left.
+
+Example:
+  ipam block forecast --cidr 10.0.0.0/16
+  ipam block forecast --cidr 10.0.0.0/16 --days 30 --file prod`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cidr, _ := cmd.Flags().GetString("cidr")
+		fileKey, _ := cmd.Flags().GetString("file")
+		days, _ := cmd.Flags().GetInt("days")
+		if days <= 0 {
+			fmt.Fprintln(os.Stderr, "Error: --days must be positive")
+			os.Exit(ExitError)
+		}
+
+		mgr, err := newManager()
+		if err != nil {
+			exitWithError(err)
+		}
+
+		report, err := mgr.Forecast(cidr, fileKey, time.Duration(days)*24*time.Hour)
+		if err != nil {
+			exitWithError(err)
+		}
+
+		if err := ipam.PrintForecast(report); err != nil {
+			exitWithError(err)
+		}
+	},
+}
+
+// blockDefragPlanCmd represents the defrag-plan command
+var blockDefragPlanCmd = &cobra.Command{
+	Use:   "defrag-plan",
+	Short: "Plan subnet moves that consolidate a block's free space",
+	Long: `Suggest a compaction plan for a fragmented block: a set of subnet moves
+(old CIDR -> new CIDR) that packs the subnets together so that the free space
+forms the largest possible contiguous ranges. The plan is only printed.
+
+With --apply, only subnets flagged as safe to renumber are moved. Mark a subnet
+as safe by setting "renumberable: true" on it in the block file. All other
+subnets stay in place and the plan is recomputed around them before it is
+applied.
+
+Example:
+  ipam block defrag-plan --cidr 10.0.0.0/16
+  ipam block defrag-plan --cidr 10.0.0.0/16 --apply --file prod`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cidr, _ := cmd.Flags().GetString("cidr")
+		fileKey, _ := cmd.Flags().GetString("file")
+		apply, _ := cmd.Flags().GetBool("apply")
+
+		mgr, err := newManager()
+		if err != nil {
+			exitWithError(err)
+		}
+
+		plan, err := mgr.PlanDefrag(cidr, fileKey, apply)
+		if err != nil {
+			exitWithError(err)
+		}
+
+		if err := ipam.PrintDefragPlan(plan); err != nil {
+			exitWithError(err)
+		}
+
+		if apply && len(plan.Moves) > 0 {
+			if err := mgr.ApplyDefrag(plan); err != nil {
+				exitWithError(err)
+			}
+			fmt.Printf("\nApplied %d subnet moves to block %s\n", len(plan.Moves), plan.BlockCIDR)
+		}
+	},
+}
+
+// blockMapCmd represents the map command
+var blockMapCmd = &cobra.Command{
+	Use:   "map",
+	Short: "Render a visual map of a block's address space",
+	Long: `Render a block as a proportional bar showing its subnets colored by region,
+special-purpose ranges within it, and its free ranges. The map is written as a
+self-contained SVG image or HTML page, suitable for attaching to change requests.
+
+Without --out the map is written to standard output.
+
+Example:
+  ipam block map --cidr 10.0.0.0/16 --format svg --out block.svg
+  ipam block map --cidr 10.0.0.0/16 --format html --file prod > block.html`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cidr, _ := cmd.Flags().GetString("cidr")
+		fileKey, _ := cmd.Flags().GetString("file")
+		format, _ := cmd.Flags().GetString("format")
+		out, _ := cmd.Flags().GetString("out")
+
+		if format != "svg" && format != "html" {
+			fmt.Fprintf(os.Stderr, "Error: unsupported map format %q (use svg or html)\n", format)
+			os.Exit(ExitError)
+		}
+
+		mgr, err := newManager()
+		if err != nil {
+			exitWithError(err)
+		}
+
+		blockMap, err := mgr.BlockMap(cidr, fileKey)
+		if err != nil {
+			exitWithError(err)
+		}
+
+		if out == "" {
+			if err := ipam.WriteBlockMap(os.Stdout, blockMap, format); err != nil {
+				exitWithError(err)
 			}
+			return
 		}
+
+		if err := writeBlockMapFile(out, blockMap, format); err != nil {
+			exitWithError(err)
+		}
+		fmt.Printf("Wrote %s map of block %s to %s\n", format, blockMap.BlockCIDR, out)
 	},
 }
 
+// writeBlockMapFile writes a block map to a file. The file is closed before
+// returning, and an error closing it is reported, so that a truncated map is
+// never reported as written.
+func writeBlockMapFile(path string, blockMap *ipam.BlockMap, format string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating map file: %w", err)
+	}
+	if err := ipam.WriteBlockMap(f, blockMap, format); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error writing map file: %w", err)
+	}
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(blockCmd)
 	blockCmd.AddCommand(blockCreateCmd)
@@ -219,10 +486,15 @@ func init() {
 	blockCmd.AddCommand(blockAvailableCmd)
 	blockCmd.AddCommand(blockValidateCmd)
 	blockCmd.AddCommand(blockUtilCommand)
+	blockCmd.AddCommand(blockForecastCmd)
+	blockCmd.AddCommand(blockDefragPlanCmd)
+	blockCmd.AddCommand(blockMapCmd)
 
 	blockCreateCmd.Flags().String("cidr", "", "CIDR range of the block")
 	blockCreateCmd.Flags().String("description", "", "Description of the block")
 	blockCreateCmd.Flags().StringP("file", "f", "default", "Block file key to use")
+	blockCreateCmd.Flags().Bool("allow-public", false, "Allow blocks in public address space")
+	blockCreateCmd.Flags().String("provider", "", "Cloud provider of the block (aws, azure, gcp, ...), for its reserved addresses")
 	if err := blockCreateCmd.MarkFlagRequired("cidr"); err != nil {
 		fmt.Fprintf(os.Stderr, "Error marking flag required: %v\n", err)
 	}
@@ -237,4 +509,36 @@ func init() {
 	blockAvailableCmd.Flags().StringP("file", "f", "default", "Block file key to use")
 
 	blockUtilCommand.Flags().StringP("file", "f", "default", "Block file key to use")
-}
\ No newline at end of file
+	blockUtilCommand.Flags().StringP("output", "o", "table", "Output format: table or json")
+	blockUtilCommand.Flags().Float64("threshold", 0, "Exit non-zero if a block exceeds this utilization percentage")
+
+	blockForecastCmd.Flags().String("cidr", "", "CIDR of the block to forecast")
+	blockForecastCmd.Flags().StringP("file", "f", "default", "Block file key to use")
+	blockForecastCmd.Flags().Int("days", 90, "Number of days of allocation history to derive the rate from")
+
+	blockDefragPlanCmd.Flags().String("cidr", "", "CIDR of the block to defragment")
+	blockDefragPlanCmd.Flags().StringP("file", "f", "default", "Block file key to use")
+	blockDefragPlanCmd.Flags().Bool("apply", false, "Move the subnets flagged as renumberable")
+	if err := blockDefragPlanCmd.MarkFlagRequired("cidr"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error marking flag required: %v\n", err)
+	}
+	if err := blockForecastCmd.MarkFlagRequired("cidr"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error marking flag required: %v\n", err)
+	}
+
+	blockMapCmd.Flags().String("cidr", "", "CIDR of the block to map")
+	blockMapCmd.Flags().StringP("file", "f", "default", "Block file key to use")
+	blockMapCmd.Flags().String("format", "svg", "Map format: svg or html")
+	blockMapCmd.Flags().String("out", "", "File to write the map to (default standard output)")
+	if err := blockMapCmd.MarkFlagRequired("cidr"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error marking flag required: %v\n", err)
+	}
+
+	for _, cmd := range []*cobra.Command{blockCreateCmd, blockListCmd, blockShowCmd, blockDeleteCmd, blockAvailableCmd, blockUtilCommand, blockForecastCmd, blockDefragPlanCmd, blockMapCmd} {
+		registerFlagCompletion(cmd, "file", completeFileKeys)
+	}
+	for _, cmd := range []*cobra.Command{blockForecastCmd, blockDefragPlanCmd, blockMapCmd} {
+		registerFlagCompletion(cmd, "cidr", completeBlocks)
+	}
+	registerFlagCompletion(blockCreateCmd, "provider", completeProviders)
+}
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/ipam"
 	"github.com/lugnut42/openipam/internal/logger"
 
 	"github.com/spf13/cobra"
@@ -137,3 +138,16 @@ func TestBlockCommands(t *testing.T) {
 
 	// Rest of the tests...
 }
+
+func TestWriteBlockMapFile(t *testing.T) {
+	blockMap := &ipam.BlockMap{BlockCIDR: "10.0.0.0/16"}
+	out := filepath.Join(t.TempDir(), "block.svg")
+
+	assert.NoError(t, writeBlockMapFile(out, blockMap, "svg"))
+	data, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "</svg>")
+
+	assert.ErrorContains(t, writeBlockMapFile(out, blockMap, "png"), "unsupported map format")
+	assert.ErrorContains(t, writeBlockMapFile(filepath.Join(out, "missing", "block.svg"), blockMap, "svg"), "error creating map file")
+}
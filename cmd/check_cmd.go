@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/lugnut42/openipam/internal/ipam"
+	openipam "github.com/lugnut42/openipam/pkg/ipam"
 	"github.com/spf13/cobra"
 )
 
@@ -26,24 +27,52 @@ This performs a comprehensive validation on block files, checking:
 - Duplicate entries and references
 - Required fields and metadata
 
-If a specific file-key is provided, only checks that file. Otherwise, checks all configured files.`,
+If a specific file-key is provided, only checks that file. Otherwise, checks all configured files.
+
+With --fix, safe remediations are applied before validating: non-canonical
+CIDRs are normalized, exact duplicate subnet entries are removed, subnets are
+sorted by address and patterns referencing deleted blocks are removed. A diff
+of the changes is shown and any remaining issues are reported as usual.`,
+	ValidArgsFunction: completeFileKeyArgs,
 	Run: func(cmd *cobra.Command, args []string) {
 		all, _ := cmd.Flags().GetBool("all")
+		fix, _ := cmd.Flags().GetBool("fix")
+
+		mgr, err := newManager()
+		if err != nil {
+			exitWithError(err)
+		}
+
+		if fix {
+			var fileKeys []string
+			if all {
+				fileKeys = mgr.FileKeys()
+			} else if len(args) > 0 {
+				fileKeys = []string{args[0]}
+			} else {
+				fileKeys = []string{"default"}
+			}
+
+			for _, fileKey := range fileKeys {
+				report, err := mgr.FixBlockFile(fileKey)
+				if err != nil {
+					exitWithError(err)
+				}
+				ipam.PrintFixReport(report)
+			}
+		}
 
 		if all {
 			fmt.Println("Checking all block files...")
-			err := ipam.ValidateAllBlockFiles(cfg)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, "Error:", err)
-				os.Exit(1)
+			if err := validateAllBlockFiles(mgr); err != nil {
+				exitWithError(err)
 			}
 		} else if len(args) > 0 {
 			fileKey := args[0]
 			fmt.Printf("Checking block file '%s'...\n", fileKey)
-			results, err := ipam.ValidateBlockFile(cfg, fileKey)
+			results, err := mgr.Validate(fileKey)
 			if err != nil {
-				fmt.Fprintln(os.Stderr, "Error:", err)
-				os.Exit(1)
+				exitWithError(err)
 			}
 			if err := ipam.PrintValidationResults(results); err != nil {
 				fmt.Fprintln(os.Stderr, "Error printing validation results:", err)
@@ -55,10 +84,9 @@ If a specific file-key is provided, only checks that file. Otherwise, checks all
 		} else {
 			// Default to checking the default block file
 			fmt.Println("Checking default block file...")
-			results, err := ipam.ValidateBlockFile(cfg, "default")
+			results, err := mgr.Validate("default")
 			if err != nil {
-				fmt.Fprintln(os.Stderr, "Error:", err)
-				os.Exit(1)
+				exitWithError(err)
 			}
 			if err := ipam.PrintValidationResults(results); err != nil {
 				fmt.Fprintln(os.Stderr, "Error printing validation results:", err)
@@ -71,9 +99,20 @@ If a specific file-key is provided, only checks that file. Otherwise, checks all
 	},
 }
 
+// validateAllBlockFiles validates and prints every block file and the checks
+// between them. It returns an error if validation found errors.
+func validateAllBlockFiles(mgr *openipam.Manager) error {
+	files, crossResults, err := mgr.ValidateAll()
+	if err != nil {
+		return err
+	}
+	return ipam.PrintAllValidationResults(files, crossResults)
+}
+
 func init() {
 	rootCmd.AddCommand(checkCmd)
 	checkCmd.AddCommand(checkBlocksCmd)
 
 	checkBlocksCmd.Flags().BoolP("all", "a", false, "Check all block files")
+	checkBlocksCmd.Flags().Bool("fix", false, "Apply safe fixes for fixable issues before checking")
 }
@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/lugnut42/openipam/internal/ipam"
+	"github.com/spf13/cobra"
+)
+
+var completionCmd = &cobra.Command{
+	Use:   "completion bash|zsh|fish|powershell",
+	Short: "Generate the shell completion script",
+	Long: `Generate the completion script of ipam for a shell. Besides commands and flags,
+the script completes block file keys for --file, pattern names for --pattern,
+block CIDRs for --block and existing CIDRs for --cidr, read from the
+configuration reported by 'ipam config path'.
+
+To load completions:
+
+Bash:
+  source <(ipam completion bash)
+  # To load completions for each session, execute once:
+  ipam completion bash > /etc/bash_completion.d/ipam
+
+Zsh:
+  # If shell completion is not already enabled, execute once:
+  echo "autoload -U compinit; compinit" >> ~/.zshrc
+  ipam completion zsh > "${fpath[1]}/_ipam"
+
+Fish:
+  ipam completion fish > ~/.config/fish/completions/ipam.fish
+
+PowerShell:
+  ipam completion powershell | Out-String | Invoke-Expression`,
+	ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+	Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root, out := cmd.Root(), cmd.OutOrStdout()
+		switch args[0] {
+		case "bash":
+			return root.GenBashCompletionV2(out, true)
+		case "zsh":
+			return root.GenZshCompletion(out)
+		case "fish":
+			return root.GenFishCompletion(out, true)
+		default:
+			return root.GenPowerShellCompletionWithDesc(out)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(completionCmd)
+}
+
+// isCompletionCommand reports whether cmd generates a completion script or
+// answers a completion request from the shell
+func isCompletionCommand(cmd *cobra.Command) bool {
+	switch cmd.Name() {
+	case "completion", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+		return cmd.Parent() != nil && cmd.Parent().Parent() == nil
+	}
+	return false
+}
+
+// registerFlagCompletion sets the completion function of a flag
+func registerFlagCompletion(cmd *cobra.Command, flag string, fn func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective)) {
+	if err := cmd.RegisterFlagCompletionFunc(flag, fn); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+	}
+}
+
+// completionConfigLoaded loads the configuration for a completion request. The
+// root command does not load it for completion, so that completing commands
+// and flags works without a configuration.
+func completionConfigLoaded() bool {
+	return loadConfig() == nil
+}
+
+// completeFileKeys completes block file keys
+func completeFileKeys(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if !completionConfigLoaded() {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var completions []string
+	for fileKey, path := range cfg.BlockFiles {
+		if strings.HasPrefix(fileKey, toComplete) {
+			completions = append(completions, fileKey+"\t"+path)
+		}
+	}
+	sort.Strings(completions)
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeProviders completes the providers whose reserved addresses are known
+func completeProviders(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if !completionConfigLoaded() {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var completions []string
+	for provider, reserved := range ipam.ReservedAddressesByProvider(cfg) {
+		if strings.HasPrefix(provider, toComplete) {
+			completions = append(completions, fmt.Sprintf("%s\t%d reserved addresses per subnet", provider, reserved))
+		}
+	}
+	sort.Strings(completions)
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeFileKeyArgs completes block file keys for commands taking one file key argument
+func completeFileKeyArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeFileKeys(cmd, args, toComplete)
+}
+
+// completePatterns completes the pattern names of the block file given with --file
+func completePatterns(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if !completionConfigLoaded() {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	fileKey, _ := cmd.Flags().GetString("file")
+	var completions []string
+	for name, pattern := range cfg.Patterns[fileKey] {
+		if strings.HasPrefix(name, toComplete) {
+			completions = append(completions, fmt.Sprintf("%s\t/%d subnets from %s", name, pattern.CIDRSize, pattern.Block))
+		}
+	}
+	sort.Strings(completions)
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeBlocks completes block CIDRs, of the block file given with --file
+// for commands that have the flag and of all block files otherwise
+func completeBlocks(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if !completionConfigLoaded() {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var fileKeys []string
+	if cmd.Flags().Lookup("file") != nil {
+		fileKey, _ := cmd.Flags().GetString("file")
+		fileKeys = append(fileKeys, fileKey)
+	}
+	entries, err := ipam.FindBlocks(cfg, fileKeys...)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var completions []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Block.CIDR, toComplete) {
+			completions = append(completions, entry.Block.CIDR+"\t"+entry.Block.Description)
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeBlockArgs completes block CIDRs for commands taking one block argument
+func completeBlockArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeBlocks(cmd, args, toComplete)
+}
+
+// completeSubnets completes the CIDRs of existing subnets in all block files
+func completeSubnets(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if !completionConfigLoaded() {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	entries, err := ipam.FindSubnets(cfg, "", "")
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var completions []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Subnet.CIDR, toComplete) {
+			completions = append(completions, fmt.Sprintf("%s\t%s (%s)", entry.Subnet.CIDR, entry.Subnet.Name, entry.Subnet.Region))
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeBlocksAndSubnets completes the CIDRs of blocks and subnets in all block files
+func completeBlocksAndSubnets(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	blocks, directive := completeBlocks(cmd, args, toComplete)
+	subnets, _ := completeSubnets(cmd, args, toComplete)
+	return append(blocks, subnets...), directive
+}
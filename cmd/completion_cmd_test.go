@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDynamicCompletion(t *testing.T) {
+	tempDir := t.TempDir()
+	blockPath := filepath.Join(tempDir, "dev.yaml")
+	require.NoError(t, os.WriteFile(blockPath, []byte(`- cidr: 10.0.0.0/16
+  description: Development
+  subnets:
+  - cidr: 10.0.1.0/24
+    name: app
+    region: us-east1
+  - cidr: 10.0.2.0/24
+    name: db
+    region: us-east1
+`), 0644))
+	configPath := filepath.Join(tempDir, "ipam-config.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`block_files:
+  dev: `+blockPath+`
+patterns:
+  dev:
+    web:
+      cidr_size: 24
+      environment: dev
+      region: us-east1
+      block: 10.0.0.0/16
+`), 0644))
+
+	oldCfgFile := cfgFile
+	cfgFile = configPath
+	t.Cleanup(func() { cfgFile = oldCfgFile })
+
+	completions, directive := completeFileKeys(blockListCmd, nil, "")
+	assert.Equal(t, []string{"dev\t" + blockPath}, completions)
+	assert.Equal(t, cobra.ShellCompDirectiveNoFileComp, directive)
+
+	require.NoError(t, subnetCreateFromPatternCmd.Flags().Set("file", "dev"))
+	t.Cleanup(func() { _ = subnetCreateFromPatternCmd.Flags().Set("file", "default") })
+	completions, _ = completePatterns(subnetCreateFromPatternCmd, nil, "w")
+	assert.Equal(t, []string{"web\t/24 subnets from 10.0.0.0/16"}, completions)
+
+	completions, _ = completeBlocks(subnetCreateCmd, nil, "")
+	assert.Equal(t, []string{"10.0.0.0/16\tDevelopment"}, completions)
+
+	completions, _ = completeSubnets(subnetShowCmd, nil, "10.0.2")
+	assert.Equal(t, []string{"10.0.2.0/24\tdb (us-east1)"}, completions)
+
+	completions, _ = completeBlockArgs(blockShowCmd, []string{"10.0.0.0/16"}, "")
+	assert.Empty(t, completions)
+
+	// Without a configuration nothing is suggested
+	cfgFile = filepath.Join(tempDir, "missing.yaml")
+	completions, directive = completeSubnets(subnetShowCmd, nil, "")
+	assert.Empty(t, completions)
+	assert.Equal(t, cobra.ShellCompDirectiveNoFileComp, directive)
+}
+
+func TestCompletionScript(t *testing.T) {
+	var buf bytes.Buffer
+	completionCmd.SetOut(&buf)
+	t.Cleanup(func() { completionCmd.SetOut(nil) })
+
+	require.NoError(t, completionCmd.RunE(completionCmd, []string{"zsh"}))
+	assert.Contains(t, buf.String(), "#compdef ipam")
+	assert.True(t, isCompletionCommand(completionCmd))
+	assert.False(t, isCompletionCommand(subnetShowCmd))
+}
@@ -5,12 +5,15 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
+	"text/tabwriter"
 
 	"github.com/lugnut42/openipam/internal/config"
 	"github.com/lugnut42/openipam/internal/ipam"
 	"github.com/lugnut42/openipam/internal/logger"
 
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
 var configCmd = &cobra.Command{
@@ -35,13 +38,18 @@ func validateBlockName(name string) error {
 var configInitCmd = &cobra.Command{
 	Use:   "init [block-name]",
 	Short: "Initialize configuration",
-	Long:  `Initialize the configuration file with a named block file.`,
-	Args:  cobra.ExactArgs(1), // Require the block name argument
+	Long: `Initialize the configuration file with a named block file. The configuration
+file is created where 'ipam config path' reports, by default in
+$XDG_CONFIG_HOME/openipam (~/.config/openipam), and the block file in the
+blocks directory next to it.`,
+	Args: cobra.ExactArgs(1), // Require the block name argument
 	RunE: func(cmd *cobra.Command, args []string) error {
-		configDir := os.Getenv("IPAM_CONFIG_PATH")
-		if configDir == "" {
-			return fmt.Errorf("IPAM_CONFIG_PATH environment variable is required")
+		loc, err := resolveConfig()
+		if err != nil {
+			return err
 		}
+		configFile := loc.Path
+		configDir := filepath.Dir(configFile)
 
 		blockName := args[0]
 		if err := validateBlockName(blockName); err != nil {
@@ -51,7 +59,7 @@ var configInitCmd = &cobra.Command{
 		logger.Debug("Config init called with config directory=%s, block name=%s", configDir, blockName)
 
 		// Create the configuration directory if it doesn't exist
-		err := os.MkdirAll(configDir, 0750)
+		err = os.MkdirAll(configDir, 0750)
 		if err != nil {
 			return fmt.Errorf("error creating configuration directory: %w", err)
 		}
@@ -63,9 +71,6 @@ var configInitCmd = &cobra.Command{
 			return fmt.Errorf("error creating blocks directory: %w", err)
 		}
 
-		// Construct the config file path
-		configFile := filepath.Join(configDir, "ipam-config.yaml")
-
 		// Check if configuration file already exists
 		if _, err := os.Stat(configFile); err == nil {
 			return fmt.Errorf("configuration file already exists at %s", configFile)
@@ -92,9 +97,6 @@ var configInitCmd = &cobra.Command{
 			return fmt.Errorf("error writing configuration file: %w", err)
 		}
 
-		// Set the config for use by other commands
-		ipam.SetConfig(cfg)
-
 		fmt.Printf("Configuration initialized successfully:\n")
 		fmt.Printf("  Config file: %s\n", configFile)
 		fmt.Printf("  Block file: %s (%s)\n", blockFile, blockName)
@@ -106,7 +108,7 @@ var configInitCmd = &cobra.Command{
 var configAddBlockCmd = &cobra.Command{
 	Use:   "add-block [block-name]",
 	Short: "Add a new block file",
-	Long:  `Add a new named block file to the configuration.`,
+	Long:  `Add a new named block file to the configuration. The block file is created in the blocks directory next to the configuration file.`,
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		blockName := args[0]
@@ -114,56 +116,233 @@ var configAddBlockCmd = &cobra.Command{
 			return err
 		}
 
-		configDir := os.Getenv("IPAM_CONFIG_PATH")
-		if configDir == "" {
-			return fmt.Errorf("IPAM_CONFIG_PATH environment variable is required")
+		mgr, err := newManager()
+		if err != nil {
+			return err
 		}
 
-		// Ensure we're using the full path to the config file
-		configFile := filepath.Join(configDir, "ipam-config.yaml")
-		logger.Debug("Loading config from: %s", configFile)
+		// The block file goes to the blocks directory next to the configuration file
+		logger.Debug("Adding block file %s to config %s", blockName, mgr.Config().ConfigFile)
+		blockFile, err := mgr.AddBlockFile(blockName)
+		if err != nil {
+			return err
+		}
 
-		// Load existing config
-		cfg, err := config.LoadConfig(configFile)
+		fmt.Printf("Added new block file:\n")
+		fmt.Printf("  Name: %s\n", blockName)
+		fmt.Printf("  Path: %s\n", blockFile)
+
+		return nil
+	},
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the loaded configuration",
+	Long:  `Show which configuration file was loaded, how it was located, and its contents.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := yaml.Marshal(cfg)
 		if err != nil {
-			return fmt.Errorf("error loading configuration from %s: %w", configFile, err)
+			return fmt.Errorf("error marshalling config: %w", err)
 		}
 
-		// Check if block name already exists
-		if _, exists := cfg.BlockFiles[blockName]; exists {
-			return fmt.Errorf("block file with name '%s' already exists", blockName)
+		out := cmd.OutOrStdout()
+		fmt.Fprintf(out, "# Config file: %s\n", cfgLocation.Path)
+		fmt.Fprintf(out, "# Located by:  %s\n", cfgLocation.Source)
+		if cfgLocation.Profile != "" {
+			fmt.Fprintf(out, "# Profile:     %s\n", cfgLocation.Profile)
 		}
+		fmt.Fprint(out, string(data))
+		return nil
+	},
+}
 
-		// Create the new block file
-		blockFile := filepath.Join(configDir, "blocks", fmt.Sprintf("%s.yaml", blockName))
-		if err := os.MkdirAll(filepath.Dir(blockFile), 0750); err != nil {
-			return fmt.Errorf("error creating blocks directory: %w", err)
+var configPathCmd = &cobra.Command{
+	Use:   "path",
+	Short: "Print the path of the configuration file",
+	Long: `Print the path of the configuration file ipam uses, resolved in order from the
+--config flag, the profile given with --profile or IPAM_PROFILE, the
+IPAM_CONFIG_PATH environment variable, $XDG_CONFIG_HOME/openipam and
+~/.openipam. The file does not need to exist yet; with --verbose the source
+of the path and whether the file exists are printed too.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		loc, err := resolveConfig()
+		if err != nil {
+			return err
 		}
 
-		if _, err := os.Stat(blockFile); os.IsNotExist(err) {
-			err = os.WriteFile(blockFile, []byte("[]"), 0600)
-			if err != nil {
-				return fmt.Errorf("error creating block file: %w", err)
+		out := cmd.OutOrStdout()
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		if !verbose {
+			fmt.Fprintln(out, loc.Path)
+			return nil
+		}
+
+		exists := "yes"
+		if _, err := os.Stat(loc.Path); err != nil {
+			exists = "no"
+		}
+		fmt.Fprintf(out, "Config file: %s\n", loc.Path)
+		fmt.Fprintf(out, "Located by:  %s\n", loc.Source)
+		if loc.Profile != "" {
+			fmt.Fprintf(out, "Profile:     %s\n", loc.Profile)
+		}
+		fmt.Fprintf(out, "Exists:      %s\n", exists)
+		return nil
+	},
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the block files of the configuration",
+	Long:  `List the block file keys of the configuration with their path and number of blocks, subnets and patterns.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output, _ := cmd.Flags().GetString("output")
+		if output != "table" && output != "json" {
+			return fmt.Errorf("unsupported output format %q (use table or json)", output)
+		}
+
+		mgr, err := newManager()
+		if err != nil {
+			return fmt.Errorf("error: %w", err)
+		}
+
+		infos := mgr.ListBlockFiles()
+		if output == "json" {
+			if infos == nil {
+				infos = []ipam.BlockFileInfo{}
 			}
+			return ipam.PrintJSON(infos)
 		}
+		return ipam.PrintBlockFiles(infos)
+	},
+}
 
-		// Add to config and save
-		cfg.BlockFiles[blockName] = blockFile
-		err = config.WriteConfig(cfg)
+var configRemoveBlockCmd = &cobra.Command{
+	Use:   "remove-block <block-name>",
+	Short: "Remove a block file from the configuration",
+	Long: `Remove a block file key from the configuration. Removing a key that patterns or
+policies are defined for would orphan them, so it is refused unless --force is
+given, which removes them too. The blocks are kept: the block file stays where
+it is, so it can be added back by editing the configuration.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeFileKeyArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		force, _ := cmd.Flags().GetBool("force")
+
+		mgr, err := newManager()
 		if err != nil {
-			return fmt.Errorf("error updating configuration: %w", err)
+			return fmt.Errorf("error: %w", err)
+		}
+		path := cfg.BlockFiles[args[0]]
+		if err := mgr.RemoveBlockFile(args[0], force); err != nil {
+			return fmt.Errorf("error: %w", err)
 		}
 
-		fmt.Printf("Added new block file:\n")
-		fmt.Printf("  Name: %s\n", blockName)
-		fmt.Printf("  Path: %s\n", blockFile)
+		fmt.Printf("Removed block file %s from the configuration\n", args[0])
+		if cfg.Storage.Backend == ipam.BackendSQLite {
+			fmt.Println("  Its blocks are kept in the database")
+		} else {
+			fmt.Printf("  The block file is kept at %s\n", path)
+		}
+		return nil
+	},
+}
+
+var configRenameBlockCmd = &cobra.Command{
+	Use:   "rename-block <old-name> <new-name>",
+	Short: "Rename a block file",
+	Long: `Rename a block file key. Patterns and policies defined for the key move to the
+new key. A block file named after the key, such as blocks/<old-name>.yaml, is
+renamed to blocks/<new-name>.yaml; with the sqlite backend the stored blocks
+move to the new key. Block files in a bucket keep their object key.`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: completeFileKeyArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		oldName, newName := args[0], args[1]
+		if err := validateBlockName(newName); err != nil {
+			return err
+		}
 
+		mgr, err := newManager()
+		if err != nil {
+			return fmt.Errorf("error: %w", err)
+		}
+		if err := mgr.RenameBlockFile(oldName, newName); err != nil {
+			return fmt.Errorf("error: %w", err)
+		}
+
+		fmt.Printf("Renamed block file %s to %s\n", oldName, newName)
+		fmt.Printf("  Path: %s\n", cfg.BlockFiles[newName])
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Change a configuration setting",
+	Args:  cobra.ExactArgs(2),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		var completions []string
+		for _, setting := range config.Settings() {
+			completions = append(completions, setting.Key+"\t"+setting.Description)
+		}
+		return completions, cobra.ShellCompDirectiveNoFileComp
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		mgr, err := newManager()
+		if err != nil {
+			return fmt.Errorf("error: %w", err)
+		}
+		if err := mgr.SetConfig(args[0], args[1]); err != nil {
+			return fmt.Errorf("error: %w", err)
+		}
+
+		fmt.Printf("Set %s to %q\n", args[0], args[1])
 		return nil
 	},
 }
 
+// configSetLong lists the settings config set accepts in its help
+func configSetLong() string {
+	var b strings.Builder
+	b.WriteString("Change a setting of the configuration file. Settings:\n\n")
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	for _, setting := range config.Settings() {
+		fmt.Fprintf(w, "  %s\t%s\n", setting.Key, setting.Description)
+	}
+	w.Flush()
+	b.WriteString(`
+Block files, patterns and the storage backend are changed with their own
+commands: config add-block, config remove-block, config rename-block, pattern
+and migrate.
+
+Example:
+  ipam config set git.auto_commit true
+  ipam config set reserved_addresses.gcp 4`)
+	return b.String()
+}
+
 func init() {
 	rootCmd.AddCommand(configCmd)
 	configCmd.AddCommand(configInitCmd)
 	configCmd.AddCommand(configAddBlockCmd)
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configPathCmd)
+	configCmd.AddCommand(configListCmd)
+	configCmd.AddCommand(configRemoveBlockCmd)
+	configCmd.AddCommand(configRenameBlockCmd)
+	configCmd.AddCommand(configSetCmd)
+
+	configSetCmd.Long = configSetLong()
+	configListCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+	configRemoveBlockCmd.Flags().Bool("force", false, "Also remove the patterns and policies of the block file")
+
+	configPathCmd.Flags().BoolP("verbose", "v", false, "Also print where the path comes from and whether the file exists")
 }
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
 	"testing"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestConfigCommands(t *testing.T) {
@@ -90,3 +92,39 @@ func TestConfig(t *testing.T) {
 	assert.Equal(t, cfg.BlockFiles["default"], loadedCfg.BlockFiles["default"])
 	assert.Equal(t, cfg.Patterns["default"]["dev-gke-uswest"].CIDRSize, loadedCfg.Patterns["default"]["dev-gke-uswest"].CIDRSize)
 }
+
+func TestConfigProfileInitPathShow(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "xdg"))
+	t.Setenv("IPAM_CONFIG_PATH", "")
+	t.Setenv("IPAM_PROFILE", "")
+
+	oldCfgFile, oldProfile, oldCfg := cfgFile, cfgProfile, cfg
+	cfgFile, cfgProfile = "", "lab"
+	t.Cleanup(func() { cfgFile, cfgProfile, cfg = oldCfgFile, oldProfile, oldCfg })
+
+	// config init creates the configuration of the profile
+	require.NoError(t, configInitCmd.RunE(configInitCmd, []string{"default"}))
+	configFile := filepath.Join(home, "xdg", "openipam", "profiles", "lab", "ipam-config.yaml")
+	assert.FileExists(t, configFile)
+	assert.FileExists(t, filepath.Join(filepath.Dir(configFile), "blocks", "default.yaml"))
+
+	var out bytes.Buffer
+	configPathCmd.SetOut(&out)
+	t.Cleanup(func() { configPathCmd.SetOut(nil) })
+	require.NoError(t, configPathCmd.RunE(configPathCmd, nil))
+	assert.Equal(t, configFile+"\n", out.String())
+
+	require.NoError(t, loadConfig())
+	out.Reset()
+	configShowCmd.SetOut(&out)
+	t.Cleanup(func() { configShowCmd.SetOut(nil) })
+	require.NoError(t, configShowCmd.RunE(configShowCmd, nil))
+	assert.Contains(t, out.String(), "# Config file: "+configFile+"\n# Located by:  profile\n# Profile:     lab\n")
+	assert.Contains(t, out.String(), "default: "+filepath.Join(filepath.Dir(configFile), "blocks", "default.yaml"))
+
+	// A missing configuration file is reported with its location
+	cfgProfile = "other"
+	assert.ErrorContains(t, loadConfig(), "configuration file not found at "+filepath.Join(home, "xdg", "openipam", "profiles", "other", "ipam-config.yaml")+" (profile other)")
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/lugnut42/openipam/internal/ipam"
+	"github.com/spf13/cobra"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show the change history of a block or subnet",
+	Long: `Show the commits that changed a block or subnet, newest first, from the git
+repository the block files live in. Commits made by ipam with git auto-commit
+enabled are found by their message; other commits are found by the CIDR being
+added to or removed from a block file. Only the local repository is read.
+
+Enable auto-commit in the configuration file to have every change made by ipam
+committed:
+
+  git:
+    auto_commit: true
+
+Example:
+  ipam history --cidr 10.0.0.0/16
+  ipam history --cidr 10.0.1.0/24`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cidr, _ := cmd.Flags().GetString("cidr")
+
+		mgr, err := newManager()
+		if err != nil {
+			exitWithError(err)
+		}
+
+		entries, err := mgr.History(cidr)
+		if err != nil {
+			exitWithError(err)
+		}
+
+		if err := ipam.PrintHistory(entries); err != nil {
+			exitWithError(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+
+	historyCmd.Flags().String("cidr", "", "CIDR of the block or subnet")
+	if err := historyCmd.MarkFlagRequired("cidr"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error marking flag required: %v\n", err)
+	}
+
+	registerFlagCompletion(historyCmd, "cidr", completeBlocksAndSubnets)
+}
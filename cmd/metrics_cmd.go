@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// metricsReadHeaderTimeout bounds how long a scrape may take to send its
+// request headers, so that idle connections cannot hold the server open
+const metricsReadHeaderTimeout = 10 * time.Second
+
+var metricsCmd = &cobra.Command{
+	Use:   "metrics",
+	Short: "Export block utilization metrics for Prometheus",
+	Long: `Export block utilization and validation metrics in the Prometheus text format.
+
+For every block of every block file, labeled by file key and block CIDR:
+- total, allocated and available IPs
+- utilization ratio
+- prefix length of the largest free range
+- number of subnets by region
+
+Validation error and warning counts are exported per block file.
+
+By default the metrics are written to standard output. With --out they are
+written atomically to a file, for the node_exporter textfile collector. With
+--listen, the metrics are served on /metrics and recomputed on every scrape.
+
+Example:
+  ipam metrics
+  ipam metrics --out /var/lib/node_exporter/textfile/openipam.prom
+  ipam metrics --listen :9184`,
+	Run: func(cmd *cobra.Command, args []string) {
+		out, _ := cmd.Flags().GetString("out")
+		listen, _ := cmd.Flags().GetString("listen")
+
+		mgr, err := newManager()
+		if err != nil {
+			exitWithError(err)
+		}
+
+		if listen != "" {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", mgr.MetricsHandler())
+			server := &http.Server{
+				Addr:              listen,
+				Handler:           mux,
+				ReadHeaderTimeout: metricsReadHeaderTimeout,
+			}
+			fmt.Printf("Serving metrics on %s/metrics\n", listen)
+			if err := server.ListenAndServe(); err != nil {
+				exitWithError(fmt.Errorf("error serving metrics: %w", err))
+			}
+			return
+		}
+
+		if out != "" {
+			if err := mgr.WriteMetricsFile(out); err != nil {
+				exitWithError(err)
+			}
+			return
+		}
+
+		if err := mgr.WriteMetrics(os.Stdout); err != nil {
+			exitWithError(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(metricsCmd)
+
+	metricsCmd.Flags().String("out", "", "Write the metrics to this file instead of standard output")
+	metricsCmd.Flags().String("listen", "", "Serve the metrics on /metrics at this address")
+}
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/lugnut42/openipam/internal/ipam"
+	openipam "github.com/lugnut42/openipam/pkg/ipam"
+	"github.com/spf13/cobra"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Migrate block files and configuration",
+	Long:  `Migrate existing block files and configuration to the current storage conventions.`,
+}
+
+var migrateNormalizeCmd = &cobra.Command{
+	Use:   "normalize-cidrs [file-key]",
+	Short: "Rewrite stored CIDRs in canonical form",
+	Long: `Rewrite every block and subnet CIDR, and every pattern block reference, in
+canonical form: host bits are cleared and IPv6 addresses are compressed.
+For example 10.0.1.7/24 is stored as 10.0.1.0/24.
+
+If a file-key is provided, only that block file is migrated. Otherwise all
+configured block files are migrated.
+
+Example:
+  ipam migrate normalize-cidrs
+  ipam migrate normalize-cidrs prod`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: completeFileKeyArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		mgr, err := newManager()
+		if err != nil {
+			exitWithError(err)
+		}
+
+		fileKeys := mgr.FileKeys()
+		if len(args) > 0 {
+			fileKeys = []string{args[0]}
+		}
+
+		for _, fileKey := range fileKeys {
+			report, err := mgr.NormalizeBlockFile(fileKey)
+			if err != nil {
+				exitWithError(err)
+			}
+			ipam.PrintFixReport(report)
+		}
+	},
+}
+
+var migrateSQLiteCmd = &cobra.Command{
+	Use:   "sqlite [file-key...]",
+	Short: "Import YAML block files into a SQLite database",
+	Long: `Import the YAML block files into an embedded SQLite database and switch the
+configuration to the sqlite storage backend. Blocks already stored in the
+database for an imported file key are replaced. The YAML files are left in
+place, so switching storage.backend back to yaml restores the old state.
+
+If file-keys are provided, only those block files are imported. Otherwise all
+configured block files are imported.
+
+Example:
+  ipam migrate sqlite
+  ipam migrate sqlite --db /var/lib/ipam/ipam.db`,
+	ValidArgsFunction: completeFileKeys,
+	Run: func(cmd *cobra.Command, args []string) {
+		mgr, err := newManager()
+		if err != nil {
+			exitWithError(err)
+		}
+
+		dbPath, _ := cmd.Flags().GetString("db")
+		if dbPath == "" {
+			dbPath = mgr.Config().Storage.Path
+		}
+		if dbPath == "" {
+			dbPath = "ipam.db"
+		}
+
+		report, err := mgr.MigrateToSQLite(dbPath, args...)
+		if report != nil {
+			ipam.PrintImportReport(report)
+		}
+		if err != nil {
+			exitWithError(err)
+		}
+		fmt.Printf("Storage backend set to %s\n", ipam.BackendSQLite)
+	},
+}
+
+var migrateS3Cmd = &cobra.Command{
+	Use:   "s3",
+	Short: "Move block files and configuration to an S3-compatible bucket",
+	Long: `Upload every block file to an S3-compatible bucket, store the configuration
+in the bucket as well, and switch to the s3 storage backend. Block files are
+stored as blocks/<file-key>.yaml below the prefix; the local configuration file
+afterwards only holds the storage settings. A configuration that another
+installation already keeps in the bucket is never overwritten. Credentials are read from AWS_ACCESS_KEY_ID,
+AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+
+Example:
+  ipam migrate s3 --bucket network-ipam --region eu-west-1
+  ipam migrate s3 --bucket ipam --endpoint http://localhost:9000 --path-style`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		settings := openipam.S3Settings{}
+		settings.Bucket, _ = cmd.Flags().GetString("bucket")
+		settings.Prefix, _ = cmd.Flags().GetString("prefix")
+		settings.Endpoint, _ = cmd.Flags().GetString("endpoint")
+		settings.Region, _ = cmd.Flags().GetString("region")
+		settings.PathStyle, _ = cmd.Flags().GetBool("path-style")
+
+		mgr, err := newManager()
+		if err != nil {
+			exitWithError(err)
+		}
+
+		report, err := mgr.MigrateToS3(settings)
+		if err != nil {
+			exitWithError(err)
+		}
+		ipam.PrintImportReport(report)
+		fmt.Printf("Storage backend set to %s\n", ipam.BackendS3)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+	migrateCmd.AddCommand(migrateNormalizeCmd)
+	migrateCmd.AddCommand(migrateSQLiteCmd)
+	migrateCmd.AddCommand(migrateS3Cmd)
+
+	migrateS3Cmd.Flags().String("bucket", "", "Bucket to store the block files and configuration in")
+	migrateS3Cmd.Flags().String("prefix", "", "Prefix of the object keys, e.g. ipam/")
+	migrateS3Cmd.Flags().String("endpoint", "", "URL of an S3-compatible server (defaults to AWS S3)")
+	migrateS3Cmd.Flags().String("region", "", "Region of the bucket (defaults to us-east-1)")
+	migrateS3Cmd.Flags().Bool("path-style", false, "Address the bucket in the URL path, as MinIO requires")
+	_ = migrateS3Cmd.MarkFlagRequired("bucket")
+
+	migrateSQLiteCmd.Flags().String("db", "", "SQLite database file (defaults to storage.path, or ipam.db next to the configuration)")
+}
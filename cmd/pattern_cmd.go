@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/lugnut42/openipam/internal/ipam"
+	openipam "github.com/lugnut42/openipam/pkg/ipam"
 
 	"github.com/spf13/cobra"
 )
@@ -27,16 +28,139 @@ var patternCreateCmd = &cobra.Command{
 		block, _ := cmd.Flags().GetString("block")
 		fileKey, _ := cmd.Flags().GetString("file")
 
-		err := ipam.CreatePattern(cfg, name, cidrSize, environment, region, block, fileKey)
+		mgr, err := newManager()
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error:", err)
-			os.Exit(1)
+			exitWithError(err)
+		}
+
+		pattern := openipam.Pattern{CIDRSize: cidrSize, Environment: environment, Region: region, Block: block}
+		if err := applyPatternSettings(cmd, &pattern); err != nil {
+			exitWithError(err)
+		}
+		if err := mgr.CreatePattern(name, pattern, fileKey); err != nil {
+			exitWithError(err)
 		}
 
 		fmt.Println("Pattern created successfully!")
 	},
 }
 
+var patternUpdateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Update a pattern",
+	Long: `Update the settings of a subnet allocation pattern. Only the given flags are
+changed; --tag adds or replaces tags and --remove-tag removes them. Subnets
+already allocated from the pattern keep their CIDR, name and tags.`,
+	Example: `  ipam pattern update --name dev-gke-uswest --cidr-size 25
+  ipam pattern update --name dev-gke-uswest --strategy best-fit --max-subnets 8
+  ipam pattern update --name dev-gke-uswest --tag team=platform --remove-tag cost-center`,
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		fileKey, _ := cmd.Flags().GetString("file")
+
+		mgr, err := newManager()
+		if err != nil {
+			exitWithError(err)
+		}
+
+		current, err := mgr.GetPattern(name, fileKey)
+		if err != nil {
+			exitWithError(err)
+		}
+
+		changed := false
+		for _, flag := range []string{"cidr-size", "environment", "region", "block", "description", "tag", "remove-tag", "name-template", "strategy", "preferred-range", "max-subnets"} {
+			changed = changed || cmd.Flags().Changed(flag)
+		}
+		if !changed {
+			exitWithError(fmt.Errorf("nothing to update, give at least one setting to change"))
+		}
+
+		pattern := *current
+		pattern.Tags = make(map[string]string, len(current.Tags))
+		for key, value := range current.Tags {
+			pattern.Tags[key] = value
+		}
+		if cmd.Flags().Changed("cidr-size") {
+			pattern.CIDRSize, _ = cmd.Flags().GetInt("cidr-size")
+		}
+		if cmd.Flags().Changed("environment") {
+			pattern.Environment, _ = cmd.Flags().GetString("environment")
+		}
+		if cmd.Flags().Changed("region") {
+			pattern.Region, _ = cmd.Flags().GetString("region")
+		}
+		if cmd.Flags().Changed("block") {
+			pattern.Block, _ = cmd.Flags().GetString("block")
+		}
+		if err := applyPatternSettings(cmd, &pattern); err != nil {
+			exitWithError(err)
+		}
+		removeTags, _ := cmd.Flags().GetStringSlice("remove-tag")
+		for _, key := range removeTags {
+			delete(pattern.Tags, key)
+		}
+		if len(pattern.Tags) == 0 {
+			pattern.Tags = nil
+		}
+
+		if err := mgr.UpdatePattern(name, pattern, fileKey); err != nil {
+			exitWithError(err)
+		}
+
+		fmt.Println("Pattern updated successfully!")
+		ipam.PrintPattern(name, pattern)
+	},
+}
+
+// addPatternSettingFlags adds the flags of the optional pattern settings
+func addPatternSettingFlags(cmd *cobra.Command) {
+	cmd.Flags().String("description", "", "What the subnets of the pattern are used for")
+	cmd.Flags().StringToString("tag", nil, "Tag to set on allocated subnets as key=value (repeatable)")
+	cmd.Flags().String("name-template", "", "Name of allocated subnets, with {pattern}, {env}, {region}, {ip} and {index} (default \"{pattern}-{ip}\")")
+	cmd.Flags().String("strategy", "", "Allocation strategy: first-fit, best-fit or last-fit (default first-fit)")
+	cmd.Flags().String("preferred-range", "", "CIDR within the block to allocate from first")
+	cmd.Flags().Int("max-subnets", 0, "Maximum number of subnets allocated from the pattern, 0 for no limit")
+	registerFlagCompletion(cmd, "strategy", cobra.FixedCompletions(
+		[]string{ipam.StrategyFirstFit, ipam.StrategyBestFit, ipam.StrategyLastFit}, cobra.ShellCompDirectiveNoFileComp))
+}
+
+// applyPatternSettings sets the optional pattern settings given on the command line
+func applyPatternSettings(cmd *cobra.Command, pattern *openipam.Pattern) error {
+	flags := cmd.Flags()
+	if flags.Changed("description") {
+		pattern.Description, _ = flags.GetString("description")
+	}
+	if flags.Changed("tag") {
+		tags, err := flags.GetStringToString("tag")
+		if err != nil {
+			return err
+		}
+		if pattern.Tags == nil {
+			pattern.Tags = make(map[string]string, len(tags))
+		}
+		for key, value := range tags {
+			if key == ipam.TagPattern || key == ipam.TagEnvironment {
+				return fmt.Errorf("tag %s is set from the pattern and cannot be given", key)
+			}
+			pattern.Tags[key] = value
+		}
+	}
+	if flags.Changed("name-template") {
+		pattern.NameTemplate, _ = flags.GetString("name-template")
+	}
+	if flags.Changed("strategy") {
+		pattern.Strategy, _ = flags.GetString("strategy")
+	}
+	if flags.Changed("preferred-range") {
+		pattern.PreferredRange, _ = flags.GetString("preferred-range")
+	}
+	if flags.Changed("max-subnets") {
+		pattern.MaxSubnets, _ = flags.GetInt("max-subnets")
+	}
+	return nil
+}
+
 var patternListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List available patterns",
@@ -44,11 +168,18 @@ var patternListCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		fileKey, _ := cmd.Flags().GetString("file")
 
-		err := ipam.ListPatterns(cfg, fileKey)
+		mgr, err := newManager()
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error:", err)
-			os.Exit(1)
+			exitWithError(err)
 		}
+
+		patterns := mgr.ListPatterns(fileKey)
+		if len(patterns) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: no patterns found for file key %s\n", fileKey)
+			os.Exit(ExitNotFound)
+		}
+
+		ipam.PrintPatterns(patterns)
 	},
 }
 
@@ -60,11 +191,17 @@ var patternShowCmd = &cobra.Command{
 		name, _ := cmd.Flags().GetString("name")
 		fileKey, _ := cmd.Flags().GetString("file")
 
-		err := ipam.ShowPattern(cfg, name, fileKey)
+		mgr, err := newManager()
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error:", err)
-			os.Exit(1)
+			exitWithError(err)
 		}
+
+		pattern, err := mgr.GetPattern(name, fileKey)
+		if err != nil {
+			exitWithError(err)
+		}
+
+		ipam.PrintPattern(name, *pattern)
 	},
 }
 
@@ -76,10 +213,13 @@ var patternDeleteCmd = &cobra.Command{
 		name, _ := cmd.Flags().GetString("name")
 		fileKey, _ := cmd.Flags().GetString("file")
 
-		err := ipam.DeletePattern(cfg, name, fileKey)
+		mgr, err := newManager()
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "Error:", err)
-			os.Exit(1)
+			exitWithError(err)
+		}
+
+		if err := mgr.DeletePattern(name, fileKey); err != nil {
+			exitWithError(err)
 		}
 
 		fmt.Println("Pattern deleted successfully!")
@@ -92,6 +232,7 @@ func init() {
 	patternCmd.AddCommand(patternListCmd)
 	patternCmd.AddCommand(patternShowCmd)
 	patternCmd.AddCommand(patternDeleteCmd)
+	patternCmd.AddCommand(patternUpdateCmd)
 
 	patternCreateCmd.Flags().StringP("name", "n", "", "Pattern name (required)")
 	if err := patternCreateCmd.MarkFlagRequired("name"); err != nil {
@@ -119,6 +260,20 @@ func init() {
 		os.Exit(1)
 	}
 	patternCreateCmd.Flags().StringP("file", "f", "default", "Key for the block file in the configuration (default is 'default')")
+	addPatternSettingFlags(patternCreateCmd)
+
+	patternUpdateCmd.Flags().StringP("name", "n", "", "Pattern name (required)")
+	if err := patternUpdateCmd.MarkFlagRequired("name"); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	patternUpdateCmd.Flags().IntP("cidr-size", "c", 0, "CIDR size")
+	patternUpdateCmd.Flags().StringP("environment", "e", "", "Environment")
+	patternUpdateCmd.Flags().StringP("region", "r", "", "Region")
+	patternUpdateCmd.Flags().StringP("block", "b", "", "Block CIDR")
+	patternUpdateCmd.Flags().StringP("file", "f", "default", "Key for the block file in the configuration (default is 'default')")
+	patternUpdateCmd.Flags().StringSlice("remove-tag", nil, "Tag key to remove (repeatable)")
+	addPatternSettingFlags(patternUpdateCmd)
 
 	patternListCmd.Flags().StringP("file", "f", "default", "Key for the block file in the configuration (default is 'default')")
 
@@ -136,4 +291,13 @@ func init() {
 		os.Exit(1)
 	}
 	patternDeleteCmd.Flags().StringP("file", "f", "default", "Key for the block file in the configuration (default is 'default')")
+
+	for _, cmd := range []*cobra.Command{patternCreateCmd, patternListCmd, patternShowCmd, patternDeleteCmd, patternUpdateCmd} {
+		registerFlagCompletion(cmd, "file", completeFileKeys)
+	}
+	registerFlagCompletion(patternCreateCmd, "block", completeBlocks)
+	registerFlagCompletion(patternUpdateCmd, "block", completeBlocks)
+	registerFlagCompletion(patternShowCmd, "name", completePatterns)
+	registerFlagCompletion(patternDeleteCmd, "name", completePatterns)
+	registerFlagCompletion(patternUpdateCmd, "name", completePatterns)
 }
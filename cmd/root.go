@@ -1,20 +1,25 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
 
 	"github.com/lugnut42/openipam/internal/config"
 	"github.com/lugnut42/openipam/internal/ipam"
 	"github.com/lugnut42/openipam/internal/logger"
-
+	openipam "github.com/lugnut42/openipam/pkg/ipam"
 	"github.com/spf13/cobra"
 )
 
 var cfgFile string
+var cfgProfile string
 var cfg *config.Config
+
+// cfgLocation is where the configuration file was located, set by loadConfig
+// and resolveConfig
+var cfgLocation config.Location
 var debugMode bool
 
 var rootCmd = &cobra.Command{
@@ -22,14 +27,14 @@ var rootCmd = &cobra.Command{
 	Short: "IP Address Management tool",
 	Long: `IP Address Management tool for managing IP blocks and subnets.
 
-To get started, you need to initialize the configuration file using one of the following methods:
-
-1. Using the IPAM_CONFIG_PATH environment variable:
-  export IPAM_CONFIG_PATH=/path/to/ipam-config.yaml
-  ipam config init
+To get started, initialize the configuration file:
+  ipam config init default
 
-2. Using the --config flag:
-  ipam config init --config /path/to/ipam-config.yaml
+The configuration file is located with, in order: the --config flag, the
+profile given with --profile or IPAM_PROFILE, the IPAM_CONFIG_PATH
+environment variable, $XDG_CONFIG_HOME/openipam/ipam-config.yaml
+(~/.config/openipam by default) and ~/.openipam/ipam-config.yaml.
+Run 'ipam config path' to see which file is used.
 
 You can then use the following commands to manage IP blocks and subnets:
   ipam block create --cidr <CIDR> --name <n>
@@ -51,48 +56,104 @@ You can then use the following commands to manage IP blocks and subnets:
 			return nil
 		}
 
-		// Skip configuration check for "config add-block" command
-		if cmd.Name() == "add-block" && cmd.Parent() != nil && cmd.Parent().Name() == "config" {
-			logger.Debug("Skipping config check for config add-block command")
+		// Skip configuration check for "config path" command, which only
+		// resolves the location
+		if cmd.Name() == "path" && cmd.Parent() != nil && cmd.Parent().Name() == "config" {
+			logger.Debug("Skipping config check for config path command")
 			return nil
 		}
 
-		// Check for --config flag
-		if cfgFile == "" {
-			// Check for environment variable
-			envConfigPath := os.Getenv("IPAM_CONFIG_PATH")
-			logger.Debug("Environment IPAM_CONFIG_PATH: %s", envConfigPath)
-			if envConfigPath == "" {
-				return fmt.Errorf("no configuration file specified. Please set the IPAM_CONFIG_PATH environment variable or use the --config flag")
-			}
-			// Construct config file path from environment variable
-			cfgFile = filepath.Join(envConfigPath, "ipam-config.yaml")
+		// Skip configuration check for shell completion, which loads the
+		// configuration itself when it is available
+		if isCompletionCommand(cmd) {
+			logger.Debug("Skipping config check for completion command")
+			return nil
 		}
 
-		logger.Debug("Using config file: %s", cfgFile)
+		return loadConfig()
+	},
+}
 
-		// Check if the configuration file exists
-		if _, err := os.Stat(cfgFile); os.IsNotExist(err) {
-			log.Printf("ERROR: Config file not found at %s", cfgFile)
-			return fmt.Errorf("configuration file not found at %s", cfgFile)
-		}
+// resolveConfig locates the configuration file from --config, --profile,
+// the environment and the configuration directories
+func resolveConfig() (config.Location, error) {
+	loc, err := config.Locate(cfgFile, cfgProfile)
+	if err != nil {
+		return config.Location{}, err
+	}
+	cfgLocation = loc
+	logger.Debug("Using config file: %s", loc)
+	return loc, nil
+}
 
-		// Load the configuration
-		logger.Debug("Loading configuration from %s", cfgFile)
-		var err error
-		cfg, err = config.LoadConfig(cfgFile)
-		if err != nil {
-			log.Printf("ERROR: Failed to load config: %v", err)
-			return fmt.Errorf("error loading config file: %v", err)
-		}
-		logger.Debug("Loaded config: %+v", cfg)
+// loadConfig loads the configuration file located by resolveConfig
+func loadConfig() error {
+	loc, err := resolveConfig()
+	if err != nil {
+		return err
+	}
 
-		// Set the configuration in the ipam package
-		logger.Debug("Setting config in ipam package")
-		ipam.SetConfig(cfg)
+	// Check if the configuration file exists
+	if _, err := os.Stat(loc.Path); os.IsNotExist(err) {
+		log.Printf("ERROR: Config file not found at %s", loc)
+		return fmt.Errorf("configuration file not found at %s; run 'ipam config init' to create it", loc)
+	}
 
-		return nil
-	},
+	// Load the configuration
+	logger.Debug("Loading configuration from %s", loc.Path)
+	cfg, err = config.LoadConfig(loc.Path)
+	if err != nil {
+		log.Printf("ERROR: Failed to load config: %v", err)
+		return fmt.Errorf("error loading config file: %v", err)
+	}
+	logger.Debug("Loaded config: %+v", cfg)
+
+	return nil
+}
+
+// newManager returns a library Manager for the configuration loaded by the root command
+func newManager() (*openipam.Manager, error) {
+	return openipam.NewManager(openipam.NewConfigStore(cfg))
+}
+
+// Exit codes returned by the ipam binary, so that scripts can tell failure
+// classes apart without parsing error text
+const (
+	ExitOK        = 0
+	ExitError     = 1 // any other failure, including validation errors
+	ExitNotFound  = 3 // a block file, block, subnet or pattern does not exist
+	ExitOverlap   = 4 // a block or subnet overlaps an existing one
+	ExitExhausted = 5 // a block has no free range for the requested allocation
+	ExitThreshold = 6 // a block exceeds the utilization threshold of block util --threshold
+)
+
+// ExitCode maps an error returned by a command to the process exit code
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, ipam.ErrNotFound):
+		return ExitNotFound
+	case errors.Is(err, ipam.ErrOverlap):
+		return ExitOverlap
+	case errors.Is(err, ipam.ErrExhausted):
+		return ExitExhausted
+	default:
+		return ExitError
+	}
+}
+
+// printWarnings prints warnings returned by an operation to stderr
+func printWarnings(warnings []string) {
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, "Warning:", warning)
+	}
+}
+
+// exitWithError prints err and exits with the exit code for its failure class
+func exitWithError(err error) {
+	fmt.Fprintln(os.Stderr, "Error:", err)
+	os.Exit(ExitCode(err))
 }
 
 func Execute() error {
@@ -108,21 +169,27 @@ func Execute() error {
 func init() {
 	logger.Debug("Initializing root command")
 	cfg = &config.Config{}
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "Path to configuration file")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "Path to configuration file, or a directory holding ipam-config.yaml")
+	rootCmd.PersistentFlags().StringVar(&cfgProfile, "profile", "", "Named configuration profile to use (default $IPAM_PROFILE)")
 	rootCmd.PersistentFlags().BoolVar(&debugMode, "debug", false, "Enable debug logging")
 
 	// Add a direct command to check block file integrity
 	validateFilesCmd := &cobra.Command{
-		Use:   "check-files [file-key]",
-		Short: "Check configuration files for integrity",
-		Long:  `Check block files and configuration for integrity and consistency.`,
+		Use:               "check-files [file-key]",
+		Short:             "Check configuration files for integrity",
+		Long:              `Check block files and configuration for integrity and consistency.`,
+		ValidArgsFunction: completeFileKeyArgs,
 		Run: func(cmd *cobra.Command, args []string) {
+			mgr, err := newManager()
+			if err != nil {
+				exitWithError(err)
+			}
+
 			if len(args) > 0 {
 				fileKey := args[0]
-				results, err := ipam.ValidateBlockFile(cfg, fileKey)
+				results, err := mgr.Validate(fileKey)
 				if err != nil {
-					fmt.Fprintln(os.Stderr, "Error:", err)
-					os.Exit(1)
+					exitWithError(err)
 				}
 
 				fmt.Printf("=== Block File: %s ===\n", fileKey)
@@ -135,8 +202,7 @@ func init() {
 					os.Exit(1)
 				}
 			} else {
-				err := ipam.ValidateAllBlockFiles(cfg)
-				if err != nil {
+				if err := validateAllBlockFiles(mgr); err != nil {
 					os.Exit(1)
 				}
 			}
@@ -144,6 +210,7 @@ func init() {
 	}
 
 	validateFilesCmd.Flags().StringP("file", "f", "default", "Key for the block file in the configuration (default is 'default')")
+	registerFlagCompletion(validateFilesCmd, "file", completeFileKeys)
 	rootCmd.AddCommand(validateFilesCmd)
 	logger.Debug("Root command initialized with empty config: %+v", cfg)
 }
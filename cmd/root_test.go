@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"os"
@@ -9,6 +11,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/lugnut42/openipam/internal/ipam"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -292,3 +295,24 @@ func TestRootCmdInitialization(t *testing.T) {
 	// This test just verifies the initialization runs
 	assert.NotNil(t, rootCmd)
 }
+
+func TestExitCode(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{name: "No error", err: nil, expected: ExitOK},
+		{name: "Generic error", err: errors.New("boom"), expected: ExitError},
+		{name: "Not found", err: &ipam.NotFoundError{Kind: "block", Name: "10.0.0.0/16"}, expected: ExitNotFound},
+		{name: "Overlap", err: &ipam.OverlapError{Kind: "subnet", CIDR: "10.0.1.0/24", Existing: "10.0.0.0/23"}, expected: ExitOverlap},
+		{name: "Exhausted", err: &ipam.ExhaustedError{BlockCIDR: "10.0.0.0/24", RequestedPrefix: 24}, expected: ExitExhausted},
+		{name: "Wrapped", err: fmt.Errorf("error: %w", &ipam.ExhaustedError{BlockCIDR: "10.0.0.0/24"}), expected: ExitExhausted},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, ExitCode(tc.err))
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lugnut42/openipam/internal/ipam"
+	"github.com/spf13/cobra"
+)
+
+var searchCmd = &cobra.Command{
+	Use:   "search [query]",
+	Short: "Search blocks, subnets and patterns",
+	Long: `Search the blocks, subnets and patterns of every block file. The query is a
+list of field:value terms that must all match; prefix a term with - to exclude
+matches, after -- so that it is not read as a flag. Quote values containing
+spaces.
+
+Fields:
+  type:block|subnet|pattern        kind of entity
+  name:GLOB or name:/REGEX/         subnet or pattern name, or block description
+  region:GLOB                       region of a subnet or pattern
+  env:GLOB                          environment of a pattern, or environment
+                                    tag of a subnet
+  tag:KEY or tag:KEY=GLOB           subnet tag
+  file:GLOB                         block file key
+  contains:IP|CIDR                  CIDR contains the address or CIDR
+  within:CIDR                       CIDR lies within the CIDR
+  prefix:N, N-M, <N, <=N, >N, >=N   prefix length (pattern subnet size for patterns)
+  status:STATUS                     empty, partial or full blocks, allocated or
+                                    invalid subnets, active or orphaned patterns
+
+A term without a field matches the name. An empty query lists everything.
+
+Example:
+  ipam search type:subnet region:us-west1 tag:team=platform
+  ipam search 'name:/^gke-/' prefix:20-24
+  ipam search contains:10.20.3.17
+  ipam search -- type:subnet -tag:team
+  ipam search status:orphaned -o json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		if output != "table" && output != "json" {
+			fmt.Fprintf(os.Stderr, "Error: unsupported output format %q (use table or json)\n", output)
+			os.Exit(ExitError)
+		}
+
+		mgr, err := newManager()
+		if err != nil {
+			exitWithError(err)
+		}
+
+		results, err := mgr.Search(strings.Join(args, " "))
+		if err != nil {
+			exitWithError(err)
+		}
+
+		if output == "json" {
+			if results == nil {
+				results = []ipam.SearchResult{}
+			}
+			err = ipam.PrintJSON(results)
+		} else {
+			err = ipam.PrintSearchResults(results)
+		}
+		if err != nil {
+			exitWithError(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(searchCmd)
+
+	searchCmd.Flags().StringP("output", "o", "table", "Output format: table or json")
+}
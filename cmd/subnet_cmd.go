@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/lugnut42/openipam/internal/ipam"
+	openipam "github.com/lugnut42/openipam/pkg/ipam"
 
 	"github.com/spf13/cobra"
 )
@@ -25,11 +26,17 @@ var subnetCreateCmd = &cobra.Command{
 		name, _ := cmd.Flags().GetString("name")
 		region, _ := cmd.Flags().GetString("region")
 
-		err := ipam.CreateSubnet(cfg, block, cidr, name, region)
+		mgr, err := newManager()
 		if err != nil {
 			return fmt.Errorf("error: %w", err)
 		}
 
+		_, warnings, err := mgr.CreateSubnet(block, cidr, name, region)
+		if err != nil {
+			return fmt.Errorf("error: %w", err)
+		}
+		printWarnings(warnings)
+
 		fmt.Println("Subnet created successfully!")
 		return nil
 	},
@@ -43,12 +50,18 @@ var subnetCreateFromPatternCmd = &cobra.Command{
 		patternName, _ := cmd.Flags().GetString("pattern")
 		fileKey, _ := cmd.Flags().GetString("file")
 
-		err := ipam.CreateSubnetFromPattern(cfg, patternName, fileKey)
+		mgr, err := newManager()
 		if err != nil {
 			return fmt.Errorf("error: %w", err)
 		}
 
-		fmt.Println("Subnet created successfully!")
+		subnet, warnings, err := mgr.AllocateFromPattern(patternName, fileKey)
+		if err != nil {
+			return fmt.Errorf("error: %w", err)
+		}
+		printWarnings(warnings)
+
+		fmt.Printf("Subnet %s created successfully!\n", subnet.CIDR)
 		return nil
 	},
 }
@@ -61,16 +74,48 @@ var subnetDeleteCmd = &cobra.Command{
 		cidr, _ := cmd.Flags().GetString("cidr")
 		force, _ := cmd.Flags().GetBool("force")
 
-		err := ipam.DeleteSubnet(cfg, cidr, force)
+		if !force {
+			return fmt.Errorf("error: deletion requires --force flag for confirmation")
+		}
+
+		mgr, err := newManager()
 		if err != nil {
 			return fmt.Errorf("error: %w", err)
 		}
 
+		if err := mgr.DeleteSubnet(cidr); err != nil {
+			return fmt.Errorf("error: %w", err)
+		}
+
 		fmt.Println("Subnet deleted successfully!")
 		return nil
 	},
 }
 
+var subnetRenameCmd = &cobra.Command{
+	Use:   "rename",
+	Short: "Rename a subnet",
+	Long:  `Change the name of a subnet. The new name is checked against the policies of its block file.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cidr, _ := cmd.Flags().GetString("cidr")
+		name, _ := cmd.Flags().GetString("name")
+
+		mgr, err := newManager()
+		if err != nil {
+			return fmt.Errorf("error: %w", err)
+		}
+
+		warnings, err := mgr.RenameSubnet(cidr, name)
+		if err != nil {
+			return fmt.Errorf("error: %w", err)
+		}
+		printWarnings(warnings)
+
+		fmt.Println("Subnet renamed successfully!")
+		return nil
+	},
+}
+
 var subnetListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List subnets",
@@ -79,11 +124,16 @@ var subnetListCmd = &cobra.Command{
 		block, _ := cmd.Flags().GetString("block")
 		region, _ := cmd.Flags().GetString("region")
 
-		err := ipam.ListSubnets(cfg, block, region)
+		mgr, err := newManager()
 		if err != nil {
 			return fmt.Errorf("error: %w", err)
 		}
-		return nil
+
+		entries, err := mgr.ListSubnets(openipam.SubnetFilter{BlockCIDR: block, Region: region})
+		if err != nil {
+			return fmt.Errorf("error: %w", err)
+		}
+		return ipam.PrintSubnets(entries)
 	},
 }
 
@@ -94,11 +144,16 @@ var subnetShowCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cidr, _ := cmd.Flags().GetString("cidr")
 
-		err := ipam.ShowSubnet(cfg, cidr)
+		mgr, err := newManager()
 		if err != nil {
 			return fmt.Errorf("error: %w", err)
 		}
-		return nil
+
+		entry, err := mgr.GetSubnet(cidr)
+		if err != nil {
+			return fmt.Errorf("error: %w", err)
+		}
+		return ipam.PrintSubnet(entry)
 	},
 }
 
@@ -108,6 +163,7 @@ func init() {
 	subnetCmd.AddCommand(subnetCreateFromPatternCmd)
 	subnetCmd.AddCommand(subnetDeleteCmd)
 	subnetCmd.AddCommand(subnetListCmd)
+	subnetCmd.AddCommand(subnetRenameCmd)
 	subnetCmd.AddCommand(subnetShowCmd)
 
 	subnetCreateCmd.Flags().StringP("block", "b", "", "Block CIDR (required)")
@@ -142,6 +198,15 @@ func init() {
 	}
 
 	subnetDeleteCmd.Flags().BoolP("force", "f", false, "Force delete")
+	subnetRenameCmd.Flags().StringP("cidr", "c", "", "Subnet CIDR (required)")
+	if err := subnetRenameCmd.MarkFlagRequired("cidr"); err != nil {
+		fmt.Println("Error:", err)
+	}
+	subnetRenameCmd.Flags().StringP("name", "n", "", "New subnet name (required)")
+	if err := subnetRenameCmd.MarkFlagRequired("name"); err != nil {
+		fmt.Println("Error:", err)
+	}
+
 	subnetListCmd.Flags().StringP("block", "b", "", "Block CIDR")
 	subnetListCmd.Flags().StringP("region", "r", "", "Region")
 
@@ -149,4 +214,12 @@ func init() {
 	if err := subnetShowCmd.MarkFlagRequired("cidr"); err != nil {
 		fmt.Fprintln(os.Stderr, "Error:", err)
 	}
+
+	registerFlagCompletion(subnetCreateCmd, "block", completeBlocks)
+	registerFlagCompletion(subnetCreateFromPatternCmd, "pattern", completePatterns)
+	registerFlagCompletion(subnetCreateFromPatternCmd, "file", completeFileKeys)
+	registerFlagCompletion(subnetListCmd, "block", completeBlocks)
+	for _, cmd := range []*cobra.Command{subnetDeleteCmd, subnetRenameCmd, subnetShowCmd} {
+		registerFlagCompletion(cmd, "cidr", completeSubnets)
+	}
 }
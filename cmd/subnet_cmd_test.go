@@ -7,7 +7,6 @@ import (
 	"strings"
 	"testing"
 
-	"github.com/lugnut42/openipam/internal/ipam"
 	"github.com/lugnut42/openipam/internal/config"
 	"github.com/lugnut42/openipam/internal/logger"
 
@@ -42,7 +41,6 @@ func TestSubnetCommands(t *testing.T) {
 			return err
 		}
 		logger.Debug("PreRun hook - Loaded config: %+v", cfg)
-		ipam.SetConfig(cfg)
 		return nil
 	}
 
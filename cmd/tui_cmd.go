@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/lugnut42/openipam/internal/tui"
+	"github.com/spf13/cobra"
+)
+
+var tuiCmd = &cobra.Command{
+	Use:   "tui",
+	Short: "Browse and allocate interactively in the terminal",
+	Long: `Start an interactive terminal interface listing the block files, their blocks
+and the subnets of each block, with utilization bars and the free ranges of the
+selected block.
+
+Keys:
+  ↑/↓ or j/k     move
+  enter          open the selected block file or block
+  esc            go back
+  a              allocate a subnet from a pattern of the block
+  r              rename the selected subnet
+  d              delete the selected subnet, after confirmation
+  R              reload
+  q              quit
+
+Changes are saved, and committed when git auto-commit is enabled, like those
+of the other commands.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		mgr, err := newManager()
+		if err != nil {
+			exitWithError(err)
+		}
+
+		if err := tui.Run(mgr, os.Stdin, os.Stdout); err != nil {
+			exitWithError(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tuiCmd)
+}
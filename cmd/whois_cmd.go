@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"github.com/lugnut42/openipam/internal/ipam"
+	"github.com/spf13/cobra"
+)
+
+var whoisCmd = &cobra.Command{
+	Use:   "whois <ip-address>",
+	Short: "Show the block and subnet containing an IP address",
+	Long: `Look up an IP address across all block files and show the most specific
+match: the subnet containing it with its name, region and tags, and its block
+and block file. An address within a block but no subnet is reported as
+unallocated together with the free range around it; an address outside every
+block is reported as outside all managed space.
+
+Example:
+  ipam whois 10.20.3.17
+  ipam whois 2001:db8:1::10`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		mgr, err := newManager()
+		if err != nil {
+			exitWithError(err)
+		}
+
+		result, err := mgr.Whois(args[0])
+		if err != nil {
+			exitWithError(err)
+		}
+
+		if err := ipam.PrintWhois(result); err != nil {
+			exitWithError(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(whoisCmd)
+}
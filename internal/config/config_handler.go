@@ -1,17 +1,104 @@
 package config
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/lugnut42/openipam/internal/s3"
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
 	BlockFiles map[string]string             `yaml:"block_files"`
 	Patterns   map[string]map[string]Pattern `yaml:"patterns"`
-	ConfigFile string                        `yaml:"-"`
+	Policies   map[string][]Policy           `yaml:"policies,omitempty"`
+
+	// ReservedAddresses overrides or adds the number of addresses a cloud
+	// provider reserves in every subnet, keyed by provider name
+	ReservedAddresses map[string]int `yaml:"reserved_addresses,omitempty"`
+
+	// Git configures committing changes to the local git repository the
+	// block files and configuration file live in
+	Git GitSettings `yaml:"git,omitempty"`
+
+	// Storage selects where the blocks of the block files are stored
+	Storage StorageSettings `yaml:"storage,omitempty"`
+
+	ConfigFile string `yaml:"-"`
+
+	// remoteETag is the ETag of the configuration object the configuration was
+	// loaded from when the s3 backend is used, empty if it did not exist
+	remoteETag string
+}
+
+// StorageSettings selects the storage backend for blocks and subnets
+type StorageSettings struct {
+	// Backend is "yaml" (the default), storing each block file key in the
+	// YAML file it maps to, "sqlite", storing all block file keys in an
+	// embedded SQLite database, or "s3", storing the block files and the rest
+	// of the configuration in an S3-compatible bucket
+	Backend string `yaml:"backend,omitempty"`
+
+	// Path is the SQLite database file; relative paths are resolved against
+	// the directory of the configuration file
+	Path string `yaml:"path,omitempty"`
+
+	// S3 locates the bucket of the s3 backend
+	S3 S3Settings `yaml:"s3,omitempty"`
+}
+
+// storageBackendS3 is the Backend value of the s3 storage backend
+const storageBackendS3 = "s3"
+
+// RemoteConfigName is the name of the configuration object in the bucket of
+// the s3 backend, relative to the prefix
+const RemoteConfigName = "ipam-config.yaml"
+
+// S3Settings locate the bucket of the s3 storage backend. Credentials are read
+// from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+type S3Settings struct {
+	Bucket string `yaml:"bucket,omitempty"`
+	// Prefix is prepended to every object key, e.g. "ipam/"
+	Prefix string `yaml:"prefix,omitempty"`
+	// Endpoint is the URL of an S3-compatible server such as MinIO; AWS S3 is
+	// used when it is empty
+	Endpoint string `yaml:"endpoint,omitempty"`
+	Region   string `yaml:"region,omitempty"`
+	// PathStyle addresses the bucket in the URL path, as MinIO requires
+	PathStyle bool `yaml:"path_style,omitempty"`
+}
+
+// Client returns a client for the bucket
+func (s S3Settings) Client() *s3.Client {
+	return s3.New(s3.Options{
+		Endpoint:     s.Endpoint,
+		Region:       s.Region,
+		Bucket:       s.Bucket,
+		PathStyle:    s.PathStyle,
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		HTTPClient:   &http.Client{Timeout: 30 * time.Second},
+	})
+}
+
+// Key returns the object key of a name relative to the prefix
+func (s S3Settings) Key(name string) string {
+	return strings.TrimPrefix(path.Join(s.Prefix, filepath.ToSlash(name)), "/")
+}
+
+// GitSettings controls the git integration
+type GitSettings struct {
+	// AutoCommit commits the modified block file and configuration file after
+	// every change made by ipam
+	AutoCommit bool `yaml:"auto_commit,omitempty"`
 }
 
 type Pattern struct {
@@ -19,6 +106,40 @@ type Pattern struct {
 	Environment string `yaml:"environment"`
 	Region      string `yaml:"region"`
 	Block       string `yaml:"block"`
+
+	// Description documents what the subnets of the pattern are used for
+	Description string `yaml:"description,omitempty"`
+
+	// Tags are added to every subnet allocated from the pattern
+	Tags map[string]string `yaml:"tags,omitempty"`
+
+	// NameTemplate names the allocated subnets; it may use the placeholders
+	// {pattern}, {env}, {region}, {ip} and {index}. Defaults to "{pattern}-{ip}".
+	NameTemplate string `yaml:"name_template,omitempty"`
+
+	// Strategy picks the free range to allocate from: "first-fit" (the
+	// default), "best-fit" or "last-fit"
+	Strategy string `yaml:"strategy,omitempty"`
+
+	// PreferredRange is a CIDR within the block to allocate from while it has
+	// room, before falling back to the rest of the block
+	PreferredRange string `yaml:"preferred_range,omitempty"`
+
+	// MaxSubnets limits the subnets allocated from the pattern, 0 for no limit
+	MaxSubnets int `yaml:"max_subnets,omitempty"`
+}
+
+// Policy is a declarative rule evaluated against the blocks and subnets of a
+// block file. Policies are keyed by block file key in the configuration; the
+// special key "*" applies a policy to every block file.
+type Policy struct {
+	Name           string   `yaml:"name"`
+	Severity       string   `yaml:"severity,omitempty"` // "error" (default) or "warning"
+	MinPrefix      int      `yaml:"min_prefix,omitempty"`
+	MaxPrefix      int      `yaml:"max_prefix,omitempty"`
+	NamePattern    string   `yaml:"name_pattern,omitempty"`
+	AllowedRegions []string `yaml:"allowed_regions,omitempty"`
+	DenyPublic     bool     `yaml:"deny_public,omitempty"`
 }
 
 func LoadConfig(configFile string) (*Config, error) {
@@ -49,9 +170,88 @@ func LoadConfig(configFile string) (*Config, error) {
 	}
 
 	cfg.ConfigFile = cleanPath
+	loaded := &cfg
+	if cfg.Storage.Backend == storageBackendS3 {
+		if loaded, err = loadRemoteConfig(&cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	// Reject policies that would otherwise be misread when they are enforced
+	if err := validatePolicies(loaded); err != nil {
+		return nil, err
+	}
+	return loaded, nil
+}
+
+// loadRemoteConfig replaces a local configuration by the configuration object in
+// the bucket of its s3 backend. The local storage settings are kept. The local
+// configuration is used as is when the bucket has no configuration object yet.
+func loadRemoteConfig(local *Config) (*Config, error) {
+	settings := local.Storage.S3
+	if settings.Bucket == "" {
+		return nil, fmt.Errorf("storage.s3.bucket must be set for the %s backend", storageBackendS3)
+	}
+
+	key := settings.Key(RemoteConfigName)
+	data, etag, err := settings.Client().Get(key)
+	if errors.Is(err, s3.ErrNotFound) {
+		return local, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading configuration from bucket %s: %w", settings.Bucket, err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("error unmarshalling config %s from bucket %s: %w", key, settings.Bucket, err)
+	}
+	cfg.Storage = local.Storage
+	cfg.ConfigFile = local.ConfigFile
+	cfg.remoteETag = etag
 	return &cfg, nil
 }
 
+// writeRemoteConfig writes the configuration to the bucket of its s3 backend,
+// unless it was changed there since it was loaded, and keeps only the storage
+// settings in the local configuration file
+func writeRemoteConfig(cfg *Config, localPath string) error {
+	settings := cfg.Storage.S3
+	if settings.Bucket == "" {
+		return fmt.Errorf("storage.s3.bucket must be set for the %s backend", storageBackendS3)
+	}
+
+	remote := *cfg
+	remote.Storage = StorageSettings{}
+	data, err := yaml.Marshal(&remote)
+	if err != nil {
+		return fmt.Errorf("error marshalling config: %w", err)
+	}
+
+	etag, err := settings.Client().PutIfMatch(settings.Key(RemoteConfigName), data, cfg.remoteETag)
+	if errors.Is(err, s3.ErrPreconditionFailed) {
+		return fmt.Errorf("configuration in bucket %s was changed by another writer, retry the command: %w", settings.Bucket, err)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing configuration to bucket %s: %w", settings.Bucket, err)
+	}
+	cfg.remoteETag = etag
+
+	local, err := yaml.Marshal(struct {
+		Storage StorageSettings `yaml:"storage"`
+	}{cfg.Storage})
+	if err != nil {
+		return fmt.Errorf("error marshalling config: %w", err)
+	}
+	if current, err := os.ReadFile(localPath); err == nil && bytes.Equal(current, local) { // #nosec G304
+		return nil
+	}
+	if err := os.WriteFile(localPath, local, 0600); err != nil { // #nosec G304
+		return fmt.Errorf("error writing config file: %w", err)
+	}
+	return nil
+}
+
 func WriteConfig(cfg *Config) error {
 	if cfg.ConfigFile == "" {
 		return fmt.Errorf("config file path not set")
@@ -66,6 +266,10 @@ func WriteConfig(cfg *Config) error {
 		return fmt.Errorf("parent directory does not exist: %s", dir)
 	}
 
+	if cfg.Storage.Backend == storageBackendS3 {
+		return writeRemoteConfig(cfg, cleanPath)
+	}
+
 	data, err := yaml.Marshal(cfg)
 	if err != nil {
 		return fmt.Errorf("error marshalling config: %w", err)
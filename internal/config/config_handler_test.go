@@ -2,9 +2,14 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/lugnut42/openipam/internal/s3"
+	"github.com/lugnut42/openipam/internal/s3/s3test"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
 )
 
 func TestConfig(t *testing.T) {
@@ -40,3 +45,48 @@ func TestConfig(t *testing.T) {
 	assert.Equal(t, cfg.BlockFiles["default"], loadedCfg.BlockFiles["default"])
 	assert.Equal(t, cfg.Patterns["default"]["dev-gke-uswest"].CIDRSize, loadedCfg.Patterns["default"]["dev-gke-uswest"].CIDRSize)
 }
+
+func TestRemoteConfig(t *testing.T) {
+	server := s3test.NewServer()
+	defer server.Close()
+
+	// The local configuration file only points to the bucket
+	localFile := filepath.Join(t.TempDir(), "ipam-config.yaml")
+	storage := StorageSettings{Backend: "s3", S3: S3Settings{Bucket: "ipam", Prefix: "team", Endpoint: server.URL, PathStyle: true}}
+	data, err := yaml.Marshal(&Config{BlockFiles: map[string]string{"dev": "blocks/dev.yaml"}, Storage: storage})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(localFile, data, 0600))
+
+	// Without a configuration object the local configuration is used and written to the bucket
+	cfg, err := LoadConfig(localFile)
+	require.NoError(t, err)
+	assert.Equal(t, "blocks/dev.yaml", cfg.BlockFiles["dev"])
+	cfg.Patterns = map[string]map[string]Pattern{"dev": {"app": {CIDRSize: 24, Block: "10.0.0.0/16"}}}
+	require.NoError(t, WriteConfig(cfg))
+
+	remote, ok := server.Object("ipam", "team/"+RemoteConfigName)
+	require.True(t, ok)
+	assert.Contains(t, string(remote), "blocks/dev.yaml")
+	assert.NotContains(t, string(remote), "storage")
+	local, err := os.ReadFile(localFile)
+	require.NoError(t, err)
+	assert.NotContains(t, string(local), "block_files")
+
+	// Two writers loaded the same version; the second one must not clobber the first
+	first, err := LoadConfig(localFile)
+	require.NoError(t, err)
+	assert.Equal(t, 24, first.Patterns["dev"]["app"].CIDRSize)
+	second, err := LoadConfig(localFile)
+	require.NoError(t, err)
+
+	first.BlockFiles["prod"] = "blocks/prod.yaml"
+	require.NoError(t, WriteConfig(first))
+	second.BlockFiles["test"] = "blocks/test.yaml"
+	assert.ErrorIs(t, WriteConfig(second), s3.ErrPreconditionFailed)
+
+	reloaded, err := LoadConfig(localFile)
+	require.NoError(t, err)
+	assert.Contains(t, reloaded.BlockFiles, "prod")
+	assert.NotContains(t, reloaded.BlockFiles, "test")
+	assert.Equal(t, storage, reloaded.Storage)
+}
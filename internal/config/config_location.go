@@ -0,0 +1,184 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileName is the name of the configuration file in a configuration directory
+const ConfigFileName = "ipam-config.yaml"
+
+// ProfilesFileName is the name of the file mapping profile names to
+// configuration files in a configuration directory
+const ProfilesFileName = "profiles.yaml"
+
+// Sources of the configuration file path, in the order they are consulted
+const (
+	SourceFlag    = "--config flag"
+	SourceProfile = "profile"
+	SourceEnv     = "IPAM_CONFIG_PATH"
+	SourceXDG     = "XDG config directory"
+	SourceHome    = "home directory"
+)
+
+// profileNamePattern restricts profile names, which are used as directory names
+var profileNamePattern = regexp.MustCompile("^[a-zA-Z0-9-_]+$")
+
+// Location is the configuration file path Locate resolved and where it came from
+type Location struct {
+	Path    string
+	Source  string
+	Profile string
+}
+
+func (l Location) String() string {
+	if l.Profile != "" {
+		return fmt.Sprintf("%s (profile %s)", l.Path, l.Profile)
+	}
+	return fmt.Sprintf("%s (from %s)", l.Path, l.Source)
+}
+
+// profilesFile is the format of the profiles file
+type profilesFile struct {
+	Profiles map[string]string `yaml:"profiles"`
+}
+
+// Locate resolves the configuration file. It uses, in order: the --config
+// flag, the profile given with --profile or IPAM_PROFILE, IPAM_CONFIG_PATH,
+// and the first of the configuration directories (see Dirs) that has a
+// configuration file. The flag and IPAM_CONFIG_PATH may name a file or a
+// directory holding ipam-config.yaml. When no configuration file exists yet,
+// the path in the XDG config directory is returned, which is where
+// 'ipam config init' creates it.
+func Locate(flagPath, profile string) (Location, error) {
+	if flagPath != "" && profile != "" {
+		return Location{}, errors.New("--config and --profile cannot be used together")
+	}
+	if flagPath != "" {
+		return Location{Path: configPath(flagPath), Source: SourceFlag}, nil
+	}
+
+	if profile == "" {
+		profile = os.Getenv("IPAM_PROFILE")
+	}
+	if profile != "" {
+		path, err := profilePath(profile)
+		if err != nil {
+			return Location{}, err
+		}
+		return Location{Path: path, Source: SourceProfile, Profile: profile}, nil
+	}
+
+	if env := os.Getenv("IPAM_CONFIG_PATH"); env != "" {
+		return Location{Path: configPath(env), Source: SourceEnv}, nil
+	}
+
+	dirs := Dirs()
+	if len(dirs) == 0 {
+		return Location{}, errors.New("no configuration file specified. Please set the IPAM_CONFIG_PATH environment variable or use the --config flag")
+	}
+	for _, dir := range dirs {
+		path := filepath.Join(dir.Path, ConfigFileName)
+		if isFile(path) {
+			return Location{Path: path, Source: dir.Source}, nil
+		}
+	}
+	return Location{Path: filepath.Join(dirs[0].Path, ConfigFileName), Source: dirs[0].Source}, nil
+}
+
+// Dir is a configuration directory searched by Locate
+type Dir struct {
+	Path   string
+	Source string
+}
+
+// Dirs returns the configuration directories in the order they are searched:
+// openipam in $XDG_CONFIG_HOME (~/.config by default), then ~/.openipam.
+// Directories whose base cannot be determined are left out.
+func Dirs() []Dir {
+	var dirs []Dir
+	home, _ := os.UserHomeDir()
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); filepath.IsAbs(xdg) {
+		dirs = append(dirs, Dir{Path: filepath.Join(xdg, "openipam"), Source: SourceXDG})
+	} else if home != "" {
+		dirs = append(dirs, Dir{Path: filepath.Join(home, ".config", "openipam"), Source: SourceXDG})
+	}
+	if home != "" {
+		dirs = append(dirs, Dir{Path: filepath.Join(home, ".openipam"), Source: SourceHome})
+	}
+	return dirs
+}
+
+// configPath returns the configuration file of a path that names either the
+// file or a directory holding ipam-config.yaml
+func configPath(path string) string {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return filepath.Join(path, ConfigFileName)
+	}
+	if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" || isFile(path) {
+		return path
+	}
+	return filepath.Join(path, ConfigFileName)
+}
+
+// profilePath returns the configuration file of a profile: the path the
+// profile maps to in the profiles file of a configuration directory, relative
+// to that directory, or otherwise profiles/<name>/ipam-config.yaml in the
+// first configuration directory that has it, or in the XDG config directory
+func profilePath(name string) (string, error) {
+	if !profileNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid profile name '%s': only alphanumeric characters, hyphens, and underscores are allowed", name)
+	}
+	dirs := Dirs()
+	if len(dirs) == 0 {
+		return "", fmt.Errorf("cannot locate profile %s: no configuration directory", name)
+	}
+
+	for _, dir := range dirs {
+		profiles, err := loadProfiles(filepath.Join(dir.Path, ProfilesFileName))
+		if err != nil {
+			return "", err
+		}
+		if path, ok := profiles[name]; ok {
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir.Path, path)
+			}
+			return configPath(path), nil
+		}
+	}
+
+	for _, dir := range dirs {
+		path := filepath.Join(dir.Path, "profiles", name, ConfigFileName)
+		if isFile(path) {
+			return path, nil
+		}
+	}
+	return filepath.Join(dirs[0].Path, "profiles", name, ConfigFileName), nil
+}
+
+// loadProfiles reads a profiles file, returning no profiles if it does not exist
+func loadProfiles(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path) // #nosec G304
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading profiles file: %w", err)
+	}
+
+	var profiles profilesFile
+	if err := yaml.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("error unmarshalling profiles file %s: %w", path, err)
+	}
+	return profiles.Profiles, nil
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
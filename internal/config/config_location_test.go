@@ -0,0 +1,70 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocate(t *testing.T) {
+	home := t.TempDir()
+	xdg := filepath.Join(home, "xdg")
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	t.Setenv("IPAM_CONFIG_PATH", "")
+	t.Setenv("IPAM_PROFILE", "")
+
+	locate := func(flagPath, profile string) Location {
+		t.Helper()
+		loc, err := Locate(flagPath, profile)
+		require.NoError(t, err)
+		return loc
+	}
+
+	// Without any configuration the XDG location is used for creating it
+	xdgConfig := filepath.Join(xdg, "openipam", ConfigFileName)
+	assert.Equal(t, Location{Path: xdgConfig, Source: SourceXDG}, locate("", ""))
+
+	// An existing ~/.openipam configuration is found
+	homeConfig := filepath.Join(home, ".openipam", ConfigFileName)
+	require.NoError(t, os.MkdirAll(filepath.Dir(homeConfig), 0750))
+	require.NoError(t, os.WriteFile(homeConfig, []byte("{}"), 0600))
+	assert.Equal(t, Location{Path: homeConfig, Source: SourceHome}, locate("", ""))
+
+	// The XDG config directory takes precedence over ~/.openipam
+	require.NoError(t, os.MkdirAll(filepath.Dir(xdgConfig), 0750))
+	require.NoError(t, os.WriteFile(xdgConfig, []byte("{}"), 0600))
+	assert.Equal(t, Location{Path: xdgConfig, Source: SourceXDG}, locate("", ""))
+
+	// IPAM_CONFIG_PATH names a directory or a file
+	envDir := t.TempDir()
+	t.Setenv("IPAM_CONFIG_PATH", envDir)
+	assert.Equal(t, Location{Path: filepath.Join(envDir, ConfigFileName), Source: SourceEnv}, locate("", ""))
+	t.Setenv("IPAM_CONFIG_PATH", filepath.Join(envDir, "other.yaml"))
+	assert.Equal(t, filepath.Join(envDir, "other.yaml"), locate("", "").Path)
+
+	// Profiles map to files relative to the configuration directory, or
+	// default to the profiles directory
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".openipam", ProfilesFileName), []byte(`profiles:
+  prod: prod/ipam-config.yaml
+  shared: /etc/openipam/ipam-config.yaml
+`), 0600))
+	assert.Equal(t, Location{Path: filepath.Join(home, ".openipam", "prod", ConfigFileName), Source: SourceProfile, Profile: "prod"}, locate("", "prod"))
+	assert.Equal(t, "/etc/openipam/ipam-config.yaml", locate("", "shared").Path)
+	assert.Equal(t, filepath.Join(xdg, "openipam", "profiles", "staging", ConfigFileName), locate("", "staging").Path)
+
+	t.Setenv("IPAM_PROFILE", "prod")
+	assert.Equal(t, "prod", locate("", "").Profile)
+
+	// The flag takes precedence over everything else
+	assert.Equal(t, Location{Path: "/tmp/ipam.yaml", Source: SourceFlag}, locate("/tmp/ipam.yaml", ""))
+	assert.Equal(t, "/tmp/ipam.yaml (from --config flag)", locate("/tmp/ipam.yaml", "").String())
+
+	_, err := Locate("/tmp/ipam.yaml", "prod")
+	assert.ErrorContains(t, err, "cannot be used together")
+	_, err = Locate("", "../prod")
+	assert.ErrorContains(t, err, "invalid profile name")
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Severities of a policy
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Validate checks that the severity of a policy is known and that its name
+// pattern compiles
+func (p Policy) Validate() error {
+	if p.Severity != "" && !strings.EqualFold(p.Severity, SeverityError) && !strings.EqualFold(p.Severity, SeverityWarning) {
+		return fmt.Errorf("unknown severity %q, use %s or %s", p.Severity, SeverityError, SeverityWarning)
+	}
+	if p.NamePattern != "" {
+		if _, err := regexp.Compile(p.NamePattern); err != nil {
+			return fmt.Errorf("invalid name_pattern %q: %w", p.NamePattern, err)
+		}
+	}
+	return nil
+}
+
+// validatePolicies validates the policies of every block file key
+func validatePolicies(cfg *Config) error {
+	fileKeys := make([]string, 0, len(cfg.Policies))
+	for fileKey := range cfg.Policies {
+		fileKeys = append(fileKeys, fileKey)
+	}
+	sort.Strings(fileKeys)
+
+	for _, fileKey := range fileKeys {
+		for _, policy := range cfg.Policies[fileKey] {
+			if err := policy.Validate(); err != nil {
+				return fmt.Errorf("invalid policy '%s' of block file %s in %s: %w", policy.Name, fileKey, cfg.ConfigFile, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyValidate(t *testing.T) {
+	assert.NoError(t, Policy{Name: "default"}.Validate())
+	assert.NoError(t, Policy{Name: "soft", Severity: "Warning", NamePattern: "^app-"}.Validate())
+	assert.ErrorContains(t, Policy{Name: "typo", Severity: "warn"}.Validate(), `unknown severity "warn"`)
+	assert.ErrorContains(t, Policy{Name: "regex", NamePattern: "app-("}.Validate(), "invalid name_pattern")
+}
+
+func TestLoadConfigRejectsInvalidPolicies(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "ipam-config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte(`block_files:
+  prod: prod.yaml
+policies:
+  prod:
+    - name: naming
+      severity: warn
+      name_pattern: "^app-"
+`), 0600))
+
+	_, err := LoadConfig(configFile)
+	assert.ErrorContains(t, err, `invalid policy 'naming' of block file prod`)
+	assert.ErrorContains(t, err, `unknown severity "warn"`)
+}
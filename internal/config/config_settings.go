@@ -0,0 +1,103 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// reservedAddressesPrefix prefixes the settings overriding the reserved
+// addresses of a provider, e.g. reserved_addresses.gcp
+const reservedAddressesPrefix = "reserved_addresses."
+
+// Setting is a configuration value that can be changed with Set
+type Setting struct {
+	Key         string
+	Description string
+	set         func(cfg *Config, value string) error
+}
+
+// settings are the settings Set accepts, besides reserved_addresses.<provider>.
+// Block files, patterns, policies and the storage backend have their own commands.
+var settings = []Setting{
+	{
+		Key:         "git.auto_commit",
+		Description: "commit every change to the git repository of the block files (true or false)",
+		set: func(cfg *Config, value string) error {
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid value %q for git.auto_commit: use true or false", value)
+			}
+			cfg.Git.AutoCommit = enabled
+			return nil
+		},
+	},
+	{
+		Key:         "storage.s3.endpoint",
+		Description: "URL of the S3-compatible server of the s3 backend, empty for AWS S3",
+		set: func(cfg *Config, value string) error {
+			cfg.Storage.S3.Endpoint = value
+			return nil
+		},
+	},
+	{
+		Key:         "storage.s3.region",
+		Description: "region of the bucket of the s3 backend",
+		set: func(cfg *Config, value string) error {
+			cfg.Storage.S3.Region = value
+			return nil
+		},
+	},
+	{
+		Key:         "storage.s3.path_style",
+		Description: "address the bucket of the s3 backend in the URL path (true or false)",
+		set: func(cfg *Config, value string) error {
+			pathStyle, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid value %q for storage.s3.path_style: use true or false", value)
+			}
+			cfg.Storage.S3.PathStyle = pathStyle
+			return nil
+		},
+	},
+}
+
+// Settings returns the settings Set accepts, sorted by key, including the
+// reserved_addresses.<provider> pattern
+func Settings() []Setting {
+	all := append([]Setting{{
+		Key:         reservedAddressesPrefix + "<provider>",
+		Description: "addresses the provider reserves in every subnet, empty to use the built-in value",
+	}}, settings...)
+	sort.Slice(all, func(i, j int) bool { return all[i].Key < all[j].Key })
+	return all
+}
+
+// Set changes a setting of the configuration. The configuration is not written.
+func (c *Config) Set(key, value string) error {
+	if provider, ok := strings.CutPrefix(key, reservedAddressesPrefix); ok && provider != "" {
+		// Providers are looked up in lower case
+		provider = strings.ToLower(provider)
+		if value == "" {
+			delete(c.ReservedAddresses, provider)
+			return nil
+		}
+		reserved, err := strconv.Atoi(value)
+		if err != nil || reserved < 0 {
+			return fmt.Errorf("invalid value %q for %s: use a number of addresses", value, reservedAddressesPrefix+provider)
+		}
+		if c.ReservedAddresses == nil {
+			c.ReservedAddresses = make(map[string]int)
+		}
+		c.ReservedAddresses[provider] = reserved
+		return nil
+	}
+
+	for _, setting := range settings {
+		if setting.Key == key {
+			return setting.set(c, value)
+		}
+	}
+	return fmt.Errorf("unknown setting %q, run 'ipam config set --help' for the settings", key)
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSet(t *testing.T) {
+	cfg := &Config{}
+
+	require.NoError(t, cfg.Set("git.auto_commit", "true"))
+	assert.True(t, cfg.Git.AutoCommit)
+	assert.ErrorContains(t, cfg.Set("git.auto_commit", "yes please"), "use true or false")
+
+	require.NoError(t, cfg.Set("storage.s3.endpoint", "http://localhost:9000"))
+	require.NoError(t, cfg.Set("storage.s3.path_style", "1"))
+	assert.Equal(t, S3Settings{Endpoint: "http://localhost:9000", PathStyle: true}, cfg.Storage.S3)
+
+	require.NoError(t, cfg.Set("reserved_addresses.gcp", "4"))
+	assert.Equal(t, map[string]int{"gcp": 4}, cfg.ReservedAddresses)
+	require.NoError(t, cfg.Set("reserved_addresses.AWS", "6"))
+	assert.Equal(t, map[string]int{"gcp": 4, "aws": 6}, cfg.ReservedAddresses)
+	require.NoError(t, cfg.Set("reserved_addresses.gcp", ""))
+	require.NoError(t, cfg.Set("reserved_addresses.Aws", ""))
+	assert.Empty(t, cfg.ReservedAddresses)
+	assert.ErrorContains(t, cfg.Set("reserved_addresses.gcp", "-1"), "invalid value")
+
+	assert.ErrorContains(t, cfg.Set("storage.backend", "sqlite"), "unknown setting")
+	assert.ErrorContains(t, cfg.Set("reserved_addresses.", "4"), "unknown setting")
+
+	keys := make([]string, 0, len(Settings()))
+	for _, setting := range Settings() {
+		keys = append(keys, setting.Key)
+	}
+	assert.Equal(t, []string{"git.auto_commit", "reserved_addresses.<provider>", "storage.s3.endpoint", "storage.s3.path_style", "storage.s3.region"}, keys)
+}
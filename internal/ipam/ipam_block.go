@@ -1,7 +1,11 @@
 package ipam
 
 import (
-	"net"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
 )
 
 // Block represents an IP block
@@ -9,6 +13,10 @@ type Block struct {
 	CIDR        string   `yaml:"cidr"`
 	Description string   `yaml:"description"`
 	Subnets     []Subnet `yaml:"subnets"`
+
+	// Provider is the cloud provider the block is deployed in ("aws", "azure",
+	// "gcp", ...); it determines the reserved addresses per subnet
+	Provider string `yaml:"provider,omitempty"`
 	
 	// Stats are calculated at runtime, not stored in YAML
 	Stats *UtilizationStats `yaml:"-"`
@@ -16,9 +24,9 @@ type Block struct {
 
 // UtilizationStats represents runtime utilization statistics
 type UtilizationStats struct {
-	TotalIPs     uint64
-	AllocatedIPs uint64
-	AvailableIPs uint64
+	TotalIPs     *big.Int
+	AllocatedIPs *big.Int
+	AvailableIPs *big.Int
 	Utilization  float64
 }
 
@@ -27,26 +35,44 @@ type Subnet struct {
 	CIDR   string `yaml:"cidr"`
 	Name   string `yaml:"name"`
 	Region string `yaml:"region"`
+
+	// CreatedAt records when the subnet was allocated; it is the allocation
+	// history used for capacity forecasting. Zero for subnets created before
+	// it was recorded.
+	CreatedAt time.Time `yaml:"created_at,omitempty"`
+
+	// Renumberable marks a subnet as safe to move to a new CIDR when a block is defragmented
+	Renumberable bool `yaml:"renumberable,omitempty"`
+
+	// Tags are free-form key/value labels of the subnet
+	Tags map[string]string `yaml:"tags,omitempty"`
 }
 
-// Helper functions
-func nextIP(ip net.IP, mask net.IPMask) net.IP {
-	next := make(net.IP, len(ip))
-	copy(next, ip)
-	for i := len(next) - 1; i >= 0; i-- {
-		next[i]++
-		if next[i] > 0 {
-			break
-		}
-	}
-	return next.Mask(mask)
+// subnetKey is a comparable form of a Subnet for detecting exact duplicate entries
+type subnetKey struct {
+	CIDR         string
+	Name         string
+	Region       string
+	CreatedAt    time.Time
+	Renumberable bool
+	Tags         string
 }
 
-func lastIP(network *net.IPNet) net.IP {
-	ip := make(net.IP, len(network.IP))
-	copy(ip, network.IP)
-	for i := range ip {
-		ip[i] |= ^network.Mask[i]
+// keyOf returns the comparable form of a subnet
+func keyOf(s Subnet) subnetKey {
+	keys := make([]string, 0, len(s.Tags))
+	for key := range s.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var tags strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&tags, "%q=%q;", key, s.Tags[key])
 	}
-	return ip
+	return subnetKey{CIDR: s.CIDR, Name: s.Name, Region: s.Region, CreatedAt: s.CreatedAt, Renumberable: s.Renumberable, Tags: tags.String()}
+}
+
+// timeNow returns the current time; replaced in tests
+var timeNow = func() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
 }
@@ -1,114 +1,11 @@
 package ipam
 
 import (
-	"net"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
-func TestIsIPAligned(t *testing.T) {
-	testCases := []struct {
-		name     string
-		ip       string
-		maskSize int
-		expected bool
-	}{
-		{
-			name:     "IP not aligned with /24 mask",
-			ip:       "192.168.1.1",
-			maskSize: 24,
-			expected: false,
-		},
-		{
-			name:     "IP not aligned with /16 mask",
-			ip:       "192.168.1.0",
-			maskSize: 16,
-			expected: false,
-		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			ip := net.ParseIP(tc.ip)
-			mask := net.CIDRMask(tc.maskSize, 32)
-			result := isIPAligned(ip, mask)
-			assert.Equal(t, tc.expected, result)
-		})
-	}
-}
-
-func TestNextIPWithStep(t *testing.T) {
-	testCases := []struct {
-		name     string
-		startIP  string
-		step     int
-		expected string
-	}{
-		{
-			name:     "Next IP with step 1",
-			startIP:  "192.168.1.1",
-			step:     1,
-			expected: "192.168.1.2",
-		},
-		{
-			name:     "Next IP with step 10",
-			startIP:  "192.168.1.1",
-			step:     10,
-			expected: "192.168.1.11",
-		},
-		{
-			name:     "Next IP with step across octet boundary",
-			startIP:  "192.168.1.250",
-			step:     10,
-			expected: "192.168.2.4",
-		},
-		{
-			name:     "Next IP with large step",
-			startIP:  "192.168.1.1",
-			step:     65535,
-			expected: "192.169.1.0",
-		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			ip := net.ParseIP(tc.startIP)
-			result := nextIPWithStep(ip, tc.step)
-			assert.Equal(t, tc.expected, result.String())
-		})
-	}
-}
-
-func TestMaxCIDRSize(t *testing.T) {
-	testCases := []struct {
-		name      string
-		startIP   string
-		endIP     string
-		maxPrefix int
-		expected  int
-	}{
-		{
-			name:      "Range limited by alignment",
-			startIP:   "10.0.0.1", // Not aligned for /24
-			endIP:     "10.0.2.0",
-			maxPrefix: 8,
-			expected:  32,
-		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			startIP := net.ParseIP(tc.startIP)
-			endIP := net.ParseIP(tc.endIP)
-			result := maxCIDRSize(startIP, endIP, tc.maxPrefix)
-			assert.Equal(t, tc.expected, result)
-		})
-	}
-}
-
-// Skipping tests for calculateCIDRsInRange because the implementation is different than expected
-
 func TestCalculateAvailableCIDRs(t *testing.T) {
 	testCases := []struct {
 		name     string
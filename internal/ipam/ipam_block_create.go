@@ -2,74 +2,76 @@ package ipam
 
 import (
 	"fmt"
-	"net"
+	"strings"
 
 	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/iprange"
 	"github.com/lugnut42/openipam/internal/logger"
 )
 
-func AddBlock(cfg *config.Config, cidr, description, fileKey string) error {
-	logger.Debug("AddBlock called with CIDR=%s, description=%s, fileKey=%s", cidr, description, fileKey)
+// AddBlock adds a new block to a block file. Blocks overlapping reserved
+// special-purpose ranges are rejected, and blocks in public address space are
+// rejected unless allowPublic is set. The provider, if any, is stored in lower
+// case and determines the reserved addresses of the block's subnets. It returns
+// warnings about the block, such as it being in public address space, for the
+// caller to report.
+func AddBlock(cfg *config.Config, cidr, description, provider, fileKey string, allowPublic bool) ([]string, error) {
+	logger.Debug("AddBlock called with CIDR=%s, description=%s, provider=%s, fileKey=%s, allowPublic=%v", cidr, description, provider, fileKey, allowPublic)
 
-	blockFile, ok := cfg.BlockFiles[fileKey]
-	if !ok {
-		return fmt.Errorf("block file for key %s not found", fileKey)
+	if _, ok := cfg.BlockFiles[fileKey]; !ok {
+		return nil, &NotFoundError{Kind: "block file", Name: fileKey}
 	}
 
-	// Validate CIDR
-	_, newBlockNet, err := net.ParseCIDR(cidr)
+	// Validate CIDR and store it in canonical form
+	newPrefix, err := iprange.ParsePrefix(cidr)
 	if err != nil {
-		return fmt.Errorf("invalid CIDR: %w", err)
+		return nil, fmt.Errorf("invalid CIDR: %w", err)
 	}
+	cidr = newPrefix.String()
+	provider = strings.ToLower(strings.TrimSpace(provider))
 
-	// Check for overlaps across all block files
-	for bfKey, blockFilePath := range cfg.BlockFiles {
-		yamlData, err := readYAMLFile(blockFilePath)
-		if err != nil {
-			return fmt.Errorf("error reading block file %s: %w", bfKey, err)
-		}
+	// Check the block against the special-purpose address registry
+	warning, err := checkSpecialPurpose(newPrefix, allowPublic)
+	if err != nil {
+		return nil, err
+	}
+	var warnings []string
+	if warning != "" {
+		warnings = append(warnings, warning)
+	}
 
-		blocks, err := unmarshalBlocks(yamlData)
+	// Check for overlaps across all block files
+	index := &prefixTrie[indexedBlock]{}
+	for _, bfKey := range SortedFileKeys(cfg) {
+		blocks, err := loadBlocks(cfg, bfKey)
 		if err != nil {
-			return fmt.Errorf("error parsing block file %s: %w", bfKey, err)
+			return nil, fmt.Errorf("error reading block file %s: %w", bfKey, err)
 		}
 
 		for _, b := range blocks {
-			_, existingBlockNet, err := net.ParseCIDR(b.CIDR)
+			existing, err := iprange.ParsePrefix(b.CIDR)
 			if err != nil {
-				return fmt.Errorf("error parsing existing block CIDR %s: %w", b.CIDR, err)
-			}
-
-			if checkCIDROverlap(newBlockNet, existingBlockNet) {
-				return fmt.Errorf("block with CIDR %s overlaps with existing block %s in file %s", cidr, b.CIDR, bfKey)
+				return nil, fmt.Errorf("error parsing existing block CIDR %s: %w", b.CIDR, err)
 			}
+			index.insert(existing, indexedBlock{FileKey: bfKey, Block: b})
 		}
 	}
-
-	// Now add the block to the specified file
-	yamlData, err := readYAMLFile(blockFile)
-	if err != nil {
-		return fmt.Errorf("error reading block file: %w", err)
-	}
-
-	blocks, err := unmarshalBlocks(yamlData)
-	if err != nil {
-		return fmt.Errorf("error parsing blocks: %w", err)
+	if overlaps := index.overlapping(newPrefix); len(overlaps) > 0 {
+		existing := overlaps[0].Value
+		return nil, &OverlapError{Kind: "block", CIDR: cidr, Existing: existing.Block.CIDR, FileKey: existing.FileKey}
 	}
 
-	blocks = append(blocks, Block{
-		CIDR:        cidr,
-		Description: description,
+	// Now add the block to the specified file
+	err = updateBlocks(cfg, fileKey, func(blocks []Block) ([]Block, error) {
+		return append(blocks, Block{
+			CIDR:        cidr,
+			Description: description,
+			Provider:    provider,
+		}), nil
 	})
-
-	newYamlData, err := marshalBlocks(blocks)
 	if err != nil {
-		return fmt.Errorf("error marshalling blocks: %w", err)
-	}
-
-	if err = writeYAMLFile(blockFile, newYamlData); err != nil {
-		return fmt.Errorf("error writing block file: %w", err)
+		return nil, fmt.Errorf("error writing block file: %w", err)
 	}
 
-	return nil
+	return warnings, nil
 }
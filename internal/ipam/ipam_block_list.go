@@ -8,46 +8,57 @@ import (
 	"github.com/lugnut42/openipam/internal/config"
 )
 
-func ListBlocks(cfg *config.Config, fileKey ...string) error {
+// BlockEntry is a block together with the key of the block file it belongs to
+type BlockEntry struct {
+	FileKey string
+	Block   Block
+}
+
+// FindBlocks returns the blocks of a specific block file, or of all block files
+// when no file key is given, ordered by file key
+func FindBlocks(cfg *config.Config, fileKey ...string) ([]BlockEntry, error) {
 	// Get all block files or a specific one
-	blockFiles := make(map[string]string)
+	var fileKeys []string
 
 	if len(fileKey) > 0 && fileKey[0] != "" {
 		// Use a specific block file
-		specificFile, ok := cfg.BlockFiles[fileKey[0]]
-		if !ok {
-			return fmt.Errorf("block file for key %s not found", fileKey[0])
+		if _, ok := cfg.BlockFiles[fileKey[0]]; !ok {
+			return nil, &NotFoundError{Kind: "block file", Name: fileKey[0]}
 		}
-		blockFiles[fileKey[0]] = specificFile
+		fileKeys = []string{fileKey[0]}
 	} else {
 		// Use all block files
-		for key, file := range cfg.BlockFiles {
-			blockFiles[key] = file
-		}
+		fileKeys = SortedFileKeys(cfg)
 	}
 
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "Block CIDR\tSubnet CIDR\tDescription")
-
-	for _, blockFile := range blockFiles {
-		yamlData, err := readYAMLFile(blockFile)
+	var entries []BlockEntry
+	for _, key := range fileKeys {
+		blocks, err := loadBlocks(cfg, key)
 		if err != nil {
-			return fmt.Errorf("error reading block file: %w", err)
+			return nil, fmt.Errorf("error reading block file: %w", err)
 		}
 
-		blocks, err := unmarshalBlocks(yamlData)
-		if err != nil {
-			return fmt.Errorf("error parsing blocks: %w", err)
+		for _, block := range blocks {
+			entries = append(entries, BlockEntry{FileKey: key, Block: block})
 		}
+	}
 
-		for _, block := range blocks {
-			if len(block.Subnets) > 0 {
-				for _, subnet := range block.Subnets {
-					fmt.Fprintln(w, block.CIDR+"\t"+subnet.CIDR+"\t"+block.Description)
-				}
-			} else {
-				fmt.Fprintln(w, block.CIDR+"\t\t"+block.Description)
+	return entries, nil
+}
+
+// PrintBlocks prints block entries as a table, one row per subnet
+func PrintBlocks(entries []BlockEntry) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Block CIDR\tSubnet CIDR\tDescription")
+
+	for _, entry := range entries {
+		block := entry.Block
+		if len(block.Subnets) > 0 {
+			for _, subnet := range block.Subnets {
+				fmt.Fprintln(w, block.CIDR+"\t"+subnet.CIDR+"\t"+block.Description)
 			}
+		} else {
+			fmt.Fprintln(w, block.CIDR+"\t\t"+block.Description)
 		}
 	}
 
@@ -0,0 +1,298 @@
+package ipam
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"math/big"
+	"net/netip"
+	"sort"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/iprange"
+)
+
+// Kinds of segments in a block map
+const (
+	segmentSubnet   = "subnet"
+	segmentFree     = "free"
+	segmentReserved = "reserved"
+)
+
+// MapSegment is a range of a block in an address-space map. Start and Width
+// are fractions of the block's address space.
+type MapSegment struct {
+	CIDR      string
+	Kind      string
+	Name      string
+	Region    string
+	Addresses *big.Int
+	Start     float64
+	Width     float64
+}
+
+// BlockMap is the layout of a block's address space: its subnets, the
+// special-purpose ranges within it and its free ranges
+type BlockMap struct {
+	BlockCIDR   string
+	Description string
+	FileKey     string
+	Segments    []MapSegment
+
+	// Regions are the subnet regions in legend order
+	Regions []string
+}
+
+// Map dimensions in pixels
+const (
+	mapWidth     = 1000
+	mapBarY      = 50
+	mapBarHeight = 60
+	mapLegendY   = 140
+	mapLabelMin  = 90 // narrowest segment that gets a text label
+)
+
+// mapPalette colors subnets by region; regions beyond its length reuse colors
+var mapPalette = []string{
+	"#4e79a7", "#f28e2b", "#59a14f", "#b07aa1", "#76b7b2",
+	"#edc948", "#ff9da7", "#9c755f", "#e15759", "#bab0ac",
+}
+
+const (
+	mapFreeColor     = "#eeeeee"
+	mapReservedColor = "#d62728"
+)
+
+// BuildBlockMap lays out the address space of a block. Free ranges are those
+// reported by block available.
+func BuildBlockMap(cfg *config.Config, blockCIDR, fileKey string) (*BlockMap, error) {
+	block, err := FindBlock(cfg, blockCIDR, fileKey)
+	if err != nil {
+		return nil, err
+	}
+
+	blockPrefix, err := iprange.ParsePrefix(block.CIDR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR format: %w", err)
+	}
+
+	m := &BlockMap{BlockCIDR: block.CIDR, Description: block.Description, FileKey: fileKey}
+	total := iprange.Size(blockPrefix)
+
+	addSegment := func(kind string, prefix netip.Prefix, name, region string) {
+		offset := iprange.Offset(blockPrefix.Addr(), prefix.Addr())
+		size := iprange.Size(prefix)
+		m.Segments = append(m.Segments, MapSegment{
+			CIDR:      prefix.String(),
+			Kind:      kind,
+			Name:      name,
+			Region:    region,
+			Addresses: size,
+			Start:     utilizationRatio(offset, total),
+			Width:     utilizationRatio(size, total),
+		})
+	}
+
+	regions := make(map[string]bool)
+	for _, subnet := range block.Subnets {
+		subnetPrefix, err := iprange.ParsePrefix(subnet.CIDR)
+		if err != nil || !blockPrefix.Contains(subnetPrefix.Addr()) {
+			continue // Reported by validation
+		}
+		addSegment(segmentSubnet, subnetPrefix, subnet.Name, subnet.Region)
+		regions[subnet.Region] = true
+	}
+	for region := range regions {
+		m.Regions = append(m.Regions, region)
+	}
+	sort.Strings(m.Regions)
+
+	for _, prefix := range subnetTrie(block.Subnets).free(blockPrefix) {
+		addSegment(segmentFree, prefix, "", "")
+	}
+
+	// Special-purpose ranges within the block are drawn on top of everything else
+	for _, entry := range specialPurposeRegistry {
+		if entry.Class != rangeReserved && entry.Class != rangeLimited {
+			continue
+		}
+		if !entry.prefix.Overlaps(blockPrefix) {
+			continue
+		}
+		// A range covering the whole block is clipped to it
+		prefix := entry.prefix
+		if iprange.Covers(entry.prefix, blockPrefix) {
+			prefix = blockPrefix
+		}
+		addSegment(segmentReserved, prefix, entry.Name, "")
+	}
+
+	sort.SliceStable(m.Segments, func(i, j int) bool {
+		if kindOrder(m.Segments[i].Kind) != kindOrder(m.Segments[j].Kind) {
+			return kindOrder(m.Segments[i].Kind) < kindOrder(m.Segments[j].Kind)
+		}
+		return m.Segments[i].Start < m.Segments[j].Start
+	})
+
+	return m, nil
+}
+
+// kindOrder is the drawing order of segment kinds
+func kindOrder(kind string) int {
+	switch kind {
+	case segmentFree:
+		return 0
+	case segmentSubnet:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// regionColor returns the fill color of a region's subnets
+func (m *BlockMap) regionColor(region string) string {
+	for i, r := range m.Regions {
+		if r == region {
+			return mapPalette[i%len(mapPalette)]
+		}
+	}
+	return mapPalette[0]
+}
+
+// WriteBlockMap renders a block map as a self-contained SVG image or HTML page
+func WriteBlockMap(w io.Writer, m *BlockMap, format string) error {
+	switch format {
+	case "svg":
+		return writeMapSVG(w, m)
+	case "html":
+		return writeMapHTML(w, m)
+	default:
+		return fmt.Errorf("unsupported map format %q (use svg or html)", format)
+	}
+}
+
+// writeMapSVG draws the block as a proportional bar with a legend below it
+func writeMapSVG(w io.Writer, m *BlockMap) error {
+	legendRows := (len(m.Regions) + 2 + 3) / 4
+	height := mapLegendY + legendRows*24 + 10
+
+	ew := &errWriter{w: w}
+	ew.printf("<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\" font-family=\"sans-serif\" font-size=\"12\">\n",
+		mapWidth+20, height, mapWidth+20, height)
+	ew.printf("<defs><pattern id=\"reserved\" width=\"8\" height=\"8\" patternUnits=\"userSpaceOnUse\" patternTransform=\"rotate(45)\">"+
+		"<rect width=\"4\" height=\"8\" fill=\"%s\" fill-opacity=\"0.7\"/></pattern></defs>\n", mapReservedColor)
+
+	title := m.BlockCIDR
+	if m.Description != "" {
+		title += " - " + m.Description
+	}
+	ew.printf("<text x=\"10\" y=\"25\" font-size=\"16\" font-weight=\"bold\">%s</text>\n", html.EscapeString(title))
+	ew.printf("<rect x=\"10\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"%s\" stroke=\"#999999\"/>\n",
+		mapBarY, mapWidth, mapBarHeight, mapFreeColor)
+
+	for _, s := range m.Segments {
+		x := 10 + s.Start*mapWidth
+		width := s.Width * mapWidth
+		if width < 1 {
+			width = 1 // Keep tiny ranges visible
+		}
+
+		fill, stroke := mapFreeColor, "#bbbbbb"
+		switch s.Kind {
+		case segmentSubnet:
+			fill, stroke = m.regionColor(s.Region), "#ffffff"
+		case segmentReserved:
+			fill, stroke = "url(#reserved)", mapReservedColor
+		}
+
+		ew.printf("<rect x=\"%.2f\" y=\"%d\" width=\"%.2f\" height=\"%d\" fill=\"%s\" stroke=\"%s\"><title>%s</title></rect>\n",
+			x, mapBarY, width, mapBarHeight, fill, stroke, html.EscapeString(segmentTitle(s)))
+		if width >= mapLabelMin && s.Kind != segmentReserved {
+			ew.printf("<text x=\"%.2f\" y=\"%d\" text-anchor=\"middle\">%s</text>\n",
+				x+width/2, mapBarY+mapBarHeight/2+4, html.EscapeString(s.CIDR))
+		}
+	}
+
+	// Legend: one entry per region, then free and reserved space
+	type legendEntry struct{ label, fill string }
+	var legend []legendEntry
+	for _, region := range m.Regions {
+		label := region
+		if label == "" {
+			label = "(no region)"
+		}
+		legend = append(legend, legendEntry{label, m.regionColor(region)})
+	}
+	legend = append(legend, legendEntry{"free", mapFreeColor}, legendEntry{"reserved", "url(#reserved)"})
+	for i, e := range legend {
+		x := 10 + (i%4)*250
+		y := mapLegendY + (i/4)*24
+		ew.printf("<rect x=\"%d\" y=\"%d\" width=\"14\" height=\"14\" fill=\"%s\" stroke=\"#999999\"/>\n", x, y, e.fill)
+		ew.printf("<text x=\"%d\" y=\"%d\">%s</text>\n", x+20, y+12, html.EscapeString(e.label))
+	}
+
+	ew.printf("</svg>\n")
+	return ew.err
+}
+
+// writeMapHTML embeds the SVG map in a standalone page with a table of the segments
+func writeMapHTML(w io.Writer, m *BlockMap) error {
+	ew := &errWriter{w: w}
+	ew.printf("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>Block %s</title>\n", html.EscapeString(m.BlockCIDR))
+	ew.printf("<style>body{font-family:sans-serif;margin:20px}table{border-collapse:collapse}" +
+		"th,td{border:1px solid #cccccc;padding:4px 8px;text-align:left}th{background:#f5f5f5}</style>\n")
+	ew.printf("</head>\n<body>\n<h1>Block %s</h1>\n", html.EscapeString(m.BlockCIDR))
+	ew.printf("<p>Block file: %s</p>\n", html.EscapeString(m.FileKey))
+	if ew.err != nil {
+		return ew.err
+	}
+
+	if err := writeMapSVG(w, m); err != nil {
+		return err
+	}
+
+	ew.printf("<table>\n<tr><th>CIDR</th><th>Type</th><th>Name</th><th>Region</th><th>Addresses</th><th>%% of Block</th></tr>\n")
+	segments := make([]MapSegment, len(m.Segments))
+	copy(segments, m.Segments)
+	sort.SliceStable(segments, func(i, j int) bool { return segments[i].Start < segments[j].Start })
+	for _, s := range segments {
+		ew.printf("<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td><td>%.2f%%</td></tr>\n",
+			html.EscapeString(s.CIDR), s.Kind, html.EscapeString(s.Name), html.EscapeString(s.Region),
+			s.Addresses.String(), s.Width*100)
+	}
+	ew.printf("</table>\n</body>\n</html>\n")
+	return ew.err
+}
+
+// segmentTitle is the tooltip text of a map segment
+func segmentTitle(s MapSegment) string {
+	switch s.Kind {
+	case segmentSubnet:
+		title := s.CIDR
+		if s.Name != "" {
+			title += " " + s.Name
+		}
+		if s.Region != "" {
+			title += " (" + s.Region + ")"
+		}
+		return title
+	case segmentReserved:
+		return s.CIDR + " reserved: " + s.Name
+	default:
+		return s.CIDR + " free"
+	}
+}
+
+// errWriter keeps the first write error so that rendering code can write
+// unconditionally and check once at the end
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (e *errWriter) printf(format string, args ...interface{}) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = fmt.Fprintf(e.w, format, args...)
+}
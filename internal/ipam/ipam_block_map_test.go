@@ -0,0 +1,71 @@
+package ipam
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockMap(t *testing.T) {
+	blockFile := filepath.Join(t.TempDir(), "default.yaml")
+	yamlData, err := marshalBlocks([]Block{
+		{
+			CIDR:        "10.0.0.0/24",
+			Description: "Map <test>",
+			Subnets: []Subnet{
+				{CIDR: "10.0.0.0/26", Name: "web", Region: "us-east1"},
+				{CIDR: "10.0.0.128/26", Name: "db", Region: "eu-west1"},
+			},
+		},
+		{CIDR: "198.18.0.0/16"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, writeYAMLFile(blockFile, yamlData))
+	cfg := &config.Config{BlockFiles: map[string]string{"default": blockFile}}
+
+	m, err := BuildBlockMap(cfg, "10.0.0.0/24", "default")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"eu-west1", "us-east1"}, m.Regions)
+
+	// Free ranges are drawn first, then subnets, each by address
+	require.Len(t, m.Segments, 4)
+	assert.Equal(t, MapSegment{CIDR: "10.0.0.64/26", Kind: segmentFree, Addresses: m.Segments[0].Addresses, Start: 0.25, Width: 0.25}, m.Segments[0])
+	assert.Equal(t, "10.0.0.192/26", m.Segments[1].CIDR)
+	assert.Equal(t, "web", m.Segments[2].Name)
+	assert.Equal(t, 0.0, m.Segments[2].Start)
+	assert.Equal(t, "db", m.Segments[3].Name)
+	assert.Equal(t, 0.5, m.Segments[3].Start)
+	assert.Equal(t, "64", m.Segments[3].Addresses.String())
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteBlockMap(&buf, m, "svg"))
+	svg := buf.String()
+	assert.Contains(t, svg, "<svg xmlns=\"http://www.w3.org/2000/svg\"")
+	assert.Contains(t, svg, "10.0.0.0/24 - Map &lt;test&gt;")
+	assert.Contains(t, svg, "<title>10.0.0.128/26 db (eu-west1)</title>")
+	assert.Contains(t, svg, "fill=\""+mapPalette[0]+"\"")
+
+	buf.Reset()
+	require.NoError(t, WriteBlockMap(&buf, m, "html"))
+	page := buf.String()
+	assert.Contains(t, page, "<!DOCTYPE html>")
+	assert.Contains(t, page, "<svg")
+	assert.Contains(t, page, "<td>10.0.0.64/26</td><td>free</td>")
+
+	assert.Error(t, WriteBlockMap(&buf, m, "png"))
+
+	// Special-purpose ranges within a block are marked as reserved
+	m, err = BuildBlockMap(cfg, "198.18.0.0/16", "default")
+	require.NoError(t, err)
+	last := m.Segments[len(m.Segments)-1]
+	assert.Equal(t, segmentReserved, last.Kind)
+	assert.Equal(t, "198.18.0.0/16", last.CIDR)
+	assert.Equal(t, 1.0, last.Width)
+
+	_, err = BuildBlockMap(cfg, "10.1.0.0/24", "default")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -2,82 +2,87 @@ package ipam
 
 import (
 	"fmt"
-	"net"
+	"math/big"
 	"os"
 	"text/tabwriter"
 
 	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/iprange"
 )
 
-func ShowBlock(cfg *config.Config, cidr, fileKey string) error {
-	blockFile, ok := cfg.BlockFiles[fileKey]
-	if !ok {
-		return fmt.Errorf("block file for key %s not found", fileKey)
-	}
-
-	yamlData, err := readYAMLFile(blockFile)
-	if err != nil {
-		return fmt.Errorf("error reading YAML file: %w", err)
+// FindBlock returns a block of a block file with its utilization stats calculated
+func FindBlock(cfg *config.Config, cidr, fileKey string) (*Block, error) {
+	if _, ok := cfg.BlockFiles[fileKey]; !ok {
+		return nil, &NotFoundError{Kind: "block file", Name: fileKey}
 	}
 
-	blocks, err := unmarshalBlocks(yamlData)
+	blocks, err := loadBlocks(cfg, fileKey)
 	if err != nil {
-		return fmt.Errorf("error unmarshalling YAML data: %w", err)
+		return nil, fmt.Errorf("error reading blocks: %w", err)
 	}
 
 	for i, block := range blocks {
-		if block.CIDR == cidr {
-			// Calculate utilization stats
-			if block.Stats == nil {
-				// Calculate the stats
-				_, ipNet, _ := net.ParseCIDR(block.CIDR)
-				totalIPs := calculateIPCount(ipNet)
-
-				var allocatedIPs uint64 = 0
-				for _, subnet := range block.Subnets {
-					_, subnetNet, err := net.ParseCIDR(subnet.CIDR)
-					if err == nil {
-						allocatedIPs += calculateIPCount(subnetNet)
-					}
-				}
+		if cidrEqual(block.CIDR, cidr) {
+			// Calculate the stats over raw address space
+			blockPrefix, _ := iprange.ParsePrefix(block.CIDR)
+			totalIPs := iprange.Size(blockPrefix)
 
-				utilization := float64(0)
-				if totalIPs > 0 {
-					utilization = float64(allocatedIPs) / float64(totalIPs) * 100
-				}
-
-				blocks[i].Stats = &UtilizationStats{
-					TotalIPs:     totalIPs,
-					AllocatedIPs: allocatedIPs,
-					AvailableIPs: totalIPs - allocatedIPs,
-					Utilization:  utilization,
+			allocatedIPs := new(big.Int)
+			for _, subnet := range block.Subnets {
+				subnetPrefix, err := iprange.ParsePrefix(subnet.CIDR)
+				if err == nil {
+					allocatedIPs.Add(allocatedIPs, iprange.Size(subnetPrefix))
 				}
 			}
 
-			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-			fmt.Fprintln(w, "Block CIDR\tDescription")
-			fmt.Fprintln(w, block.CIDR+"\t"+block.Description)
-
-			// Display utilization
-			if block.Stats != nil {
-				fmt.Fprintln(w, "\nUtilization:")
-				fmt.Fprintf(w, "Total IPs:\t%d\n", block.Stats.TotalIPs)
-				fmt.Fprintf(w, "Allocated IPs:\t%d\n", block.Stats.AllocatedIPs)
-				fmt.Fprintf(w, "Available IPs:\t%d\n", block.Stats.AvailableIPs)
-				fmt.Fprintf(w, "Utilization:\t%.2f%%\n", block.Stats.Utilization)
+			availableIPs := new(big.Int).Sub(totalIPs, allocatedIPs)
+			if availableIPs.Sign() < 0 {
+				availableIPs.SetInt64(0)
 			}
 
-			fmt.Fprintln(w, "\nSubnets:")
-			fmt.Fprintln(w, "Subnet CIDR\tName\tRegion")
-			for _, subnet := range block.Subnets {
-				fmt.Fprintln(w, subnet.CIDR+"\t"+subnet.Name+"\t"+subnet.Region)
-			}
-			if err := w.Flush(); err != nil {
-				return fmt.Errorf("error flushing writer: %w", err)
+			blocks[i].Stats = &UtilizationStats{
+				TotalIPs:     totalIPs,
+				AllocatedIPs: allocatedIPs,
+				AvailableIPs: availableIPs,
+				Utilization:  utilizationRatio(allocatedIPs, totalIPs) * 100,
 			}
-			return nil
+			return &blocks[i], nil
 		}
 	}
 
-	return fmt.Errorf("block with CIDR %s not found", cidr)
+	return nil, &NotFoundError{Kind: "block", Name: cidr}
+}
+
+func ShowBlock(cfg *config.Config, cidr, fileKey string) error {
+	block, err := FindBlock(cfg, cidr, fileKey)
+	if err != nil {
+		return err
+	}
+	return PrintBlock(block)
+}
+
+// PrintBlock prints the details, utilization and subnets of a block
+func PrintBlock(block *Block) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Block CIDR\tDescription")
+	fmt.Fprintln(w, block.CIDR+"\t"+block.Description)
+
+	// Display utilization
+	if block.Stats != nil {
+		fmt.Fprintln(w, "\nUtilization:")
+		fmt.Fprintf(w, "Total IPs:\t%d\n", block.Stats.TotalIPs)
+		fmt.Fprintf(w, "Allocated IPs:\t%d\n", block.Stats.AllocatedIPs)
+		fmt.Fprintf(w, "Available IPs:\t%d\n", block.Stats.AvailableIPs)
+		fmt.Fprintf(w, "Utilization:\t%.2f%%\n", block.Stats.Utilization)
+	}
+
+	fmt.Fprintln(w, "\nSubnets:")
+	fmt.Fprintln(w, "Subnet CIDR\tName\tRegion")
+	for _, subnet := range block.Subnets {
+		fmt.Fprintln(w, subnet.CIDR+"\t"+subnet.Name+"\t"+subnet.Region)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error flushing writer: %w", err)
+	}
+	return nil
 }
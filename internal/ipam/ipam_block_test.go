@@ -1,10 +1,10 @@
 package ipam
 
 import (
-	"net"
 	"testing"
 
 	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/iprange"
 )
 
 func TestPartialOverlap(t *testing.T) {
@@ -43,26 +43,26 @@ func TestPartialOverlap(t *testing.T) {
 	
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			_, cidr1, err := net.ParseCIDR(tc.cidr1)
+			cidr1, err := iprange.ParsePrefix(tc.cidr1)
 			if err != nil {
 				t.Fatalf("Failed to parse CIDR1 %s: %v", tc.cidr1, err)
 			}
 	
-			_, cidr2, err := net.ParseCIDR(tc.cidr2)
+			cidr2, err := iprange.ParsePrefix(tc.cidr2)
 			if err != nil {
 				t.Fatalf("Failed to parse CIDR2 %s: %v", tc.cidr2, err)
 			}
 	
-			overlaps := checkCIDROverlap(cidr1, cidr2)
+			overlaps := cidr1.Overlaps(cidr2)
 			
 			if overlaps != tc.shouldOverlap {
 				t.Errorf("Expected overlap=%v, got %v", tc.shouldOverlap, overlaps)
 				
 				// Debug info
-				cidr1Start := cidr1.IP
-				cidr1End := lastIP(cidr1)
-				cidr2Start := cidr2.IP
-				cidr2End := lastIP(cidr2)
+				cidr1Start := cidr1.Addr()
+				cidr1End := iprange.Last(cidr1)
+				cidr2Start := cidr2.Addr()
+				cidr2End := iprange.Last(cidr2)
 	
 				t.Logf("CIDR1 range: %s - %s", cidr1Start, cidr1End)
 				t.Logf("CIDR2 range: %s - %s", cidr2Start, cidr2End)
@@ -95,7 +95,7 @@ func TestBlockDeletion(t *testing.T) {
 	}
 
 	// Add a block
-	err = AddBlock(cfg, "10.0.0.0/8", "test block", "default")
+	_, err = AddBlock(cfg, "10.0.0.0/8", "test block", "", "default", false)
 	if err != nil {
 		t.Fatalf("Failed to add test block: %v", err)
 	}
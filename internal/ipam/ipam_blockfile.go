@@ -0,0 +1,227 @@
+package ipam
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/logger"
+)
+
+// BlockFileInfo summarizes a block file key of the configuration
+type BlockFileInfo struct {
+	Key      string `json:"key"`
+	Path     string `json:"path"`
+	Blocks   int    `json:"blocks"`
+	Subnets  int    `json:"subnets"`
+	Patterns int    `json:"patterns"`
+	Policies int    `json:"policies"`
+	// Error is set when the blocks of the key could not be loaded
+	Error string `json:"error,omitempty"`
+}
+
+// ListBlockFiles returns the block file keys of the configuration sorted by
+// key. A block file that cannot be loaded is listed with its error.
+func ListBlockFiles(cfg *config.Config) []BlockFileInfo {
+	var infos []BlockFileInfo
+	for _, fileKey := range SortedFileKeys(cfg) {
+		info := BlockFileInfo{
+			Key:      fileKey,
+			Path:     cfg.BlockFiles[fileKey],
+			Patterns: len(cfg.Patterns[fileKey]),
+			Policies: len(cfg.Policies[fileKey]),
+		}
+		blocks, err := loadBlocks(cfg, fileKey)
+		if err != nil {
+			info.Error = err.Error()
+		}
+		info.Blocks = len(blocks)
+		for _, block := range blocks {
+			info.Subnets += len(block.Subnets)
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// PrintBlockFiles prints the block file keys returned by ListBlockFiles
+func PrintBlockFiles(infos []BlockFileInfo) error {
+	if len(infos) == 0 {
+		fmt.Println("No block files configured.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Key\tBlocks\tSubnets\tPatterns\tPath")
+	fmt.Fprintln(w, "---\t------\t-------\t--------\t----")
+	for _, info := range infos {
+		path := info.Path
+		if info.Error != "" {
+			path += " (error: " + info.Error + ")"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\n", info.Key, info.Blocks, info.Subnets, info.Patterns, path)
+	}
+	return w.Flush()
+}
+
+// AddBlockFile adds a block file key to the configuration and returns the path
+// of its block file, blocks/<key>.yaml next to the configuration file. The
+// empty block file is created unless it already exists; in a bucket it is
+// created on first write.
+func AddBlockFile(cfg *config.Config, fileKey string) (string, error) {
+	if _, exists := cfg.BlockFiles[fileKey]; exists {
+		return "", fmt.Errorf("block file with name '%s' already exists", fileKey)
+	}
+
+	blockFile := filepath.Join(filepath.Dir(cfg.ConfigFile), "blocks", fileKey+".yaml")
+	if cfg.Storage.Backend == BackendS3 {
+		blockFile = "blocks/" + fileKey + ".yaml"
+	} else {
+		if err := os.MkdirAll(filepath.Dir(blockFile), 0750); err != nil {
+			return "", fmt.Errorf("error creating blocks directory: %w", err)
+		}
+		if _, err := os.Stat(blockFile); os.IsNotExist(err) {
+			if err := os.WriteFile(blockFile, []byte("[]"), 0600); err != nil {
+				return "", fmt.Errorf("error creating block file: %w", err)
+			}
+		}
+	}
+
+	if cfg.BlockFiles == nil {
+		cfg.BlockFiles = make(map[string]string)
+	}
+	cfg.BlockFiles[fileKey] = blockFile
+	logger.Debug("Added block file %s (%s)", fileKey, blockFile)
+	return blockFile, nil
+}
+
+// RemoveBlockFile removes a block file key from the configuration. It refuses
+// when patterns or policies of the key would be orphaned, unless force is set,
+// in which case they are removed too. The blocks themselves are kept: the block
+// file stays on disk or in the bucket and the rows stay in the database.
+func RemoveBlockFile(cfg *config.Config, fileKey string, force bool) error {
+	if _, ok := cfg.BlockFiles[fileKey]; !ok {
+		return &NotFoundError{Kind: "block file", Name: fileKey}
+	}
+
+	patterns, policies := len(cfg.Patterns[fileKey]), len(cfg.Policies[fileKey])
+	if (patterns > 0 || policies > 0) && !force {
+		return fmt.Errorf("block file %s is referenced by %d patterns and %d policies, use --force to remove them too", fileKey, patterns, policies)
+	}
+
+	delete(cfg.BlockFiles, fileKey)
+	delete(cfg.Patterns, fileKey)
+	delete(cfg.Policies, fileKey)
+	logger.Debug("Removed block file %s with %d patterns and %d policies", fileKey, patterns, policies)
+	return nil
+}
+
+// RenameBlockFile renames a block file key, moving its patterns and policies
+// to the new key. With the YAML backend a block file named after the old key,
+// such as blocks/<old>.yaml, is renamed to match the new key; with the SQLite
+// backend the stored blocks are moved to the new key. Objects in a bucket keep
+// their key. save is called to write the renamed configuration; if it fails,
+// the block file and the configuration are moved back. It returns the previous
+// path of a renamed block file, or an empty string when the path is unchanged.
+func RenameBlockFile(cfg *config.Config, oldKey, newKey string, save func(*config.Config) error) (string, error) {
+	oldPath, ok := cfg.BlockFiles[oldKey]
+	if !ok {
+		return "", &NotFoundError{Kind: "block file", Name: oldKey}
+	}
+	if _, exists := cfg.BlockFiles[newKey]; exists {
+		return "", fmt.Errorf("block file with name '%s' already exists", newKey)
+	}
+
+	newPath, err := moveBlockFile(cfg, oldKey, newKey, oldPath)
+	if err != nil {
+		return "", err
+	}
+	renameConfigKey(cfg, oldKey, newKey, newPath)
+
+	if err := save(cfg); err != nil {
+		renameConfigKey(cfg, newKey, oldKey, oldPath)
+		if _, undoErr := moveBlockFile(cfg, newKey, oldKey, newPath); undoErr != nil {
+			return "", fmt.Errorf("%w; moving the block file back also failed: %v", err, undoErr)
+		}
+		return "", err
+	}
+
+	logger.Debug("Renamed block file %s to %s (%s)", oldKey, newKey, newPath)
+	if newPath == oldPath {
+		return "", nil
+	}
+	return oldPath, nil
+}
+
+// moveBlockFile moves the stored blocks of a block file key at path to another
+// key and returns their new path: a YAML block file named after the key is
+// renamed, and SQLite rows are moved to the new key
+func moveBlockFile(cfg *config.Config, fromKey, toKey, path string) (string, error) {
+	switch cfg.Storage.Backend {
+	case "", BackendYAML:
+		ext := filepath.Ext(path)
+		if filepath.Base(path) != fromKey+ext {
+			return path, nil
+		}
+		newPath := filepath.Join(filepath.Dir(path), toKey+ext)
+		if _, err := os.Stat(newPath); err == nil {
+			return "", fmt.Errorf("cannot rename block file %s: %s already exists", path, newPath)
+		}
+		if err := os.Rename(path, newPath); err != nil {
+			return "", fmt.Errorf("error renaming block file: %w", err)
+		}
+		return newPath, nil
+	case BackendSQLite:
+		backend, err := openSQLiteBackend(cfg)
+		if err != nil {
+			return "", err
+		}
+		return path, backend.renameFileKey(fromKey, toKey)
+	}
+	return path, nil
+}
+
+// renameConfigKey moves a block file key of the configuration, with its
+// patterns and policies, to another key mapped to path
+func renameConfigKey(cfg *config.Config, fromKey, toKey, path string) {
+	delete(cfg.BlockFiles, fromKey)
+	cfg.BlockFiles[toKey] = path
+	if patterns, ok := cfg.Patterns[fromKey]; ok {
+		delete(cfg.Patterns, fromKey)
+		cfg.Patterns[toKey] = patterns
+	}
+	if policies, ok := cfg.Policies[fromKey]; ok {
+		delete(cfg.Policies, fromKey)
+		cfg.Policies[toKey] = policies
+	}
+}
+
+// renameFileKey moves the stored blocks and subnets of a block file key to another key
+func (b *sqliteBackend) renameFileKey(oldKey, newKey string) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op after Commit
+
+	var count int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM blocks WHERE file_key = ?`, newKey).Scan(&count); err != nil {
+		return fmt.Errorf("error renaming blocks of %s: %w", oldKey, err)
+	}
+	if count > 0 {
+		return fmt.Errorf("the database already holds blocks for block file %s", newKey)
+	}
+
+	if _, err := tx.Exec(`UPDATE blocks SET file_key = ? WHERE file_key = ?`, newKey, oldKey); err != nil {
+		return fmt.Errorf("error renaming blocks of %s: %w", oldKey, err)
+	}
+	if _, err := tx.Exec(`UPDATE subnets SET file_key = ? WHERE file_key = ?`, newKey, oldKey); err != nil {
+		return fmt.Errorf("error renaming subnets of %s: %w", oldKey, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package ipam
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListBlockFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	dev := filepath.Join(tempDir, "dev.yaml")
+	require.NoError(t, os.WriteFile(dev, []byte(`- cidr: 10.0.0.0/16
+  description: Development
+  subnets:
+  - cidr: 10.0.1.0/24
+    name: app
+    region: us-east1
+  - cidr: 10.0.2.0/24
+    name: db
+    region: us-east1
+`), 0644))
+	cfg := &config.Config{
+		BlockFiles: map[string]string{"dev": dev, "missing": filepath.Join(tempDir, "missing.yaml")},
+		Patterns:   map[string]map[string]config.Pattern{"dev": {"web": {CIDRSize: 24, Block: "10.0.0.0/16"}}},
+	}
+
+	infos := ListBlockFiles(cfg)
+	require.Len(t, infos, 2)
+	assert.Equal(t, BlockFileInfo{Key: "dev", Path: dev, Blocks: 1, Subnets: 2, Patterns: 1}, infos[0])
+	assert.Equal(t, "missing", infos[1].Key)
+	assert.NotEmpty(t, infos[1].Error)
+}
+
+func TestAddBlockFile(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := &config.Config{
+		BlockFiles: map[string]string{"default": filepath.Join(tempDir, "default.yaml")},
+		ConfigFile: filepath.Join(tempDir, "ipam-config.yaml"),
+	}
+
+	blockFile, err := AddBlockFile(cfg, "prod")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(tempDir, "blocks", "prod.yaml"), blockFile)
+	assert.Equal(t, blockFile, cfg.BlockFiles["prod"])
+	blocks, err := loadBlocks(cfg, "prod")
+	require.NoError(t, err)
+	assert.Empty(t, blocks)
+
+	_, err = AddBlockFile(cfg, "prod")
+	assert.ErrorContains(t, err, "already exists")
+
+	// Block files in a bucket are created on first write
+	cfg.Storage.Backend = BackendS3
+	blockFile, err = AddBlockFile(cfg, "staging")
+	require.NoError(t, err)
+	assert.Equal(t, "blocks/staging.yaml", blockFile)
+	assert.NoFileExists(t, filepath.Join(tempDir, "blocks", "staging.yaml"))
+}
+
+func TestRemoveBlockFile(t *testing.T) {
+	tempDir := t.TempDir()
+	dev := filepath.Join(tempDir, "dev.yaml")
+	require.NoError(t, os.WriteFile(dev, []byte("[]"), 0644))
+	cfg := &config.Config{
+		BlockFiles: map[string]string{"dev": dev, "prod": filepath.Join(tempDir, "prod.yaml")},
+		Patterns:   map[string]map[string]config.Pattern{"dev": {"web": {CIDRSize: 24}}},
+		Policies:   map[string][]config.Policy{"dev": {{Name: "naming"}}},
+	}
+
+	var notFound *NotFoundError
+	assert.ErrorAs(t, RemoveBlockFile(cfg, "test", false), &notFound)
+
+	// Patterns and policies would be orphaned
+	assert.ErrorContains(t, RemoveBlockFile(cfg, "dev", false), "referenced by 1 patterns and 1 policies")
+	assert.Contains(t, cfg.BlockFiles, "dev")
+
+	require.NoError(t, RemoveBlockFile(cfg, "dev", true))
+	assert.NotContains(t, cfg.BlockFiles, "dev")
+	assert.NotContains(t, cfg.Patterns, "dev")
+	assert.NotContains(t, cfg.Policies, "dev")
+	assert.FileExists(t, dev)
+
+	require.NoError(t, RemoveBlockFile(cfg, "prod", false))
+	assert.Empty(t, cfg.BlockFiles)
+}
+
+func TestRenameBlockFile(t *testing.T) {
+	tempDir := t.TempDir()
+	dev := filepath.Join(tempDir, "blocks", "dev.yaml")
+	custom := filepath.Join(tempDir, "custom-name.yaml")
+	require.NoError(t, os.MkdirAll(filepath.Dir(dev), 0755))
+	require.NoError(t, os.WriteFile(dev, []byte("- cidr: 10.0.0.0/16\n  description: Development\n"), 0644))
+	require.NoError(t, os.WriteFile(custom, []byte("[]"), 0644))
+	cfg := &config.Config{
+		BlockFiles: map[string]string{"dev": dev, "prod": custom},
+		Patterns:   map[string]map[string]config.Pattern{"dev": {"web": {CIDRSize: 24, Block: "10.0.0.0/16"}}},
+		Policies:   map[string][]config.Policy{"dev": {{Name: "naming"}}},
+	}
+
+	_, err := RenameBlockFile(cfg, "dev", "prod", saveNothing)
+	assert.ErrorContains(t, err, "already exists")
+
+	// A block file named after its key follows the key
+	oldPath, err := RenameBlockFile(cfg, "dev", "development", saveNothing)
+	require.NoError(t, err)
+	assert.Equal(t, dev, oldPath)
+	renamed := filepath.Join(tempDir, "blocks", "development.yaml")
+	assert.Equal(t, map[string]string{"development": renamed, "prod": custom}, cfg.BlockFiles)
+	assert.NoFileExists(t, dev)
+	assert.Contains(t, cfg.Patterns["development"], "web")
+	assert.Len(t, cfg.Policies["development"], 1)
+	assert.NotContains(t, cfg.Patterns, "dev")
+
+	blocks, err := loadBlocks(cfg, "development")
+	require.NoError(t, err)
+	assert.Len(t, blocks, 1)
+
+	// Other block files keep their path
+	oldPath, err = RenameBlockFile(cfg, "prod", "production", saveNothing)
+	require.NoError(t, err)
+	assert.Empty(t, oldPath)
+	assert.Equal(t, custom, cfg.BlockFiles["production"])
+}
+
+func TestRenameBlockFileSaveFails(t *testing.T) {
+	tempDir := t.TempDir()
+	dev := filepath.Join(tempDir, "blocks", "dev.yaml")
+	require.NoError(t, os.MkdirAll(filepath.Dir(dev), 0755))
+	require.NoError(t, os.WriteFile(dev, []byte("- cidr: 10.0.0.0/16\n"), 0644))
+	cfg := &config.Config{
+		BlockFiles: map[string]string{"dev": dev},
+		Patterns:   map[string]map[string]config.Pattern{"dev": {"web": {CIDRSize: 24, Block: "10.0.0.0/16"}}},
+	}
+
+	// The block file is moved back when the configuration cannot be written
+	_, err := RenameBlockFile(cfg, "dev", "development", func(*config.Config) error {
+		return errors.New("disk full")
+	})
+	assert.ErrorContains(t, err, "disk full")
+	assert.FileExists(t, dev)
+	assert.NoFileExists(t, filepath.Join(tempDir, "blocks", "development.yaml"))
+	assert.Equal(t, map[string]string{"dev": dev}, cfg.BlockFiles)
+	assert.Contains(t, cfg.Patterns["dev"], "web")
+	assert.NotContains(t, cfg.Patterns, "development")
+}
+
+// saveNothing stands in for writing the configuration
+func saveNothing(*config.Config) error {
+	return nil
+}
+
+func TestRenameBlockFileSQLite(t *testing.T) {
+	_, cfg := newSQLiteConfig(t, map[string][]Block{
+		"dev":  {{CIDR: "10.0.0.0/16", Subnets: []Subnet{{CIDR: "10.0.1.0/24", Name: "app"}}}},
+		"prod": {{CIDR: "10.1.0.0/16"}},
+	})
+
+	_, err := RenameBlockFile(cfg, "dev", "development", saveNothing)
+	require.NoError(t, err)
+
+	blocks, err := loadBlocks(cfg, "development")
+	require.NoError(t, err)
+	require.Len(t, blocks, 1)
+	assert.Equal(t, "10.0.1.0/24", blocks[0].Subnets[0].CIDR)
+
+	entry, err := FindSubnet(cfg, "10.0.1.0/24")
+	require.NoError(t, err)
+	assert.Equal(t, "development", entry.FileKey)
+}
+
+func TestCommitMove(t *testing.T) {
+	cfg := newGitRepo(t)
+	repo := filepath.Dir(cfg.ConfigFile)
+	require.NoError(t, CommitChange(cfg, "ipam: initial", "default"))
+
+	oldPath, err := RenameBlockFile(cfg, "default", "main", config.WriteConfig)
+	require.NoError(t, err)
+	require.NoError(t, CommitMove(cfg, "ipam: rename block file default to main", oldPath, "main"))
+
+	out, err := runGit(repo, "status", "--porcelain")
+	require.NoError(t, err)
+	assert.Empty(t, strings.TrimSpace(out))
+	out, err = runGit(repo, "ls-files")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"blocks/main.yaml", "ipam-config.yaml"}, strings.Fields(out))
+}
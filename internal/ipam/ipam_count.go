@@ -0,0 +1,76 @@
+package ipam
+
+import (
+	"math/big"
+	"net/netip"
+	"strings"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/iprange"
+)
+
+// defaultReservedAddresses are the addresses cloud providers reserve in every
+// subnet, overridable with reserved_addresses in the configuration
+var defaultReservedAddresses = map[string]int{
+	"aws":   5, // network, VPC router, DNS, future use, broadcast
+	"azure": 5, // network, default gateway, 2x DNS, broadcast
+	"gcp":   4, // network, default gateway, second-to-last, broadcast
+}
+
+// reservedAddresses returns the number of addresses a provider reserves per
+// subnet, and whether the provider is known
+func reservedAddresses(cfg *config.Config, provider string) (int, bool) {
+	provider = strings.ToLower(provider)
+	if cfg != nil {
+		if reserved, ok := cfg.ReservedAddresses[provider]; ok {
+			return reserved, true
+		}
+	}
+	reserved, ok := defaultReservedAddresses[provider]
+	return reserved, ok
+}
+
+// ReservedAddressesByProvider returns the addresses each known provider
+// reserves per subnet: the built-in providers and those of the configuration
+func ReservedAddressesByProvider(cfg *config.Config) map[string]int {
+	providers := make(map[string]int, len(defaultReservedAddresses)+len(cfg.ReservedAddresses))
+	for provider, reserved := range defaultReservedAddresses {
+		providers[provider] = reserved
+	}
+	for provider, reserved := range cfg.ReservedAddresses {
+		providers[strings.ToLower(provider)] = reserved
+	}
+	return providers
+}
+
+// usableHosts returns the number of assignable host addresses of a subnet.
+// For a known provider its reserved addresses are subtracted. Otherwise IPv4
+// subnets lose their network and broadcast addresses, except /31 point-to-point
+// links (RFC 3021) and /32 host routes which use every address, and IPv6
+// subnets, which have no broadcast address, use every address.
+func usableHosts(cfg *config.Config, prefix netip.Prefix, provider string) *big.Int {
+	count := iprange.Size(prefix)
+	ones, bits := prefix.Bits(), prefix.Addr().BitLen()
+
+	reserved := 0
+	if r, ok := reservedAddresses(cfg, provider); ok && provider != "" {
+		reserved = r
+	} else if bits == 32 && ones < 31 {
+		reserved = 2
+	}
+
+	count.Sub(count, big.NewInt(int64(reserved)))
+	if count.Sign() < 0 {
+		count.SetInt64(0)
+	}
+	return count
+}
+
+// utilizationRatio returns allocated / total as a float
+func utilizationRatio(allocated, total *big.Int) float64 {
+	if total.Sign() == 0 {
+		return 0
+	}
+	ratio, _ := new(big.Rat).SetFrac(allocated, total).Float64()
+	return ratio
+}
@@ -0,0 +1,112 @@
+package ipam
+
+import (
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/iprange"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddressCounts(t *testing.T) {
+	cfg := &config.Config{ReservedAddresses: map[string]int{"onprem": 3, "gcp": 6}}
+
+	testCases := []struct {
+		cidr      string
+		provider  string
+		addresses string
+		usable    string
+	}{
+		{cidr: "10.0.0.0/24", addresses: "256", usable: "254"},
+		{cidr: "10.0.0.0/30", addresses: "4", usable: "2"},
+		{cidr: "10.0.0.0/31", addresses: "2", usable: "2"},
+		{cidr: "10.0.0.1/32", addresses: "1", usable: "1"},
+		{cidr: "10.0.0.0/24", provider: "aws", addresses: "256", usable: "251"},
+		{cidr: "10.0.0.0/24", provider: "Azure", addresses: "256", usable: "251"},
+		{cidr: "10.0.0.0/24", provider: "gcp", addresses: "256", usable: "250"},
+		{cidr: "10.0.0.0/24", provider: "onprem", addresses: "256", usable: "253"},
+		{cidr: "10.0.0.0/24", provider: "unknown", addresses: "256", usable: "254"},
+		{cidr: "10.0.0.0/30", provider: "aws", addresses: "4", usable: "0"},
+		{cidr: "2001:db8::/64", addresses: "18446744073709551616", usable: "18446744073709551616"},
+		{cidr: "2001:db8::/32", addresses: "79228162514264337593543950336", usable: "79228162514264337593543950336"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.cidr+"/"+tc.provider, func(t *testing.T) {
+			prefix, err := iprange.ParsePrefix(tc.cidr)
+			require.NoError(t, err)
+			assert.Equal(t, tc.addresses, iprange.Size(prefix).String())
+			assert.Equal(t, tc.usable, usableHosts(cfg, prefix, tc.provider).String())
+		})
+	}
+}
+
+func TestBlockUtilizationRawAddressSpace(t *testing.T) {
+	blockFile := filepath.Join(t.TempDir(), "default.yaml")
+	yamlData, err := marshalBlocks([]Block{
+		{
+			CIDR:     "10.0.0.0/24",
+			Provider: "aws",
+			Subnets: []Subnet{
+				{CIDR: "10.0.0.0/25", Name: "a"},
+				{CIDR: "10.0.0.128/25", Name: "b"},
+			},
+		},
+		{
+			CIDR:    "2001:db8::/48",
+			Subnets: []Subnet{{CIDR: "2001:db8::/64", Name: "v6"}},
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, writeYAMLFile(blockFile, yamlData))
+	cfg := &config.Config{BlockFiles: map[string]string{"default": blockFile}}
+
+	// A block fully covered by its subnets is 100% utilized
+	report, err := CalculateBlockUtilization(cfg, "10.0.0.0/24", "default")
+	require.NoError(t, err)
+	assert.Equal(t, "aws", report.Provider)
+	assert.Equal(t, big.NewInt(256), report.TotalIPs)
+	assert.Equal(t, big.NewInt(256), report.AllocatedIPs)
+	assert.Zero(t, report.AvailableIPs.Sign())
+	assert.Equal(t, big.NewInt(246), report.UsableHosts)
+	assert.Equal(t, 1.0, report.UtilizationRatio)
+	require.Len(t, report.Subnets, 2)
+	assert.Equal(t, big.NewInt(123), report.Subnets[0].UsableHosts)
+	assert.Equal(t, 0.5, report.Subnets[0].BlockShare)
+
+	block, err := FindBlock(cfg, "10.0.0.0/24", "default")
+	require.NoError(t, err)
+	assert.Equal(t, 100.0, block.Stats.Utilization)
+
+	// IPv6 counts exceed 64 bits
+	report, err = CalculateBlockUtilization(cfg, "2001:db8::/48", "default")
+	require.NoError(t, err)
+	assert.Equal(t, new(big.Int).Lsh(big.NewInt(1), 80).String(), report.TotalIPs.String())
+	assert.Equal(t, new(big.Int).Lsh(big.NewInt(1), 64).String(), report.AllocatedIPs.String())
+	assert.InDelta(t, 1.0/65536, report.UtilizationRatio, 1e-12)
+}
+
+func TestAddBlockProvider(t *testing.T) {
+	blockFile := filepath.Join(t.TempDir(), "default.yaml")
+	require.NoError(t, writeYAMLFile(blockFile, []byte("[]")))
+	cfg := &config.Config{
+		BlockFiles:        map[string]string{"default": blockFile},
+		ReservedAddresses: map[string]int{"onprem": 3},
+	}
+
+	// Providers are stored in lower case, as they are looked up
+	_, err := AddBlock(cfg, "10.0.0.0/24", "cloud", " AWS ", "default", false)
+	require.NoError(t, err)
+	_, err = CreateSubnet(cfg, "10.0.0.0/24", "10.0.0.0/25", "app", "us-east1")
+	require.NoError(t, err)
+
+	report, err := CalculateBlockUtilization(cfg, "10.0.0.0/24", "default")
+	require.NoError(t, err)
+	assert.Equal(t, "aws", report.Provider)
+	assert.Equal(t, big.NewInt(123), report.UsableHosts)
+
+	assert.Equal(t, map[string]int{"aws": 5, "azure": 5, "gcp": 4, "onprem": 3}, ReservedAddressesByProvider(cfg))
+}
@@ -0,0 +1,293 @@
+package ipam
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/iprange"
+	"github.com/lugnut42/openipam/internal/logger"
+)
+
+// DefragMove moves a subnet to a new CIDR
+type DefragMove struct {
+	Name string
+	From string
+	To   string
+
+	// Safe is set when the subnet is flagged as renumberable
+	Safe bool
+}
+
+// DefragPlan is a set of subnet moves that consolidates the free space of a block
+type DefragPlan struct {
+	BlockCIDR string
+	FileKey   string
+	Moves     []DefragMove
+
+	// Pinned lists the subnets the plan keeps in place
+	Pinned []string
+
+	LargestFreeBefore string
+	LargestFreeAfter  string
+}
+
+// placement is a subnet range as an offset from the start of its block
+type placement struct {
+	start *big.Int
+	end   *big.Int // exclusive
+}
+
+func (p placement) overlaps(o placement) bool {
+	return p.start.Cmp(o.end) < 0 && o.start.Cmp(p.end) < 0
+}
+
+// PlanDefrag computes a compaction plan for a block. Subnets are repacked
+// largest first at the lowest free aligned address, which moves all free space
+// to the end of the block. With pinRigid, subnets that are not flagged as
+// renumberable keep their CIDR and are packed around; otherwise every subnet
+// may move and each move records whether it is safe. The plan is empty when
+// repacking would not enlarge the largest free range.
+func PlanDefrag(cfg *config.Config, blockCIDR, fileKey string, pinRigid bool) (*DefragPlan, error) {
+	block, err := FindBlock(cfg, blockCIDR, fileKey)
+	if err != nil {
+		return nil, err
+	}
+
+	blockPrefix, err := iprange.ParsePrefix(block.CIDR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR format: %w", err)
+	}
+	bits := blockPrefix.Addr().BitLen()
+	blockEnd := iprange.Size(blockPrefix)
+
+	plan := &DefragPlan{
+		BlockCIDR:         block.CIDR,
+		FileKey:           fileKey,
+		LargestFreeBefore: largestFreeRange(calculateAvailableCIDRs(block)),
+	}
+
+	type movable struct {
+		subnet Subnet
+		ones   int
+		start  *big.Int
+	}
+
+	var occupied []placement
+	var toPlace []movable
+	for _, subnet := range block.Subnets {
+		subnetPrefix, err := iprange.ParsePrefix(subnet.CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subnet CIDR %s: %w", subnet.CIDR, err)
+		}
+		ones := subnetPrefix.Bits()
+		start := iprange.Offset(blockPrefix.Addr(), subnetPrefix.Addr())
+
+		if pinRigid && !subnet.Renumberable {
+			size := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+			occupied = append(occupied, placement{start: start, end: new(big.Int).Add(start, size)})
+			plan.Pinned = append(plan.Pinned, subnet.CIDR)
+			continue
+		}
+		toPlace = append(toPlace, movable{subnet: subnet, ones: ones, start: start})
+	}
+
+	// Largest subnets first; equal sizes keep their current order
+	sort.SliceStable(toPlace, func(i, j int) bool {
+		if toPlace[i].ones != toPlace[j].ones {
+			return toPlace[i].ones < toPlace[j].ones
+		}
+		return toPlace[i].start.Cmp(toPlace[j].start) < 0
+	})
+
+	after := *block
+	after.Subnets = nil
+	for _, cidr := range plan.Pinned {
+		after.Subnets = append(after.Subnets, Subnet{CIDR: cidr})
+	}
+
+	var moves []DefragMove
+	for _, m := range toPlace {
+		size := new(big.Int).Lsh(big.NewInt(1), uint(bits-m.ones))
+		start := firstFreeSlot(occupied, size, blockEnd)
+		if start == nil {
+			// Aligned power-of-two ranges packed largest first always fit where
+			// they fit before, so this only happens for overlapping input
+			return nil, fmt.Errorf("no slot found for subnet %s while planning", m.subnet.CIDR)
+		}
+		occupied = append(occupied, placement{start: start, end: new(big.Int).Add(start, size)})
+
+		addr, _ := iprange.Add(blockPrefix.Addr(), start)
+		newCIDR := netip.PrefixFrom(addr, m.ones).String()
+		after.Subnets = append(after.Subnets, Subnet{CIDR: newCIDR})
+
+		if !cidrEqual(newCIDR, m.subnet.CIDR) {
+			moves = append(moves, DefragMove{Name: m.subnet.Name, From: m.subnet.CIDR, To: newCIDR, Safe: m.subnet.Renumberable})
+		}
+	}
+
+	plan.LargestFreeAfter = largestFreeRange(calculateAvailableCIDRs(&after))
+	if !freeRangeLarger(plan.LargestFreeAfter, plan.LargestFreeBefore) {
+		logger.Debug("Defrag plan for %s does not enlarge the largest free range, dropping %d moves", block.CIDR, len(moves))
+		plan.LargestFreeAfter = plan.LargestFreeBefore
+		return plan, nil
+	}
+
+	plan.Moves = moves
+	return plan, nil
+}
+
+// firstFreeSlot returns the lowest offset aligned to size at which a range of
+// size fits without overlapping an occupied range, or nil if there is none.
+// Candidates are the block start and the aligned ends of the occupied ranges.
+func firstFreeSlot(occupied []placement, size, blockEnd *big.Int) *big.Int {
+	candidates := []*big.Int{big.NewInt(0)}
+	for _, o := range occupied {
+		// Round the end of the range up to the next multiple of size
+		aligned := new(big.Int).Add(o.end, new(big.Int).Sub(size, big.NewInt(1)))
+		aligned.Div(aligned, size)
+		aligned.Mul(aligned, size)
+		candidates = append(candidates, aligned)
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Cmp(candidates[j]) < 0 })
+
+	for _, start := range candidates {
+		slot := placement{start: start, end: new(big.Int).Add(start, size)}
+		if slot.end.Cmp(blockEnd) > 0 {
+			continue
+		}
+		free := true
+		for _, o := range occupied {
+			if slot.overlaps(o) {
+				free = false
+				break
+			}
+		}
+		if free {
+			return start
+		}
+	}
+	return nil
+}
+
+// freeRangeLarger reports whether free range a is larger than free range b
+func freeRangeLarger(a, b string) bool {
+	if a == "" {
+		return false
+	}
+	if b == "" {
+		return true
+	}
+	aPrefix, errA := iprange.ParsePrefix(a)
+	bPrefix, errB := iprange.ParsePrefix(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return aPrefix.Bits() < bPrefix.Bits()
+}
+
+// ApplyDefragPlan renumbers the subnets of a plan in its block file. Every move
+// must be safe, and the block is checked for overlaps before it is written.
+func ApplyDefragPlan(cfg *config.Config, plan *DefragPlan) error {
+	for _, move := range plan.Moves {
+		if !move.Safe {
+			return fmt.Errorf("subnet %s is not flagged as renumberable; refusing to move it", move.From)
+		}
+	}
+
+	err := updateBlocks(cfg, plan.FileKey, func(blocks []Block) ([]Block, error) {
+		var block *Block
+		for i := range blocks {
+			if cidrEqual(blocks[i].CIDR, plan.BlockCIDR) {
+				block = &blocks[i]
+				break
+			}
+		}
+		if block == nil {
+			return nil, &NotFoundError{Kind: "block", Name: plan.BlockCIDR, FileKey: plan.FileKey}
+		}
+
+		// Look up all subnets before renumbering, a move may target another move's old CIDR
+		indexes := make([]int, len(plan.Moves))
+		for m, move := range plan.Moves {
+			indexes[m] = -1
+			for i := range block.Subnets {
+				if cidrEqual(block.Subnets[i].CIDR, move.From) {
+					indexes[m] = i
+					break
+				}
+			}
+			if indexes[m] == -1 {
+				return nil, &NotFoundError{Kind: "subnet", Name: move.From, FileKey: plan.FileKey}
+			}
+		}
+		for m, move := range plan.Moves {
+			block.Subnets[indexes[m]].CIDR = move.To
+		}
+
+		// Guard against a stale plan: the result must not contain overlaps
+		index := subnetTrie(block.Subnets)
+		for i, subnet := range block.Subnets {
+			prefix, err := iprange.ParsePrefix(subnet.CIDR)
+			if err != nil {
+				continue
+			}
+			for _, j := range overlapPositions(index, prefix) {
+				if j > i {
+					return nil, &OverlapError{Kind: "subnet", CIDR: subnet.CIDR, Existing: block.Subnets[j].CIDR, FileKey: plan.FileKey}
+				}
+			}
+		}
+
+		sort.SliceStable(block.Subnets, func(a, b int) bool {
+			return subnetLess(block.Subnets[a], block.Subnets[b])
+		})
+		return blocks, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Debug("Applied defrag plan for block %s: %d moves", plan.BlockCIDR, len(plan.Moves))
+	return nil
+}
+
+// PrintDefragPlan prints a defragmentation plan
+func PrintDefragPlan(plan *DefragPlan) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Defragmentation Plan for %s\n", plan.BlockCIDR)
+	fmt.Fprintf(w, "Largest free range:\t%s -> %s\n", formatFreeRange(plan.LargestFreeBefore), formatFreeRange(plan.LargestFreeAfter))
+	if len(plan.Pinned) > 0 {
+		fmt.Fprintf(w, "Pinned subnets:\t%d (not flagged as renumberable)\n", len(plan.Pinned))
+	}
+
+	if len(plan.Moves) == 0 {
+		fmt.Fprintln(w, "\nNo moves needed; the free space cannot be consolidated further.")
+	} else {
+		fmt.Fprintln(w, "\nName\tFrom\tTo\tRenumberable")
+		fmt.Fprintln(w, "----\t----\t--\t------------")
+		for _, move := range plan.Moves {
+			safe := "no"
+			if move.Safe {
+				safe = "yes"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", move.Name, move.From, move.To, safe)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error flushing writer: %w", err)
+	}
+	return nil
+}
+
+func formatFreeRange(cidr string) string {
+	if cidr == "" {
+		return "none"
+	}
+	return cidr
+}
@@ -0,0 +1,78 @@
+package ipam
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeDefragBlock(t *testing.T, subnets []Subnet) *config.Config {
+	t.Helper()
+	blockFile := filepath.Join(t.TempDir(), "default.yaml")
+	yamlData, err := marshalBlocks([]Block{{CIDR: "10.0.0.0/24", Description: "defrag", Subnets: subnets}})
+	require.NoError(t, err)
+	require.NoError(t, writeYAMLFile(blockFile, yamlData))
+	return &config.Config{BlockFiles: map[string]string{"default": blockFile}}
+}
+
+func TestPlanDefrag(t *testing.T) {
+	t.Run("Consolidates free space", func(t *testing.T) {
+		cfg := writeDefragBlock(t, []Subnet{
+			{CIDR: "10.0.0.64/26", Name: "a", Renumberable: true},
+			{CIDR: "10.0.0.192/26", Name: "b"},
+		})
+
+		plan, err := PlanDefrag(cfg, "10.0.0.0/24", "default", false)
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.0.0/26", plan.LargestFreeBefore)
+		assert.Equal(t, "10.0.0.128/25", plan.LargestFreeAfter)
+		assert.Equal(t, []DefragMove{
+			{Name: "a", From: "10.0.0.64/26", To: "10.0.0.0/26", Safe: true},
+			{Name: "b", From: "10.0.0.192/26", To: "10.0.0.64/26", Safe: false},
+		}, plan.Moves)
+
+		// Plans containing subnets not flagged as renumberable are not applied
+		assert.Error(t, ApplyDefragPlan(cfg, plan))
+
+		// Pinning b leaves no move that enlarges the largest free range
+		plan, err = PlanDefrag(cfg, "10.0.0.0/24", "default", true)
+		require.NoError(t, err)
+		assert.Empty(t, plan.Moves)
+		assert.Equal(t, []string{"10.0.0.192/26"}, plan.Pinned)
+	})
+
+	t.Run("Applies safe moves around pinned subnets", func(t *testing.T) {
+		cfg := writeDefragBlock(t, []Subnet{
+			{CIDR: "10.0.0.0/26", Name: "pinned"},
+			{CIDR: "10.0.0.128/26", Name: "app", Region: "us-east1", Renumberable: true},
+		})
+
+		plan, err := PlanDefrag(cfg, "10.0.0.0/24", "default", true)
+		require.NoError(t, err)
+		require.Equal(t, []DefragMove{{Name: "app", From: "10.0.0.128/26", To: "10.0.0.64/26", Safe: true}}, plan.Moves)
+		require.NoError(t, ApplyDefragPlan(cfg, plan))
+
+		block, err := FindBlock(cfg, "10.0.0.0/24", "default")
+		require.NoError(t, err)
+		require.Len(t, block.Subnets, 2)
+		assert.Equal(t, "10.0.0.64/26", block.Subnets[1].CIDR)
+		assert.Equal(t, "us-east1", block.Subnets[1].Region)
+		assert.True(t, block.Subnets[1].Renumberable)
+		assert.Equal(t, []string{"10.0.0.128/25"}, calculateAvailableCIDRs(block))
+	})
+
+	t.Run("Already compact", func(t *testing.T) {
+		cfg := writeDefragBlock(t, []Subnet{
+			{CIDR: "10.0.0.0/26", Name: "a", Renumberable: true},
+			{CIDR: "10.0.0.128/25", Name: "b", Renumberable: true},
+		})
+
+		plan, err := PlanDefrag(cfg, "10.0.0.0/24", "default", false)
+		require.NoError(t, err)
+		assert.Empty(t, plan.Moves)
+		assert.Equal(t, plan.LargestFreeBefore, plan.LargestFreeAfter)
+	})
+}
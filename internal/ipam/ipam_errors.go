@@ -0,0 +1,101 @@
+package ipam
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lugnut42/openipam/internal/iprange"
+)
+
+// Sentinel errors for the failure classes of the block, subnet and pattern
+// operations. The typed errors below unwrap to them, so callers can test the
+// class with errors.Is and get the details with errors.As.
+var (
+	// ErrNotFound is returned when a block file, block, subnet or pattern does not exist
+	ErrNotFound = errors.New("not found")
+
+	// ErrOverlap is returned when a new block or subnet overlaps an existing one
+	ErrOverlap = errors.New("overlaps with existing")
+
+	// ErrExhausted is returned when a block has no free range large enough for an allocation
+	ErrExhausted = errors.New("no available CIDR found")
+)
+
+// NotFoundError reports a missing block file, block, subnet or pattern
+type NotFoundError struct {
+	Kind    string // "block file", "block", "subnet" or "pattern"
+	Name    string // file key, CIDR or pattern name
+	FileKey string // block file searched, if the lookup was scoped to one
+}
+
+func (e *NotFoundError) Error() string {
+	if e.FileKey != "" && e.Kind != "block file" {
+		return fmt.Sprintf("%s %s not found in file %s", e.Kind, e.Name, e.FileKey)
+	}
+	return fmt.Sprintf("%s %s not found", e.Kind, e.Name)
+}
+
+func (e *NotFoundError) Unwrap() error {
+	return ErrNotFound
+}
+
+// OverlapError reports a new block or subnet that overlaps an existing one
+type OverlapError struct {
+	Kind     string // "block" or "subnet"
+	CIDR     string // the requested CIDR
+	Existing string // the CIDR it overlaps with
+	FileKey  string // block file of the existing entry, if known
+}
+
+func (e *OverlapError) Error() string {
+	msg := fmt.Sprintf("%s %s overlaps with existing %s %s", e.Kind, e.CIDR, e.Kind, e.Existing)
+	if e.FileKey != "" {
+		msg += " in file " + e.FileKey
+	}
+	return msg
+}
+
+func (e *OverlapError) Unwrap() error {
+	return ErrOverlap
+}
+
+// ExhaustedError reports a block without a free range large enough for an allocation
+type ExhaustedError struct {
+	BlockCIDR       string
+	RequestedPrefix int    // prefix length requested, 0 if not applicable
+	LargestFree     string // largest free range left in the block, empty if the block is full
+}
+
+func (e *ExhaustedError) Error() string {
+	msg := fmt.Sprintf("no available CIDR found in block %s", e.BlockCIDR)
+	if e.RequestedPrefix > 0 {
+		msg += fmt.Sprintf(" that can accommodate /%d subnet", e.RequestedPrefix)
+	}
+	if e.LargestFree != "" {
+		msg += fmt.Sprintf(" (largest free range: %s)", e.LargestFree)
+	} else {
+		msg += " (block is full)"
+	}
+	return msg
+}
+
+func (e *ExhaustedError) Unwrap() error {
+	return ErrExhausted
+}
+
+// largestFreeRange returns the largest of the available CIDRs of a block
+func largestFreeRange(availableCIDRs []string) string {
+	largest := ""
+	largestOnes := -1
+	for _, cidr := range availableCIDRs {
+		prefix, err := iprange.ParsePrefix(cidr)
+		if err != nil {
+			continue
+		}
+		ones := prefix.Bits()
+		if largestOnes == -1 || ones < largestOnes {
+			largest, largestOnes = cidr, ones
+		}
+	}
+	return largest
+}
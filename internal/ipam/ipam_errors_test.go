@@ -0,0 +1,61 @@
+package ipam
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypedErrors(t *testing.T) {
+	blockFile := filepath.Join(t.TempDir(), "default.yaml")
+	require.NoError(t, writeYAMLFile(blockFile, []byte("[]")))
+	cfg := &config.Config{
+		BlockFiles: map[string]string{"default": blockFile},
+		Patterns: map[string]map[string]config.Pattern{
+			"default": {"big": {CIDRSize: 24, Block: "10.0.0.0/24"}},
+		},
+	}
+	_, err := AddBlock(cfg, "10.0.0.0/24", "test block", "", "default", false)
+	require.NoError(t, err)
+
+	t.Run("Overlap", func(t *testing.T) {
+		_, err := AddBlock(cfg, "10.0.0.128/25", "overlapping", "", "default", false)
+		var overlap *OverlapError
+		require.True(t, errors.As(err, &overlap))
+		assert.True(t, errors.Is(err, ErrOverlap))
+		assert.Equal(t, "block", overlap.Kind)
+		assert.Equal(t, "10.0.0.128/25", overlap.CIDR)
+		assert.Equal(t, "10.0.0.0/24", overlap.Existing)
+		assert.Equal(t, "default", overlap.FileKey)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		err := DeleteBlock(cfg, "10.9.0.0/16", true, "default")
+		var notFound *NotFoundError
+		require.True(t, errors.As(err, &notFound))
+		assert.True(t, errors.Is(err, ErrNotFound))
+		assert.Equal(t, "block", notFound.Kind)
+		assert.Equal(t, "10.9.0.0/16", notFound.Name)
+
+		err = CreateSubnetFromPattern(cfg, "missing", "default")
+		require.True(t, errors.As(err, &notFound))
+		assert.Equal(t, "pattern", notFound.Kind)
+	})
+
+	t.Run("Exhausted", func(t *testing.T) {
+		_, err = CreateSubnet(cfg, "10.0.0.0/24", "10.0.0.0/26", "app", "us-east1")
+		require.NoError(t, err)
+
+		err := CreateSubnetFromPattern(cfg, "big", "default")
+		var exhausted *ExhaustedError
+		require.True(t, errors.As(err, &exhausted))
+		assert.True(t, errors.Is(err, ErrExhausted))
+		assert.Equal(t, 24, exhausted.RequestedPrefix)
+		assert.Equal(t, "10.0.0.128/25", exhausted.LargestFree)
+		assert.Contains(t, err.Error(), "largest free range: 10.0.0.128/25")
+	})
+}
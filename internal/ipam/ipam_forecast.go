@@ -0,0 +1,270 @@
+package ipam
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"net/netip"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/iprange"
+)
+
+// PatternForecast projects how long a block can keep serving one pattern
+type PatternForecast struct {
+	Pattern string
+	Prefix  int
+
+	// Remaining is the number of further subnets of Prefix that fit in the block
+	Remaining uint64
+
+	// DaysLeft is the projected number of days until no subnet of Prefix fits,
+	// or -1 when there were no allocations in the forecast window
+	DaysLeft float64
+	Exhausts time.Time
+}
+
+// ForecastReport projects when a block runs out of capacity from its recent allocation rate
+type ForecastReport struct {
+	CIDR         string
+	FileKey      string
+	Window       time.Duration
+	Allocations  int     // subnets allocated within the window
+	RatePerDay   float64 // addresses allocated per day within the window
+	AvailableIPs *big.Int
+
+	// DaysLeft and Exhausts project when the block is completely allocated;
+	// DaysLeft is -1 when there were no allocations in the window
+	DaysLeft float64
+	Exhausts time.Time
+
+	Patterns []PatternForecast
+}
+
+// ForecastBlock projects when a block runs out of capacity. The allocation rate
+// is derived from the CreatedAt time of the subnets allocated within window, and
+// a forecast is made for the block as a whole and for the prefix size of each
+// pattern that allocates from it.
+func ForecastBlock(cfg *config.Config, blockCIDR, fileKey string, window time.Duration) (*ForecastReport, error) {
+	block, err := FindBlock(cfg, blockCIDR, fileKey)
+	if err != nil {
+		return nil, err
+	}
+
+	now := timeNow()
+	report := &ForecastReport{
+		CIDR:         block.CIDR,
+		FileKey:      fileKey,
+		Window:       window,
+		AvailableIPs: block.Stats.AvailableIPs,
+	}
+
+	allocatedInWindow := new(big.Int)
+	for _, subnet := range block.Subnets {
+		if subnet.CreatedAt.IsZero() || now.Sub(subnet.CreatedAt) > window {
+			continue
+		}
+		subnetPrefix, err := iprange.ParsePrefix(subnet.CIDR)
+		if err != nil {
+			continue
+		}
+		report.Allocations++
+		allocatedInWindow.Add(allocatedInWindow, iprange.Size(subnetPrefix))
+	}
+
+	days := window.Hours() / 24
+	if days > 0 {
+		allocated, _ := new(big.Float).SetInt(allocatedInWindow).Float64()
+		report.RatePerDay = allocated / days
+	}
+	available, _ := new(big.Float).SetInt(report.AvailableIPs).Float64()
+	report.DaysLeft, report.Exhausts = projectExhaustion(now, available, report.RatePerDay)
+
+	blockPrefix, err := iprange.ParsePrefix(block.CIDR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR format: %w", err)
+	}
+	availableCIDRs := calculateAvailableCIDRs(block)
+
+	for _, name := range patternsForBlock(cfg, fileKey, block.CIDR) {
+		pattern := cfg.Patterns[fileKey][name]
+		forecast := PatternForecast{
+			Pattern:   name,
+			Prefix:    pattern.CIDRSize,
+			Remaining: countFittingSubnets(availableCIDRs, pattern.CIDRSize),
+		}
+
+		// Only whole subnets of the pattern's size are usable capacity for it
+		patternPrefix := netip.PrefixFrom(blockPrefix.Addr(), pattern.CIDRSize)
+		patternSize, _ := new(big.Float).SetInt(iprange.Size(patternPrefix)).Float64()
+		capacity := float64(forecast.Remaining) * patternSize
+		forecast.DaysLeft, forecast.Exhausts = projectExhaustion(now, capacity, report.RatePerDay)
+		report.Patterns = append(report.Patterns, forecast)
+	}
+
+	return report, nil
+}
+
+// forecastHorizonDays bounds projected exhaustion dates. Large blocks, IPv6 in
+// particular, can last far longer than a time.Duration can represent.
+const forecastHorizonDays = 100 * 365
+
+// projectExhaustion returns the days until capacity addresses are used up at
+// ratePerDay and the corresponding date, or -1 and a zero time if the rate is
+// zero. Beyond the forecast horizon the days are returned with a zero time.
+func projectExhaustion(now time.Time, capacity, ratePerDay float64) (float64, time.Time) {
+	if capacity <= 0 {
+		return 0, now
+	}
+	if ratePerDay <= 0 {
+		return -1, time.Time{}
+	}
+	daysLeft := capacity / ratePerDay
+	if daysLeft > forecastHorizonDays {
+		return daysLeft, time.Time{}
+	}
+	return daysLeft, now.Add(time.Duration(daysLeft * 24 * float64(time.Hour)))
+}
+
+// patternsForBlock returns the names of the patterns of a block file that
+// allocate from the given block, sorted by name
+func patternsForBlock(cfg *config.Config, fileKey, blockCIDR string) []string {
+	var names []string
+	for name, pattern := range cfg.Patterns[fileKey] {
+		if cidrEqual(pattern.Block, blockCIDR) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// countFittingSubnets returns how many subnets of the given prefix length fit
+// into the available CIDRs, saturating at math.MaxUint64
+func countFittingSubnets(availableCIDRs []string, prefix int) uint64 {
+	var count uint64
+	for _, cidr := range availableCIDRs {
+		availPrefix, err := iprange.ParsePrefix(cidr)
+		if err != nil {
+			continue
+		}
+		ones := availPrefix.Bits()
+		if ones > prefix {
+			continue
+		}
+		if prefix-ones >= 63 {
+			return math.MaxUint64
+		}
+		fitting := uint64(1) << uint(prefix-ones)
+		if count > math.MaxUint64-fitting {
+			return math.MaxUint64
+		}
+		count += fitting
+	}
+	return count
+}
+
+// PrintForecast prints a capacity forecast
+func PrintForecast(report *ForecastReport) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Block Capacity Forecast")
+	fmt.Fprintln(w, "-----------------------")
+	fmt.Fprintf(w, "CIDR:\t%s\n", report.CIDR)
+	fmt.Fprintf(w, "Window:\t%.0f days\n", report.Window.Hours()/24)
+	fmt.Fprintf(w, "Allocations in window:\t%d\n", report.Allocations)
+	fmt.Fprintf(w, "Allocation rate:\t%.1f IPs/day\n", report.RatePerDay)
+	fmt.Fprintf(w, "Available IPs:\t%d\n", report.AvailableIPs)
+	fmt.Fprintf(w, "Block exhausted:\t%s\n", formatExhaustion(report.DaysLeft, report.Exhausts))
+
+	if len(report.Patterns) > 0 {
+		fmt.Fprintln(w, "\nPatterns:")
+		fmt.Fprintln(w, "Pattern\tPrefix\tRemaining\tExhausted")
+		fmt.Fprintln(w, "-------\t------\t---------\t---------")
+		for _, p := range report.Patterns {
+			fmt.Fprintf(w, "%s\t/%d\t%d\t%s\n", p.Pattern, p.Prefix, p.Remaining, formatExhaustion(p.DaysLeft, p.Exhausts))
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error flushing writer: %w", err)
+	}
+	return nil
+}
+
+func formatExhaustion(daysLeft float64, exhausts time.Time) string {
+	switch {
+	case daysLeft < 0:
+		return "never (no allocations in window)"
+	case daysLeft == 0:
+		return "now"
+	case daysLeft > forecastHorizonDays:
+		return fmt.Sprintf("beyond forecast horizon (over %d years)", forecastHorizonDays/365)
+	default:
+		return fmt.Sprintf("%s (in %.0f days)", exhausts.Format("2006-01-02"), math.Ceil(daysLeft))
+	}
+}
+
+// ThresholdViolation describes a block exceeding a utilization threshold or
+// unable to fit the subnet size of one of its patterns
+type ThresholdViolation struct {
+	FileKey string
+	CIDR    string
+	Reason  string
+}
+
+// CheckUtilizationThresholds returns the blocks of a block file, or of all block
+// files when fileKey is empty, whose utilization exceeds threshold percent, and
+// the blocks whose largest free range is smaller than the prefix size of a
+// pattern allocating from them. If blockCIDR is set only that block is checked.
+func CheckUtilizationThresholds(cfg *config.Config, fileKey, blockCIDR string, threshold float64) ([]ThresholdViolation, error) {
+	entries, err := FindBlocks(cfg, fileKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []ThresholdViolation
+	found := false
+	for _, entry := range entries {
+		block := entry.Block
+		if blockCIDR != "" && !cidrEqual(block.CIDR, blockCIDR) {
+			continue
+		}
+		found = true
+
+		// The block is already loaded, so its utilization is not re-read per block
+		report, err := blockUtilization(cfg, entry.FileKey, &block)
+		if err != nil {
+			return nil, err
+		}
+		if report.UtilizationRatio*100 > threshold {
+			violations = append(violations, ThresholdViolation{
+				FileKey: entry.FileKey,
+				CIDR:    block.CIDR,
+				Reason:  fmt.Sprintf("utilization %.2f%% exceeds threshold %.2f%%", report.UtilizationRatio*100, threshold),
+			})
+		}
+
+		availableCIDRs := calculateAvailableCIDRs(&block)
+		largest := largestFreeRange(availableCIDRs)
+		for _, name := range patternsForBlock(cfg, entry.FileKey, block.CIDR) {
+			prefix := cfg.Patterns[entry.FileKey][name].CIDRSize
+			if countFittingSubnets(availableCIDRs, prefix) > 0 {
+				continue
+			}
+			reason := fmt.Sprintf("no free range fits pattern %s (/%d), block is full", name, prefix)
+			if largest != "" {
+				reason = fmt.Sprintf("largest free range %s is smaller than pattern %s (/%d)", largest, name, prefix)
+			}
+			violations = append(violations, ThresholdViolation{FileKey: entry.FileKey, CIDR: block.CIDR, Reason: reason})
+		}
+	}
+
+	if blockCIDR != "" && !found {
+		return nil, &NotFoundError{Kind: "block", Name: blockCIDR, FileKey: fileKey}
+	}
+	return violations, nil
+}
@@ -0,0 +1,141 @@
+package ipam
+
+import (
+	"math"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupForecastConfig(t *testing.T) (*config.Config, time.Time) {
+	t.Helper()
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	originalNow := timeNow
+	timeNow = func() time.Time { return now }
+	t.Cleanup(func() { timeNow = originalNow })
+
+	blockFile := filepath.Join(t.TempDir(), "default.yaml")
+	yamlData, err := marshalBlocks([]Block{
+		{
+			CIDR:        "10.0.0.0/22",
+			Description: "forecast block",
+			Subnets: []Subnet{
+				{CIDR: "10.0.0.0/24", Name: "a", CreatedAt: now.AddDate(0, 0, -10)},
+				{CIDR: "10.0.1.0/25", Name: "b", CreatedAt: now.AddDate(0, 0, -5)},
+				{CIDR: "10.0.3.0/24", Name: "old", CreatedAt: now.AddDate(0, 0, -200)},
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, writeYAMLFile(blockFile, yamlData))
+
+	cfg := &config.Config{
+		BlockFiles: map[string]string{"default": blockFile},
+		Patterns: map[string]map[string]config.Pattern{
+			"default": {
+				"small": {CIDRSize: 24, Block: "10.0.0.0/22"},
+				"large": {CIDRSize: 23, Block: "10.0.0.0/22"},
+			},
+		},
+	}
+	return cfg, now
+}
+
+func TestForecastBlock(t *testing.T) {
+	cfg, now := setupForecastConfig(t)
+
+	report, err := ForecastBlock(cfg, "10.0.0.0/22", "default", 30*24*time.Hour)
+	require.NoError(t, err)
+
+	// Only the two subnets allocated within the window count towards the
+	// rate: 256 + 128 addresses over 30 days
+	assert.Equal(t, 2, report.Allocations)
+	assert.InDelta(t, 12.8, report.RatePerDay, 0.001)
+	assert.Equal(t, big.NewInt(384), report.AvailableIPs)
+	assert.InDelta(t, 30, report.DaysLeft, 0.001)
+	assert.Equal(t, now.Add(time.Duration(report.DaysLeft*24*float64(time.Hour))), report.Exhausts)
+
+	require.Len(t, report.Patterns, 2)
+	large, small := report.Patterns[0], report.Patterns[1]
+
+	assert.Equal(t, "large", large.Pattern)
+	assert.Equal(t, uint64(0), large.Remaining)
+	assert.Equal(t, float64(0), large.DaysLeft)
+
+	assert.Equal(t, "small", small.Pattern)
+	assert.Equal(t, uint64(1), small.Remaining)
+	assert.InDelta(t, 20, small.DaysLeft, 0.001)
+
+	// Without recent allocations there is no projection
+	report, err = ForecastBlock(cfg, "10.0.0.0/22", "default", 24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, float64(-1), report.DaysLeft)
+	assert.True(t, report.Exhausts.IsZero())
+}
+
+func TestForecastLargeCapacity(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	// An IPv6 /48 at a few addresses a day lasts beyond any representable date
+	daysLeft, exhausts := projectExhaustion(now, math.Pow(2, 80), 256)
+	assert.Greater(t, daysLeft, float64(forecastHorizonDays))
+	assert.True(t, exhausts.IsZero())
+	assert.Equal(t, "beyond forecast horizon (over 100 years)", formatExhaustion(daysLeft, exhausts))
+
+	// Counts of fitting subnets saturate instead of wrapping around
+	quarters := []string{"::/2", "4000::/2", "8000::/2", "c000::/2"}
+	assert.Equal(t, uint64(math.MaxUint64), countFittingSubnets(quarters, 64))
+	assert.Equal(t, uint64(3)<<62, countFittingSubnets(quarters[:3], 64))
+}
+
+func TestCheckUtilizationThresholds(t *testing.T) {
+	cfg, _ := setupForecastConfig(t)
+
+	violations, err := CheckUtilizationThresholds(cfg, "default", "", 60)
+	require.NoError(t, err)
+	require.Len(t, violations, 2)
+	assert.Contains(t, violations[0].Reason, "utilization 62.50%")
+	assert.Contains(t, violations[1].Reason, "smaller than pattern large (/23)")
+
+	violations, err = CheckUtilizationThresholds(cfg, "default", "10.0.0.0/22", 70)
+	require.NoError(t, err)
+	assert.Len(t, violations, 1)
+
+	_, err = CheckUtilizationThresholds(cfg, "default", "192.168.0.0/16", 70)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Without a file key every block file is checked
+	prodFile := filepath.Join(t.TempDir(), "prod.yaml")
+	yamlData, err := marshalBlocks([]Block{{
+		CIDR:    "10.1.0.0/24",
+		Subnets: []Subnet{{CIDR: "10.1.0.0/25", Name: "c"}},
+	}})
+	require.NoError(t, err)
+	require.NoError(t, writeYAMLFile(prodFile, yamlData))
+	cfg.BlockFiles["prod"] = prodFile
+
+	violations, err = CheckUtilizationThresholds(cfg, "", "", 40)
+	require.NoError(t, err)
+	require.Len(t, violations, 3)
+	assert.Equal(t, "default", violations[0].FileKey)
+	assert.Equal(t, ThresholdViolation{FileKey: "prod", CIDR: "10.1.0.0/24", Reason: "utilization 50.00% exceeds threshold 40.00%"}, violations[2])
+
+	violations, err = CheckUtilizationThresholds(cfg, "", "10.1.0.0/24", 40)
+	require.NoError(t, err)
+	assert.Len(t, violations, 1)
+}
+
+func TestCreateSubnetRecordsCreationTime(t *testing.T) {
+	cfg, now := setupForecastConfig(t)
+
+	_, err := CreateSubnet(cfg, "10.0.0.0/22", "10.0.2.0/24", "c", "us-east1")
+	require.NoError(t, err)
+	entry, err := FindSubnet(cfg, "10.0.2.0/24")
+	require.NoError(t, err)
+	assert.Equal(t, now, entry.Subnet.CreatedAt)
+}
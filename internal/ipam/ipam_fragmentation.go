@@ -0,0 +1,156 @@
+package ipam
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+	"slices"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/iprange"
+)
+
+// FragmentationReport describes how the free space of a block is split up
+type FragmentationReport struct {
+	// LargestFree is the largest free CIDR of the block, empty if the block is full
+	LargestFree       string `json:"largest_free"`
+	LargestFreePrefix int    `json:"largest_free_prefix"`
+
+	// FreeRanges is a histogram of the free ranges by prefix length
+	FreeRanges map[int]int `json:"free_ranges"`
+
+	// PatternCapacity lists how many subnets of each pattern's size still fit
+	PatternCapacity []PatternCapacity `json:"pattern_capacity,omitempty"`
+
+	// Score is 0 when all free space is one contiguous range and approaches 1
+	// as the free space is split into many small ranges
+	Score float64 `json:"fragmentation_score"`
+}
+
+// PatternCapacity is the number of subnets of a pattern's size that can still be allocated
+type PatternCapacity struct {
+	Pattern   string `json:"pattern"`
+	Prefix    int    `json:"prefix"`
+	Remaining uint64 `json:"remaining"`
+}
+
+// calculateFragmentation builds the fragmentation report of a block from its
+// free ranges and the patterns of the block file that allocate from it
+func calculateFragmentation(cfg *config.Config, fileKey string, block *Block) (*FragmentationReport, error) {
+	if _, err := iprange.ParsePrefix(block.CIDR); err != nil {
+		return nil, fmt.Errorf("invalid CIDR format: %w", err)
+	}
+
+	availableCIDRs := calculateAvailableCIDRs(block)
+	report := &FragmentationReport{
+		LargestFree:       largestFreeRange(availableCIDRs),
+		LargestFreePrefix: -1,
+		FreeRanges:        make(map[int]int),
+	}
+
+	var freePrefixes []netip.Prefix
+	for _, cidr := range availableCIDRs {
+		freePrefix, err := iprange.ParsePrefix(cidr)
+		if err != nil {
+			continue
+		}
+		freePrefixes = append(freePrefixes, freePrefix)
+		report.FreeRanges[freePrefix.Bits()]++
+		if report.LargestFreePrefix == -1 || freePrefix.Bits() < report.LargestFreePrefix {
+			report.LargestFreePrefix = freePrefix.Bits()
+		}
+	}
+
+	// The score is taken over contiguous ranges, as adjacent free CIDRs are
+	// not fragmented. Sizes are big integers so that IPv6 ranges cannot overflow.
+	totalFree := new(big.Int)
+	largestFree := new(big.Int)
+	for _, size := range contiguousFreeSizes(freePrefixes) {
+		totalFree.Add(totalFree, size)
+		if size.Cmp(largestFree) > 0 {
+			largestFree = size
+		}
+	}
+
+	if totalFree.Sign() > 0 {
+		ratio, _ := new(big.Rat).SetFrac(largestFree, totalFree).Float64()
+		report.Score = 1 - ratio
+	}
+
+	for _, name := range patternsForBlock(cfg, fileKey, block.CIDR) {
+		prefix := cfg.Patterns[fileKey][name].CIDRSize
+		report.PatternCapacity = append(report.PatternCapacity, PatternCapacity{
+			Pattern:   name,
+			Prefix:    prefix,
+			Remaining: countFittingSubnets(availableCIDRs, prefix),
+		})
+	}
+
+	return report, nil
+}
+
+// contiguousFreeSizes merges adjacent free prefixes into contiguous ranges and
+// returns the number of addresses of each range
+func contiguousFreeSizes(prefixes []netip.Prefix) []*big.Int {
+	sorted := slices.Clone(prefixes)
+	slices.SortFunc(sorted, func(a, b netip.Prefix) int {
+		return a.Addr().Compare(b.Addr())
+	})
+
+	var sizes []*big.Int
+	var last netip.Addr
+	for _, p := range sorted {
+		if len(sizes) > 0 && last.Next() == p.Addr() {
+			sizes[len(sizes)-1].Add(sizes[len(sizes)-1], iprange.Size(p))
+		} else {
+			sizes = append(sizes, iprange.Size(p))
+		}
+		last = iprange.Last(p)
+	}
+	return sizes
+}
+
+// writeFragmentation writes the fragmentation section of a block utilization report
+func writeFragmentation(w *tabwriter.Writer, report *FragmentationReport) {
+	fmt.Fprintln(w, "\nFragmentation:")
+	if report.LargestFree == "" {
+		fmt.Fprintln(w, "Largest Free Range:\tnone (block is full)")
+	} else {
+		fmt.Fprintf(w, "Largest Free Range:\t%s\n", report.LargestFree)
+	}
+	fmt.Fprintf(w, "Fragmentation Score:\t%.2f\n", report.Score)
+
+	if len(report.FreeRanges) > 0 {
+		prefixes := make([]int, 0, len(report.FreeRanges))
+		for prefix := range report.FreeRanges {
+			prefixes = append(prefixes, prefix)
+		}
+		sort.Ints(prefixes)
+
+		fmt.Fprintln(w, "\nFree Ranges by Prefix:")
+		fmt.Fprintln(w, "Prefix\tCount")
+		fmt.Fprintln(w, "------\t-----")
+		for _, prefix := range prefixes {
+			fmt.Fprintf(w, "/%d\t%d\n", prefix, report.FreeRanges[prefix])
+		}
+	}
+
+	if len(report.PatternCapacity) > 0 {
+		fmt.Fprintln(w, "\nPattern Capacity:")
+		fmt.Fprintln(w, "Pattern\tPrefix\tRemaining")
+		fmt.Fprintln(w, "-------\t------\t---------")
+		for _, p := range report.PatternCapacity {
+			fmt.Fprintf(w, "%s\t/%d\t%d\n", p.Pattern, p.Prefix, p.Remaining)
+		}
+	}
+}
+
+// formatLargestFree returns the largest free range of a report for table output
+func formatLargestFree(report *FragmentationReport) string {
+	if report == nil || report.LargestFree == "" {
+		return "-"
+	}
+	return report.LargestFree
+}
@@ -0,0 +1,81 @@
+package ipam
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockFragmentation(t *testing.T) {
+	blockFile := filepath.Join(t.TempDir(), "default.yaml")
+	yamlData, err := marshalBlocks([]Block{
+		{
+			CIDR:        "10.0.0.0/24",
+			Description: "half used, but no /25 left",
+			Subnets: []Subnet{
+				{CIDR: "10.0.0.0/26", Name: "a"},
+				{CIDR: "10.0.0.128/26", Name: "b"},
+			},
+		},
+		{CIDR: "10.0.1.0/24", Description: "empty"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, writeYAMLFile(blockFile, yamlData))
+
+	cfg := &config.Config{
+		BlockFiles: map[string]string{"default": blockFile},
+		Patterns: map[string]map[string]config.Pattern{
+			"default": {
+				"large": {CIDRSize: 25, Block: "10.0.0.0/24"},
+				"small": {CIDRSize: 27, Block: "10.0.0.0/24"},
+			},
+		},
+	}
+
+	report, err := CalculateBlockUtilization(cfg, "10.0.0.0/24", "default")
+	require.NoError(t, err)
+	frag := report.Fragmentation
+	require.NotNil(t, frag)
+
+	assert.Equal(t, "10.0.0.64/26", frag.LargestFree)
+	assert.Equal(t, 26, frag.LargestFreePrefix)
+	assert.Equal(t, map[int]int{26: 2}, frag.FreeRanges)
+	assert.InDelta(t, 0.5, frag.Score, 0.0001)
+	assert.Equal(t, []PatternCapacity{
+		{Pattern: "large", Prefix: 25, Remaining: 0},
+		{Pattern: "small", Prefix: 27, Remaining: 4},
+	}, frag.PatternCapacity)
+
+	// An empty block is a single free range
+	reports, err := CalculateAllBlocksUtilization(cfg, "default")
+	require.NoError(t, err)
+	require.Len(t, reports, 2)
+	assert.Equal(t, "10.0.1.0/24", reports[1].Fragmentation.LargestFree)
+	assert.Equal(t, float64(0), reports[1].Fragmentation.Score)
+
+	// Free CIDRs that are adjacent form one contiguous range
+	blocks, err := loadBlocks(cfg, "default")
+	require.NoError(t, err)
+	blocks[1].Subnets = []Subnet{{CIDR: "10.0.1.0/26", Name: "c"}}
+	require.NoError(t, saveBlocks(cfg, "default", blocks))
+	contiguous, err := CalculateBlockUtilization(cfg, "10.0.1.0/24", "default")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.128/25", contiguous.Fragmentation.LargestFree)
+	assert.Equal(t, map[int]int{25: 1, 26: 1}, contiguous.Fragmentation.FreeRanges)
+	assert.Equal(t, float64(0), contiguous.Fragmentation.Score)
+
+	data, err := json.Marshal(report)
+	require.NoError(t, err)
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	fragJSON, ok := decoded["fragmentation"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "10.0.0.64/26", fragJSON["largest_free"])
+	assert.Equal(t, map[string]interface{}{"26": float64(2)}, fragJSON["free_ranges"])
+
+	assert.NoError(t, PrintBlockUtilization(report))
+}
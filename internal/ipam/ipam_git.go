@@ -0,0 +1,223 @@
+package ipam
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/logger"
+)
+
+// HistoryEntry is a commit that changed a block or subnet
+type HistoryEntry struct {
+	Commit  string
+	Author  string
+	Date    time.Time
+	Message string
+}
+
+// runGit runs git in dir and returns its standard output
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...) // #nosec G204
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	logger.Debug("Running git %s in %s", strings.Join(args, " "), dir)
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s: %w", args[0], msg, err)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.String(), nil
+}
+
+// gitRepoPaths returns the block files of fileKeys and the configuration file,
+// grouped by the root of the git repository they are in. Block files are left
+// out when the blocks are kept in a bucket or a SQLite database, as the YAML
+// files are then not read any more and may have been removed.
+func gitRepoPaths(cfg *config.Config, fileKeys ...string) (map[string][]string, error) {
+	var paths []string
+	for _, fileKey := range fileKeys {
+		blockFile, ok := cfg.BlockFiles[fileKey]
+		if !ok {
+			return nil, &NotFoundError{Kind: "block file", Name: fileKey}
+		}
+		if backend := cfg.Storage.Backend; backend != BackendS3 && backend != BackendSQLite {
+			paths = append(paths, blockFile)
+		}
+	}
+	if cfg.ConfigFile != "" {
+		paths = append(paths, cfg.ConfigFile)
+	}
+
+	repos := make(map[string][]string)
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving %s: %w", path, err)
+		}
+		root, err := runGit(filepath.Dir(absPath), "rev-parse", "--show-toplevel")
+		if err != nil {
+			return nil, fmt.Errorf("%s is not in a git repository: %w", path, err)
+		}
+		root = strings.TrimSpace(root)
+		repos[root] = append(repos[root], absPath)
+	}
+	return repos, nil
+}
+
+// sortedRepoRoots returns the repository roots of gitRepoPaths in sorted order
+func sortedRepoRoots(repos map[string][]string) []string {
+	roots := make([]string, 0, len(repos))
+	for root := range repos {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+	return roots
+}
+
+// CommitChange commits the block files of fileKeys and the configuration file
+// to their local git repository with message, if auto-commit is enabled. Only
+// these files are committed, other staged changes are left alone, and nothing
+// is committed when they are unchanged. Nothing is ever pushed.
+func CommitChange(cfg *config.Config, message string, fileKeys ...string) error {
+	return CommitMove(cfg, message, "", fileKeys...)
+}
+
+// CommitMove commits like CommitChange, and also records the removal of a
+// block file that was moved away from oldPath when git tracks it
+func CommitMove(cfg *config.Config, message, oldPath string, fileKeys ...string) error {
+	if !cfg.Git.AutoCommit {
+		return nil
+	}
+
+	repos, err := gitRepoPaths(cfg, fileKeys...)
+	if err != nil {
+		return err
+	}
+
+	if oldPath != "" {
+		absPath, err := filepath.Abs(oldPath)
+		if err != nil {
+			return fmt.Errorf("error resolving %s: %w", oldPath, err)
+		}
+		root, err := runGit(filepath.Dir(absPath), "rev-parse", "--show-toplevel")
+		if err != nil {
+			return fmt.Errorf("%s is not in a git repository: %w", oldPath, err)
+		}
+		root = strings.TrimSpace(root)
+		tracked, err := runGit(root, "ls-files", "--", absPath)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(tracked) != "" {
+			repos[root] = append(repos[root], absPath)
+		}
+	}
+
+	for _, root := range sortedRepoRoots(repos) {
+		paths := repos[root]
+		if _, err := runGit(root, append([]string{"add", "--"}, paths...)...); err != nil {
+			return err
+		}
+
+		// diff --quiet exits with status 1 when there are staged changes
+		_, err := runGit(root, append([]string{"diff", "--cached", "--quiet", "--"}, paths...)...)
+		var exitErr *exec.ExitError
+		if err == nil {
+			logger.Debug("No changes to commit in %s", root)
+			continue
+		} else if !errors.As(err, &exitErr) || exitErr.ExitCode() != 1 {
+			return err
+		}
+
+		if _, err := runGit(root, append([]string{"commit", "--quiet", "-m", message, "--"}, paths...)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// History returns the commits that changed a block or subnet, newest first.
+// Commits made by ipam are found by their message; other commits are found by
+// the CIDR being added to or removed from a block file.
+func History(cfg *config.Config, cidr string) ([]HistoryEntry, error) {
+	normalized, err := normalizeCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+
+	repos, err := gitRepoPaths(cfg, SortedFileKeys(cfg)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// The CIDR must not be part of a longer address or prefix, such as
+	// 110.0.0.0/16 or 10.0.0.0/160 for 10.0.0.0/16
+	pattern := "(^|[^0-9A-Fa-f.:])" + regexp.QuoteMeta(normalized) + "([^0-9]|$)"
+
+	const format = "--format=%H%x1f%an%x1f%aI%x1f%s"
+	seen := make(map[string]bool)
+	var entries []HistoryEntry
+	for _, root := range sortedRepoRoots(repos) {
+		if _, err := runGit(root, "rev-parse", "--verify", "--quiet", "HEAD"); err != nil {
+			continue // No commits yet
+		}
+
+		paths := repos[root]
+		for _, filter := range [][]string{
+			{"--extended-regexp", "--grep=" + pattern},
+			{"--pickaxe-regex", "-S" + pattern},
+		} {
+			args := append([]string{"log", format}, filter...)
+			out, err := runGit(root, append(append(args, "--"), paths...)...)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+				fields := strings.SplitN(line, "\x1f", 4)
+				if len(fields) != 4 || seen[fields[0]] {
+					continue
+				}
+				seen[fields[0]] = true
+
+				date, err := time.Parse(time.RFC3339, fields[2])
+				if err != nil {
+					return nil, fmt.Errorf("invalid commit date %q: %w", fields[2], err)
+				}
+				entries = append(entries, HistoryEntry{Commit: fields[0], Author: fields[1], Date: date, Message: fields[3]})
+			}
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Date.After(entries[j].Date) })
+	return entries, nil
+}
+
+// PrintHistory prints the history of a block or subnet
+func PrintHistory(entries []HistoryEntry) error {
+	if len(entries) == 0 {
+		fmt.Println("No history found.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Commit\tDate\tAuthor\tMessage")
+	fmt.Fprintln(w, "------\t----\t------\t-------")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%.8s\t%s\t%s\t%s\n", entry.Commit, entry.Date.Format("2006-01-02 15:04"), entry.Author, entry.Message)
+	}
+	return w.Flush()
+}
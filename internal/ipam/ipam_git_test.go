@@ -0,0 +1,173 @@
+package ipam
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newGitRepo creates a git repository with a block file and configuration file
+func newGitRepo(t *testing.T) *config.Config {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	repo := t.TempDir()
+	_, err := runGit(repo, "init", "--quiet")
+	require.NoError(t, err)
+
+	blockFile := filepath.Join(repo, "blocks", "default.yaml")
+	require.NoError(t, os.MkdirAll(filepath.Dir(blockFile), 0755))
+	require.NoError(t, os.WriteFile(blockFile, []byte("[]"), 0644))
+
+	cfg := &config.Config{
+		BlockFiles: map[string]string{"default": blockFile},
+		ConfigFile: filepath.Join(repo, "ipam-config.yaml"),
+		Git:        config.GitSettings{AutoCommit: true},
+	}
+	require.NoError(t, config.WriteConfig(cfg))
+	return cfg
+}
+
+func gitLog(t *testing.T, cfg *config.Config) []string {
+	t.Helper()
+	out, err := runGit(filepath.Dir(cfg.ConfigFile), "log", "--format=%s")
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSpace(out), "\n")
+}
+
+func TestCommitChange(t *testing.T) {
+	cfg := newGitRepo(t)
+	repo := filepath.Dir(cfg.ConfigFile)
+
+	// Unrelated files are not committed
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "notes.txt"), []byte("notes"), 0644))
+	_, err := runGit(repo, "add", "notes.txt")
+	require.NoError(t, err)
+
+	_, err = AddBlock(cfg, "10.0.0.0/16", "test", "", "default", false)
+	require.NoError(t, err)
+	require.NoError(t, CommitChange(cfg, "ipam: add block 10.0.0.0/16 to default", "default"))
+	assert.Equal(t, []string{"ipam: add block 10.0.0.0/16 to default"}, gitLog(t, cfg))
+
+	out, err := runGit(repo, "show", "--name-only", "--format=", "HEAD")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"blocks/default.yaml", "ipam-config.yaml"}, strings.Fields(out))
+
+	out, err = runGit(repo, "status", "--porcelain")
+	require.NoError(t, err)
+	assert.Equal(t, "A  notes.txt", strings.TrimSpace(out))
+
+	// Nothing is committed without changes
+	require.NoError(t, CommitChange(cfg, "ipam: no change", "default"))
+	assert.Len(t, gitLog(t, cfg), 1)
+
+	// Nothing is committed when auto-commit is disabled
+	_, err = CreateSubnet(cfg, "10.0.0.0/16", "10.0.1.0/24", "app", "us-east1")
+	require.NoError(t, err)
+	cfg.Git.AutoCommit = false
+	require.NoError(t, CommitChange(cfg, "ipam: disabled", "default"))
+	assert.Len(t, gitLog(t, cfg), 1)
+
+	// Files outside a repository cannot be committed
+	outside := &config.Config{
+		BlockFiles: map[string]string{"default": filepath.Join(t.TempDir(), "default.yaml")},
+		Git:        config.GitSettings{AutoCommit: true},
+	}
+	assert.ErrorContains(t, CommitChange(outside, "ipam: outside", "default"), "not in a git repository")
+}
+
+func TestCommitChangeSQLite(t *testing.T) {
+	cfg := newGitRepo(t)
+	repo := filepath.Dir(cfg.ConfigFile)
+	require.NoError(t, CommitChange(cfg, "ipam: initial", "default"))
+
+	_, err := ImportToSQLite(cfg, "ipam.db")
+	require.NoError(t, err)
+	cfg.Storage = config.StorageSettings{Backend: BackendSQLite, Path: "ipam.db"}
+	require.NoError(t, config.WriteConfig(cfg))
+
+	// The YAML block file is no longer used and may be removed
+	require.NoError(t, os.Remove(cfg.BlockFiles["default"]))
+	require.NoError(t, CommitChange(cfg, "ipam: switch storage to sqlite", "default"))
+
+	out, err := runGit(repo, "show", "--name-only", "--format=%s", "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ipam:", "switch", "storage", "to", "sqlite", "ipam-config.yaml"}, strings.Fields(out))
+}
+
+func TestHistory(t *testing.T) {
+	cfg := newGitRepo(t)
+	repo := filepath.Dir(cfg.ConfigFile)
+
+	// No history before the first commit
+	entries, err := History(cfg, "10.0.0.0/16")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	_, err = AddBlock(cfg, "10.0.0.0/16", "test", "", "default", false)
+	require.NoError(t, err)
+	require.NoError(t, CommitChange(cfg, "ipam: add block 10.0.0.0/16 to default", "default"))
+	_, err = CreateSubnet(cfg, "10.0.0.0/16", "10.0.1.0/24", "app", "us-east1")
+	require.NoError(t, err)
+	require.NoError(t, CommitChange(cfg, "ipam: create subnet 10.0.1.0/24 (app) in block 10.0.0.0/16", "default"))
+
+	// Changes committed by hand are found by their content
+	_, err = CreateSubnet(cfg, "10.0.0.0/16", "10.0.2.0/24", "db", "us-east1")
+	require.NoError(t, err)
+	_, err = runGit(repo, "commit", "--quiet", "-am", "Add database subnet")
+	require.NoError(t, err)
+
+	entries, err = History(cfg, "10.0.0.0/16")
+	require.NoError(t, err)
+	messages := make([]string, len(entries))
+	for i, entry := range entries {
+		messages[i] = entry.Message
+		assert.Equal(t, "Test", entry.Author)
+	}
+	assert.ElementsMatch(t, []string{
+		"ipam: add block 10.0.0.0/16 to default",
+		"ipam: create subnet 10.0.1.0/24 (app) in block 10.0.0.0/16",
+	}, messages)
+
+	entries, err = History(cfg, "10.0.2.7/24")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "Add database subnet", entries[0].Message)
+
+	_, err = History(cfg, "not-a-cidr")
+	assert.Error(t, err)
+}
+
+func TestHistoryMatchesWholeCIDR(t *testing.T) {
+	cfg := newGitRepo(t)
+
+	_, err := AddBlock(cfg, "110.0.0.0/16", "test", "", "default", true)
+	require.NoError(t, err)
+	require.NoError(t, CommitChange(cfg, "ipam: add block 110.0.0.0/16 to default", "default"))
+	_, err = AddBlock(cfg, "10.0.0.0/16", "test", "", "default", false)
+	require.NoError(t, err)
+	require.NoError(t, CommitChange(cfg, "ipam: add block 10.0.0.0/16 to default", "default"))
+
+	// 10.0.0.0/16 is a suffix of 110.0.0.0/16, but only its own commit matches
+	entries, err := History(cfg, "10.0.0.0/16")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "ipam: add block 10.0.0.0/16 to default", entries[0].Message)
+
+	entries, err = History(cfg, "110.0.0.0/16")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "ipam: add block 110.0.0.0/16 to default", entries[0].Message)
+}
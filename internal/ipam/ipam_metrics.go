@@ -0,0 +1,215 @@
+package ipam
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/logger"
+)
+
+// metricFamily is a metric in the Prometheus text exposition format
+type metricFamily struct {
+	name    string
+	help    string
+	samples []metricSample
+}
+
+// metricSample is a single labeled value of a metric family
+type metricSample struct {
+	labels []string // alternating label names and values
+	value  string
+}
+
+func (f *metricFamily) add(value string, labels ...string) {
+	f.samples = append(f.samples, metricSample{labels: labels, value: value})
+}
+
+// collectMetrics gathers the utilization of every block and the validation
+// results of every block file. Block files and blocks that cannot be read are
+// skipped; they show up in the validation counts.
+func collectMetrics(cfg *config.Config) ([]*metricFamily, error) {
+	total := &metricFamily{name: "openipam_block_total_ips", help: "Number of addresses in the block."}
+	allocated := &metricFamily{name: "openipam_block_allocated_ips", help: "Number of addresses allocated to subnets of the block."}
+	available := &metricFamily{name: "openipam_block_available_ips", help: "Number of addresses of the block not allocated to a subnet."}
+	utilization := &metricFamily{name: "openipam_block_utilization_ratio", help: "Allocated addresses divided by the addresses of the block."}
+	largestFree := &metricFamily{name: "openipam_block_largest_free_prefix", help: "Prefix length of the largest free range of the block; absent when the block is full."}
+	subnets := &metricFamily{name: "openipam_block_subnets", help: "Number of subnets in the block by region."}
+	validation := &metricFamily{name: "openipam_validation_results", help: "Number of validation results by block file and severity."}
+
+	for _, fileKey := range SortedFileKeys(cfg) {
+		reports, err := CalculateAllBlocksUtilization(cfg, fileKey)
+		if err != nil {
+			logger.Debug("Skipping block file %s in metrics: %v", fileKey, err)
+		}
+
+		for _, report := range reports {
+			labels := []string{"file", fileKey, "block", report.CIDR}
+			total.add(formatMetricInt(report.TotalIPs), labels...)
+			allocated.add(formatMetricInt(report.AllocatedIPs), labels...)
+			available.add(formatMetricInt(report.AvailableIPs), labels...)
+			utilization.add(strconv.FormatFloat(report.UtilizationRatio, 'g', -1, 64), labels...)
+			if report.Fragmentation != nil && report.Fragmentation.LargestFreePrefix >= 0 {
+				largestFree.add(strconv.Itoa(report.Fragmentation.LargestFreePrefix), labels...)
+			}
+
+			regions := make(map[string]int)
+			for _, subnet := range report.Subnets {
+				regions[subnet.Region]++
+			}
+			for _, region := range sortedKeys(regions) {
+				subnets.add(strconv.Itoa(regions[region]), "file", fileKey, "block", report.CIDR, "region", region)
+			}
+		}
+	}
+
+	// The same checks as ValidateAllBlockFiles, counted instead of printed
+	counts := make(map[string]map[string]int)
+	count := func(results *ValidationResults, fileKey string) {
+		for _, result := range results.Results {
+			file := result.File
+			if file == "" {
+				file = fileKey
+			}
+			if counts[file] == nil {
+				counts[file] = map[string]int{"error": 0, "warning": 0}
+			}
+			counts[file][result.Type]++
+		}
+	}
+	for _, fileKey := range SortedFileKeys(cfg) {
+		counts[fileKey] = map[string]int{"error": 0, "warning": 0}
+		results, err := ValidateBlockFile(cfg, fileKey)
+		if err != nil {
+			logger.Debug("Error validating block file %s: %v", fileKey, err)
+			continue
+		}
+		count(results, fileKey)
+	}
+	crossResults, err := ValidateCrossFile(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error validating across block files: %w", err)
+	}
+	count(crossResults, "")
+
+	files := make([]string, 0, len(counts))
+	for file := range counts {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		for _, severity := range sortedKeys(counts[file]) {
+			validation.add(strconv.Itoa(counts[file][severity]), "file", file, "severity", severity)
+		}
+	}
+
+	return []*metricFamily{total, allocated, available, utilization, largestFree, subnets, validation}, nil
+}
+
+// WriteMetrics writes the block utilization and validation metrics of all block
+// files in the Prometheus text exposition format
+func WriteMetrics(w io.Writer, cfg *config.Config) error {
+	families, err := collectMetrics(cfg)
+	if err != nil {
+		return err
+	}
+
+	ew := &errWriter{w: w}
+	for _, f := range families {
+		ew.printf("# HELP %s %s\n", f.name, f.help)
+		ew.printf("# TYPE %s gauge\n", f.name)
+		for _, s := range f.samples {
+			ew.printf("%s%s %s\n", f.name, formatMetricLabels(s.labels), s.value)
+		}
+	}
+	return ew.err
+}
+
+// WriteMetricsFile writes the metrics to a file for the node_exporter textfile
+// collector. The file is replaced atomically so that the collector never reads
+// a partial file.
+func WriteMetricsFile(path string, cfg *config.Config) error {
+	var buf bytes.Buffer
+	if err := WriteMetrics(&buf, cfg); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("error creating metrics file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing metrics file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing metrics file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("error writing metrics file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error writing metrics file: %w", err)
+	}
+	return nil
+}
+
+// MetricsHandler serves the metrics over HTTP. Block files are re-read on every scrape.
+func MetricsHandler(cfg *config.Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		if err := WriteMetrics(&buf, cfg); err != nil {
+			logger.Debug("Error collecting metrics: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			logger.Debug("Error writing metrics response: %v", err)
+		}
+	})
+}
+
+// formatMetricInt formats an address count as a sample value; counts beyond
+// 64 bits are written in exponent notation
+func formatMetricInt(n *big.Int) string {
+	if n.IsInt64() {
+		return n.String()
+	}
+	return new(big.Float).SetInt(n).Text('g', -1)
+}
+
+// metricLabelEscaper escapes label values as required by the exposition format
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatMetricLabels formats alternating label names and values as {name="value",...}
+func formatMetricLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", labels[i], metricLabelEscaper.Replace(labels[i+1])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,74 @@
+package ipam
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := &config.Config{BlockFiles: map[string]string{
+		"dev":  filepath.Join(tempDir, "dev.yaml"),
+		"prod": filepath.Join(tempDir, "prod.yaml"),
+	}}
+	for fileKey, blocks := range map[string][]Block{
+		"dev": {{
+			CIDR: "10.0.0.0/24",
+			Subnets: []Subnet{
+				{CIDR: "10.0.0.0/26", Name: "app", Region: "us-east1"},
+				{CIDR: "10.0.0.64/26", Name: "db", Region: "us-east1"},
+				{CIDR: "10.0.0.128/25", Name: "edge", Region: "eu-west1"},
+			},
+		}},
+		"prod": {{CIDR: "10.1.0.0/16", Subnets: []Subnet{{CIDR: "10.1.0.0/24", Name: "app", Region: "us-east1"}}}},
+	} {
+		yamlData, err := marshalBlocks(blocks)
+		require.NoError(t, err)
+		require.NoError(t, writeYAMLFile(cfg.BlockFiles[fileKey], yamlData))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteMetrics(&buf, cfg))
+	metrics := buf.String()
+
+	assert.Contains(t, metrics, "# TYPE openipam_block_total_ips gauge\n")
+	assert.Contains(t, metrics, `openipam_block_total_ips{file="dev",block="10.0.0.0/24"} 256`)
+	assert.Contains(t, metrics, `openipam_block_allocated_ips{file="dev",block="10.0.0.0/24"} 256`)
+	assert.Contains(t, metrics, `openipam_block_available_ips{file="prod",block="10.1.0.0/16"} 65280`)
+	assert.Contains(t, metrics, `openipam_block_utilization_ratio{file="dev",block="10.0.0.0/24"} 1`)
+	assert.Contains(t, metrics, `openipam_block_largest_free_prefix{file="prod",block="10.1.0.0/16"} 17`)
+	assert.NotContains(t, metrics, `openipam_block_largest_free_prefix{file="dev"`)
+	assert.Contains(t, metrics, `openipam_block_subnets{file="dev",block="10.0.0.0/24",region="us-east1"} 2`)
+	assert.Contains(t, metrics, `openipam_block_subnets{file="dev",block="10.0.0.0/24",region="eu-west1"} 1`)
+
+	// The subnet name used in both files is a cross-file warning
+	assert.Contains(t, metrics, `openipam_validation_results{file="prod",severity="error"} 0`)
+	assert.Regexp(t, `openipam_validation_results\{file="[^"]*",severity="warning"\} [1-9]`, metrics)
+
+	// The textfile collector output matches and the handler serves the same metrics
+	path := filepath.Join(tempDir, "openipam.prom")
+	require.NoError(t, WriteMetricsFile(path, cfg))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, metrics, string(data))
+
+	recorder := httptest.NewRecorder()
+	MetricsHandler(cfg).ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(recorder.Result().Body)
+	require.NoError(t, err)
+	assert.Equal(t, 200, recorder.Code)
+	assert.Equal(t, metrics, string(body))
+}
+
+func TestFormatMetricLabels(t *testing.T) {
+	assert.Equal(t, "", formatMetricLabels(nil))
+	assert.Equal(t, `{file="a\"b\\c",region=""}`, formatMetricLabels([]string{"file", `a"b\c`, "region", ""}))
+}
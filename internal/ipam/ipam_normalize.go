@@ -0,0 +1,139 @@
+package ipam
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/iprange"
+	"github.com/lugnut42/openipam/internal/logger"
+)
+
+// normalizeCIDR returns the canonical form of a CIDR: surrounding whitespace is
+// removed, host bits are cleared, IPv6 addresses are compressed and IPv4-mapped
+// IPv6 prefixes are written as IPv4, so that 10.0.1.7/24 becomes 10.0.1.0/24,
+// 2001:db8:0:0::/64 becomes 2001:db8::/64 and ::ffff:10.0.0.0/104 becomes 10.0.0.0/8.
+func normalizeCIDR(cidr string) (string, error) {
+	prefix, err := iprange.ParsePrefix(cidr)
+	if err != nil {
+		return "", err
+	}
+	return prefix.String(), nil
+}
+
+// CanonicalCIDR returns the canonical form of a CIDR, or the CIDR unchanged if
+// it cannot be parsed
+func CanonicalCIDR(cidr string) string {
+	normalized, err := normalizeCIDR(cidr)
+	if err != nil {
+		return cidr
+	}
+	return normalized
+}
+
+// cidrEqual reports whether two CIDR strings describe the same network.
+// Unparsable values fall back to a whitespace-insensitive string comparison.
+func cidrEqual(a, b string) bool {
+	prefixA, errA := iprange.ParsePrefix(a)
+	prefixB, errB := iprange.ParsePrefix(b)
+	if errA != nil || errB != nil {
+		return strings.TrimSpace(a) == strings.TrimSpace(b)
+	}
+	return prefixA == prefixB
+}
+
+// normalizeBlocks rewrites every block and subnet CIDR to canonical form and
+// keeps the block references of the given patterns in step. It returns a
+// description of each change and whether any block or pattern was modified.
+func normalizeBlocks(blocks []Block, patterns map[string]config.Pattern) (applied []string, blocksChanged, patternsChanged bool) {
+	for i := range blocks {
+		block := &blocks[i]
+
+		if canonical, err := normalizeCIDR(block.CIDR); err == nil && canonical != block.CIDR {
+			applied = append(applied, fmt.Sprintf("Normalized block CIDR %s to %s", block.CIDR, canonical))
+			for name, p := range patterns {
+				if p.Block == block.CIDR {
+					p.Block = canonical
+					patterns[name] = p
+					patternsChanged = true
+				}
+			}
+			block.CIDR = canonical
+			blocksChanged = true
+		}
+
+		for j := range block.Subnets {
+			subnet := &block.Subnets[j]
+			if canonical, err := normalizeCIDR(subnet.CIDR); err == nil && canonical != subnet.CIDR {
+				applied = append(applied, fmt.Sprintf("Normalized subnet CIDR %s to %s", subnet.CIDR, canonical))
+				subnet.CIDR = canonical
+				blocksChanged = true
+			}
+		}
+	}
+
+	// Pattern references written by hand may also be non-canonical
+	for name, p := range patterns {
+		if canonical, err := normalizeCIDR(p.Block); err == nil && canonical != p.Block {
+			applied = append(applied, fmt.Sprintf("Normalized block reference of pattern '%s' from %s to %s", name, p.Block, canonical))
+			p.Block = canonical
+			patterns[name] = p
+			patternsChanged = true
+		}
+	}
+
+	return applied, blocksChanged, patternsChanged
+}
+
+// NormalizeBlockFile migrates a block file so that every CIDR it contains, and
+// every pattern block reference for the file key, is stored in canonical form.
+func NormalizeBlockFile(cfg *config.Config, fileKey string) (*FixReport, error) {
+	logger.Debug("NormalizeBlockFile called with fileKey=%s", fileKey)
+
+	blockFile, ok := cfg.BlockFiles[fileKey]
+	if !ok {
+		return nil, &NotFoundError{Kind: "block file", Name: fileKey}
+	}
+
+	// fn may be retried, so the pattern changes are made to a copy that is
+	// only applied once the blocks are saved
+	report := &FixReport{FileKey: fileKey}
+	var patterns map[string]config.Pattern
+	patternsChanged := false
+	err := updateBlocks(cfg, fileKey, func(blocks []Block) ([]Block, error) {
+		yamlData, err := marshalBlocks(blocks)
+		if err != nil {
+			return nil, fmt.Errorf("error marshalling blocks: %w", err)
+		}
+		patterns = maps.Clone(cfg.Patterns[fileKey])
+
+		applied, blocksChanged, changed := normalizeBlocks(blocks, patterns)
+		report.Applied = applied
+		report.Diff = ""
+		patternsChanged = changed
+		if !blocksChanged {
+			return nil, errUnchanged
+		}
+
+		newYamlData, err := marshalBlocks(blocks)
+		if err != nil {
+			return nil, fmt.Errorf("error marshalling blocks: %w", err)
+		}
+		report.Diff = lineDiff(blockFile, string(yamlData), string(newYamlData))
+		return blocks, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error writing block file: %w", err)
+	}
+
+	if patternsChanged {
+		cfg.Patterns[fileKey] = patterns
+		if err := config.WriteConfig(cfg); err != nil {
+			return nil, fmt.Errorf("error writing configuration: %w", err)
+		}
+	}
+
+	logger.Debug("Normalized %d CIDRs in block file %s", len(report.Applied), fileKey)
+	return report, nil
+}
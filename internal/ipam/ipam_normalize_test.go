@@ -0,0 +1,114 @@
+package ipam
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeCIDR(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{input: "10.0.1.0/24", expected: "10.0.1.0/24"},
+		{input: "10.0.1.7/24", expected: "10.0.1.0/24"},
+		{input: " 10.0.0.0/16 ", expected: "10.0.0.0/16"},
+		{input: "2001:0db8:0000:0000::1/64", expected: "2001:db8::/64"},
+		{input: "2001:DB8::/32", expected: "2001:db8::/32"},
+		{input: "::ffff:10.0.1.0/120", expected: "10.0.1.0/24"},
+		{input: "10.0.0.256/24", wantErr: true},
+		{input: "not-a-cidr", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			result, err := normalizeCIDR(tc.input)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+
+	assert.True(t, cidrEqual("10.0.1.7/24", "10.0.1.0/24"))
+	assert.True(t, cidrEqual("2001:db8:0::/48", "2001:db8::/48"))
+	assert.False(t, cidrEqual("10.0.1.0/24", "10.0.1.0/25"))
+	assert.True(t, cidrEqual("::ffff:10.0.0.0/112", "10.0.0.0/16"))
+}
+
+func TestCanonicalLookups(t *testing.T) {
+	blockFile := filepath.Join(t.TempDir(), "default.yaml")
+	require.NoError(t, writeYAMLFile(blockFile, []byte("[]")))
+	cfg := &config.Config{BlockFiles: map[string]string{"default": blockFile}}
+
+	_, err := AddBlock(cfg, "10.0.3.4/16", "test block", "", "default", false)
+	require.NoError(t, err)
+	_, err = CreateSubnet(cfg, "10.0.0.0/16", "10.0.1.7/24", "app", "us-east1")
+	require.NoError(t, err)
+
+	yamlData, err := readYAMLFile(blockFile)
+	require.NoError(t, err)
+	blocks, err := unmarshalBlocks(yamlData)
+	require.NoError(t, err)
+	require.Len(t, blocks, 1)
+	assert.Equal(t, "10.0.0.0/16", blocks[0].CIDR)
+	assert.Equal(t, "10.0.1.0/24", blocks[0].Subnets[0].CIDR)
+
+	// IPv4-mapped IPv6 CIDRs are the IPv4 networks they map
+	var overlap *OverlapError
+	_, err = AddBlock(cfg, "::ffff:10.0.128.0/113", "mapped", "", "default", false)
+	assert.ErrorAs(t, err, &overlap)
+	_, err = CreateSubnet(cfg, "::ffff:10.0.0.0/112", "::ffff:10.0.1.128/121", "mapped", "us-east1")
+	assert.ErrorAs(t, err, &overlap)
+
+	assert.NoError(t, ShowSubnet(cfg, "10.0.1.0/24"))
+	assert.NoError(t, DeleteSubnet(cfg, "10.0.1.9/24", true))
+	assert.NoError(t, DeleteBlock(cfg, "10.0.0.0/16", true))
+}
+
+func TestNormalizeBlockFile(t *testing.T) {
+	tempDir := t.TempDir()
+	blockFile := filepath.Join(tempDir, "default.yaml")
+	yamlData, err := marshalBlocks([]Block{
+		{
+			CIDR:        "10.0.0.5/16",
+			Description: "legacy",
+			Subnets:     []Subnet{{CIDR: "10.0.1.7/24", Name: "app", Region: "us-east1"}},
+		},
+		{CIDR: "2001:0db8:0000::/48", Description: "v6"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, writeYAMLFile(blockFile, yamlData))
+
+	cfg := &config.Config{
+		BlockFiles: map[string]string{"default": blockFile},
+		ConfigFile: filepath.Join(tempDir, "ipam-config.yaml"),
+		Patterns: map[string]map[string]config.Pattern{
+			"default": {"app": {CIDRSize: 24, Block: "10.0.0.5/16"}},
+		},
+	}
+
+	report, err := NormalizeBlockFile(cfg, "default")
+	require.NoError(t, err)
+	assert.Len(t, report.Applied, 3)
+	assert.Equal(t, "10.0.0.0/16", cfg.Patterns["default"]["app"].Block)
+
+	loaded, err := config.LoadConfig(cfg.ConfigFile)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.0/16", loaded.Patterns["default"]["app"].Block)
+
+	yamlData, err = readYAMLFile(blockFile)
+	require.NoError(t, err)
+	blocks, err := unmarshalBlocks(yamlData)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.0/16", blocks[0].CIDR)
+	assert.Equal(t, "10.0.1.0/24", blocks[0].Subnets[0].CIDR)
+	assert.Equal(t, "2001:db8::/48", blocks[1].CIDR)
+}
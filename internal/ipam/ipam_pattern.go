@@ -2,69 +2,168 @@ package ipam
 
 import (
 	"fmt"
+	"regexp"
+	"sort"
 
 	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/iprange"
 	"github.com/lugnut42/openipam/internal/logger"
 )
 
-func CreatePattern(cfg *config.Config, name string, cidrSize int, environment, region, block, fileKey string) error {
-	logger.Debug("Creating pattern: %s", name)
+// Allocation strategies of a pattern, choosing among the free ranges of its
+// block that fit a subnet
+const (
+	StrategyFirstFit = "first-fit" // lowest address
+	StrategyBestFit  = "best-fit"  // smallest free range, keeping large ranges whole
+	StrategyLastFit  = "last-fit"  // highest address
+)
+
+// Tags set on the subnets allocated from a pattern
+const (
+	TagPattern     = "pattern"
+	TagEnvironment = "environment"
+)
+
+// defaultNameTemplate names subnets allocated from a pattern without a name template
+const defaultNameTemplate = "{pattern}-{ip}"
+
+// namePlaceholder matches the placeholders of a name template
+var namePlaceholder = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// AddPattern adds a pattern to the in-memory configuration without saving it
+func AddPattern(cfg *config.Config, name string, cidrSize int, environment, region, block, fileKey string) error {
+	return InsertPattern(cfg, name, config.Pattern{
+		CIDRSize:    cidrSize,
+		Environment: environment,
+		Region:      region,
+		Block:       block,
+	}, fileKey)
+}
+
+// InsertPattern adds a pattern with all its settings to the in-memory
+// configuration without saving it
+func InsertPattern(cfg *config.Config, name string, pattern config.Pattern, fileKey string) error {
+	logger.Debug("Adding pattern: %s", name)
+	if _, exists := cfg.Patterns[fileKey][name]; exists {
+		return fmt.Errorf("pattern %s already exists", name)
+	}
+	if err := validatePattern(cfg, &pattern, fileKey); err != nil {
+		return err
+	}
+
 	if cfg.Patterns == nil {
 		cfg.Patterns = make(map[string]map[string]config.Pattern)
 	}
-	patterns, ok := cfg.Patterns[fileKey]
-	if !ok {
-		patterns = make(map[string]config.Pattern)
-		cfg.Patterns[fileKey] = patterns
+	if cfg.Patterns[fileKey] == nil {
+		cfg.Patterns[fileKey] = make(map[string]config.Pattern)
 	}
+	cfg.Patterns[fileKey][name] = pattern
+	logger.Debug("Pattern added: %+v", pattern)
+	return nil
+}
 
-	if _, exists := patterns[name]; exists {
-		return fmt.Errorf("pattern %s already exists", name)
+// UpdatePattern replaces the settings of an existing pattern in the in-memory
+// configuration without saving it. Subnets already allocated are not changed.
+func UpdatePattern(cfg *config.Config, name string, pattern config.Pattern, fileKey string) error {
+	logger.Debug("Updating pattern: %s", name)
+	if _, err := FindPattern(cfg, name, fileKey); err != nil {
+		return err
+	}
+	if err := validatePattern(cfg, &pattern, fileKey); err != nil {
+		return err
 	}
 
+	cfg.Patterns[fileKey][name] = pattern
+	logger.Debug("Pattern updated: %+v", pattern)
+	return nil
+}
+
+// validatePattern checks the settings of a pattern for a block file and
+// normalizes its block and preferred range to the form stored in the block file
+func validatePattern(cfg *config.Config, pattern *config.Pattern, fileKey string) error {
 	// Validate CIDR size
-	if cidrSize < 0 || cidrSize > 32 {
-		return fmt.Errorf("invalid CIDR size: %d", cidrSize)
+	if pattern.CIDRSize < 0 || pattern.CIDRSize > 32 {
+		return fmt.Errorf("invalid CIDR size: %d", pattern.CIDRSize)
 	}
 
 	// Ensure the block exists
-	blockFile, ok := cfg.BlockFiles[fileKey]
-	if !ok {
-		return fmt.Errorf("block file for key %s not found", fileKey)
+	if _, ok := cfg.BlockFiles[fileKey]; !ok {
+		return &NotFoundError{Kind: "block file", Name: fileKey}
 	}
 
-	yamlData, err := readYAMLFile(blockFile)
+	blocks, err := loadBlocks(cfg, fileKey)
 	if err != nil {
-		return fmt.Errorf("error reading YAML file: %w", err)
-	}
-
-	blocks, err := unmarshalBlocks(yamlData)
-	if err != nil {
-		return fmt.Errorf("error unmarshalling YAML data: %w", err)
+		return fmt.Errorf("error reading blocks: %w", err)
 	}
 
 	blockExists := false
 	for _, b := range blocks {
-		if b.CIDR == block {
+		if cidrEqual(b.CIDR, pattern.Block) {
+			pattern.Block = b.CIDR
 			blockExists = true
 			break
 		}
 	}
 
 	if !blockExists {
-		return fmt.Errorf("block %s not found", block)
+		return &NotFoundError{Kind: "block", Name: pattern.Block, FileKey: fileKey}
 	}
 
-	pattern := config.Pattern{
-		CIDRSize:    cidrSize,
-		Environment: environment,
-		Region:      region,
-		Block:       block,
+	switch pattern.Strategy {
+	case "", StrategyFirstFit, StrategyBestFit, StrategyLastFit:
+	default:
+		return fmt.Errorf("invalid allocation strategy %q (use %s, %s or %s)", pattern.Strategy, StrategyFirstFit, StrategyBestFit, StrategyLastFit)
 	}
 
-	patterns[name] = pattern
-	logger.Debug("Pattern created: %+v", pattern)
-	return config.WriteConfig(cfg)
+	if pattern.PreferredRange != "" {
+		preferred, err := iprange.ParsePrefix(pattern.PreferredRange)
+		if err != nil {
+			return fmt.Errorf("invalid preferred range %s: %w", pattern.PreferredRange, err)
+		}
+		blockPrefix, err := iprange.ParsePrefix(pattern.Block)
+		if err != nil {
+			return fmt.Errorf("invalid block CIDR %s: %w", pattern.Block, err)
+		}
+		if !iprange.Covers(blockPrefix, preferred) {
+			return fmt.Errorf("preferred range %s is not within block %s", pattern.PreferredRange, pattern.Block)
+		}
+		if preferred.Bits() > pattern.CIDRSize {
+			return fmt.Errorf("preferred range %s is smaller than the /%d subnets of the pattern", pattern.PreferredRange, pattern.CIDRSize)
+		}
+		pattern.PreferredRange = preferred.String()
+	}
+
+	if pattern.NameTemplate != "" {
+		if _, err := expandNameTemplate(pattern.NameTemplate, nil); err != nil {
+			return err
+		}
+	}
+
+	if pattern.MaxSubnets < 0 {
+		return fmt.Errorf("invalid maximum subnet count: %d", pattern.MaxSubnets)
+	}
+	return nil
+}
+
+// expandNameTemplate replaces the placeholders of a subnet name template with
+// their values. With nil values it only checks the placeholders are known.
+func expandNameTemplate(template string, values map[string]string) (string, error) {
+	var unknown string
+	name := namePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		key := placeholder[1 : len(placeholder)-1]
+		switch key {
+		case "pattern", "env", "region", "ip", "index":
+			return values[key]
+		}
+		if unknown == "" {
+			unknown = placeholder
+		}
+		return placeholder
+	})
+	if unknown != "" {
+		return "", fmt.Errorf("unknown placeholder %s in name template %q (use {pattern}, {env}, {region}, {ip} or {index})", unknown, template)
+	}
+	return name, nil
 }
 
 func ListPatterns(cfg *config.Config, fileKey string) error {
@@ -74,42 +173,90 @@ func ListPatterns(cfg *config.Config, fileKey string) error {
 		return fmt.Errorf("no patterns found for file key %s", fileKey)
 	}
 
-	for name, pattern := range patterns {
-		fmt.Printf("Name: %s, CIDR Size: %d, Environment: %s, Region: %s, Block: %s\n",
-			name, pattern.CIDRSize, pattern.Environment, pattern.Region, pattern.Block)
-	}
+	PrintPatterns(patterns)
 	return nil
 }
 
-func ShowPattern(cfg *config.Config, name, fileKey string) error {
-	logger.Debug("Showing pattern: %s", name)
+// PrintPatterns prints patterns sorted by name
+func PrintPatterns(patterns map[string]config.Pattern) {
+	names := make([]string, 0, len(patterns))
+	for name := range patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		PrintPattern(name, patterns[name])
+	}
+}
+
+// PrintPattern prints a single pattern
+func PrintPattern(name string, pattern config.Pattern) {
+	line := fmt.Sprintf("Name: %s, CIDR Size: %d, Environment: %s, Region: %s, Block: %s",
+		name, pattern.CIDRSize, pattern.Environment, pattern.Region, pattern.Block)
+
+	// Optional settings are only shown when set
+	if pattern.Description != "" {
+		line += ", Description: " + pattern.Description
+	}
+	if len(pattern.Tags) > 0 {
+		line += ", Tags: {" + formatTags(pattern.Tags) + "}"
+	}
+	if pattern.NameTemplate != "" {
+		line += ", Name Template: " + pattern.NameTemplate
+	}
+	if pattern.Strategy != "" {
+		line += ", Strategy: " + pattern.Strategy
+	}
+	if pattern.PreferredRange != "" {
+		line += ", Preferred Range: " + pattern.PreferredRange
+	}
+	if pattern.MaxSubnets > 0 {
+		line += fmt.Sprintf(", Max Subnets: %d", pattern.MaxSubnets)
+	}
+	fmt.Println(line)
+}
+
+// FindPattern returns the pattern with the given name for a block file key
+func FindPattern(cfg *config.Config, name, fileKey string) (*config.Pattern, error) {
 	patterns, ok := cfg.Patterns[fileKey]
 	if !ok {
-		return fmt.Errorf("no patterns found for file key %s", fileKey)
+		return nil, &NotFoundError{Kind: "pattern", Name: name, FileKey: fileKey}
 	}
 
 	pattern, ok := patterns[name]
 	if !ok {
-		return fmt.Errorf("pattern %s not found", name)
+		return nil, &NotFoundError{Kind: "pattern", Name: name, FileKey: fileKey}
 	}
+	return &pattern, nil
+}
 
-	fmt.Printf("Name: %s, CIDR Size: %d, Environment: %s, Region: %s, Block: %s\n",
-		name, pattern.CIDRSize, pattern.Environment, pattern.Region, pattern.Block)
+func ShowPattern(cfg *config.Config, name, fileKey string) error {
+	logger.Debug("Showing pattern: %s", name)
+	pattern, err := FindPattern(cfg, name, fileKey)
+	if err != nil {
+		return err
+	}
+
+	PrintPattern(name, *pattern)
 	return nil
 }
 
-func DeletePattern(cfg *config.Config, name, fileKey string) error {
-	logger.Debug("Deleting pattern: %s", name)
-	patterns, ok := cfg.Patterns[fileKey]
-	if !ok {
-		return fmt.Errorf("no patterns found for file key %s", fileKey)
+// RemovePattern removes a pattern from the in-memory configuration without saving it
+func RemovePattern(cfg *config.Config, name, fileKey string) error {
+	if _, err := FindPattern(cfg, name, fileKey); err != nil {
+		return err
 	}
 
-	if _, exists := patterns[name]; !exists {
-		return fmt.Errorf("pattern %s not found", name)
-	}
+	delete(cfg.Patterns[fileKey], name)
+	logger.Debug("Pattern removed: %s", name)
+	return nil
+}
 
-	delete(patterns, name)
-	logger.Debug("Pattern deleted: %s", name)
+func DeletePattern(cfg *config.Config, name, fileKey string) error {
+	logger.Debug("Deleting pattern: %s", name)
+	if err := RemovePattern(cfg, name, fileKey); err != nil {
+		return err
+	}
 	return config.WriteConfig(cfg)
 }
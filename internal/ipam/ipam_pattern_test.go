@@ -1,10 +1,13 @@
 package ipam
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/lugnut42/openipam/internal/config"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPatternBasicFunctions(t *testing.T) {
@@ -47,4 +50,129 @@ func TestPatternBasicFunctions(t *testing.T) {
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "not found")
 	})
-}
\ No newline at end of file
+}
+
+// newPatternConfig returns a configuration with a /22 block whose first /25 is allocated
+func newPatternConfig(t *testing.T) *config.Config {
+	t.Helper()
+	blockFile := filepath.Join(t.TempDir(), "default.yaml")
+	require.NoError(t, os.WriteFile(blockFile, []byte(`- cidr: 10.0.0.0/22
+  description: Test
+  subnets:
+  - cidr: 10.0.0.0/25
+    name: existing
+    region: us-east1
+`), 0644))
+	return &config.Config{BlockFiles: map[string]string{"default": blockFile}}
+}
+
+func TestUpdatePattern(t *testing.T) {
+	cfg := newPatternConfig(t)
+	require.NoError(t, AddPattern(cfg, "web", 26, "dev", "us-east1", "10.0.0.0/22", "default"))
+
+	pattern := cfg.Patterns["default"]["web"]
+	pattern.CIDRSize = 27
+	pattern.Strategy = StrategyBestFit
+	pattern.PreferredRange = "10.0.2.5/23"
+	pattern.Tags = map[string]string{"team": "web"}
+	require.NoError(t, UpdatePattern(cfg, "web", pattern, "default"))
+
+	updated, err := FindPattern(cfg, "web", "default")
+	require.NoError(t, err)
+	assert.Equal(t, 27, updated.CIDRSize)
+	assert.Equal(t, "10.0.2.0/23", updated.PreferredRange)
+	assert.Equal(t, map[string]string{"team": "web"}, updated.Tags)
+
+	var notFound *NotFoundError
+	assert.ErrorAs(t, UpdatePattern(cfg, "missing", pattern, "default"), &notFound)
+
+	invalid := []struct {
+		name   string
+		change func(*config.Pattern)
+		err    string
+	}{
+		{"strategy", func(p *config.Pattern) { p.Strategy = "worst-fit" }, "invalid allocation strategy"},
+		{"preferred range outside block", func(p *config.Pattern) { p.PreferredRange = "10.1.0.0/24" }, "not within block"},
+		{"preferred range too small", func(p *config.Pattern) { p.PreferredRange = "10.0.2.0/28" }, "smaller than the /27 subnets"},
+		{"name template", func(p *config.Pattern) { p.NameTemplate = "{pattern}-{zone}" }, "unknown placeholder {zone}"},
+		{"max subnets", func(p *config.Pattern) { p.MaxSubnets = -1 }, "invalid maximum subnet count"},
+		{"block", func(p *config.Pattern) { p.Block = "10.9.0.0/16" }, "not found"},
+	}
+	for _, tc := range invalid {
+		t.Run(tc.name, func(t *testing.T) {
+			changed := *updated
+			tc.change(&changed)
+			assert.ErrorContains(t, UpdatePattern(cfg, "web", changed, "default"), tc.err)
+		})
+	}
+
+	// Failed updates leave the pattern unchanged
+	assert.Equal(t, *updated, cfg.Patterns["default"]["web"])
+}
+
+func TestAllocateSubnetFromPatternSettings(t *testing.T) {
+	allocate := func(t *testing.T, cfg *config.Config) *Subnet {
+		t.Helper()
+		subnet, _, err := AllocateSubnetFromPattern(cfg, "web", "default")
+		require.NoError(t, err)
+		return subnet
+	}
+
+	t.Run("tags and name template", func(t *testing.T) {
+		cfg := newPatternConfig(t)
+		require.NoError(t, InsertPattern(cfg, "web", config.Pattern{
+			CIDRSize: 26, Environment: "prod", Region: "us-east1", Block: "10.0.0.0/22",
+			Tags: map[string]string{"team": "web"}, NameTemplate: "{env}-{region}-web-{index}", MaxSubnets: 2,
+		}, "default"))
+
+		subnet := allocate(t, cfg)
+		assert.Equal(t, "10.0.0.128/26", subnet.CIDR)
+		assert.Equal(t, "prod-us-east1-web-1", subnet.Name)
+		assert.Equal(t, map[string]string{"team": "web", TagEnvironment: "prod", TagPattern: "web"}, subnet.Tags)
+		assert.Equal(t, "prod-us-east1-web-2", allocate(t, cfg).Name)
+
+		_, _, err := AllocateSubnetFromPattern(cfg, "web", "default")
+		assert.ErrorContains(t, err, "maximum of 2 subnets")
+
+		// Subnets of the pattern are found by environment in search
+		results, err := Search(cfg, "type:subnet env:prod")
+		require.NoError(t, err)
+		assert.Len(t, results, 2)
+	})
+
+	t.Run("default name", func(t *testing.T) {
+		cfg := newPatternConfig(t)
+		require.NoError(t, AddPattern(cfg, "web", 26, "", "us-east1", "10.0.0.0/22", "default"))
+		subnet := allocate(t, cfg)
+		assert.Equal(t, "web-10.0.0.128", subnet.Name)
+		assert.Equal(t, map[string]string{TagPattern: "web"}, subnet.Tags)
+	})
+
+	// Free ranges: 10.0.0.128/25, 10.0.1.64/26, 10.0.1.128/25 and 10.0.2.0/23
+	strategies := []struct {
+		strategy  string
+		preferred string
+		expected  string
+	}{
+		{StrategyFirstFit, "", "10.0.0.128/26"},
+		{StrategyBestFit, "", "10.0.1.64/26"},
+		{StrategyLastFit, "", "10.0.3.192/26"},
+		{StrategyFirstFit, "10.0.2.0/23", "10.0.2.0/26"},
+		{StrategyLastFit, "10.0.2.0/24", "10.0.2.192/26"},
+		{StrategyBestFit, "10.0.0.0/23", "10.0.1.64/26"},
+		// A full preferred range falls back to the rest of the block
+		{StrategyLastFit, "10.0.0.0/25", "10.0.3.192/26"},
+	}
+	for _, tc := range strategies {
+		t.Run(tc.strategy+" "+tc.preferred, func(t *testing.T) {
+			cfg := newPatternConfig(t)
+			_, err := CreateSubnet(cfg, "10.0.0.0/22", "10.0.1.0/26", "other", "us-east1")
+			require.NoError(t, err)
+			require.NoError(t, InsertPattern(cfg, "web", config.Pattern{
+				CIDRSize: 26, Region: "us-east1", Block: "10.0.0.0/22", Strategy: tc.strategy, PreferredRange: tc.preferred,
+			}, "default"))
+
+			assert.Equal(t, tc.expected, allocate(t, cfg).CIDR)
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package ipam
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/iprange"
+	"github.com/lugnut42/openipam/internal/logger"
+)
+
+// allFilesPolicyKey is the policies key that applies to every block file
+const allFilesPolicyKey = "*"
+
+// policiesFor returns the policies that apply to the given block file key
+func policiesFor(cfg *config.Config, fileKey string) []config.Policy {
+	var policies []config.Policy
+	policies = append(policies, cfg.Policies[allFilesPolicyKey]...)
+	if fileKey != allFilesPolicyKey {
+		policies = append(policies, cfg.Policies[fileKey]...)
+	}
+	return policies
+}
+
+// policySeverity returns the validation result type for a policy
+func policySeverity(policy config.Policy) string {
+	if strings.EqualFold(policy.Severity, config.SeverityWarning) {
+		return "warning"
+	}
+	return "error"
+}
+
+// checkBlockPolicies evaluates the policies that apply to a block's own CIDR
+func checkBlockPolicies(policies []config.Policy, fileKey string, block Block, location string) []ValidationResult {
+	var results []ValidationResult
+
+	blockPrefix, err := iprange.ParsePrefix(block.CIDR)
+	if err != nil {
+		return results // Invalid CIDRs are reported elsewhere
+	}
+
+	for _, policy := range policies {
+		if policy.DenyPublic && isPublicNetwork(blockPrefix) {
+			results = append(results, ValidationResult{
+				Type:        policySeverity(policy),
+				File:        fileKey,
+				Category:    "policy",
+				Description: fmt.Sprintf("Policy '%s': block %s is in public address space", policy.Name, block.CIDR),
+				Location:    location,
+			})
+		}
+	}
+
+	return results
+}
+
+// checkSubnetPolicies evaluates the policies that apply to a single subnet
+func checkSubnetPolicies(policies []config.Policy, fileKey string, subnet Subnet, location string) []ValidationResult {
+	var results []ValidationResult
+
+	subnetPrefix, err := iprange.ParsePrefix(subnet.CIDR)
+	if err != nil {
+		return results // Invalid CIDRs are reported elsewhere
+	}
+	prefixLen := subnetPrefix.Bits()
+
+	for _, policy := range policies {
+		violation := func(format string, args ...interface{}) {
+			results = append(results, ValidationResult{
+				Type:        policySeverity(policy),
+				File:        fileKey,
+				Category:    "policy",
+				Description: fmt.Sprintf("Policy '%s': ", policy.Name) + fmt.Sprintf(format, args...),
+				Location:    location,
+			})
+		}
+
+		if policy.MinPrefix > 0 && prefixLen < policy.MinPrefix {
+			violation("subnet %s is larger than /%d", subnet.CIDR, policy.MinPrefix)
+		}
+
+		if policy.MaxPrefix > 0 && prefixLen > policy.MaxPrefix {
+			violation("subnet %s is smaller than /%d", subnet.CIDR, policy.MaxPrefix)
+		}
+
+		if policy.NamePattern != "" {
+			re, err := regexp.Compile(policy.NamePattern)
+			if err != nil {
+				violation("invalid name pattern %q: %s", policy.NamePattern, err)
+			} else if !re.MatchString(subnet.Name) {
+				violation("subnet name '%s' does not match %s", subnet.Name, policy.NamePattern)
+			}
+		}
+
+		if len(policy.AllowedRegions) > 0 {
+			allowed := false
+			for _, region := range policy.AllowedRegions {
+				if region == subnet.Region {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				violation("region '%s' is not in the allowed list %v", subnet.Region, policy.AllowedRegions)
+			}
+		}
+
+		if policy.DenyPublic && isPublicNetwork(subnetPrefix) {
+			violation("subnet %s is in public address space", subnet.CIDR)
+		}
+	}
+
+	return results
+}
+
+// validatePolicies evaluates the configured policies against every block and subnet
+func validatePolicies(blocks []Block, cfg *config.Config, fileKey string, results *ValidationResults) {
+	policies := policiesFor(cfg, fileKey)
+	if len(policies) == 0 {
+		return
+	}
+
+	for _, block := range blocks {
+		results.Results = append(results.Results,
+			checkBlockPolicies(policies, fileKey, block, fmt.Sprintf("blocks.%s", block.CIDR))...)
+
+		for i, subnet := range block.Subnets {
+			location := fmt.Sprintf("blocks.%s.subnets[%d]", block.CIDR, i)
+			results.Results = append(results.Results,
+				checkSubnetPolicies(policies, fileKey, subnet, location)...)
+		}
+	}
+}
+
+// enforceSubnetPolicies checks a subnet against the policies before it is created.
+// Error-level violations are returned as an error; warnings are returned for
+// the caller to report.
+func enforceSubnetPolicies(cfg *config.Config, fileKey string, subnet Subnet) ([]string, error) {
+	policies := policiesFor(cfg, fileKey)
+	if len(policies) == 0 {
+		return nil, nil
+	}
+
+	var violations, warnings []string
+	for _, r := range checkSubnetPolicies(policies, fileKey, subnet, subnet.CIDR) {
+		if r.Type == "error" {
+			violations = append(violations, r.Description)
+		} else {
+			logger.Debug("Policy warning for subnet %s: %s", subnet.CIDR, r.Description)
+			warnings = append(warnings, r.Description)
+		}
+	}
+
+	if len(violations) > 0 {
+		return nil, fmt.Errorf("subnet %s violates policy: %s", subnet.CIDR, strings.Join(violations, "; "))
+	}
+	return warnings, nil
+}
@@ -0,0 +1,110 @@
+package ipam
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckSubnetPolicies(t *testing.T) {
+	policies := []config.Policy{
+		{Name: "prod-size", MinPrefix: 24},
+		{Name: "naming", NamePattern: "^[a-z]+-[a-z0-9-]+$"},
+		{Name: "regions", AllowedRegions: []string{"us-east1", "us-west1"}, Severity: "warning"},
+		{Name: "no-public", DenyPublic: true},
+	}
+
+	testCases := []struct {
+		name     string
+		subnet   Subnet
+		errors   int
+		warnings int
+	}{
+		{
+			name:   "Compliant subnet",
+			subnet: Subnet{CIDR: "10.0.1.0/24", Name: "app-tier", Region: "us-east1"},
+		},
+		{
+			name:   "Subnet too large",
+			subnet: Subnet{CIDR: "10.0.0.0/20", Name: "app-tier", Region: "us-east1"},
+			errors: 1,
+		},
+		{
+			name:   "Bad name",
+			subnet: Subnet{CIDR: "10.0.1.0/24", Name: "AppTier", Region: "us-east1"},
+			errors: 1,
+		},
+		{
+			name:     "Region not allowed",
+			subnet:   Subnet{CIDR: "10.0.1.0/24", Name: "app-tier", Region: "eu-west1"},
+			warnings: 1,
+		},
+		{
+			name:   "Public range",
+			subnet: Subnet{CIDR: "8.8.8.0/24", Name: "app-tier", Region: "us-east1"},
+			errors: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			results := checkSubnetPolicies(policies, "prod", tc.subnet, "test")
+			errors, warnings := 0, 0
+			for _, r := range results {
+				if r.Type == "error" {
+					errors++
+				} else {
+					warnings++
+				}
+			}
+			assert.Equal(t, tc.errors, errors)
+			assert.Equal(t, tc.warnings, warnings)
+		})
+	}
+}
+
+func TestPolicyEnforcement(t *testing.T) {
+	tempDir := t.TempDir()
+	blockFile := filepath.Join(tempDir, "prod.yaml")
+	require.NoError(t, writeYAMLFile(blockFile, []byte("[]")))
+
+	cfg := &config.Config{
+		BlockFiles: map[string]string{"prod": blockFile},
+		Patterns: map[string]map[string]config.Pattern{
+			"prod": {
+				"big": {CIDRSize: 20, Region: "us-east1", Block: "10.0.0.0/16"},
+			},
+		},
+		Policies: map[string][]config.Policy{
+			"prod": {{Name: "prod-size", MinPrefix: 24}},
+		},
+	}
+
+	_, err := AddBlock(cfg, "10.0.0.0/16", "prod block", "", "prod", false)
+	require.NoError(t, err)
+
+	_, err = CreateSubnet(cfg, "10.0.0.0/16", "10.0.0.0/20", "app-tier", "us-east1")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "prod-size")
+
+	err = CreateSubnetFromPattern(cfg, "big", "prod")
+	assert.Error(t, err)
+
+	_, err = CreateSubnet(cfg, "10.0.0.0/16", "10.0.1.0/24", "app-tier", "us-east1")
+	assert.NoError(t, err)
+
+	// Policies keyed by "*" apply to every file and are reported by validation
+	cfg.Policies["*"] = []config.Policy{{Name: "naming", NamePattern: "^db-", Severity: "warning"}}
+	results, err := ValidateBlockFile(cfg, "prod")
+	require.NoError(t, err)
+	assert.Equal(t, 0, results.ErrorCount)
+	assert.Equal(t, 1, results.WarningCount)
+
+	// Warning-level violations are returned to the caller, not printed
+	warnings, err := CreateSubnet(cfg, "10.0.0.0/16", "10.0.2.0/24", "web-tier", "us-east1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Policy 'naming': subnet name 'web-tier' does not match ^db-"}, warnings)
+}
@@ -0,0 +1,427 @@
+package ipam
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/iprange"
+)
+
+// Kinds of entities returned by Search
+const (
+	KindBlock   = "block"
+	KindSubnet  = "subnet"
+	KindPattern = "pattern"
+)
+
+// Status of a search result
+const (
+	StatusEmpty     = "empty"     // block without subnets
+	StatusPartial   = "partial"   // block with subnets and free space
+	StatusFull      = "full"      // block without free space
+	StatusAllocated = "allocated" // subnet within its block
+	StatusActive    = "active"    // pattern whose block exists
+	StatusOrphaned  = "orphaned"  // pattern whose block does not exist
+	StatusInvalid   = "invalid"   // block or subnet with an unparsable CIDR, or a subnet outside its block
+)
+
+var searchStatuses = []string{StatusEmpty, StatusPartial, StatusFull, StatusAllocated, StatusActive, StatusOrphaned, StatusInvalid}
+
+// SearchResult is a block, subnet or pattern matching a search query
+type SearchResult struct {
+	Kind    string `json:"kind"`
+	FileKey string `json:"file_key"`
+
+	// CIDR is the block a pattern allocates from for patterns, which is also
+	// what contains and within match
+	CIDR string `json:"cidr"`
+
+	// PrefixLen is the prefix length of the CIDR, or the size of the subnets
+	// a pattern allocates
+	PrefixLen int `json:"prefix_len"`
+
+	// Name is the description of a block and the name of a subnet or pattern
+	Name        string            `json:"name,omitempty"`
+	Region      string            `json:"region,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Block       string            `json:"block,omitempty"` // parent block of a subnet
+	Tags        map[string]string `json:"tags,omitempty"`
+	Status      string            `json:"status"`
+
+	prefix netip.Prefix
+}
+
+// Query is a parsed search query: a list of terms that must all match
+type Query struct {
+	terms []queryTerm
+}
+
+type queryTerm struct {
+	negate bool
+	match  func(*SearchResult) bool
+}
+
+// ParseQuery parses a search query. A query is a whitespace-separated list of
+// field:value terms that must all match; a term prefixed with - must not match.
+// Values containing spaces can be double-quoted. The fields are:
+//
+//	type:block|subnet|pattern   kind of entity
+//	name:GLOB or name:/REGEX/    subnet or pattern name, or block description
+//	region:GLOB                  region of a subnet or pattern
+//	env:GLOB                     environment of a pattern, or environment tag of a subnet
+//	tag:KEY or tag:KEY=GLOB      subnet tag
+//	file:GLOB                    block file key
+//	contains:IP|CIDR             the entity's CIDR contains the address or CIDR
+//	within:CIDR                  the entity's CIDR lies within the CIDR
+//	prefix:N, N-M, <N, <=N, >N, >=N  prefix length
+//	status:STATUS                empty, partial, full, allocated, active, orphaned or invalid
+//
+// A term without a field matches the name.
+func ParseQuery(query string) (*Query, error) {
+	tokens, err := splitQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Query{}
+	for _, token := range tokens {
+		term := queryTerm{}
+		if strings.HasPrefix(token, "-") && len(token) > 1 {
+			term.negate = true
+			token = token[1:]
+		}
+
+		field, value, ok := strings.Cut(token, ":")
+		if !ok {
+			field, value = "name", token
+		}
+		term.match, err = parseTerm(strings.ToLower(field), value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid search term %q: %w", token, err)
+		}
+		q.terms = append(q.terms, term)
+	}
+	return q, nil
+}
+
+// splitQuery splits a query at whitespace outside double quotes and removes the quotes
+func splitQuery(query string) ([]string, error) {
+	var tokens []string
+	var token strings.Builder
+	inToken, quoted := false, false
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inToken = true
+		case !quoted && (r == ' ' || r == '\t' || r == '\n'):
+			if inToken {
+				tokens = append(tokens, token.String())
+				token.Reset()
+				inToken = false
+			}
+		default:
+			token.WriteRune(r)
+			inToken = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in search query")
+	}
+	if inToken {
+		tokens = append(tokens, token.String())
+	}
+	return tokens, nil
+}
+
+func parseTerm(field, value string) (func(*SearchResult) bool, error) {
+	if value == "" {
+		return nil, fmt.Errorf("missing value")
+	}
+
+	switch field {
+	case "type", "kind":
+		kind := strings.ToLower(value)
+		if kind != KindBlock && kind != KindSubnet && kind != KindPattern {
+			return nil, fmt.Errorf("unknown type %s (use %s, %s or %s)", value, KindBlock, KindSubnet, KindPattern)
+		}
+		return func(r *SearchResult) bool { return r.Kind == kind }, nil
+
+	case "name":
+		return textMatcher(value, func(r *SearchResult) string { return r.Name })
+	case "region":
+		return textMatcher(value, func(r *SearchResult) string { return r.Region })
+	case "env", "environment":
+		return textMatcher(value, func(r *SearchResult) string { return r.Environment })
+	case "file":
+		return textMatcher(value, func(r *SearchResult) string { return r.FileKey })
+
+	case "tag":
+		key, pattern, hasValue := strings.Cut(value, "=")
+		if !hasValue {
+			return func(r *SearchResult) bool {
+				_, ok := r.Tags[key]
+				return ok
+			}, nil
+		}
+		match, err := textMatcher(pattern, func(r *SearchResult) string { return r.Tags[key] })
+		if err != nil {
+			return nil, err
+		}
+		return func(r *SearchResult) bool {
+			_, ok := r.Tags[key]
+			return ok && match(r)
+		}, nil
+
+	case "contains":
+		inner, err := parseAddrOrPrefix(value)
+		if err != nil {
+			return nil, err
+		}
+		return func(r *SearchResult) bool {
+			return r.prefix.IsValid() && iprange.Covers(r.prefix, inner)
+		}, nil
+
+	case "within":
+		outer, err := iprange.ParsePrefix(value)
+		if err != nil {
+			return nil, err
+		}
+		return func(r *SearchResult) bool {
+			return r.prefix.IsValid() && iprange.Covers(outer, r.prefix)
+		}, nil
+
+	case "prefix":
+		low, high, err := parsePrefixRange(value)
+		if err != nil {
+			return nil, err
+		}
+		return func(r *SearchResult) bool {
+			return r.PrefixLen >= low && r.PrefixLen <= high
+		}, nil
+
+	case "status":
+		status := strings.ToLower(value)
+		for _, known := range searchStatuses {
+			if status == known {
+				return func(r *SearchResult) bool { return r.Status == status }, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown status %s (use %s)", value, strings.Join(searchStatuses, ", "))
+	}
+	return nil, fmt.Errorf("unknown field %s", field)
+}
+
+// textMatcher matches a field against a glob, or a regular expression
+// between slashes
+func textMatcher(pattern string, field func(*SearchResult) string) (func(*SearchResult) bool, error) {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, err
+		}
+		return func(r *SearchResult) bool { return re.MatchString(field(r)) }, nil
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	return func(r *SearchResult) bool {
+		matched, _ := path.Match(pattern, field(r))
+		return matched
+	}, nil
+}
+
+// parseAddrOrPrefix parses a CIDR, or an address as a single-address prefix
+func parseAddrOrPrefix(s string) (netip.Prefix, error) {
+	if addr, err := netip.ParseAddr(s); err == nil {
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	return iprange.ParsePrefix(s)
+}
+
+// parsePrefixRange parses a prefix length term into an inclusive range
+func parsePrefixRange(s string) (int, int, error) {
+	atoi := func(s string) (int, error) {
+		n, err := strconv.Atoi(strings.TrimPrefix(s, "/"))
+		if err != nil || n < 0 || n > 128 {
+			return 0, fmt.Errorf("invalid prefix length %s", s)
+		}
+		return n, nil
+	}
+
+	for _, op := range []string{"<=", ">=", "<", ">"} {
+		if !strings.HasPrefix(s, op) {
+			continue
+		}
+		n, err := atoi(s[len(op):])
+		if err != nil {
+			return 0, 0, err
+		}
+		switch op {
+		case "<=":
+			return 0, n, nil
+		case ">=":
+			return n, 128, nil
+		case "<":
+			return 0, n - 1, nil
+		default:
+			return n + 1, 128, nil
+		}
+	}
+
+	if from, to, ok := strings.Cut(s, "-"); ok {
+		low, err := atoi(from)
+		if err != nil {
+			return 0, 0, err
+		}
+		high, err := atoi(to)
+		if err != nil {
+			return 0, 0, err
+		}
+		return low, high, nil
+	}
+
+	n, err := atoi(s)
+	return n, n, err
+}
+
+// Matches reports whether a search result matches every term of the query
+func (q *Query) Matches(r *SearchResult) bool {
+	for _, term := range q.terms {
+		if term.match(r) == term.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// Search returns the blocks, subnets and patterns of every block file key that
+// match a query; see ParseQuery for its syntax. Results are ordered by file
+// key, with each block followed by its subnets and the patterns last.
+func Search(cfg *config.Config, query string) ([]SearchResult, error) {
+	q, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := SortedFileKeys(cfg)
+	for fileKey := range cfg.Patterns {
+		if _, ok := cfg.BlockFiles[fileKey]; !ok {
+			keys = append(keys, fileKey)
+		}
+	}
+	sort.Strings(keys)
+
+	var results []SearchResult
+	add := func(r SearchResult) {
+		if q.Matches(&r) {
+			results = append(results, r)
+		}
+	}
+
+	for _, fileKey := range keys {
+		var blocks []Block
+		if _, ok := cfg.BlockFiles[fileKey]; ok {
+			blocks, err = loadBlocks(cfg, fileKey)
+			if err != nil {
+				return nil, fmt.Errorf("error reading block file %s: %w", fileKey, err)
+			}
+		}
+
+		blockPrefixes := make(map[netip.Prefix]bool)
+		for _, block := range blocks {
+			blockPrefix, blockErr := iprange.ParsePrefix(block.CIDR)
+			if blockErr == nil {
+				blockPrefixes[blockPrefix] = true
+			}
+			add(blockResult(fileKey, block, blockPrefix, blockErr))
+
+			for _, subnet := range block.Subnets {
+				r := SearchResult{Kind: KindSubnet, FileKey: fileKey, CIDR: subnet.CIDR, Name: subnet.Name, Region: subnet.Region, Environment: subnet.Tags[TagEnvironment], Block: block.CIDR, Tags: subnet.Tags, Status: StatusInvalid}
+				if prefix, err := iprange.ParsePrefix(subnet.CIDR); err == nil {
+					r.prefix, r.PrefixLen = prefix, prefix.Bits()
+					if blockErr == nil && iprange.Covers(blockPrefix, prefix) {
+						r.Status = StatusAllocated
+					}
+				}
+				add(r)
+			}
+		}
+
+		names := make([]string, 0, len(cfg.Patterns[fileKey]))
+		for name := range cfg.Patterns[fileKey] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			pattern := cfg.Patterns[fileKey][name]
+			r := SearchResult{Kind: KindPattern, FileKey: fileKey, CIDR: pattern.Block, PrefixLen: pattern.CIDRSize, Name: name, Region: pattern.Region, Environment: pattern.Environment, Status: StatusOrphaned}
+			if prefix, err := iprange.ParsePrefix(pattern.Block); err == nil {
+				r.prefix = prefix
+				if blockPrefixes[prefix] {
+					r.Status = StatusActive
+				}
+			}
+			add(r)
+		}
+	}
+	return results, nil
+}
+
+func blockResult(fileKey string, block Block, prefix netip.Prefix, parseErr error) SearchResult {
+	r := SearchResult{Kind: KindBlock, FileKey: fileKey, CIDR: block.CIDR, Name: block.Description, Status: StatusInvalid}
+	if parseErr != nil {
+		return r
+	}
+	r.prefix, r.PrefixLen = prefix, prefix.Bits()
+	switch {
+	case len(block.Subnets) == 0:
+		r.Status = StatusEmpty
+	case len(subnetTrie(block.Subnets).free(prefix)) == 0:
+		r.Status = StatusFull
+	default:
+		r.Status = StatusPartial
+	}
+	return r
+}
+
+// formatTags formats tags as key=value pairs ordered by key
+func formatTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		keys[i] = key + "=" + tags[key]
+	}
+	return strings.Join(keys, ", ")
+}
+
+// PrintSearchResults prints search results as a table
+func PrintSearchResults(results []SearchResult) error {
+	if len(results) == 0 {
+		fmt.Println("No matches found.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Type\tFile\tCIDR\tPrefix\tName\tRegion\tStatus\tTags")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t/%d\t%s\t%s\t%s\t%s\n", r.Kind, r.FileKey, r.CIDR, r.PrefixLen, r.Name, r.Region, r.Status, formatTags(r.Tags))
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error flushing writer: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package ipam
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSearchConfig(t *testing.T) *config.Config {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		BlockFiles: map[string]string{
+			"dev":  filepath.Join(dir, "dev.yaml"),
+			"prod": filepath.Join(dir, "prod.yaml"),
+		},
+		Patterns: map[string]map[string]config.Pattern{
+			"dev":  {"gke-pods": {CIDRSize: 22, Environment: "dev", Region: "us-west1", Block: "10.20.0.0/16"}},
+			"prod": {"old-app": {CIDRSize: 24, Environment: "prod", Region: "us-east1", Block: "10.99.0.0/16"}},
+		},
+	}
+	files := map[string][]Block{
+		"dev": {
+			{CIDR: "10.20.0.0/16", Description: "Development", Subnets: []Subnet{
+				{CIDR: "10.20.0.0/22", Name: "gke-nodes", Region: "us-west1", Tags: map[string]string{"team": "platform"}},
+				{CIDR: "10.20.4.0/24", Name: "db", Region: "us-east1", Tags: map[string]string{"team": "data", "tier": "1"}},
+			}},
+			{CIDR: "10.21.0.0/30", Subnets: []Subnet{{CIDR: "10.21.0.0/30", Name: "link", Region: "us-west1"}}},
+		},
+		"prod": {{CIDR: "2001:db8::/32", Description: "Production v6"}},
+	}
+	for fileKey, blocks := range files {
+		yamlData, err := marshalBlocks(blocks)
+		require.NoError(t, err)
+		require.NoError(t, writeYAMLFile(cfg.BlockFiles[fileKey], yamlData))
+	}
+	return cfg
+}
+
+func TestSearch(t *testing.T) {
+	cfg := newSearchConfig(t)
+
+	describe := func(results []SearchResult) []string {
+		var out []string
+		for _, r := range results {
+			out = append(out, r.Kind+" "+r.FileKey+" "+r.CIDR)
+		}
+		return out
+	}
+
+	testCases := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{
+			"block dev 10.20.0.0/16", "subnet dev 10.20.0.0/22", "subnet dev 10.20.4.0/24",
+			"block dev 10.21.0.0/30", "subnet dev 10.21.0.0/30", "pattern dev 10.20.0.0/16",
+			"block prod 2001:db8::/32", "pattern prod 10.99.0.0/16",
+		}},
+		{"type:subnet name:gke-*", []string{"subnet dev 10.20.0.0/22"}},
+		{"gke-*", []string{"subnet dev 10.20.0.0/22", "pattern dev 10.20.0.0/16"}},
+		{"name:/^(db|link)$/", []string{"subnet dev 10.20.4.0/24", "subnet dev 10.21.0.0/30"}},
+		{`name:"Production v6"`, []string{"block prod 2001:db8::/32"}},
+		{"region:us-east1", []string{"subnet dev 10.20.4.0/24", "pattern prod 10.99.0.0/16"}},
+		{"tag:team=plat*", []string{"subnet dev 10.20.0.0/22"}},
+		{"tag:tier", []string{"subnet dev 10.20.4.0/24"}},
+		{"-tag:team type:subnet", []string{"subnet dev 10.21.0.0/30"}},
+		{"contains:10.20.4.9", []string{"block dev 10.20.0.0/16", "subnet dev 10.20.4.0/24", "pattern dev 10.20.0.0/16"}},
+		{"contains:10.20.0.0/23 -type:pattern", []string{"block dev 10.20.0.0/16", "subnet dev 10.20.0.0/22"}},
+		{"within:10.20.0.0/16 type:subnet", []string{"subnet dev 10.20.0.0/22", "subnet dev 10.20.4.0/24"}},
+		{"prefix:22-24", []string{"subnet dev 10.20.0.0/22", "subnet dev 10.20.4.0/24", "pattern dev 10.20.0.0/16", "pattern prod 10.99.0.0/16"}},
+		{"prefix:<=16 type:block", []string{"block dev 10.20.0.0/16"}},
+		{"prefix:>30", []string{"block prod 2001:db8::/32"}},
+		{"prefix:31", nil},
+		{"file:prod", []string{"block prod 2001:db8::/32", "pattern prod 10.99.0.0/16"}},
+		{"status:partial", []string{"block dev 10.20.0.0/16"}},
+		{"status:full", []string{"block dev 10.21.0.0/30"}},
+		{"status:empty", []string{"block prod 2001:db8::/32"}},
+		{"status:orphaned", []string{"pattern prod 10.99.0.0/16"}},
+		{"env:dev", []string{"pattern dev 10.20.0.0/16"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			results, err := Search(cfg, tc.query)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, describe(results))
+		})
+	}
+
+	results, err := Search(cfg, "tag:team=data")
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, SearchResult{
+		Kind: KindSubnet, FileKey: "dev", CIDR: "10.20.4.0/24", PrefixLen: 24, Name: "db", Region: "us-east1",
+		Block: "10.20.0.0/16", Tags: map[string]string{"team": "data", "tier": "1"}, Status: StatusAllocated,
+		prefix: results[0].prefix,
+	}, results[0])
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, query := range []string{
+		"color:red",
+		"type:vpc",
+		"status:busy",
+		"name:[",
+		"name:/(/",
+		"contains:10.0.0.300",
+		"within:10.0.0.1",
+		"prefix:abc",
+		"prefix:129",
+		"region:",
+		`name:"unterminated`,
+	} {
+		_, err := ParseQuery(query)
+		assert.Error(t, err, query)
+	}
+}
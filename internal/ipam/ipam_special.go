@@ -0,0 +1,158 @@
+package ipam
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/lugnut42/openipam/internal/iprange"
+)
+
+// Address space classifications used by the special-purpose registry
+const (
+	rangePrivate  = "private"  // Private-use space that may be allocated freely
+	rangeReserved = "reserved" // Special-purpose space that must never be allocated
+	rangeLimited  = "limited"  // Special-purpose space that may be allocated with a warning
+	rangePublic   = "public"   // Globally routable space outside the registry
+)
+
+// specialPurposeRange is an entry of the IANA special-purpose address registry
+type specialPurposeRange struct {
+	CIDR  string
+	Name  string
+	RFC   string
+	Class string
+
+	prefix netip.Prefix
+}
+
+// specialPurposeRegistry is the built-in copy of the IANA IPv4 and IPv6
+// special-purpose address registries (RFC 6890 and later updates).
+var specialPurposeRegistry = []specialPurposeRange{
+	// IPv4
+	{CIDR: "0.0.0.0/8", Name: "This network", RFC: "RFC 791", Class: rangeReserved},
+	{CIDR: "10.0.0.0/8", Name: "Private-Use", RFC: "RFC 1918", Class: rangePrivate},
+	{CIDR: "100.64.0.0/10", Name: "Shared Address Space", RFC: "RFC 6598", Class: rangePrivate},
+	{CIDR: "127.0.0.0/8", Name: "Loopback", RFC: "RFC 1122", Class: rangeReserved},
+	{CIDR: "169.254.0.0/16", Name: "Link Local", RFC: "RFC 3927", Class: rangeReserved},
+	{CIDR: "172.16.0.0/12", Name: "Private-Use", RFC: "RFC 1918", Class: rangePrivate},
+	{CIDR: "192.0.0.0/24", Name: "IETF Protocol Assignments", RFC: "RFC 6890", Class: rangeReserved},
+	{CIDR: "192.0.2.0/24", Name: "Documentation (TEST-NET-1)", RFC: "RFC 5737", Class: rangeReserved},
+	{CIDR: "192.88.99.0/24", Name: "6to4 Relay Anycast", RFC: "RFC 7526", Class: rangeReserved},
+	{CIDR: "192.168.0.0/16", Name: "Private-Use", RFC: "RFC 1918", Class: rangePrivate},
+	{CIDR: "198.18.0.0/15", Name: "Benchmarking", RFC: "RFC 2544", Class: rangeLimited},
+	{CIDR: "198.51.100.0/24", Name: "Documentation (TEST-NET-2)", RFC: "RFC 5737", Class: rangeReserved},
+	{CIDR: "203.0.113.0/24", Name: "Documentation (TEST-NET-3)", RFC: "RFC 5737", Class: rangeReserved},
+	{CIDR: "224.0.0.0/4", Name: "Multicast", RFC: "RFC 5771", Class: rangeReserved},
+	{CIDR: "240.0.0.0/4", Name: "Reserved", RFC: "RFC 1112", Class: rangeReserved},
+	{CIDR: "255.255.255.255/32", Name: "Limited Broadcast", RFC: "RFC 919", Class: rangeReserved},
+
+	// IPv6
+	{CIDR: "::/128", Name: "Unspecified Address", RFC: "RFC 4291", Class: rangeReserved},
+	{CIDR: "::1/128", Name: "Loopback Address", RFC: "RFC 4291", Class: rangeReserved},
+	{CIDR: "::ffff:0:0/96", Name: "IPv4-mapped Address", RFC: "RFC 4291", Class: rangeReserved},
+	{CIDR: "64:ff9b::/96", Name: "IPv4-IPv6 Translation", RFC: "RFC 6052", Class: rangeLimited},
+	{CIDR: "64:ff9b:1::/48", Name: "IPv4-IPv6 Translation", RFC: "RFC 8215", Class: rangeLimited},
+	{CIDR: "100::/64", Name: "Discard-Only Address Block", RFC: "RFC 6666", Class: rangeReserved},
+	{CIDR: "2001::/23", Name: "IETF Protocol Assignments", RFC: "RFC 2928", Class: rangeReserved},
+	{CIDR: "2001:db8::/32", Name: "Documentation", RFC: "RFC 3849", Class: rangeReserved},
+	{CIDR: "2002::/16", Name: "6to4", RFC: "RFC 3056", Class: rangeLimited},
+	{CIDR: "fc00::/7", Name: "Unique-Local", RFC: "RFC 4193", Class: rangePrivate},
+	{CIDR: "fe80::/10", Name: "Link-Local Unicast", RFC: "RFC 4291", Class: rangeReserved},
+	{CIDR: "ff00::/8", Name: "Multicast", RFC: "RFC 4291", Class: rangeReserved},
+}
+
+func init() {
+	for i := range specialPurposeRegistry {
+		// Parsed without unmapping, so that ::ffff:0:0/96 stays an IPv6 range
+		specialPurposeRegistry[i].prefix = netip.MustParsePrefix(specialPurposeRegistry[i].CIDR)
+	}
+}
+
+// classifyNetwork classifies a network against the special-purpose registry.
+// A network overlapping a reserved range is reserved; otherwise a network
+// overlapping a limited range is limited; a network that lies entirely within
+// private-use ranges is private; anything else is public. The matching
+// registry entry is returned for reserved, limited and private networks.
+func classifyNetwork(network netip.Prefix) (string, *specialPurposeRange) {
+	for _, class := range []string{rangeReserved, rangeLimited} {
+		for i := range specialPurposeRegistry {
+			entry := &specialPurposeRegistry[i]
+			if entry.Class == class && entry.prefix.Overlaps(network) {
+				return class, entry
+			}
+		}
+	}
+
+	for i := range specialPurposeRegistry {
+		entry := &specialPurposeRegistry[i]
+		if entry.Class == rangePrivate && iprange.Covers(entry.prefix, network) {
+			return rangePrivate, entry
+		}
+	}
+
+	return rangePublic, nil
+}
+
+// isPublicNetwork reports whether a network lies outside private-use space
+func isPublicNetwork(network netip.Prefix) bool {
+	class, _ := classifyNetwork(network)
+	return class != rangePrivate
+}
+
+// checkSpecialPurpose returns an error if the CIDR overlaps reserved address
+// space, or lies in public space and allowPublic is false. A warning message
+// is returned for limited-use ranges and for public space that is allowed.
+func checkSpecialPurpose(network netip.Prefix, allowPublic bool) (string, error) {
+	class, entry := classifyNetwork(network)
+	switch class {
+	case rangeReserved:
+		return "", fmt.Errorf("CIDR %s overlaps reserved range %s (%s, %s)", network.String(), entry.CIDR, entry.Name, entry.RFC)
+	case rangeLimited:
+		return fmt.Sprintf("CIDR %s overlaps special-purpose range %s (%s, %s)", network.String(), entry.CIDR, entry.Name, entry.RFC), nil
+	case rangePublic:
+		if !allowPublic {
+			return "", fmt.Errorf("CIDR %s is in public address space; use --allow-public if your organization owns it", network.String())
+		}
+		return fmt.Sprintf("CIDR %s is in public address space", network.String()), nil
+	}
+	return "", nil
+}
+
+// validateSpecialPurpose reports blocks in reserved, limited-use or public space
+func validateSpecialPurpose(blocks []Block, fileKey string, results *ValidationResults) {
+	for _, block := range blocks {
+		blockPrefix, err := iprange.ParsePrefix(block.CIDR)
+		if err != nil {
+			continue // Invalid CIDRs are reported elsewhere
+		}
+
+		location := fmt.Sprintf("blocks.%s", block.CIDR)
+		class, entry := classifyNetwork(blockPrefix)
+		switch class {
+		case rangeReserved:
+			results.Results = append(results.Results, ValidationResult{
+				Type:        "error",
+				File:        fileKey,
+				Category:    "reserved",
+				Description: fmt.Sprintf("Block %s overlaps reserved range %s (%s, %s)", block.CIDR, entry.CIDR, entry.Name, entry.RFC),
+				Location:    location,
+			})
+		case rangeLimited:
+			results.Results = append(results.Results, ValidationResult{
+				Type:        "warning",
+				File:        fileKey,
+				Category:    "reserved",
+				Description: fmt.Sprintf("Block %s overlaps special-purpose range %s (%s, %s)", block.CIDR, entry.CIDR, entry.Name, entry.RFC),
+				Location:    location,
+			})
+		case rangePublic:
+			results.Results = append(results.Results, ValidationResult{
+				Type:        "warning",
+				File:        fileKey,
+				Category:    "public",
+				Description: fmt.Sprintf("Block %s is in public address space", block.CIDR),
+				Location:    location,
+			})
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package ipam
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/iprange"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyNetwork(t *testing.T) {
+	testCases := []struct {
+		cidr     string
+		expected string
+	}{
+		{cidr: "10.0.0.0/16", expected: rangePrivate},
+		{cidr: "172.16.0.0/12", expected: rangePrivate},
+		{cidr: "100.64.0.0/16", expected: rangePrivate},
+		{cidr: "fd00:1234::/48", expected: rangePrivate},
+		{cidr: "0.0.0.0/0", expected: rangeReserved},
+		{cidr: "127.0.0.0/8", expected: rangeReserved},
+		{cidr: "169.254.1.0/24", expected: rangeReserved},
+		{cidr: "224.0.0.0/8", expected: rangeReserved},
+		{cidr: "192.0.2.0/24", expected: rangeReserved},
+		{cidr: "2001:db8:1::/48", expected: rangeReserved},
+		{cidr: "fe80::/64", expected: rangeReserved},
+		{cidr: "198.18.0.0/16", expected: rangeLimited},
+		{cidr: "8.8.8.0/24", expected: rangePublic},
+		{cidr: "2600:1f00::/32", expected: rangePublic},
+		{cidr: "10.0.0.0/7", expected: rangePublic},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.cidr, func(t *testing.T) {
+			prefix, err := iprange.ParsePrefix(tc.cidr)
+			require.NoError(t, err)
+			class, _ := classifyNetwork(prefix)
+			assert.Equal(t, tc.expected, class)
+		})
+	}
+}
+
+func TestAddBlockSpecialPurpose(t *testing.T) {
+	blockFile := filepath.Join(t.TempDir(), "default.yaml")
+	require.NoError(t, writeYAMLFile(blockFile, []byte("[]")))
+	cfg := &config.Config{BlockFiles: map[string]string{"default": blockFile}}
+
+	_, err := AddBlock(cfg, "127.0.0.0/8", "loopback", "", "default", true)
+	assert.Error(t, err, "reserved ranges are rejected even with allowPublic")
+	assert.Contains(t, err.Error(), "Loopback")
+
+	_, err = AddBlock(cfg, "0.0.0.0/0", "everything", "", "default", true)
+	assert.Error(t, err)
+
+	_, err = AddBlock(cfg, "8.8.8.0/24", "public", "", "default", false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "--allow-public")
+
+	// Public blocks are accepted with a warning instead of printing one
+	warnings, err := AddBlock(cfg, "8.8.8.0/24", "public", "", "default", true)
+	assert.NoError(t, err)
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "public")
+
+	results, err := ValidateBlockFile(cfg, "default")
+	require.NoError(t, err)
+	assert.Equal(t, 0, results.ErrorCount)
+	assert.Equal(t, 1, results.WarningCount)
+	assert.Equal(t, "public", results.Results[0].Category)
+}
@@ -0,0 +1,150 @@
+package ipam
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lugnut42/openipam/internal/config"
+)
+
+// Storage backends for blocks, selected with storage.backend in the configuration
+const (
+	BackendYAML   = "yaml"
+	BackendSQLite = "sqlite"
+	BackendS3     = "s3"
+)
+
+// blockBackend loads and saves the blocks of block file keys
+type blockBackend interface {
+	// load returns the blocks of a block file key
+	load(fileKey string) ([]Block, error)
+
+	// update applies fn to the blocks of a block file key and saves the
+	// result. Backends that support it make the load and save atomic, so that
+	// concurrent allocations cannot overwrite each other; fn may then be
+	// called more than once and must not have side effects.
+	update(fileKey string, fn func([]Block) ([]Block, error)) error
+}
+
+// rawReader is implemented by backends that store block files as YAML
+type rawReader interface {
+	readRaw(fileKey string) ([]byte, error)
+}
+
+// subnetIndex is implemented by backends that can look up subnets without
+// loading every block file
+type subnetIndex interface {
+	findSubnets(blockCIDR, region string) ([]SubnetEntry, error)
+	findSubnet(cidr string) (*SubnetEntry, bool, error)
+}
+
+// errUnchanged is returned by an update function to leave the blocks unsaved
+var errUnchanged = errors.New("blocks unchanged")
+
+// backendFor returns the storage backend selected in the configuration
+func backendFor(cfg *config.Config) (blockBackend, error) {
+	switch cfg.Storage.Backend {
+	case "", BackendYAML:
+		return &yamlBackend{cfg: cfg}, nil
+	case BackendSQLite:
+		return openSQLiteBackend(cfg)
+	case BackendS3:
+		return newS3Backend(cfg)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q (use %s, %s or %s)", cfg.Storage.Backend, BackendYAML, BackendSQLite, BackendS3)
+	}
+}
+
+// loadBlocks returns the blocks of a block file key from the configured backend
+func loadBlocks(cfg *config.Config, fileKey string) ([]Block, error) {
+	if _, ok := cfg.BlockFiles[fileKey]; !ok {
+		return nil, &NotFoundError{Kind: "block file", Name: fileKey}
+	}
+	backend, err := backendFor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return backend.load(fileKey)
+}
+
+// updateBlocks applies fn to the blocks of a block file key and saves the result
+// to the configured backend. Nothing is saved when fn returns errUnchanged.
+func updateBlocks(cfg *config.Config, fileKey string, fn func([]Block) ([]Block, error)) error {
+	if _, ok := cfg.BlockFiles[fileKey]; !ok {
+		return &NotFoundError{Kind: "block file", Name: fileKey}
+	}
+	backend, err := backendFor(cfg)
+	if err != nil {
+		return err
+	}
+	if err := backend.update(fileKey, fn); err != nil && !errors.Is(err, errUnchanged) {
+		return err
+	}
+	return nil
+}
+
+// saveBlocks replaces the blocks of a block file key
+func saveBlocks(cfg *config.Config, fileKey string, blocks []Block) error {
+	return updateBlocks(cfg, fileKey, func([]Block) ([]Block, error) {
+		return blocks, nil
+	})
+}
+
+// readBlockData returns the blocks of a block file key as YAML: the block file
+// itself for backends storing YAML, or the stored blocks marshalled to YAML
+func readBlockData(cfg *config.Config, fileKey string) ([]byte, error) {
+	if _, ok := cfg.BlockFiles[fileKey]; !ok {
+		return nil, &NotFoundError{Kind: "block file", Name: fileKey}
+	}
+	backend, err := backendFor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if raw, ok := backend.(rawReader); ok {
+		return raw.readRaw(fileKey)
+	}
+
+	blocks, err := backend.load(fileKey)
+	if err != nil {
+		return nil, err
+	}
+	if blocks == nil {
+		blocks = []Block{}
+	}
+	return marshalBlocks(blocks)
+}
+
+// yamlBackend stores the blocks of each block file key in the YAML file it maps to
+type yamlBackend struct {
+	cfg *config.Config
+}
+
+func (b *yamlBackend) readRaw(fileKey string) ([]byte, error) {
+	return readYAMLFile(b.cfg.BlockFiles[fileKey])
+}
+
+func (b *yamlBackend) load(fileKey string) ([]Block, error) {
+	yamlData, err := b.readRaw(fileKey)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalBlocks(yamlData)
+}
+
+func (b *yamlBackend) update(fileKey string, fn func([]Block) ([]Block, error)) error {
+	blocks, err := b.load(fileKey)
+	if err != nil {
+		return err
+	}
+
+	blocks, err = fn(blocks)
+	if err != nil {
+		return err
+	}
+
+	yamlData, err := marshalBlocks(blocks)
+	if err != nil {
+		return err
+	}
+	return writeYAMLFile(b.cfg.BlockFiles[fileKey], yamlData)
+}
@@ -0,0 +1,151 @@
+package ipam
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/logger"
+	"github.com/lugnut42/openipam/internal/s3"
+)
+
+// s3MaxAttempts is how often an update is tried before a conflicting writer is
+// reported as an error
+const s3MaxAttempts = 8
+
+// s3RetryDelay is the base delay between attempts; it grows with every attempt
+// and is jittered so that racing writers spread out
+var s3RetryDelay = 50 * time.Millisecond
+
+// s3Backend stores each block file as a YAML object in an S3-compatible bucket.
+// The block file paths of the configuration are object keys relative to the
+// prefix. Updates are conditional on the ETag that was read, so concurrent
+// writers retry instead of overwriting each other.
+type s3Backend struct {
+	cfg    *config.Config
+	client *s3.Client
+}
+
+func newS3Backend(cfg *config.Config) (*s3Backend, error) {
+	if cfg.Storage.S3.Bucket == "" {
+		return nil, fmt.Errorf("storage.s3.bucket must be set for the %s backend", BackendS3)
+	}
+	return &s3Backend{cfg: cfg, client: cfg.Storage.S3.Client()}, nil
+}
+
+// key returns the object key of a block file key
+func (b *s3Backend) key(fileKey string) string {
+	return b.cfg.Storage.S3.Key(b.cfg.BlockFiles[fileKey])
+}
+
+// read returns the content and ETag of the object of a block file key. A
+// missing object is an empty block file with an empty ETag.
+func (b *s3Backend) read(fileKey string) ([]byte, string, error) {
+	data, etag, err := b.client.Get(b.key(fileKey))
+	if errors.Is(err, s3.ErrNotFound) {
+		return []byte("[]\n"), "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading block file %s: %w", fileKey, err)
+	}
+	return data, etag, nil
+}
+
+func (b *s3Backend) readRaw(fileKey string) ([]byte, error) {
+	data, _, err := b.read(fileKey)
+	return data, err
+}
+
+func (b *s3Backend) load(fileKey string) ([]Block, error) {
+	data, _, err := b.read(fileKey)
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalBlocks(data)
+}
+
+// update reads the block file, applies fn and writes the result only if the
+// object is unchanged since it was read. When another writer got there first,
+// the whole read-modify-write is repeated with the new content.
+func (b *s3Backend) update(fileKey string, fn func([]Block) ([]Block, error)) error {
+	key := b.key(fileKey)
+	for attempt := 1; ; attempt++ {
+		data, etag, err := b.read(fileKey)
+		if err != nil {
+			return err
+		}
+		blocks, err := unmarshalBlocks(data)
+		if err != nil {
+			return err
+		}
+
+		blocks, err = fn(blocks)
+		if err != nil {
+			return err
+		}
+
+		newData, err := marshalBlocks(blocks)
+		if err != nil {
+			return err
+		}
+		_, err = b.client.PutIfMatch(key, newData, etag)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, s3.ErrPreconditionFailed) {
+			return fmt.Errorf("error writing block file %s: %w", fileKey, err)
+		}
+		if attempt == s3MaxAttempts {
+			return fmt.Errorf("block file %s kept changing, gave up after %d attempts: %w", fileKey, attempt, err)
+		}
+
+		delay := time.Duration(attempt)*s3RetryDelay + time.Duration(rand.Int63n(int64(s3RetryDelay)+1)) // #nosec G404
+		logger.Debug("Block file %s changed while it was updated, retrying in %s", fileKey, delay)
+		time.Sleep(delay)
+	}
+}
+
+// ExportToS3 uploads the block files of the given file keys, or of all block
+// files when none are given, from the configured backend to a bucket. Each
+// block file is stored as blocks/<file-key>.yaml below the prefix, replacing
+// any existing object. It returns the block file paths to use with the s3
+// backend; the configuration is not modified.
+func ExportToS3(cfg *config.Config, settings config.S3Settings, fileKeys ...string) (*ImportReport, map[string]string, error) {
+	if settings.Bucket == "" {
+		return nil, nil, fmt.Errorf("a bucket is required for the %s backend", BackendS3)
+	}
+	if len(fileKeys) == 0 {
+		fileKeys = SortedFileKeys(cfg)
+	}
+
+	client := settings.Client()
+	report := &ImportReport{
+		Destination: fmt.Sprintf("s3://%s/%s", settings.Bucket, settings.Key("")),
+		Blocks:      make(map[string]int),
+		Subnets:     make(map[string]int),
+	}
+	blockFiles := make(map[string]string)
+	for _, fileKey := range fileKeys {
+		data, err := readBlockData(cfg, fileKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading block file %s: %w", fileKey, err)
+		}
+		blocks, err := unmarshalBlocks(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error parsing block file %s: %w", fileKey, err)
+		}
+
+		blockFiles[fileKey] = "blocks/" + fileKey + ".yaml"
+		if _, err := client.Put(settings.Key(blockFiles[fileKey]), data); err != nil {
+			return nil, nil, fmt.Errorf("error uploading block file %s: %w", fileKey, err)
+		}
+
+		report.Blocks[fileKey] = len(blocks)
+		for _, block := range blocks {
+			report.Subnets[fileKey] += len(block.Subnets)
+		}
+	}
+	return report, blockFiles, nil
+}
@@ -0,0 +1,167 @@
+package ipam
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/s3"
+	"github.com/lugnut42/openipam/internal/s3/s3test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newS3Config stores block files in a fake bucket and returns a configuration
+// using them, with a pattern allocating /24s from 10.0.0.0/16 in "dev"
+func newS3Config(t *testing.T, files map[string][]Block) (*config.Config, *s3test.Server) {
+	server := s3test.NewServer()
+	t.Cleanup(server.Close)
+
+	delay := s3RetryDelay
+	s3RetryDelay = time.Millisecond
+	t.Cleanup(func() { s3RetryDelay = delay })
+
+	cfg := &config.Config{
+		BlockFiles: make(map[string]string),
+		Patterns: map[string]map[string]config.Pattern{
+			"dev": {"app": {CIDRSize: 24, Region: "us-east1", Block: "10.0.0.0/16"}},
+		},
+		Storage: config.StorageSettings{
+			Backend: BackendS3,
+			S3:      config.S3Settings{Bucket: "ipam", Prefix: "team", Endpoint: server.URL, PathStyle: true},
+		},
+	}
+	for fileKey, blocks := range files {
+		cfg.BlockFiles[fileKey] = "blocks/" + fileKey + ".yaml"
+		yamlData, err := marshalBlocks(blocks)
+		require.NoError(t, err)
+		server.SetObject("ipam", "team/blocks/"+fileKey+".yaml", yamlData)
+	}
+	return cfg, server
+}
+
+// storedBlocks returns the blocks of a block file object
+func storedBlocks(t *testing.T, server *s3test.Server, fileKey string) []Block {
+	data, ok := server.Object("ipam", "team/blocks/"+fileKey+".yaml")
+	require.True(t, ok)
+	blocks, err := unmarshalBlocks(data)
+	require.NoError(t, err)
+	return blocks
+}
+
+func TestS3Backend(t *testing.T) {
+	cfg, server := newS3Config(t, map[string][]Block{
+		"dev": {{CIDR: "10.0.0.0/16", Description: "Development", Subnets: []Subnet{}}},
+	})
+	cfg.BlockFiles["prod"] = "blocks/prod.yaml" // Not stored yet
+
+	_, err := CreateSubnet(cfg, "10.0.0.0/16", "10.0.1.0/24", "app", "us-east1")
+	require.NoError(t, err)
+	blocks := storedBlocks(t, server, "dev")
+	require.Len(t, blocks[0].Subnets, 1)
+	assert.Equal(t, "10.0.1.0/24", blocks[0].Subnets[0].CIDR)
+
+	entry, err := FindSubnet(cfg, "10.0.1.0/24")
+	require.NoError(t, err)
+	assert.Equal(t, "dev", entry.FileKey)
+
+	// A block file without an object is empty and created on first write
+	entries, err := FindBlocks(cfg, "prod")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	_, err = AddBlock(cfg, "10.1.0.0/16", "Production", "", "prod", false)
+	require.NoError(t, err)
+	assert.Equal(t, "10.1.0.0/16", storedBlocks(t, server, "prod")[0].CIDR)
+
+	results, err := ValidateBlockFile(cfg, "dev")
+	require.NoError(t, err)
+	assert.Zero(t, results.ErrorCount)
+}
+
+func TestS3AllocationRetry(t *testing.T) {
+	cfg, server := newS3Config(t, map[string][]Block{
+		"dev": {{CIDR: "10.0.0.0/16", Subnets: []Subnet{}}},
+	})
+
+	// Another allocator takes 10.0.0.0/24 between our read and our write
+	competing := true
+	server.BeforePut = func(bucket, key string) {
+		if competing {
+			competing = false
+			yamlData, err := marshalBlocks([]Block{{CIDR: "10.0.0.0/16", Subnets: []Subnet{{CIDR: "10.0.0.0/24", Name: "other"}}}})
+			require.NoError(t, err)
+			server.SetObject(bucket, key, yamlData)
+		}
+	}
+
+	subnet, _, err := AllocateSubnetFromPattern(cfg, "app", "dev")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.0/24", subnet.CIDR)
+	assert.Equal(t, 1, server.Conflicts)
+
+	blocks := storedBlocks(t, server, "dev")
+	require.Len(t, blocks[0].Subnets, 2)
+	assert.Equal(t, "other", blocks[0].Subnets[0].Name)
+	assert.Equal(t, "10.0.1.0/24", blocks[0].Subnets[1].CIDR)
+
+	// A block file that never stops changing is reported
+	server.BeforePut = func(bucket, key string) {
+		data, _ := server.Object(bucket, key)
+		server.SetObject(bucket, key, append(data, '\n'))
+	}
+	_, _, err = AllocateSubnetFromPattern(cfg, "app", "dev")
+	assert.ErrorIs(t, err, s3.ErrPreconditionFailed)
+	assert.Equal(t, 1+s3MaxAttempts, server.Conflicts)
+}
+
+func TestS3ConcurrentAllocation(t *testing.T) {
+	cfg, server := newS3Config(t, map[string][]Block{
+		"dev": {{CIDR: "10.0.0.0/16", Subnets: []Subnet{}}},
+	})
+
+	const allocations = 4
+	var wg sync.WaitGroup
+	errs := make([]error, allocations)
+	for i := 0; i < allocations; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, errs[i] = AllocateSubnetFromPattern(cfg, "app", "dev")
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	seen := make(map[string]bool)
+	blocks := storedBlocks(t, server, "dev")
+	require.Len(t, blocks[0].Subnets, allocations)
+	for _, subnet := range blocks[0].Subnets {
+		assert.False(t, seen[subnet.CIDR], "subnet %s allocated twice", subnet.CIDR)
+		seen[subnet.CIDR] = true
+	}
+}
+
+func TestExportToS3(t *testing.T) {
+	_, sqliteCfg := newSQLiteConfig(t, map[string][]Block{
+		"dev": {{CIDR: "10.0.0.0/16", Subnets: []Subnet{{CIDR: "10.0.1.0/24", Name: "app", Region: "us-east1"}}}},
+	})
+	server := s3test.NewServer()
+	defer server.Close()
+
+	settings := config.S3Settings{Bucket: "ipam", Endpoint: server.URL, PathStyle: true}
+	report, blockFiles, err := ExportToS3(sqliteCfg, settings)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"dev": "blocks/dev.yaml"}, blockFiles)
+	assert.Equal(t, 1, report.Subnets["dev"])
+
+	s3Cfg := *sqliteCfg
+	s3Cfg.BlockFiles = blockFiles
+	s3Cfg.Storage = config.StorageSettings{Backend: BackendS3, S3: settings}
+	entries, err := FindSubnets(&s3Cfg, "", "us-east1")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "app", entries[0].Subnet.Name)
+}
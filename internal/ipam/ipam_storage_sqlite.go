@@ -0,0 +1,660 @@
+package ipam
+
+import (
+	"database/sql"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/logger"
+
+	_ "modernc.org/sqlite" // Registers the pure Go "sqlite" database/sql driver
+)
+
+// sqliteSchema creates the tables of the SQLite backend. The prefix columns
+// hold the canonical form of each CIDR for indexed lookups, while cidr keeps
+// the value as stored so that validation sees the same data as with YAML.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS blocks (
+	id          INTEGER PRIMARY KEY,
+	file_key    TEXT    NOT NULL,
+	position    INTEGER NOT NULL,
+	cidr        TEXT    NOT NULL,
+	prefix      TEXT    NOT NULL,
+	description TEXT    NOT NULL DEFAULT '',
+	provider    TEXT    NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS blocks_file_key ON blocks (file_key, position);
+CREATE INDEX IF NOT EXISTS blocks_prefix ON blocks (prefix);
+
+CREATE TABLE IF NOT EXISTS subnets (
+	id           INTEGER PRIMARY KEY,
+	block_id     INTEGER NOT NULL REFERENCES blocks (id) ON DELETE CASCADE,
+	file_key     TEXT    NOT NULL,
+	position     INTEGER NOT NULL,
+	cidr         TEXT    NOT NULL,
+	prefix       TEXT    NOT NULL,
+	name         TEXT    NOT NULL DEFAULT '',
+	region       TEXT    NOT NULL DEFAULT '',
+	created_at   TEXT    NOT NULL DEFAULT '',
+	renumberable INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS subnets_block ON subnets (block_id, position);
+CREATE INDEX IF NOT EXISTS subnets_file_key ON subnets (file_key);
+CREATE INDEX IF NOT EXISTS subnets_prefix ON subnets (prefix);
+CREATE INDEX IF NOT EXISTS subnets_name ON subnets (name);
+CREATE INDEX IF NOT EXISTS subnets_region ON subnets (region);
+
+CREATE TABLE IF NOT EXISTS subnet_tags (
+	subnet_id INTEGER NOT NULL REFERENCES subnets (id) ON DELETE CASCADE,
+	key       TEXT    NOT NULL,
+	value     TEXT    NOT NULL DEFAULT '',
+	PRIMARY KEY (subnet_id, key)
+);
+CREATE INDEX IF NOT EXISTS subnet_tags_key ON subnet_tags (key, value);
+`
+
+// sqliteDBs caches open databases by path for the lifetime of the process
+var (
+	sqliteDBs   = make(map[string]*sql.DB)
+	sqliteDBsMu sync.Mutex
+)
+
+// sqliteBackend stores the blocks of all block file keys in a SQLite database
+type sqliteBackend struct {
+	cfg *config.Config
+	db  *sql.DB
+}
+
+// sqlitePath returns the database path of the configuration, resolved against
+// the directory of the configuration file
+func sqlitePath(cfg *config.Config) (string, error) {
+	path := cfg.Storage.Path
+	if path == "" {
+		return "", fmt.Errorf("storage.path must be set for the %s backend", BackendSQLite)
+	}
+	if !filepath.IsAbs(path) && cfg.ConfigFile != "" {
+		path = filepath.Join(filepath.Dir(cfg.ConfigFile), path)
+	}
+	return filepath.Clean(path), nil
+}
+
+// openSQLiteBackend opens, and creates if needed, the database of the configuration
+func openSQLiteBackend(cfg *config.Config) (*sqliteBackend, error) {
+	path, err := sqlitePath(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	sqliteDBsMu.Lock()
+	defer sqliteDBsMu.Unlock()
+
+	if db, ok := sqliteDBs[path]; ok {
+		return &sqliteBackend{cfg: cfg, db: db}, nil
+	}
+
+	// Transactions take the write lock when they begin, so that concurrent
+	// allocations are serialized instead of failing when they upgrade a read lock
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database %s: %w", path, err)
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating database schema in %s: %w", path, err)
+	}
+
+	logger.Debug("Opened SQLite database %s", path)
+	sqliteDBs[path] = db
+	return &sqliteBackend{cfg: cfg, db: db}, nil
+}
+
+// sqlQuerier is implemented by *sql.DB and *sql.Tx
+type sqlQuerier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (b *sqliteBackend) load(fileKey string) ([]Block, error) {
+	return loadSQLiteBlocks(b.db, fileKey)
+}
+
+// sqliteRow identifies a stored block or subnet row
+type sqliteRow struct {
+	id       int64
+	position int64
+}
+
+// sqliteRows are the rows of loaded blocks: blocks[i] is the row of block i
+// and subnets[i][j] the row of its subnet j
+type sqliteRows struct {
+	blocks  []sqliteRow
+	subnets [][]sqliteRow
+}
+
+// loadSQLiteBlocks reads the blocks of a block file key in stored order
+func loadSQLiteBlocks(q sqlQuerier, fileKey string) ([]Block, error) {
+	blocks, _, err := loadSQLiteRows(q, fileKey)
+	return blocks, err
+}
+
+// loadSQLiteRows reads the blocks of a block file key in stored order along
+// with the rows they were read from
+func loadSQLiteRows(q sqlQuerier, fileKey string) ([]Block, sqliteRows, error) {
+	var stored sqliteRows
+	rows, err := q.Query(`SELECT id, position, cidr, description, provider FROM blocks WHERE file_key = ? ORDER BY position`, fileKey)
+	if err != nil {
+		return nil, stored, fmt.Errorf("error loading blocks of %s: %w", fileKey, err)
+	}
+	var blocks []Block
+	blockIndex := make(map[int64]int)
+	for rows.Next() {
+		var row sqliteRow
+		block := Block{Subnets: []Subnet{}}
+		if err := rows.Scan(&row.id, &row.position, &block.CIDR, &block.Description, &block.Provider); err != nil {
+			rows.Close()
+			return nil, stored, fmt.Errorf("error loading blocks of %s: %w", fileKey, err)
+		}
+		blockIndex[row.id] = len(blocks)
+		blocks = append(blocks, block)
+		stored.blocks = append(stored.blocks, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, stored, fmt.Errorf("error loading blocks of %s: %w", fileKey, err)
+	}
+	stored.subnets = make([][]sqliteRow, len(blocks))
+
+	tags, err := loadSQLiteTags(q, fileKey)
+	if err != nil {
+		return nil, stored, err
+	}
+
+	rows, err = q.Query(`SELECT id, block_id, cidr, name, region, created_at, renumberable, position
+		FROM subnets WHERE file_key = ? ORDER BY block_id, position`, fileKey)
+	if err != nil {
+		return nil, stored, fmt.Errorf("error loading subnets of %s: %w", fileKey, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row sqliteRow
+		var blockID int64
+		subnet, err := scanSQLiteSubnet(rows, &row.id, &blockID, &row.position)
+		if err != nil {
+			return nil, stored, fmt.Errorf("error loading subnets of %s: %w", fileKey, err)
+		}
+		subnet.Tags = tags[row.id]
+		i := blockIndex[blockID]
+		blocks[i].Subnets = append(blocks[i].Subnets, subnet)
+		stored.subnets[i] = append(stored.subnets[i], row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, stored, fmt.Errorf("error loading subnets of %s: %w", fileKey, err)
+	}
+
+	return blocks, stored, nil
+}
+
+// scanSQLiteSubnet scans the id, block_id, cidr, name, region, created_at,
+// renumberable and position columns of a subnet row
+func scanSQLiteSubnet(rows *sql.Rows, id, blockID, position *int64) (Subnet, error) {
+	var subnet Subnet
+	var createdAt string
+	if err := rows.Scan(id, blockID, &subnet.CIDR, &subnet.Name, &subnet.Region, &createdAt, &subnet.Renumberable, position); err != nil {
+		return subnet, err
+	}
+	if createdAt != "" {
+		t, err := time.Parse(time.RFC3339Nano, createdAt)
+		if err != nil {
+			return subnet, fmt.Errorf("invalid creation time %q of subnet %s: %w", createdAt, subnet.CIDR, err)
+		}
+		subnet.CreatedAt = t
+	}
+	return subnet, nil
+}
+
+// loadSQLiteTags returns the tags of the subnets of a block file key by subnet id
+func loadSQLiteTags(q sqlQuerier, fileKey string) (map[int64]map[string]string, error) {
+	rows, err := q.Query(`SELECT t.subnet_id, t.key, t.value FROM subnet_tags t
+		JOIN subnets s ON s.id = t.subnet_id WHERE s.file_key = ?`, fileKey)
+	if err != nil {
+		return nil, fmt.Errorf("error loading subnet tags of %s: %w", fileKey, err)
+	}
+	defer rows.Close()
+
+	tags := make(map[int64]map[string]string)
+	for rows.Next() {
+		var id int64
+		var key, value string
+		if err := rows.Scan(&id, &key, &value); err != nil {
+			return nil, fmt.Errorf("error loading subnet tags of %s: %w", fileKey, err)
+		}
+		if tags[id] == nil {
+			tags[id] = make(map[string]string)
+		}
+		tags[id][key] = value
+	}
+	return tags, rows.Err()
+}
+
+// update runs fn in a transaction that holds the database write lock, so that
+// concurrent allocations from the same database are serialized. Only the rows
+// fn changed are written.
+func (b *sqliteBackend) update(fileKey string, fn func([]Block) ([]Block, error)) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op after Commit
+
+	stored, rows, err := loadSQLiteRows(tx, fileKey)
+	if err != nil {
+		return err
+	}
+
+	// fn may modify the blocks it is given, so it gets a copy to diff against
+	blocks, err := fn(cloneBlocks(stored))
+	if err != nil {
+		return err
+	}
+
+	w, err := newSQLiteWriter(tx, fileKey)
+	if err != nil {
+		return err
+	}
+	defer w.close()
+	if err := w.saveBlocks(stored, rows, blocks); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// cloneBlocks returns a deep copy of blocks
+func cloneBlocks(blocks []Block) []Block {
+	if blocks == nil {
+		return nil
+	}
+	clone := make([]Block, len(blocks))
+	for i, block := range blocks {
+		clone[i] = block
+		clone[i].Subnets = make([]Subnet, len(block.Subnets))
+		for j, subnet := range block.Subnets {
+			clone[i].Subnets[j] = subnet
+			clone[i].Subnets[j].Tags = maps.Clone(subnet.Tags)
+		}
+	}
+	return clone
+}
+
+// sqliteWriter writes changed blocks of a block file key within a transaction
+type sqliteWriter struct {
+	tx           *sql.Tx
+	fileKey      string
+	insertBlock  *sql.Stmt
+	insertSubnet *sql.Stmt
+	upsertTag    *sql.Stmt
+}
+
+func newSQLiteWriter(tx *sql.Tx, fileKey string) (*sqliteWriter, error) {
+	w := &sqliteWriter{tx: tx, fileKey: fileKey}
+	var err error
+	if w.insertBlock, err = tx.Prepare(`INSERT INTO blocks (file_key, position, cidr, prefix, description, provider) VALUES (?, ?, ?, ?, ?, ?)`); err != nil {
+		return nil, fmt.Errorf("error saving blocks of %s: %w", fileKey, err)
+	}
+	if w.insertSubnet, err = tx.Prepare(`INSERT INTO subnets (block_id, file_key, position, cidr, prefix, name, region, created_at, renumberable)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`); err != nil {
+		w.close()
+		return nil, fmt.Errorf("error saving subnets of %s: %w", fileKey, err)
+	}
+	if w.upsertTag, err = tx.Prepare(`INSERT INTO subnet_tags (subnet_id, key, value) VALUES (?, ?, ?)
+		ON CONFLICT (subnet_id, key) DO UPDATE SET value = excluded.value`); err != nil {
+		w.close()
+		return nil, fmt.Errorf("error saving subnet tags of %s: %w", fileKey, err)
+	}
+	return w, nil
+}
+
+func (w *sqliteWriter) close() {
+	for _, stmt := range []*sql.Stmt{w.insertBlock, w.insertSubnet, w.upsertTag} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+}
+
+// saveBlocks writes the difference between the stored blocks, read from rows,
+// and blocks. Blocks are matched by CIDR and subnets by CIDR within their
+// block; unmatched rows are inserted or deleted, and matched rows are only
+// updated when a value or their relative order changed.
+func (w *sqliteWriter) saveBlocks(stored []Block, rows sqliteRows, blocks []Block) error {
+	byCIDR := make(map[string][]int)
+	for i, block := range stored {
+		byCIDR[block.CIDR] = append(byCIDR[block.CIDR], i)
+	}
+	matched := make([]bool, len(stored))
+
+	last := int64(-1)
+	for _, block := range blocks {
+		candidates := byCIDR[block.CIDR]
+		if len(candidates) == 0 {
+			last++
+			if err := w.insertBlockRow(block, last); err != nil {
+				return err
+			}
+			continue
+		}
+		i := candidates[0]
+		byCIDR[block.CIDR] = candidates[1:]
+		matched[i] = true
+
+		row := rows.blocks[i]
+		position := nextPosition(row.position, &last)
+		if position != row.position || block.Description != stored[i].Description || block.Provider != stored[i].Provider {
+			if _, err := w.tx.Exec(`UPDATE blocks SET position = ?, description = ?, provider = ? WHERE id = ?`,
+				position, block.Description, block.Provider, row.id); err != nil {
+				return fmt.Errorf("error saving block %s: %w", block.CIDR, err)
+			}
+		}
+		if err := w.saveSubnets(row.id, stored[i].Subnets, rows.subnets[i], block.Subnets); err != nil {
+			return err
+		}
+	}
+
+	// Subnets and their tags are deleted with their block
+	for i, row := range rows.blocks {
+		if matched[i] {
+			continue
+		}
+		if _, err := w.tx.Exec(`DELETE FROM blocks WHERE id = ?`, row.id); err != nil {
+			return fmt.Errorf("error deleting block %s: %w", stored[i].CIDR, err)
+		}
+	}
+	return nil
+}
+
+// saveSubnets writes the difference between the stored subnets of a block and subnets
+func (w *sqliteWriter) saveSubnets(blockID int64, stored []Subnet, rows []sqliteRow, subnets []Subnet) error {
+	byCIDR := make(map[string][]int)
+	for i, subnet := range stored {
+		byCIDR[subnet.CIDR] = append(byCIDR[subnet.CIDR], i)
+	}
+	matched := make([]bool, len(stored))
+
+	last := int64(-1)
+	for _, subnet := range subnets {
+		candidates := byCIDR[subnet.CIDR]
+		if len(candidates) == 0 {
+			last++
+			if err := w.insertSubnetRow(blockID, subnet, last); err != nil {
+				return err
+			}
+			continue
+		}
+		i := candidates[0]
+		byCIDR[subnet.CIDR] = candidates[1:]
+		matched[i] = true
+
+		row, old := rows[i], stored[i]
+		position := nextPosition(row.position, &last)
+		if position != row.position || subnet.Name != old.Name || subnet.Region != old.Region ||
+			!subnet.CreatedAt.Equal(old.CreatedAt) || subnet.Renumberable != old.Renumberable {
+			if _, err := w.tx.Exec(`UPDATE subnets SET position = ?, name = ?, region = ?, created_at = ?, renumberable = ? WHERE id = ?`,
+				position, subnet.Name, subnet.Region, formatCreatedAt(subnet.CreatedAt), subnet.Renumberable, row.id); err != nil {
+				return fmt.Errorf("error saving subnet %s: %w", subnet.CIDR, err)
+			}
+		}
+		if err := w.saveTags(row.id, subnet.CIDR, old.Tags, subnet.Tags); err != nil {
+			return err
+		}
+	}
+
+	// Tags are deleted with their subnet
+	for i, row := range rows {
+		if matched[i] {
+			continue
+		}
+		if _, err := w.tx.Exec(`DELETE FROM subnets WHERE id = ?`, row.id); err != nil {
+			return fmt.Errorf("error deleting subnet %s: %w", stored[i].CIDR, err)
+		}
+	}
+	return nil
+}
+
+// saveTags writes the tags of a subnet that were added, changed or removed
+func (w *sqliteWriter) saveTags(subnetID int64, cidr string, stored, tags map[string]string) error {
+	for key, value := range tags {
+		if old, ok := stored[key]; ok && old == value {
+			continue
+		}
+		if _, err := w.upsertTag.Exec(subnetID, key, value); err != nil {
+			return fmt.Errorf("error saving tags of subnet %s: %w", cidr, err)
+		}
+	}
+	for key := range stored {
+		if _, ok := tags[key]; ok {
+			continue
+		}
+		if _, err := w.tx.Exec(`DELETE FROM subnet_tags WHERE subnet_id = ? AND key = ?`, subnetID, key); err != nil {
+			return fmt.Errorf("error saving tags of subnet %s: %w", cidr, err)
+		}
+	}
+	return nil
+}
+
+func (w *sqliteWriter) insertBlockRow(block Block, position int64) error {
+	result, err := w.insertBlock.Exec(w.fileKey, position, block.CIDR, CanonicalCIDR(block.CIDR), block.Description, block.Provider)
+	if err != nil {
+		return fmt.Errorf("error saving block %s: %w", block.CIDR, err)
+	}
+	blockID, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("error saving block %s: %w", block.CIDR, err)
+	}
+	for j, subnet := range block.Subnets {
+		if err := w.insertSubnetRow(blockID, subnet, int64(j)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *sqliteWriter) insertSubnetRow(blockID int64, subnet Subnet, position int64) error {
+	result, err := w.insertSubnet.Exec(blockID, w.fileKey, position, subnet.CIDR, CanonicalCIDR(subnet.CIDR),
+		subnet.Name, subnet.Region, formatCreatedAt(subnet.CreatedAt), subnet.Renumberable)
+	if err != nil {
+		return fmt.Errorf("error saving subnet %s: %w", subnet.CIDR, err)
+	}
+	if len(subnet.Tags) == 0 {
+		return nil
+	}
+	subnetID, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("error saving subnet %s: %w", subnet.CIDR, err)
+	}
+	return w.saveTags(subnetID, subnet.CIDR, nil, subnet.Tags)
+}
+
+// nextPosition returns the position of a matched row placed after the row at
+// last: its stored position while that keeps the order, so that removing a
+// row does not renumber the rows after it
+func nextPosition(position int64, last *int64) int64 {
+	if position <= *last {
+		position = *last + 1
+	}
+	*last = position
+	return position
+}
+
+// formatCreatedAt returns the stored form of a subnet creation time
+func formatCreatedAt(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// findSubnets looks up subnets through the prefix and region indexes. Entries
+// are ordered like FindSubnets orders them for the YAML backend.
+func (b *sqliteBackend) findSubnets(blockCIDR, region string) ([]SubnetEntry, error) {
+	query := `SELECT s.id, s.block_id, s.cidr, s.name, s.region, s.created_at, s.renumberable, s.file_key, bl.cidr
+		FROM subnets s JOIN blocks bl ON bl.id = s.block_id WHERE 1 = 1`
+	var args []interface{}
+	if blockCIDR != "" {
+		query += ` AND bl.prefix = ?`
+		args = append(args, CanonicalCIDR(blockCIDR))
+	}
+	if region != "" {
+		query += ` AND s.region = ?`
+		args = append(args, region)
+	}
+	query += ` ORDER BY s.file_key, bl.position, s.position`
+	return b.querySubnets(query, args...)
+}
+
+// findSubnet looks up a subnet through the prefix index
+func (b *sqliteBackend) findSubnet(cidr string) (*SubnetEntry, bool, error) {
+	entries, err := b.querySubnets(`SELECT s.id, s.block_id, s.cidr, s.name, s.region, s.created_at, s.renumberable, s.file_key, bl.cidr
+		FROM subnets s JOIN blocks bl ON bl.id = s.block_id WHERE s.prefix = ?
+		ORDER BY s.file_key, bl.position, s.position`, CanonicalCIDR(cidr))
+	if err != nil || len(entries) == 0 {
+		return nil, false, err
+	}
+	return &entries[0], true, nil
+}
+
+// querySubnets runs a subnet query and returns the entries of configured block file keys
+func (b *sqliteBackend) querySubnets(query string, args ...interface{}) ([]SubnetEntry, error) {
+	rows, err := b.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying subnets: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []SubnetEntry
+	var ids []int64
+	for rows.Next() {
+		var id, blockID int64
+		var entry SubnetEntry
+		var subnet Subnet
+		var createdAt string
+		if err := rows.Scan(&id, &blockID, &subnet.CIDR, &subnet.Name, &subnet.Region, &createdAt, &subnet.Renumberable,
+			&entry.FileKey, &entry.BlockCIDR); err != nil {
+			return nil, fmt.Errorf("error querying subnets: %w", err)
+		}
+		if _, ok := b.cfg.BlockFiles[entry.FileKey]; !ok {
+			continue // Stored under a file key that is no longer configured
+		}
+		if createdAt != "" {
+			if subnet.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+				return nil, fmt.Errorf("invalid creation time %q of subnet %s: %w", createdAt, subnet.CIDR, err)
+			}
+		}
+		entry.Subnet = subnet
+		entries = append(entries, entry)
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error querying subnets: %w", err)
+	}
+
+	for i, id := range ids {
+		tags, err := b.subnetTags(id)
+		if err != nil {
+			return nil, err
+		}
+		entries[i].Subnet.Tags = tags
+	}
+	return entries, nil
+}
+
+// subnetTags returns the tags of a subnet, nil if it has none
+func (b *sqliteBackend) subnetTags(id int64) (map[string]string, error) {
+	rows, err := b.db.Query(`SELECT key, value FROM subnet_tags WHERE subnet_id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error querying subnet tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags map[string]string
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("error querying subnet tags: %w", err)
+		}
+		if tags == nil {
+			tags = make(map[string]string)
+		}
+		tags[key] = value
+	}
+	return tags, rows.Err()
+}
+
+// ImportReport describes the block files copied to another storage backend
+type ImportReport struct {
+	Destination string         // database file or bucket location
+	Blocks      map[string]int // blocks copied per block file key
+	Subnets     map[string]int // subnets copied per block file key
+}
+
+// ImportToSQLite copies the YAML block files of the given file keys, or of all
+// block files when none are given, into the SQLite database at path, replacing
+// anything stored for those file keys. The configuration is not modified.
+func ImportToSQLite(cfg *config.Config, path string, fileKeys ...string) (*ImportReport, error) {
+	if len(fileKeys) == 0 {
+		fileKeys = SortedFileKeys(cfg)
+	}
+
+	dbCfg := *cfg
+	dbCfg.Storage = config.StorageSettings{Backend: BackendSQLite, Path: path}
+	resolved, err := sqlitePath(&dbCfg)
+	if err != nil {
+		return nil, err
+	}
+	backend, err := openSQLiteBackend(&dbCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	yaml := &yamlBackend{cfg: cfg}
+	report := &ImportReport{Destination: resolved, Blocks: make(map[string]int), Subnets: make(map[string]int)}
+	for _, fileKey := range fileKeys {
+		if _, ok := cfg.BlockFiles[fileKey]; !ok {
+			return nil, &NotFoundError{Kind: "block file", Name: fileKey}
+		}
+		blocks, err := yaml.load(fileKey)
+		if err != nil {
+			return nil, fmt.Errorf("error reading block file %s: %w", fileKey, err)
+		}
+		if err := backend.update(fileKey, func([]Block) ([]Block, error) { return blocks, nil }); err != nil {
+			return nil, fmt.Errorf("error importing block file %s: %w", fileKey, err)
+		}
+
+		report.Blocks[fileKey] = len(blocks)
+		for _, block := range blocks {
+			report.Subnets[fileKey] += len(block.Subnets)
+		}
+	}
+	return report, nil
+}
+
+// PrintImportReport prints the block files copied to another storage backend
+func PrintImportReport(report *ImportReport) {
+	fileKeys := make([]string, 0, len(report.Blocks))
+	for fileKey := range report.Blocks {
+		fileKeys = append(fileKeys, fileKey)
+	}
+	sort.Strings(fileKeys)
+
+	for _, fileKey := range fileKeys {
+		fmt.Printf("Copied %d blocks and %d subnets of block file %s\n", report.Blocks[fileKey], report.Subnets[fileKey], fileKey)
+	}
+	fmt.Printf("Destination: %s\n", report.Destination)
+}
@@ -0,0 +1,225 @@
+package ipam
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSQLiteConfig writes YAML block files and imports them into a SQLite
+// database, returning the YAML configuration and the SQLite configuration
+func newSQLiteConfig(t *testing.T, files map[string][]Block) (*config.Config, *config.Config) {
+	tempDir := t.TempDir()
+	yamlCfg := &config.Config{
+		BlockFiles: make(map[string]string),
+		ConfigFile: filepath.Join(tempDir, "ipam-config.yaml"),
+	}
+	for fileKey, blocks := range files {
+		yamlCfg.BlockFiles[fileKey] = filepath.Join(tempDir, fileKey+".yaml")
+		yamlData, err := marshalBlocks(blocks)
+		require.NoError(t, err)
+		require.NoError(t, writeYAMLFile(yamlCfg.BlockFiles[fileKey], yamlData))
+	}
+
+	report, err := ImportToSQLite(yamlCfg, "ipam.db")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(tempDir, "ipam.db"), report.Destination)
+
+	sqliteCfg := *yamlCfg
+	sqliteCfg.Storage = config.StorageSettings{Backend: BackendSQLite, Path: "ipam.db"}
+	return yamlCfg, &sqliteCfg
+}
+
+func TestImportToSQLite(t *testing.T) {
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	yamlCfg, sqliteCfg := newSQLiteConfig(t, map[string][]Block{
+		"dev": {{
+			CIDR:        "10.0.0.0/16",
+			Description: "Development",
+			Provider:    "aws",
+			Subnets: []Subnet{
+				{CIDR: "10.0.1.0/24", Name: "app", Region: "us-east1", CreatedAt: created, Tags: map[string]string{"team": "web"}},
+				{CIDR: "10.0.0.0/24", Name: "db", Region: "eu-west1", Renumberable: true},
+			},
+		}, {
+			CIDR:        "10.1.0.0/16",
+			Description: "Empty",
+		}},
+		"prod": {{
+			CIDR:    "10.2.0.0/16",
+			Subnets: []Subnet{{CIDR: "10.2.0.0/24", Name: "app", Region: "us-east1"}},
+		}},
+	})
+
+	// Blocks and subnets read back exactly as stored in YAML, in the same order
+	for _, fileKey := range []string{"dev", "prod"} {
+		want, err := loadBlocks(yamlCfg, fileKey)
+		require.NoError(t, err)
+		got, err := loadBlocks(sqliteCfg, fileKey)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	// Indexed lookups return what the YAML scan returns
+	for _, filter := range [][2]string{{"", ""}, {"10.0.0.0/16", ""}, {"", "us-east1"}, {"10.0.7.7/16", "eu-west1"}} {
+		want, err := FindSubnets(yamlCfg, filter[0], filter[1])
+		require.NoError(t, err)
+		got, err := FindSubnets(sqliteCfg, filter[0], filter[1])
+		require.NoError(t, err)
+		assert.Equal(t, want, got, "filter %v", filter)
+	}
+
+	entry, err := FindSubnet(sqliteCfg, "10.0.1.9/24")
+	require.NoError(t, err)
+	assert.Equal(t, "dev", entry.FileKey)
+	assert.Equal(t, "10.0.0.0/16", entry.BlockCIDR)
+	assert.Equal(t, map[string]string{"team": "web"}, entry.Subnet.Tags)
+
+	_, err = FindSubnet(sqliteCfg, "10.9.0.0/24")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Validation sees the same data as with the YAML backend
+	results, err := ValidateBlockFile(sqliteCfg, "dev")
+	require.NoError(t, err)
+	assert.Zero(t, results.ErrorCount)
+}
+
+func TestSQLiteMutations(t *testing.T) {
+	_, cfg := newSQLiteConfig(t, map[string][]Block{"dev": {}})
+
+	_, err := AddBlock(cfg, "10.0.0.0/16", "Development", "", "dev", false)
+	require.NoError(t, err)
+	var overlap *OverlapError
+	_, err = AddBlock(cfg, "10.0.128.0/17", "Overlapping", "", "dev", false)
+	assert.ErrorAs(t, err, &overlap)
+
+	_, err = CreateSubnet(cfg, "10.0.0.0/16", "10.0.1.0/24", "app", "us-east1")
+	require.NoError(t, err)
+	_, err = CreateSubnet(cfg, "10.0.0.0/16", "10.0.1.128/25", "dup", "us-east1")
+	assert.ErrorAs(t, err, &overlap)
+
+	entries, err := FindSubnets(cfg, "10.0.0.0/16", "")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "app", entries[0].Subnet.Name)
+
+	require.NoError(t, DeleteSubnet(cfg, "10.0.1.0/24", true))
+	_, err = FindSubnet(cfg, "10.0.1.0/24")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, DeleteBlock(cfg, "10.0.0.0/16", true, "dev"))
+	blocks, err := loadBlocks(cfg, "dev")
+	require.NoError(t, err)
+	assert.Empty(t, blocks)
+}
+
+func TestSQLiteConcurrentAllocation(t *testing.T) {
+	_, cfg := newSQLiteConfig(t, map[string][]Block{"dev": {{CIDR: "10.0.0.0/16", Subnets: []Subnet{}}}})
+	cfg.Patterns = map[string]map[string]config.Pattern{
+		"dev": {"app": {CIDRSize: 24, Region: "us-east1", Block: "10.0.0.0/16"}},
+	}
+
+	const allocations = 16
+	var wg sync.WaitGroup
+	cidrs := make([]string, allocations)
+	errs := make([]error, allocations)
+	for i := 0; i < allocations; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			subnet, _, err := AllocateSubnetFromPattern(cfg, "app", "dev")
+			errs[i] = err
+			if err == nil {
+				cidrs[i] = subnet.CIDR
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for i := 0; i < allocations; i++ {
+		require.NoError(t, errs[i])
+		assert.False(t, seen[cidrs[i]], "subnet %s allocated twice", cidrs[i])
+		seen[cidrs[i]] = true
+	}
+
+	entries, err := FindSubnets(cfg, "10.0.0.0/16", "")
+	require.NoError(t, err)
+	assert.Len(t, entries, allocations)
+}
+
+func TestSQLiteUpdateWritesChangedRows(t *testing.T) {
+	_, cfg := newSQLiteConfig(t, map[string][]Block{"dev": {
+		{CIDR: "10.0.0.0/16", Subnets: []Subnet{
+			{CIDR: "10.0.0.0/24", Name: "app", Tags: map[string]string{"team": "web"}},
+			{CIDR: "10.0.1.0/24", Name: "db"},
+			{CIDR: "10.0.2.0/24", Name: "cache"},
+		}},
+		{CIDR: "10.1.0.0/16", Subnets: []Subnet{{CIDR: "10.1.0.0/24", Name: "other"}}},
+	}})
+	backend, err := openSQLiteBackend(cfg)
+	require.NoError(t, err)
+
+	// Record every write to the tables
+	_, err = backend.db.Exec(`CREATE TABLE writes (tbl TEXT, op TEXT);
+		CREATE TRIGGER blocks_insert AFTER INSERT ON blocks BEGIN INSERT INTO writes VALUES ('blocks', 'insert'); END;
+		CREATE TRIGGER blocks_update AFTER UPDATE ON blocks BEGIN INSERT INTO writes VALUES ('blocks', 'update'); END;
+		CREATE TRIGGER blocks_delete AFTER DELETE ON blocks BEGIN INSERT INTO writes VALUES ('blocks', 'delete'); END;
+		CREATE TRIGGER subnets_insert AFTER INSERT ON subnets BEGIN INSERT INTO writes VALUES ('subnets', 'insert'); END;
+		CREATE TRIGGER subnets_update AFTER UPDATE ON subnets BEGIN INSERT INTO writes VALUES ('subnets', 'update'); END;
+		CREATE TRIGGER subnets_delete AFTER DELETE ON subnets BEGIN INSERT INTO writes VALUES ('subnets', 'delete'); END;
+		CREATE TRIGGER tags_insert AFTER INSERT ON subnet_tags BEGIN INSERT INTO writes VALUES ('subnet_tags', 'insert'); END;
+		CREATE TRIGGER tags_update AFTER UPDATE ON subnet_tags BEGIN INSERT INTO writes VALUES ('subnet_tags', 'update'); END;
+		CREATE TRIGGER tags_delete AFTER DELETE ON subnet_tags BEGIN INSERT INTO writes VALUES ('subnet_tags', 'delete'); END;`)
+	require.NoError(t, err)
+	writes := func() []string {
+		t.Helper()
+		rows, err := backend.db.Query(`SELECT tbl || ' ' || op FROM writes`)
+		require.NoError(t, err)
+		defer rows.Close()
+		var got []string
+		for rows.Next() {
+			var write string
+			require.NoError(t, rows.Scan(&write))
+			got = append(got, write)
+		}
+		_, err = backend.db.Exec(`DELETE FROM writes`)
+		require.NoError(t, err)
+		return got
+	}
+
+	_, err = CreateSubnet(cfg, "10.0.0.0/16", "10.0.3.0/24", "new", "us-east1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"subnets insert"}, writes())
+
+	// Later subnets keep their position when one is removed
+	require.NoError(t, DeleteSubnet(cfg, "10.0.1.0/24", true))
+	assert.Equal(t, []string{"subnets delete"}, writes())
+
+	_, err = RenameSubnet(cfg, "10.0.2.0/24", "redis")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"subnets update"}, writes())
+
+	require.NoError(t, updateBlocks(cfg, "dev", func(blocks []Block) ([]Block, error) {
+		blocks[0].Subnets[0].Tags["team"] = "api"
+		blocks[0].Subnets[0].Tags["tier"] = "1"
+		return blocks, nil
+	}))
+	assert.ElementsMatch(t, []string{"subnet_tags update", "subnet_tags insert"}, writes())
+
+	blocks, err := loadBlocks(cfg, "dev")
+	require.NoError(t, err)
+	require.Len(t, blocks, 2)
+	names := make([]string, len(blocks[0].Subnets))
+	for i, subnet := range blocks[0].Subnets {
+		names[i] = subnet.Name
+	}
+	assert.Equal(t, []string{"app", "redis", "new"}, names)
+	assert.Equal(t, map[string]string{"team": "api", "tier": "1"}, blocks[0].Subnets[0].Tags)
+	assert.Equal(t, "other", blocks[1].Subnets[0].Name)
+}
@@ -3,92 +3,90 @@ package ipam
 import (
 	"errors"
 	"fmt"
-	"net"
 
 	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/iprange"
 	"github.com/lugnut42/openipam/internal/logger"
 )
 
-// CreateSubnet creates a new subnet within a block
-func CreateSubnet(cfg *config.Config, blockCIDR, subnetCIDR, name, region string) error {
+// CreateSubnet creates a new subnet within a block. It returns the warnings of
+// the policies the subnet violates.
+func CreateSubnet(cfg *config.Config, blockCIDR, subnetCIDR, name, region string) ([]string, error) {
 	logger.Debug("Creating subnet: blockCIDR=%s, subnetCIDR=%s, name=%s, region=%s", blockCIDR, subnetCIDR, name, region)
 
-	for _, blockFile := range cfg.BlockFiles {
-		yamlData, err := readYAMLFile(blockFile)
-		if err != nil {
-			return err
-		}
-
-		blocks, err := unmarshalBlocks(yamlData)
-		if err != nil {
-			return err
-		}
-
-		// Validate subnet CIDR (ensure it's a valid CIDR and within the block)
-		_, subnetNet, err := net.ParseCIDR(subnetCIDR)
-		if err != nil {
-			return fmt.Errorf("invalid subnet CIDR: %w", err)
-		}
+	// Store the subnet in canonical form so later lookups match regardless of how it was typed
+	subnetCIDR, err := normalizeCIDR(subnetCIDR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subnet CIDR: %w", err)
+	}
 
-		_, blockNet, err := net.ParseCIDR(blockCIDR)
-		if err != nil {
-			return fmt.Errorf("invalid block CIDR: %w", err)
-		}
+	// Validate subnet CIDR (ensure it's a valid CIDR and within the block)
+	subnetPrefix, err := iprange.ParsePrefix(subnetCIDR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subnet CIDR: %w", err)
+	}
 
-		if !blockNet.Contains(subnetNet.IP) {
-			return errors.New("subnet is not within the specified block")
-		}
+	blockPrefix, err := iprange.ParsePrefix(blockCIDR)
+	if err != nil {
+		return nil, fmt.Errorf("invalid block CIDR: %w", err)
+	}
 
-		newSubnet := Subnet{
-			CIDR:   subnetCIDR,
-			Name:   name,
-			Region: region,
-		}
+	if !iprange.Covers(blockPrefix, subnetPrefix) {
+		return nil, errors.New("subnet is not within the specified block")
+	}
 
+	var warnings []string
+	for _, fileKey := range SortedFileKeys(cfg) {
 		// Find the block and add the subnet. If the block does not exist, return an error.
 		found := false
 
-		for i, block := range blocks {
-			if block.CIDR == blockCIDR {
-				// Check for available space in the block
-				availableCIDRs := calculateAvailableCIDRs(&block)
+		err := updateBlocks(cfg, fileKey, func(blocks []Block) ([]Block, error) {
+			newSubnet := Subnet{
+				CIDR:      subnetCIDR,
+				Name:      name,
+				Region:    region,
+				CreatedAt: timeNow(),
+			}
+
+			for i, block := range blocks {
+				if !cidrEqual(block.CIDR, blockCIDR) {
+					continue
+				}
+				found = true
+
+				// Check for available space in the block and for overlapping subnets
+				index := subnetTrie(block.Subnets)
+				availableCIDRs := index.free(blockPrefix)
 				logger.Debug("Available CIDRs in block %s: %v", blockCIDR, availableCIDRs)
 				if len(availableCIDRs) == 0 {
-					return fmt.Errorf("no available CIDR found in block %s", block.CIDR)
+					return nil, &ExhaustedError{BlockCIDR: block.CIDR, RequestedPrefix: subnetPrefix.Bits()}
+				}
+				if overlaps := index.overlapping(subnetPrefix); len(overlaps) > 0 {
+					existing := block.Subnets[overlaps[0].Value]
+					return nil, &OverlapError{Kind: "subnet", CIDR: subnetCIDR, Existing: existing.CIDR, FileKey: fileKey}
 				}
 
-				// Check for overlapping subnets
-				for _, existingSubnet := range block.Subnets {
-					_, existingSubnetNet, err := net.ParseCIDR(existingSubnet.CIDR)
-					if err != nil {
-						return fmt.Errorf("error parsing existing subnet CIDR: %w", err)
-					}
-
-					if subnetNet.Contains(existingSubnetNet.IP) || existingSubnetNet.Contains(subnetNet.IP) {
-						return fmt.Errorf("subnet with CIDR %s overlaps with existing subnet %s", subnetCIDR, existingSubnet.CIDR)
-					}
+				// Enforce the configured policies before allocating. The
+				// warnings are replaced, not appended, when the update is retried.
+				var err error
+				if warnings, err = enforceSubnetPolicies(cfg, fileKey, newSubnet); err != nil {
+					return nil, err
 				}
 
 				blocks[i].Subnets = append(blocks[i].Subnets, newSubnet)
-				found = true
-				break // Exit the loop once the block is found
+				return blocks, nil
 			}
+			return nil, errUnchanged
+		})
+		if err != nil {
+			return nil, err
 		}
 
 		if found {
-			newYamlData, err := marshalBlocks(blocks)
-			if err != nil {
-				return err
-			}
-			err = writeYAMLFile(blockFile, newYamlData)
-			if err != nil {
-				return err
-			}
-
 			logger.Debug("Subnet created successfully: %s", subnetCIDR)
-			return nil
+			return warnings, nil
 		}
 	}
 
-	return fmt.Errorf("block with CIDR %s not found", blockCIDR)
+	return nil, &NotFoundError{Kind: "block", Name: blockCIDR}
 }
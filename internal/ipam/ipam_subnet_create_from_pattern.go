@@ -2,112 +2,212 @@ package ipam
 
 import (
 	"fmt"
-	"net"
+	"net/netip"
+	"strconv"
+	"strings"
 
 	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/iprange"
 	"github.com/lugnut42/openipam/internal/logger"
 )
 
-// CreateSubnetFromPattern creates a new subnet from a pattern
+// CreateSubnetFromPattern creates a new subnet from a pattern, discarding
+// policy warnings
 func CreateSubnetFromPattern(cfg *config.Config, patternName, fileKey string) error {
+	_, _, err := AllocateSubnetFromPattern(cfg, patternName, fileKey)
+	return err
+}
+
+// AllocateSubnetFromPattern allocates a free subnet that fits a pattern, chosen
+// by its allocation strategy and preferred range, and returns it. The subnet
+// is named from the name template of the pattern and tagged with the pattern
+// name, its environment and its tags. The warnings of the policies the subnet
+// violates are returned with it.
+func AllocateSubnetFromPattern(cfg *config.Config, patternName, fileKey string) (*Subnet, []string, error) {
 	logger.Debug("Creating subnet from pattern: patternName=%s, fileKey=%s", patternName, fileKey)
 
-	patterns, ok := cfg.Patterns[fileKey]
-	if !ok {
-		return fmt.Errorf("patterns for file key %s not found", fileKey)
+	pattern, err := FindPattern(cfg, patternName, fileKey)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	pattern, ok := patterns[patternName]
-	if !ok {
-		return fmt.Errorf("pattern %s not found", patternName)
+	if _, ok := cfg.BlockFiles[fileKey]; !ok {
+		return nil, nil, &NotFoundError{Kind: "block file", Name: fileKey}
 	}
 
-	blockFile, ok := cfg.BlockFiles[fileKey]
-	if !ok {
-		return fmt.Errorf("block file for key %s not found", fileKey)
-	}
+	// The block is re-read and the subnet chosen inside the update, so that
+	// backends with transactions never hand out the same range twice
+	var newSubnet Subnet
+	var warnings []string
+	err = updateBlocks(cfg, fileKey, func(blocks []Block) ([]Block, error) {
+		var block *Block
+		for i, b := range blocks {
+			if cidrEqual(b.CIDR, pattern.Block) {
+				block = &blocks[i]
+				break
+			}
+		}
 
-	yamlData, err := readYAMLFile(blockFile)
-	if err != nil {
-		return fmt.Errorf("error reading YAML file: %w", err)
-	}
+		if block == nil {
+			return nil, &NotFoundError{Kind: "block", Name: pattern.Block, FileKey: fileKey}
+		}
 
-	blocks, err := unmarshalBlocks(yamlData)
-	if err != nil {
-		return fmt.Errorf("error unmarshalling YAML data: %w", err)
-	}
+		// Subnets allocated from the pattern carry its name in their tags
+		allocated := 0
+		names := make(map[string]bool, len(block.Subnets))
+		for _, s := range block.Subnets {
+			names[s.Name] = true
+			if s.Tags[TagPattern] == patternName {
+				allocated++
+			}
+		}
+		if pattern.MaxSubnets > 0 && allocated >= pattern.MaxSubnets {
+			return nil, fmt.Errorf("pattern %s already allocated its maximum of %d subnets in block %s", patternName, pattern.MaxSubnets, block.CIDR)
+		}
 
-	var block *Block
-	for i, b := range blocks {
-		if b.CIDR == pattern.Block {
-			block = &blocks[i]
-			break
+		index := subnetTrie(block.Subnets)
+		blockPrefix, err := iprange.ParsePrefix(block.CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block CIDR %s: %w", block.CIDR, err)
+		}
+		free := index.free(blockPrefix)
+		logger.Debug("Available CIDRs in block %s: %v", block.CIDR, free)
+		if len(free) == 0 {
+			return nil, &ExhaustedError{BlockCIDR: block.CIDR, RequestedPrefix: pattern.CIDRSize}
 		}
-	}
 
-	if block == nil {
-		return fmt.Errorf("block %s not found", pattern.Block)
-	}
+		var preferred netip.Prefix
+		if pattern.PreferredRange != "" {
+			if preferred, err = iprange.ParsePrefix(pattern.PreferredRange); err != nil {
+				return nil, fmt.Errorf("invalid preferred range %s: %w", pattern.PreferredRange, err)
+			}
+		}
+		selected, ok := selectSubnet(free, pattern.CIDRSize, pattern.Strategy, preferred)
+		if !ok {
+			availableCIDRs := make([]string, len(free))
+			for i, prefix := range free {
+				availableCIDRs[i] = prefix.String()
+			}
+			return nil, &ExhaustedError{
+				BlockCIDR:       block.CIDR,
+				RequestedPrefix: pattern.CIDRSize,
+				LargestFree:     largestFreeRange(availableCIDRs),
+			}
+		}
 
-	// Get available CIDRs
-	availableCIDRs := calculateAvailableCIDRs(block)
-	logger.Debug("Available CIDRs in block %s: %v", block.CIDR, availableCIDRs)
-	if len(availableCIDRs) == 0 {
-		return fmt.Errorf("no available CIDR found in block %s", block.CIDR)
-	}
+		// Verify the new subnet doesn't overlap with existing ones
+		newSubnetCIDR := selected.String()
+		if overlaps := index.overlapping(selected); len(overlaps) > 0 {
+			existing := block.Subnets[overlaps[0].Value]
+			return nil, &OverlapError{Kind: "subnet", CIDR: newSubnetCIDR, Existing: existing.CIDR, FileKey: fileKey}
+		}
 
-	// Find an available CIDR that can accommodate our requested size
-	var selectedCIDR string
-	for _, availableCIDR := range availableCIDRs {
-		_, availNet, err := net.ParseCIDR(availableCIDR)
+		name, err := patternSubnetName(patternName, pattern, selected, allocated, names)
 		if err != nil {
-			logger.Debug("Error parsing CIDR %s: %v", availableCIDR, err)
-			continue
+			return nil, err
 		}
 
-		ones, _ := availNet.Mask.Size()
-		if ones <= pattern.CIDRSize {
-			// This CIDR is big enough to accommodate our requested size
-			selectedCIDR = availableCIDR
-			break
+		tags := make(map[string]string, len(pattern.Tags)+2)
+		for key, value := range pattern.Tags {
+			tags[key] = value
+		}
+		if pattern.Environment != "" {
+			tags[TagEnvironment] = pattern.Environment
+		}
+		tags[TagPattern] = patternName
+
+		// Create the new subnet
+		subnet := Subnet{
+			CIDR:      newSubnetCIDR,
+			Name:      name,
+			Region:    pattern.Region,
+			CreatedAt: timeNow(),
+			Tags:      tags,
 		}
-	}
-
-	if selectedCIDR == "" {
-		return fmt.Errorf("no available CIDR found that can accommodate /%d subnet", pattern.CIDRSize)
-	}
 
-	// Calculate the specific subnet within the selected CIDR
-	_, selectedNet, _ := net.ParseCIDR(selectedCIDR)
-	newSubnetIP := selectedNet.IP
-	newSubnetCIDR := fmt.Sprintf("%s/%d", newSubnetIP.String(), pattern.CIDRSize)
+		// Enforce the configured policies before allocating. The warnings
+		// are replaced, not appended, when the update is retried.
+		if warnings, err = enforceSubnetPolicies(cfg, fileKey, subnet); err != nil {
+			return nil, err
+		}
 
-	// Verify the new subnet doesn't overlap with existing ones
-	_, newSubnetNet, _ := net.ParseCIDR(newSubnetCIDR)
-	if isSubnetOverlapping(block.Subnets, newSubnetNet) {
-		return fmt.Errorf("calculated subnet %s overlaps with existing subnets", newSubnetCIDR)
+		block.Subnets = append(block.Subnets, subnet)
+		newSubnet = subnet
+		return blocks, nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Create the new subnet
-	newSubnet := Subnet{
-		CIDR:   newSubnetCIDR,
-		Name:   fmt.Sprintf("%s-%s", patternName, newSubnetIP.String()),
-		Region: pattern.Region,
+	logger.Debug("Subnet created successfully from pattern: %s", newSubnet.CIDR)
+	return &newSubnet, warnings, nil
+}
+
+// selectSubnet picks the subnet of the given size to allocate from the free
+// ranges of a block, in address order, using an allocation strategy. Free
+// ranges within the preferred range are used first when it is valid.
+func selectSubnet(free []netip.Prefix, size int, strategy string, preferred netip.Prefix) (netip.Prefix, bool) {
+	if preferred.IsValid() {
+		var within []netip.Prefix
+		for _, prefix := range free {
+			switch {
+			case iprange.Covers(preferred, prefix):
+				within = append(within, prefix)
+			case iprange.Covers(prefix, preferred):
+				within = append(within, preferred)
+			}
+		}
+		if subnet, ok := selectSubnet(within, size, strategy, netip.Prefix{}); ok {
+			return subnet, true
+		}
 	}
 
-	block.Subnets = append(block.Subnets, newSubnet)
-
-	// Save the updated block configuration
-	newYamlData, err := marshalBlocks(blocks)
-	if err != nil {
-		return fmt.Errorf("error marshalling blocks: %w", err)
+	var fits []netip.Prefix
+	for _, prefix := range free {
+		if prefix.Bits() <= size && size <= prefix.Addr().BitLen() {
+			fits = append(fits, prefix)
+		}
+	}
+	if len(fits) == 0 {
+		return netip.Prefix{}, false
 	}
 
-	err = writeYAMLFile(blockFile, newYamlData)
-	if err != nil {
-		return fmt.Errorf("error writing YAML file: %w", err)
+	switch strategy {
+	case StrategyBestFit:
+		best := fits[0]
+		for _, prefix := range fits[1:] {
+			if prefix.Bits() > best.Bits() {
+				best = prefix
+			}
+		}
+		return netip.PrefixFrom(best.Addr(), size), true
+	case StrategyLastFit:
+		return netip.PrefixFrom(iprange.Last(fits[len(fits)-1]), size).Masked(), true
+	default:
+		return netip.PrefixFrom(fits[0].Addr(), size), true
+	}
+}
+
+// patternSubnetName names a subnet allocated from a pattern with its name
+// template. {index} counts the subnets of the pattern in the block, skipping
+// numbers whose name is already taken.
+func patternSubnetName(patternName string, pattern *config.Pattern, subnet netip.Prefix, allocated int, taken map[string]bool) (string, error) {
+	template := pattern.NameTemplate
+	if template == "" {
+		template = defaultNameTemplate
+	}
+	values := map[string]string{
+		"pattern": patternName,
+		"env":     pattern.Environment,
+		"region":  pattern.Region,
+		"ip":      subnet.Addr().String(),
 	}
 
-	logger.Debug("Subnet created successfully from pattern: %s", newSubnetCIDR)
-	return nil
-}
\ No newline at end of file
+	for index := allocated + 1; ; index++ {
+		values["index"] = strconv.Itoa(index)
+		name, err := expandNameTemplate(template, values)
+		if err != nil || !taken[name] || !strings.Contains(template, "{index}") {
+			return name, err
+		}
+	}
+}
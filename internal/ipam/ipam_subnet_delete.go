@@ -2,9 +2,9 @@ package ipam
 
 import (
 	"fmt"
-	"net"
 
 	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/iprange"
 )
 
 // DeleteSubnet deletes a subnet from a block
@@ -15,53 +15,45 @@ func DeleteSubnet(cfg *config.Config, subnetCIDR string, force bool) error {
 	}
 
 	// Add CIDR validation here, before any file operations
-	if _, _, err := net.ParseCIDR(subnetCIDR); err != nil {
+	if _, err := iprange.ParsePrefix(subnetCIDR); err != nil {
 		return fmt.Errorf("invalid subnet CIDR: %v", err)
 	}
 
 	subnetFound := false
 
-	for _, blockFile := range cfg.BlockFiles {
-		yamlData, err := readYAMLFile(blockFile)
-		if err != nil {
-			return err
-		}
-
-		blocks, err := unmarshalBlocks(yamlData)
-		if err != nil {
-			return err
-		}
-
-		newBlocks := []Block{} // Create a new slice to store the remaining blocks
+	for _, fileKey := range SortedFileKeys(cfg) {
+		err := updateBlocks(cfg, fileKey, func(blocks []Block) ([]Block, error) {
+			subnetFound = false
+			newBlocks := []Block{} // Create a new slice to store the remaining blocks
 
-		for _, block := range blocks {
-			newSubnets := []Subnet{} // Create a new slice to store the remaining subnets
+			for _, block := range blocks {
+				newSubnets := []Subnet{} // Create a new slice to store the remaining subnets
 
-			for _, subnet := range block.Subnets {
-				if subnet.CIDR != subnetCIDR {
-					newSubnets = append(newSubnets, subnet)
-				} else {
-					subnetFound = true
+				for _, subnet := range block.Subnets {
+					if !cidrEqual(subnet.CIDR, subnetCIDR) {
+						newSubnets = append(newSubnets, subnet)
+					} else {
+						subnetFound = true
+					}
 				}
+
+				block.Subnets = newSubnets
+				newBlocks = append(newBlocks, block)
 			}
 
-			block.Subnets = newSubnets
-			newBlocks = append(newBlocks, block)
+			if !subnetFound {
+				return nil, errUnchanged
+			}
+			return newBlocks, nil
+		})
+		if err != nil {
+			return err
 		}
 
 		if subnetFound {
-			newYamlData, err := marshalBlocks(newBlocks) // Marshal the updated blocks
-			if err != nil {
-				return err
-			}
-			err = writeYAMLFile(blockFile, newYamlData)
-			if err != nil {
-				return err
-			}
-
 			return nil
 		}
 	}
 
-	return fmt.Errorf("subnet with CIDR %s not found", subnetCIDR) // Handle if subnet isn't found in any file
+	return &NotFoundError{Kind: "subnet", Name: subnetCIDR} // Handle if subnet isn't found in any file
 }
@@ -8,30 +8,36 @@ import (
 	"github.com/lugnut42/openipam/internal/config"
 )
 
-// ListSubnets lists all subnets within a block
-func ListSubnets(cfg *config.Config, blockCIDR, region string) error {
-	// Create a single tabwriter for all results
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "Block CIDR\tSubnet CIDR\tName\tRegion") // Table header
-	
-	// Track if we found any subnets
-	foundSubnets := false
-	
-	// Iterate through all block files
-	for _, blockFile := range cfg.BlockFiles {
-		yamlData, err := readYAMLFile(blockFile)
-		if err != nil {
-			return err
-		}
+// SubnetEntry is a subnet together with its parent block and block file key
+type SubnetEntry struct {
+	FileKey   string
+	BlockCIDR string
+	Subnet    Subnet
+}
+
+// FindSubnets returns the subnets of all block files, optionally filtered by
+// parent block and region
+func FindSubnets(cfg *config.Config, blockCIDR, region string) ([]SubnetEntry, error) {
+	backend, err := backendFor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if index, ok := backend.(subnetIndex); ok {
+		return index.findSubnets(blockCIDR, region)
+	}
 
-		blocks, err := unmarshalBlocks(yamlData)
+	var entries []SubnetEntry
+
+	// Iterate through all block files
+	for _, fileKey := range SortedFileKeys(cfg) {
+		blocks, err := loadBlocks(cfg, fileKey)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		for _, block := range blocks {
 			// Optionally filter by blockCIDR
-			if blockCIDR != "" && block.CIDR != blockCIDR {
+			if blockCIDR != "" && !cidrEqual(block.CIDR, blockCIDR) {
 				continue // Skip blocks that don't match the filter
 			}
 
@@ -41,20 +47,37 @@ func ListSubnets(cfg *config.Config, blockCIDR, region string) error {
 					continue // Skip subnets that don't match the region
 				}
 
-				fmt.Fprintln(w, block.CIDR+"\t"+subnet.CIDR+"\t"+subnet.Name+"\t"+subnet.Region)
-				foundSubnets = true
+				entries = append(entries, SubnetEntry{FileKey: fileKey, BlockCIDR: block.CIDR, Subnet: subnet})
 			}
 		}
 	}
-	
-	// Only flush if we found subnets
-	if foundSubnets {
-		if err := w.Flush(); err != nil {
-			return fmt.Errorf("error flushing writer: %w", err)
-		}
-	} else {
+
+	return entries, nil
+}
+
+// ListSubnets lists all subnets within a block
+func ListSubnets(cfg *config.Config, blockCIDR, region string) error {
+	entries, err := FindSubnets(cfg, blockCIDR, region)
+	if err != nil {
+		return err
+	}
+	return PrintSubnets(entries)
+}
+
+// PrintSubnets prints subnet entries as a table
+func PrintSubnets(entries []SubnetEntry) error {
+	if len(entries) == 0 {
 		fmt.Println("No subnets found.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Block CIDR\tSubnet CIDR\tName\tRegion") // Table header
+	for _, entry := range entries {
+		fmt.Fprintln(w, entry.BlockCIDR+"\t"+entry.Subnet.CIDR+"\t"+entry.Subnet.Name+"\t"+entry.Subnet.Region)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error flushing writer: %w", err)
 	}
-	
 	return nil
 }
@@ -0,0 +1,57 @@
+package ipam
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/iprange"
+)
+
+// RenameSubnet changes the name of a subnet. The new name must satisfy the
+// policies of the subnet's block file; the warnings of the policies it
+// violates are returned.
+func RenameSubnet(cfg *config.Config, subnetCIDR, name string) ([]string, error) {
+	if _, err := iprange.ParsePrefix(subnetCIDR); err != nil {
+		return nil, fmt.Errorf("invalid subnet CIDR: %v", err)
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("subnet name cannot be empty")
+	}
+
+	var warnings []string
+	for _, fileKey := range SortedFileKeys(cfg) {
+		found := false
+		err := updateBlocks(cfg, fileKey, func(blocks []Block) ([]Block, error) {
+			found = false
+			for i := range blocks {
+				for j, subnet := range blocks[i].Subnets {
+					if !cidrEqual(subnet.CIDR, subnetCIDR) {
+						continue
+					}
+					found = true
+					if subnet.Name == name {
+						return nil, errUnchanged
+					}
+					subnet.Name = name
+					var err error
+					if warnings, err = enforceSubnetPolicies(cfg, fileKey, subnet); err != nil {
+						return nil, err
+					}
+					blocks[i].Subnets[j] = subnet
+					return blocks, nil
+				}
+			}
+			return nil, errUnchanged
+		})
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			return warnings, nil
+		}
+	}
+
+	return nil, &NotFoundError{Kind: "subnet", Name: subnetCIDR}
+}
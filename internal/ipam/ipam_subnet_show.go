@@ -8,38 +8,60 @@ import (
 	"github.com/lugnut42/openipam/internal/config"
 )
 
-// ShowSubnet displays the details of a specific subnet
-func ShowSubnet(cfg *config.Config, subnetCIDR string) error {
-	for _, blockFile := range cfg.BlockFiles {
-		yamlData, err := readYAMLFile(blockFile)
+// FindSubnet returns the subnet with the given CIDR from any block file
+func FindSubnet(cfg *config.Config, subnetCIDR string) (*SubnetEntry, error) {
+	backend, err := backendFor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if index, ok := backend.(subnetIndex); ok {
+		entry, found, err := index.findSubnet(subnetCIDR)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		if !found {
+			return nil, &NotFoundError{Kind: "subnet", Name: subnetCIDR}
 		}
+		return entry, nil
+	}
 
-		blocks, err := unmarshalBlocks(yamlData)
+	for _, fileKey := range SortedFileKeys(cfg) {
+		blocks, err := loadBlocks(cfg, fileKey)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		for _, block := range blocks {
 			for _, subnet := range block.Subnets {
-				if subnet.CIDR == subnetCIDR {
-					// Found the subnet
-					w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-					fmt.Fprintln(w, "Block CIDR:\t", block.CIDR)
-					fmt.Fprintln(w, "Subnet CIDR:\t", subnet.CIDR)
-					fmt.Fprintln(w, "Name:\t", subnet.Name)
-					fmt.Fprintln(w, "Region:\t", subnet.Region) // Include the Region
-
-					if err := w.Flush(); err != nil {
-						return fmt.Errorf("error flushing writer: %w", err)
-					}
-
-					return nil
+				if cidrEqual(subnet.CIDR, subnetCIDR) {
+					return &SubnetEntry{FileKey: fileKey, BlockCIDR: block.CIDR, Subnet: subnet}, nil
 				}
 			}
 		}
 	}
 
-	return fmt.Errorf("subnet with CIDR %s not found", subnetCIDR)
+	return nil, &NotFoundError{Kind: "subnet", Name: subnetCIDR}
+}
+
+// ShowSubnet displays the details of a specific subnet
+func ShowSubnet(cfg *config.Config, subnetCIDR string) error {
+	entry, err := FindSubnet(cfg, subnetCIDR)
+	if err != nil {
+		return err
+	}
+	return PrintSubnet(entry)
+}
+
+// PrintSubnet prints the details of a subnet entry
+func PrintSubnet(entry *SubnetEntry) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Block CIDR:\t", entry.BlockCIDR)
+	fmt.Fprintln(w, "Subnet CIDR:\t", entry.Subnet.CIDR)
+	fmt.Fprintln(w, "Name:\t", entry.Subnet.Name)
+	fmt.Fprintln(w, "Region:\t", entry.Subnet.Region) // Include the Region
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error flushing writer: %w", err)
+	}
+	return nil
 }
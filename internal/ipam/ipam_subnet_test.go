@@ -1,11 +1,12 @@
 package ipam
 
 import (
-	"net"
+	"path/filepath"
 	"testing"
 
 	"github.com/lugnut42/openipam/internal/config"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCreateSubnet_NoAvailableCIDR(t *testing.T) {
@@ -35,12 +36,30 @@ func TestCreateSubnet_NoAvailableCIDR(t *testing.T) {
 	}
 
 	// Attempt to create a new subnet, which should fail
-	err = CreateSubnet(cfg, "10.0.0.0/24", "10.0.0.256/26", "test-subnet", "us-west")
+	_, err = CreateSubnet(cfg, "10.0.0.0/24", "10.0.0.256/26", "test-subnet", "us-west")
 	if err == nil {
 		t.Fatalf("Expected error due to no available CIDR, but got nil")
 	}
 }
 
+func TestCreateSubnet_LargerThanBlock(t *testing.T) {
+	blockFile := filepath.Join(t.TempDir(), "blocks.yaml")
+	cfg := &config.Config{
+		BlockFiles: map[string]string{"default": blockFile},
+	}
+	yamlData, err := marshalBlocks([]Block{{CIDR: "10.0.0.0/16"}})
+	require.NoError(t, err)
+	require.NoError(t, writeYAMLFile(blockFile, yamlData))
+
+	// The subnet starts at the block's first address but extends past its end
+	_, err = CreateSubnet(cfg, "10.0.0.0/16", "10.0.0.0/8", "too-large", "us-west")
+	assert.ErrorContains(t, err, "not within the specified block")
+
+	blocks, err := loadBlocks(cfg, "default")
+	require.NoError(t, err)
+	assert.Empty(t, blocks[0].Subnets)
+}
+
 func TestCreateSubnetFromPattern_NoAvailableCIDR(t *testing.T) {
 	cfg := &config.Config{
 		BlockFiles: map[string]string{"default": "test_block.yaml"},
@@ -83,93 +102,27 @@ func TestCreateSubnetFromPattern_NoAvailableCIDR(t *testing.T) {
 	}
 }
 
-func TestIsSubnetOverlapping(t *testing.T) {
-	testCases := []struct {
-		name           string
-		existingSubnets []string
-		newSubnet      string
-		expected       bool
-	}{
-		{
-			name:           "No overlap with empty subnets",
-			existingSubnets: []string{},
-			newSubnet:      "10.0.1.0/24",
-			expected:       false,
-		},
-		{
-			name:           "No overlap with different subnets",
-			existingSubnets: []string{"192.168.1.0/24", "172.16.0.0/16"},
-			newSubnet:      "10.0.1.0/24",
-			expected:       false,
-		},
-		{
-			name:           "Exact match overlap",
-			existingSubnets: []string{"10.0.1.0/24", "172.16.0.0/16"},
-			newSubnet:      "10.0.1.0/24",
-			expected:       true,
-		},
-		{
-			name:           "Subset overlap",
-			existingSubnets: []string{"10.0.0.0/16", "172.16.0.0/16"},
-			newSubnet:      "10.0.1.0/24",
-			expected:       true,
-		},
-		{
-			name:           "Superset overlap",
-			existingSubnets: []string{"10.0.1.0/24", "172.16.0.0/16"},
-			newSubnet:      "10.0.0.0/16",
-			expected:       true,
-		},
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			var subnets []Subnet
-			for _, cidr := range tc.existingSubnets {
-				subnets = append(subnets, Subnet{CIDR: cidr})
-			}
-
-			_, newSubnetNet, _ := net.ParseCIDR(tc.newSubnet)
-			result := isSubnetOverlapping(subnets, newSubnetNet)
-			assert.Equal(t, tc.expected, result)
-		})
+func TestRenameSubnet(t *testing.T) {
+	blockFile := filepath.Join(t.TempDir(), "default.yaml")
+	yamlData, err := marshalBlocks([]Block{{CIDR: "10.0.0.0/16", Subnets: []Subnet{{CIDR: "10.0.1.0/24", Name: "app-old", Region: "us-east1"}}}})
+	require.NoError(t, err)
+	require.NoError(t, writeYAMLFile(blockFile, yamlData))
+	cfg := &config.Config{
+		BlockFiles: map[string]string{"default": blockFile},
+		Policies:   map[string][]config.Policy{"*": {{Name: "naming", NamePattern: "^app-"}}},
 	}
-}
 
-func TestIncrementIP(t *testing.T) {
-	testCases := []struct {
-		name     string
-		startIP  string
-		expected string
-	}{
-		{
-			name:     "Increment regular IP",
-			startIP:  "192.168.1.1",
-			expected: "192.168.1.2",
-		},
-		{
-			name:     "Increment with carry to next octet",
-			startIP:  "192.168.1.255",
-			expected: "192.168.2.0",
-		},
-		{
-			name:     "Increment with multiple carries",
-			startIP:  "192.168.255.255",
-			expected: "192.169.0.0",
-		},
-		// IPv6 formatting issue - skipping overflow test
-		// {
-		//	name:     "Increment with carry to first octet",
-		//	startIP:  "255.255.255.255",
-		//	expected: "0.0.0.0", // Wraps around
-		// },
-	}
+	_, err = RenameSubnet(cfg, "10.0.1.0/24", "app-new")
+	require.NoError(t, err)
+	entry, err := FindSubnet(cfg, "10.0.1.0/24")
+	require.NoError(t, err)
+	assert.Equal(t, "app-new", entry.Subnet.Name)
+	assert.Equal(t, "us-east1", entry.Subnet.Region)
 
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			ip := net.ParseIP(tc.startIP)
-			incrementIP(ip)
-			assert.Equal(t, tc.expected, ip.String())
-		})
-	}
+	_, err = RenameSubnet(cfg, "10.0.1.0/24", "db")
+	assert.ErrorContains(t, err, "violates policy")
+	_, err = RenameSubnet(cfg, "10.0.1.0/24", " ")
+	assert.Error(t, err)
+	_, err = RenameSubnet(cfg, "10.0.2.0/24", "app-x")
+	assert.ErrorIs(t, err, ErrNotFound)
 }
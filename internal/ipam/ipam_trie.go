@@ -0,0 +1,233 @@
+package ipam
+
+import (
+	"net/netip"
+	"sort"
+
+	"github.com/lugnut42/openipam/internal/iprange"
+)
+
+// prefixTrie is a path-compressed binary trie of network prefixes. Every node
+// branches on the first bit after its prefix, so that overlap, containment and
+// longest-prefix-match queries walk at most one path from the root instead of
+// comparing against every stored prefix. IPv4 and IPv6 prefixes are kept in
+// separate trees. A prefix may be inserted more than once with different values.
+type prefixTrie[T any] struct {
+	v4, v6 *trieNode[T]
+	size   int
+}
+
+type trieNode[T any] struct {
+	prefix netip.Prefix
+	values []T // empty for nodes that only branch
+	child  [2]*trieNode[T]
+}
+
+// trieEntry is a stored prefix with one of its values
+type trieEntry[T any] struct {
+	Prefix netip.Prefix
+	Value  T
+}
+
+// subnetTrie indexes the subnets of a block by prefix; subnets with invalid
+// CIDRs are left out
+func subnetTrie(subnets []Subnet) *prefixTrie[int] {
+	t := &prefixTrie[int]{}
+	for i, subnet := range subnets {
+		if prefix, err := iprange.ParsePrefix(subnet.CIDR); err == nil {
+			t.insert(prefix, i)
+		}
+	}
+	return t
+}
+
+// overlapPositions returns the positions stored in an index that overlap p,
+// in ascending order
+func overlapPositions(index *prefixTrie[int], p netip.Prefix) []int {
+	var positions []int
+	for _, entry := range index.overlapping(p) {
+		positions = append(positions, entry.Value)
+	}
+	sort.Ints(positions)
+	return positions
+}
+
+// Len returns the number of inserted values
+func (t *prefixTrie[T]) Len() int {
+	return t.size
+}
+
+func (t *prefixTrie[T]) root(p netip.Prefix) **trieNode[T] {
+	if p.Addr().Is4() {
+		return &t.v4
+	}
+	return &t.v6
+}
+
+// insert adds a value for a prefix; host bits of the prefix are ignored
+func (t *prefixTrie[T]) insert(p netip.Prefix, value T) {
+	p = p.Masked()
+	t.size++
+	link := t.root(p)
+	for {
+		n := *link
+		if n == nil {
+			*link = &trieNode[T]{prefix: p, values: []T{value}}
+			return
+		}
+
+		common := iprange.CommonBits(n.prefix, p)
+		switch {
+		case common == n.prefix.Bits() && common == p.Bits():
+			n.values = append(n.values, value)
+			return
+		case common == n.prefix.Bits():
+			// p lies below n
+			link = &n.child[iprange.Bit(p.Addr(), common)]
+		case common == p.Bits():
+			// p is above n and takes its place
+			node := &trieNode[T]{prefix: p, values: []T{value}}
+			node.child[iprange.Bit(n.prefix.Addr(), common)] = n
+			*link = node
+			return
+		default:
+			// p and n diverge; a branching node joins them
+			branch := &trieNode[T]{prefix: netip.PrefixFrom(p.Addr(), common).Masked()}
+			branch.child[iprange.Bit(n.prefix.Addr(), common)] = n
+			branch.child[iprange.Bit(p.Addr(), common)] = &trieNode[T]{prefix: p, values: []T{value}}
+			*link = branch
+			return
+		}
+	}
+}
+
+// covering returns the stored prefixes that contain p, including p itself,
+// from the shortest to the longest
+func (t *prefixTrie[T]) covering(p netip.Prefix) []trieEntry[T] {
+	p = p.Masked()
+	var entries []trieEntry[T]
+	for n := *t.root(p); n != nil && n.prefix.Bits() <= p.Bits() && n.prefix.Contains(p.Addr()); {
+		entries = n.appendValues(entries)
+		if n.prefix.Bits() == p.Bits() {
+			break
+		}
+		n = n.child[iprange.Bit(p.Addr(), n.prefix.Bits())]
+	}
+	return entries
+}
+
+// within returns the stored prefixes that p contains, including p itself, in
+// address order with larger prefixes before the prefixes they contain
+func (t *prefixTrie[T]) within(p netip.Prefix) []trieEntry[T] {
+	var entries []trieEntry[T]
+	if n := t.subtree(p); n != nil {
+		n.walk(func(n *trieNode[T]) { entries = n.appendValues(entries) })
+	}
+	return entries
+}
+
+// overlapping returns the stored prefixes that share addresses with p: those
+// containing it followed by those it strictly contains
+func (t *prefixTrie[T]) overlapping(p netip.Prefix) []trieEntry[T] {
+	p = p.Masked()
+	entries := t.covering(p)
+	if n := t.subtree(p); n != nil {
+		n.walk(func(n *trieNode[T]) {
+			if n.prefix != p {
+				entries = n.appendValues(entries)
+			}
+		})
+	}
+	return entries
+}
+
+// lookup returns the longest stored prefix containing addr
+func (t *prefixTrie[T]) lookup(addr netip.Addr) (trieEntry[T], bool) {
+	entries := t.covering(netip.PrefixFrom(addr, addr.BitLen()))
+	if len(entries) == 0 {
+		return trieEntry[T]{}, false
+	}
+	return entries[len(entries)-1], true
+}
+
+// entries returns all stored prefixes, IPv4 before IPv6, in address order
+func (t *prefixTrie[T]) entries() []trieEntry[T] {
+	var entries []trieEntry[T]
+	for _, n := range []*trieNode[T]{t.v4, t.v6} {
+		if n != nil {
+			n.walk(func(n *trieNode[T]) { entries = n.appendValues(entries) })
+		}
+	}
+	return entries
+}
+
+// free returns the parts of p not covered by any stored prefix as the fewest
+// CIDRs, in address order
+func (t *prefixTrie[T]) free(p netip.Prefix) []netip.Prefix {
+	p = p.Masked()
+	if len(t.covering(p)) > 0 {
+		return nil
+	}
+	return freeIn(p, t.subtree(p), nil)
+}
+
+// freeIn appends the free CIDRs of p, where n is the subtree of the stored
+// prefixes within p
+func freeIn[T any](p netip.Prefix, n *trieNode[T], out []netip.Prefix) []netip.Prefix {
+	if n == nil {
+		return append(out, p)
+	}
+	if n.prefix == p {
+		if len(n.values) > 0 {
+			return out
+		}
+		lower, upper := iprange.Halves(p)
+		out = freeIn(lower, n.child[0], out)
+		return freeIn(upper, n.child[1], out)
+	}
+
+	// n is strictly inside p, so one half of p is entirely free
+	lower, upper := iprange.Halves(p)
+	if iprange.Bit(n.prefix.Addr(), p.Bits()) == 0 {
+		out = freeIn(lower, n, out)
+		return append(out, upper)
+	}
+	out = append(out, lower)
+	return freeIn(upper, n, out)
+}
+
+// subtree returns the topmost node whose prefix lies within p
+func (t *prefixTrie[T]) subtree(p netip.Prefix) *trieNode[T] {
+	p = p.Masked()
+	n := *t.root(p)
+	for n != nil {
+		if n.prefix.Bits() >= p.Bits() {
+			if p.Contains(n.prefix.Addr()) {
+				return n
+			}
+			return nil
+		}
+		if !n.prefix.Contains(p.Addr()) {
+			return nil
+		}
+		n = n.child[iprange.Bit(p.Addr(), n.prefix.Bits())]
+	}
+	return nil
+}
+
+// walk visits n and its descendants in address order
+func (n *trieNode[T]) walk(fn func(*trieNode[T])) {
+	fn(n)
+	for _, c := range n.child {
+		if c != nil {
+			c.walk(fn)
+		}
+	}
+}
+
+func (n *trieNode[T]) appendValues(entries []trieEntry[T]) []trieEntry[T] {
+	for _, v := range n.values {
+		entries = append(entries, trieEntry[T]{Prefix: n.prefix, Value: v})
+	}
+	return entries
+}
@@ -0,0 +1,178 @@
+package ipam
+
+import (
+	"fmt"
+	"math/rand"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func prefixesOf(entries []trieEntry[string]) []string {
+	var prefixes []string
+	for _, entry := range entries {
+		prefixes = append(prefixes, entry.Value)
+	}
+	return prefixes
+}
+
+func TestPrefixTrie(t *testing.T) {
+	trie := &prefixTrie[string]{}
+	for _, cidr := range []string{"10.0.0.0/16", "10.0.1.0/24", "10.0.1.128/25", "10.0.4.0/22", "10.1.0.0/16", "2001:db8::/32", "2001:db8:1::/48"} {
+		trie.insert(netip.MustParsePrefix(cidr), cidr)
+	}
+	trie.insert(netip.MustParsePrefix("10.0.1.0/24"), "10.0.1.0/24 again")
+	assert.Equal(t, 8, trie.Len())
+
+	assert.Equal(t, []string{"10.0.0.0/16", "10.0.1.0/24", "10.0.1.0/24 again"}, prefixesOf(trie.covering(netip.MustParsePrefix("10.0.1.0/26"))))
+	assert.Equal(t, []string{"10.0.1.0/24", "10.0.1.0/24 again", "10.0.1.128/25"}, prefixesOf(trie.within(netip.MustParsePrefix("10.0.0.0/23"))))
+	assert.Equal(t, []string{"10.0.0.0/16", "10.0.4.0/22"}, prefixesOf(trie.overlapping(netip.MustParsePrefix("10.0.4.0/23"))))
+	assert.Equal(t, []string{"10.0.0.0/16", "10.0.1.0/24", "10.0.1.0/24 again", "10.0.1.128/25", "10.0.4.0/22"}, prefixesOf(trie.overlapping(netip.MustParsePrefix("10.0.0.0/16"))))
+	assert.Empty(t, trie.overlapping(netip.MustParsePrefix("10.2.0.0/16")))
+	assert.Equal(t, []string{"2001:db8::/32", "2001:db8:1::/48"}, prefixesOf(trie.overlapping(netip.MustParsePrefix("2001:db8::/31"))))
+
+	entry, ok := trie.lookup(netip.MustParseAddr("10.0.1.200"))
+	require.True(t, ok)
+	assert.Equal(t, "10.0.1.128/25", entry.Value)
+	entry, ok = trie.lookup(netip.MustParseAddr("2001:db8:1::1"))
+	require.True(t, ok)
+	assert.Equal(t, "2001:db8:1::/48", entry.Value)
+	_, ok = trie.lookup(netip.MustParseAddr("192.168.0.1"))
+	assert.False(t, ok)
+
+	assert.Len(t, trie.entries(), 8)
+}
+
+func TestPrefixTrieFree(t *testing.T) {
+	testCases := []struct {
+		name    string
+		block   string
+		subnets []string
+		want    []string
+	}{
+		{"Empty", "10.0.0.0/24", nil, []string{"10.0.0.0/24"}},
+		{"Full", "10.0.0.0/24", []string{"10.0.0.0/24"}, nil},
+		{"Covered by a larger prefix", "10.0.0.0/24", []string{"10.0.0.0/16"}, nil},
+		{"Middle", "10.0.0.0/24", []string{"10.0.0.64/26"}, []string{"10.0.0.0/26", "10.0.0.128/25"}},
+		{"Host", "10.0.0.0/29", []string{"10.0.0.3/32"}, []string{"10.0.0.0/31", "10.0.0.2/32", "10.0.0.4/30"}},
+		{"Nested", "10.0.0.0/24", []string{"10.0.0.0/25", "10.0.0.16/28"}, []string{"10.0.0.128/25"}},
+		{"Outside the block", "10.0.0.0/24", []string{"10.0.1.0/24"}, []string{"10.0.0.0/24"}},
+		{"IPv6", "2001:db8::/32", []string{"2001:db8::/33", "2001:db8:c000::/34"}, []string{"2001:db8:8000::/34"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			trie := &prefixTrie[string]{}
+			for _, cidr := range tc.subnets {
+				trie.insert(netip.MustParsePrefix(cidr), cidr)
+			}
+			var got []string
+			for _, prefix := range trie.free(netip.MustParsePrefix(tc.block)) {
+				got = append(got, prefix.String())
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+// The trie agrees with comparing every pair of prefixes
+func TestPrefixTrieRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	block := netip.MustParsePrefix("10.0.0.0/16")
+	for round := 0; round < 50; round++ {
+		trie := &prefixTrie[int]{}
+		var prefixes []netip.Prefix
+		for i := 0; i < 40; i++ {
+			addr := netip.AddrFrom4([4]byte{10, 0, byte(rng.Intn(256)), byte(rng.Intn(256))})
+			p := netip.PrefixFrom(addr, 18+rng.Intn(15)).Masked()
+			prefixes = append(prefixes, p)
+			trie.insert(p, i)
+		}
+
+		query := netip.PrefixFrom(netip.AddrFrom4([4]byte{10, 0, byte(rng.Intn(256)), 0}), 16+rng.Intn(17)).Masked()
+		var want []int
+		for i, p := range prefixes {
+			if p.Overlaps(query) {
+				want = append(want, i)
+			}
+		}
+		assert.Equal(t, want, overlapPositions(trie, query), "round %d", round)
+
+		// Free ranges never overlap a prefix and add up to the uncovered addresses
+		free := trie.free(block)
+		uncovered := 0
+		for a := block.Addr(); block.Contains(a); a = a.Next() {
+			if _, ok := trie.lookup(a); !ok {
+				uncovered++
+			}
+		}
+		total := 0
+		for _, f := range free {
+			assert.Empty(t, trie.overlapping(f), "round %d: free range %s", round, f)
+			total += 1 << (32 - f.Bits())
+		}
+		assert.Equal(t, uncovered, total, "round %d", round)
+	}
+}
+
+// benchmarkBlock returns a /8 block with 100k /28 subnets, each followed by
+// an unallocated /28
+func benchmarkBlock() Block {
+	block := Block{CIDR: "10.0.0.0/8"}
+	for i := 0; i < 100000; i++ {
+		n := uint32(10)<<24 | uint32(i)*32
+		addr := netip.AddrFrom4([4]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)})
+		block.Subnets = append(block.Subnets, Subnet{CIDR: netip.PrefixFrom(addr, 28).String(), Name: fmt.Sprintf("s%d", i), Region: "r"})
+	}
+	// Stored in random order, as hand-edited block files may be
+	rand.New(rand.NewSource(1)).Shuffle(len(block.Subnets), func(i, j int) {
+		block.Subnets[i], block.Subnets[j] = block.Subnets[j], block.Subnets[i]
+	})
+	return block
+}
+
+func BenchmarkTrieInsert(b *testing.B) {
+	block := benchmarkBlock()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		subnetTrie(block.Subnets)
+	}
+}
+
+func BenchmarkTrieOverlap(b *testing.B) {
+	block := benchmarkBlock()
+	trie := subnetTrie(block.Subnets)
+	query := netip.MustParsePrefix("10.48.0.16/28")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		trie.overlapping(query)
+	}
+}
+
+func BenchmarkTrieLookup(b *testing.B) {
+	block := benchmarkBlock()
+	trie := subnetTrie(block.Subnets)
+	addr := netip.MustParseAddr("10.48.0.7")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		trie.lookup(addr)
+	}
+}
+
+func BenchmarkAvailableCIDRs(b *testing.B) {
+	block := benchmarkBlock()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		calculateAvailableCIDRs(&block)
+	}
+}
+
+func BenchmarkValidateSubnets(b *testing.B) {
+	blocks := []Block{benchmarkBlock()}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		validateSubnets(blocks, "bench", &ValidationResults{})
+	}
+}
@@ -2,11 +2,11 @@ package ipam
 
 import (
 	"fmt"
-	"net"
 	"os"
 	"text/tabwriter"
 
 	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/iprange"
 	"github.com/lugnut42/openipam/internal/logger"
 	"gopkg.in/yaml.v3"
 )
@@ -18,6 +18,7 @@ type ValidationResult struct {
 	Category    string // Category of the validation (e.g., "structure", "cidr", "reference")
 	Description string // Description of the issue
 	Location    string // Location in the file (e.g., "blocks.10.0.0.0/16.subnets.0")
+	Fixable     bool   // Whether FixBlockFile can remediate the issue automatically
 }
 
 // ValidationResults holds all validation results for a file
@@ -32,7 +33,7 @@ type ValidationResults struct {
 func ValidateBlockFile(cfg *config.Config, fileKey string) (*ValidationResults, error) {
 	filepath, ok := cfg.BlockFiles[fileKey]
 	if !ok {
-		return nil, fmt.Errorf("block file for key %s not found", fileKey)
+		return nil, &NotFoundError{Kind: "block file", Name: fileKey}
 	}
 
 	// Initialize results
@@ -41,8 +42,8 @@ func ValidateBlockFile(cfg *config.Config, fileKey string) (*ValidationResults,
 		Results:  []ValidationResult{},
 	}
 
-	// Read the YAML file
-	yamlData, err := readYAMLFile(filepath)
+	// Read the blocks as YAML, whatever the storage backend
+	yamlData, err := readBlockData(cfg, fileKey)
 	if err != nil {
 		return nil, fmt.Errorf("error reading YAML file: %w", err)
 	}
@@ -54,8 +55,10 @@ func ValidateBlockFile(cfg *config.Config, fileKey string) (*ValidationResults,
 	blocks, err := unmarshalBlocks(yamlData)
 	if err == nil {
 		validateBlocks(blocks, fileKey, results)
+		validateSpecialPurpose(blocks, fileKey, results)
 		validateSubnets(blocks, fileKey, results)
 		validateCrossReferences(blocks, cfg, fileKey, results)
+		validatePolicies(blocks, cfg, fileKey, results)
 	}
 
 	// Count errors and warnings
@@ -124,7 +127,7 @@ func validateYAMLStructure(yamlData []byte, fileKey string, results *ValidationR
 			}
 			
 			// Validate CIDR format
-			_, _, err := net.ParseCIDR(cidr)
+			_, err := iprange.ParsePrefix(cidr)
 			if err != nil {
 				results.Results = append(results.Results, ValidationResult{
 					Type:        "error",
@@ -182,7 +185,7 @@ func validateYAMLStructure(yamlData []byte, fileKey string, results *ValidationR
 	// Check each block
 	for cidr, blockData := range blocksMap {
 		// Validate the CIDR format
-		_, _, err := net.ParseCIDR(cidr)
+		_, err := iprange.ParsePrefix(cidr)
 		if err != nil {
 			results.Results = append(results.Results, ValidationResult{
 				Type:        "error",
@@ -234,7 +237,7 @@ func validateYAMLStructure(yamlData []byte, fileKey string, results *ValidationR
 			// Check each subnet
 			for subnetCIDR, subnetData := range subnetsMap {
 				// Validate the subnet CIDR format
-				_, _, err := net.ParseCIDR(subnetCIDR)
+				_, err := iprange.ParsePrefix(subnetCIDR)
 				if err != nil {
 					results.Results = append(results.Results, ValidationResult{
 						Type:        "error",
@@ -277,6 +280,13 @@ func validateYAMLStructure(yamlData []byte, fileKey string, results *ValidationR
 
 // validateBlocks performs validations on block data
 func validateBlocks(blocks []Block, fileKey string, results *ValidationResults) {
+	index := &prefixTrie[int]{}
+	for i, block := range blocks {
+		if prefix, err := iprange.ParsePrefix(block.CIDR); err == nil {
+			index.insert(prefix, i)
+		}
+	}
+
 	// Check for duplicate CIDRs
 	seenCIDRs := make(map[string]bool)
 	for _, block := range blocks {
@@ -292,7 +302,7 @@ func validateBlocks(blocks []Block, fileKey string, results *ValidationResults)
 		seenCIDRs[block.CIDR] = true
 
 		// Validate CIDR format
-		_, blockNet, err := net.ParseCIDR(block.CIDR)
+		blockPrefix, err := iprange.ParsePrefix(block.CIDR)
 		if err != nil {
 			results.Results = append(results.Results, ValidationResult{
 				Type:        "error",
@@ -304,6 +314,18 @@ func validateBlocks(blocks []Block, fileKey string, results *ValidationResults)
 			continue
 		}
 
+		// Check that the CIDR is written in canonical form (network address)
+		if canonical, _ := normalizeCIDR(block.CIDR); canonical != block.CIDR {
+			results.Results = append(results.Results, ValidationResult{
+				Type:        "warning",
+				File:        fileKey,
+				Category:    "canonical",
+				Description: fmt.Sprintf("Block CIDR %s is not in canonical form (%s)", block.CIDR, canonical),
+				Location:    fmt.Sprintf("blocks.%s", block.CIDR),
+				Fixable:     true,
+			})
+		}
+
 		// Check if block has a description
 		if block.Description == "" {
 			results.Results = append(results.Results, ValidationResult{
@@ -316,25 +338,19 @@ func validateBlocks(blocks []Block, fileKey string, results *ValidationResults)
 		}
 
 		// Check for overlapping blocks within this file
-		for _, otherBlock := range blocks {
+		for _, j := range overlapPositions(index, blockPrefix) {
+			otherBlock := blocks[j]
 			if block.CIDR == otherBlock.CIDR {
 				continue // Skip self-comparison
 			}
 
-			_, otherBlockNet, err := net.ParseCIDR(otherBlock.CIDR)
-			if err != nil {
-				continue // Skip invalid CIDRs, they are reported elsewhere
-			}
-
-			if checkCIDROverlap(blockNet, otherBlockNet) {
-				results.Results = append(results.Results, ValidationResult{
-					Type:        "error",
-					File:        fileKey,
-					Category:    "overlap",
-					Description: fmt.Sprintf("Block %s overlaps with block %s", block.CIDR, otherBlock.CIDR),
-					Location:    fmt.Sprintf("blocks.%s", block.CIDR),
-				})
-			}
+			results.Results = append(results.Results, ValidationResult{
+				Type:        "error",
+				File:        fileKey,
+				Category:    "overlap",
+				Description: fmt.Sprintf("Block %s overlaps with block %s", block.CIDR, otherBlock.CIDR),
+				Location:    fmt.Sprintf("blocks.%s", block.CIDR),
+			})
 		}
 	}
 }
@@ -342,19 +358,23 @@ func validateBlocks(blocks []Block, fileKey string, results *ValidationResults)
 // validateSubnets performs validations on subnet data
 func validateSubnets(blocks []Block, fileKey string, results *ValidationResults) {
 	for _, block := range blocks {
-		_, blockNet, err := net.ParseCIDR(block.CIDR)
+		blockPrefix, err := iprange.ParsePrefix(block.CIDR)
 		if err != nil {
 			continue // Skip invalid blocks, they are reported elsewhere
 		}
 
+		index := subnetTrie(block.Subnets)
+
 		// Check for duplicate subnet CIDRs within the block
 		seenSubnetCIDRs := make(map[string]bool)
 		seenSubnetNames := make(map[string]bool)
+		seenSubnets := make(map[subnetKey]bool)
 
 		for i, subnet := range block.Subnets {
 			location := fmt.Sprintf("blocks.%s.subnets[%d]", block.CIDR, i)
+			key := keyOf(subnet)
 
-			// Check for duplicate CIDRs
+			// Check for duplicate CIDRs; exact duplicate entries can be removed safely
 			if seenSubnetCIDRs[subnet.CIDR] {
 				results.Results = append(results.Results, ValidationResult{
 					Type:        "error",
@@ -362,12 +382,13 @@ func validateSubnets(blocks []Block, fileKey string, results *ValidationResults)
 					Category:    "duplicate",
 					Description: fmt.Sprintf("Duplicate subnet CIDR: %s", subnet.CIDR),
 					Location:    location,
+					Fixable:     seenSubnets[key],
 				})
 			}
 			seenSubnetCIDRs[subnet.CIDR] = true
 
 			// Check for duplicate names (should be unique within a block)
-			if seenSubnetNames[subnet.Name] {
+			if seenSubnetNames[subnet.Name] && !seenSubnets[key] {
 				results.Results = append(results.Results, ValidationResult{
 					Type:        "error",
 					File:        fileKey,
@@ -377,9 +398,10 @@ func validateSubnets(blocks []Block, fileKey string, results *ValidationResults)
 				})
 			}
 			seenSubnetNames[subnet.Name] = true
+			seenSubnets[key] = true
 
 			// Validate subnet CIDR format
-			_, subnetNet, err := net.ParseCIDR(subnet.CIDR)
+			subnetPrefix, err := iprange.ParsePrefix(subnet.CIDR)
 			if err != nil {
 				results.Results = append(results.Results, ValidationResult{
 					Type:        "error",
@@ -391,8 +413,20 @@ func validateSubnets(blocks []Block, fileKey string, results *ValidationResults)
 				continue
 			}
 
+			// Check that the CIDR is written in canonical form (network address)
+			if canonical, _ := normalizeCIDR(subnet.CIDR); canonical != subnet.CIDR {
+				results.Results = append(results.Results, ValidationResult{
+					Type:        "warning",
+					File:        fileKey,
+					Category:    "canonical",
+					Description: fmt.Sprintf("Subnet CIDR %s is not in canonical form (%s)", subnet.CIDR, canonical),
+					Location:    location,
+					Fixable:     true,
+				})
+			}
+
 			// Check if subnet is within its parent block
-			if !blockNet.Contains(subnetNet.IP) {
+			if !iprange.Covers(blockPrefix, subnetPrefix) {
 				results.Results = append(results.Results, ValidationResult{
 					Type:        "error",
 					File:        fileKey,
@@ -424,57 +458,63 @@ func validateSubnets(blocks []Block, fileKey string, results *ValidationResults)
 			}
 
 			// Check for overlapping subnets within this block
-			for j, otherSubnet := range block.Subnets {
-				if i == j {
-					continue // Skip self-comparison
-				}
-
-				_, otherSubnetNet, err := net.ParseCIDR(otherSubnet.CIDR)
-				if err != nil {
-					continue // Skip invalid CIDRs, they are reported elsewhere
+			for _, j := range overlapPositions(index, subnetPrefix) {
+				otherSubnet := block.Subnets[j]
+				if i == j || subnet.CIDR == otherSubnet.CIDR {
+					continue // Skip self-comparison; duplicates are reported above
 				}
 
-				if checkCIDROverlap(subnetNet, otherSubnetNet) {
-					results.Results = append(results.Results, ValidationResult{
-						Type:        "error",
-						File:        fileKey,
-						Category:    "overlap",
-						Description: fmt.Sprintf("Subnet %s overlaps with subnet %s", subnet.CIDR, otherSubnet.CIDR),
-						Location:    location,
-					})
-				}
+				results.Results = append(results.Results, ValidationResult{
+					Type:        "error",
+					File:        fileKey,
+					Category:    "overlap",
+					Description: fmt.Sprintf("Subnet %s overlaps with subnet %s", subnet.CIDR, otherSubnet.CIDR),
+					Location:    location,
+				})
 			}
 		}
+
+		// Check that subnets are stored in address order
+		if !subnetsSorted(block.Subnets) {
+			results.Results = append(results.Results, ValidationResult{
+				Type:        "warning",
+				File:        fileKey,
+				Category:    "order",
+				Description: fmt.Sprintf("Subnets of block %s are not sorted by address", block.CIDR),
+				Location:    fmt.Sprintf("blocks.%s.subnets", block.CIDR),
+				Fixable:     true,
+			})
+		}
 	}
 }
 
 // validateCrossReferences checks references between different parts of the configuration
 func validateCrossReferences(blocks []Block, cfg *config.Config, fileKey string, results *ValidationResults) {
 	// Check patterns that reference blocks in this file
-	for patternName, pattern := range cfg.Patterns {
-		for _, p := range pattern {
-			// Check if the pattern references a block in this file
-			if _, ok := cfg.BlockFiles[fileKey]; ok && p.Block != "" {
-				// Check if the referenced block exists
-				blockExists := false
-				for _, block := range blocks {
-					if block.CIDR == p.Block {
-						blockExists = true
-						break
-					}
-				}
+	for patternName, p := range cfg.Patterns[fileKey] {
+		if p.Block == "" {
+			continue
+		}
 
-				if !blockExists {
-					results.Results = append(results.Results, ValidationResult{
-						Type:        "error",
-						File:        fileKey,
-						Category:    "reference",
-						Description: fmt.Sprintf("Pattern '%s' references non-existent block: %s", patternName, p.Block),
-						Location:    fmt.Sprintf("patterns.%s", patternName),
-					})
-				}
+		// Check if the referenced block exists
+		blockExists := false
+		for _, block := range blocks {
+			if cidrEqual(block.CIDR, p.Block) {
+				blockExists = true
+				break
 			}
 		}
+
+		if !blockExists {
+			results.Results = append(results.Results, ValidationResult{
+				Type:        "error",
+				File:        fileKey,
+				Category:    "reference",
+				Description: fmt.Sprintf("Pattern '%s' references non-existent block: %s", patternName, p.Block),
+				Location:    fmt.Sprintf("patterns.%s.%s", fileKey, patternName),
+				Fixable:     true,
+			})
+		}
 	}
 }
 
@@ -495,6 +535,7 @@ func PrintValidationResults(results *ValidationResults) error {
 	fmt.Fprintln(w, "Type\tCategory\tLocation\tDescription")
 	fmt.Fprintln(w, "----\t--------\t--------\t-----------")
 
+	fixable := 0
 	for _, result := range results.Results {
 		var typeStr string
 		if result.Type == "error" {
@@ -502,6 +543,9 @@ func PrintValidationResults(results *ValidationResults) error {
 		} else {
 			typeStr = "WARNING"
 		}
+		if result.Fixable {
+			fixable++
+		}
 
 		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
 			typeStr,
@@ -509,6 +553,9 @@ func PrintValidationResults(results *ValidationResults) error {
 			result.Location,
 			result.Description)
 	}
+	if fixable > 0 {
+		fmt.Fprintf(w, "\n%d issue(s) can be fixed automatically with --fix\n", fixable)
+	}
 	if err := w.Flush(); err != nil {
 		return err
 	}
@@ -516,9 +563,38 @@ func PrintValidationResults(results *ValidationResults) error {
 	return nil
 }
 
-// ValidateAllBlockFiles validates all block files in the configuration
-func ValidateAllBlockFiles(cfg *config.Config) error {
-	if len(cfg.BlockFiles) == 0 {
+// FileValidation is the validation of one block file. Err is set instead of
+// Results if the block file could not be validated.
+type FileValidation struct {
+	FileKey string
+	Results *ValidationResults
+	Err     error
+}
+
+// ValidateAll validates every block file of the configuration in key order,
+// and the relationships between them
+func ValidateAll(cfg *config.Config) ([]FileValidation, *ValidationResults, error) {
+	var files []FileValidation
+	for _, fileKey := range SortedFileKeys(cfg) {
+		results, err := ValidateBlockFile(cfg, fileKey)
+		if err != nil {
+			logger.Debug("Error validating block file %s: %v", fileKey, err)
+		}
+		files = append(files, FileValidation{FileKey: fileKey, Results: results, Err: err})
+	}
+
+	// Check overlaps, names and references between block files
+	crossResults, err := ValidateCrossFile(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error validating across block files: %w", err)
+	}
+	return files, crossResults, nil
+}
+
+// PrintAllValidationResults prints the results of ValidateAll with a summary.
+// It returns an error if validation found errors.
+func PrintAllValidationResults(files []FileValidation, crossResults *ValidationResults) error {
+	if len(files) == 0 {
 		fmt.Println("No block files configured.")
 		return nil
 	}
@@ -526,23 +602,29 @@ func ValidateAllBlockFiles(cfg *config.Config) error {
 	totalErrors := 0
 	totalWarnings := 0
 
-	for fileKey := range cfg.BlockFiles {
-		results, err := ValidateBlockFile(cfg, fileKey)
-		if err != nil {
-			logger.Debug("Error validating block file %s: %v", fileKey, err)
-			fmt.Printf("Error validating block file %s: %v\n", fileKey, err)
+	for _, file := range files {
+		if file.Err != nil {
+			fmt.Printf("Error validating block file %s: %v\n", file.FileKey, file.Err)
 			continue
 		}
 
-		fmt.Printf("\n=== Block File: %s ===\n", fileKey)
-		if err := PrintValidationResults(results); err != nil {
+		fmt.Printf("\n=== Block File: %s ===\n", file.FileKey)
+		if err := PrintValidationResults(file.Results); err != nil {
 			return fmt.Errorf("error printing validation results: %w", err)
 		}
 
-		totalErrors += results.ErrorCount
-		totalWarnings += results.WarningCount
+		totalErrors += file.Results.ErrorCount
+		totalWarnings += file.Results.WarningCount
+	}
+
+	fmt.Printf("\n=== Cross-file Checks ===\n")
+	if err := PrintValidationResults(crossResults); err != nil {
+		return fmt.Errorf("error printing validation results: %w", err)
 	}
 
+	totalErrors += crossResults.ErrorCount
+	totalWarnings += crossResults.WarningCount
+
 	fmt.Printf("\nValidation Summary\n")
 	fmt.Printf("Total Errors: %d  Total Warnings: %d\n", totalErrors, totalWarnings)
 
@@ -552,3 +634,12 @@ func ValidateAllBlockFiles(cfg *config.Config) error {
 
 	return nil
 }
+
+// ValidateAllBlockFiles validates all block files in the configuration and prints the results
+func ValidateAllBlockFiles(cfg *config.Config) error {
+	files, crossResults, err := ValidateAll(cfg)
+	if err != nil {
+		return err
+	}
+	return PrintAllValidationResults(files, crossResults)
+}
@@ -0,0 +1,219 @@
+package ipam
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/iprange"
+	"github.com/lugnut42/openipam/internal/logger"
+)
+
+// FixReport describes the remediations applied to a block file
+type FixReport struct {
+	FileKey string
+	Applied []string // Human readable description of each applied fix
+	Diff    string   // Line diff of the block file and configuration changes
+}
+
+// subnetsSorted reports whether subnets are stored in ascending address order
+func subnetsSorted(subnets []Subnet) bool {
+	return sort.SliceIsSorted(subnets, func(i, j int) bool {
+		return subnetLess(subnets[i], subnets[j])
+	})
+}
+
+// subnetLess orders subnets by network address, then by prefix length.
+// Subnets with unparsable CIDRs sort last in their original order.
+func subnetLess(a, b Subnet) bool {
+	prefixA, errA := iprange.ParsePrefix(a.CIDR)
+	prefixB, errB := iprange.ParsePrefix(b.CIDR)
+	if errA != nil || errB != nil {
+		return errA == nil && errB != nil
+	}
+	if c := prefixA.Addr().Compare(prefixB.Addr()); c != 0 {
+		return c < 0
+	}
+	return prefixA.Bits() < prefixB.Bits()
+}
+
+// FixBlockFile applies safe remediations for the fixable validation findings of a
+// block file: non-canonical CIDRs are rewritten to their network address, exact
+// duplicate subnet entries are removed, subnets are sorted by address, and
+// patterns referencing blocks that no longer exist are deleted. Findings that
+// cannot be fixed safely are left untouched and reported by a later validation.
+func FixBlockFile(cfg *config.Config, fileKey string) (*FixReport, error) {
+	logger.Debug("FixBlockFile called with fileKey=%s", fileKey)
+
+	blockFile, ok := cfg.BlockFiles[fileKey]
+	if !ok {
+		return nil, &NotFoundError{Kind: "block file", Name: fileKey}
+	}
+
+	// fn may be retried, so the pattern changes are made to a copy that is
+	// only applied once the blocks are saved
+	report := &FixReport{FileKey: fileKey}
+	var patterns map[string]config.Pattern
+	patternsChanged := false
+	var blocks []Block
+	err := updateBlocks(cfg, fileKey, func(stored []Block) ([]Block, error) {
+		yamlData, err := marshalBlocks(stored)
+		if err != nil {
+			return nil, fmt.Errorf("error marshalling blocks: %w", err)
+		}
+		blocks = stored
+		patterns = maps.Clone(cfg.Patterns[fileKey])
+
+		// Rewrite non-canonical CIDRs, keeping pattern references in step
+		applied, blocksChanged, changed := normalizeBlocks(blocks, patterns)
+		report.Applied = applied
+		report.Diff = ""
+		patternsChanged = changed
+
+		for i := range blocks {
+			block := &blocks[i]
+
+			// Drop exact duplicate subnet entries
+			seen := make(map[subnetKey]bool)
+			var subnets []Subnet
+			for _, subnet := range block.Subnets {
+				key := keyOf(subnet)
+				if seen[key] {
+					report.Applied = append(report.Applied, fmt.Sprintf("Removed duplicate subnet entry %s (%s)", subnet.CIDR, subnet.Name))
+					blocksChanged = true
+					continue
+				}
+				seen[key] = true
+				subnets = append(subnets, subnet)
+			}
+			block.Subnets = subnets
+
+			if !subnetsSorted(block.Subnets) {
+				sort.SliceStable(block.Subnets, func(a, b int) bool {
+					return subnetLess(block.Subnets[a], block.Subnets[b])
+				})
+				report.Applied = append(report.Applied, fmt.Sprintf("Sorted subnets of block %s by address", block.CIDR))
+				blocksChanged = true
+			}
+		}
+
+		if !blocksChanged {
+			return nil, errUnchanged
+		}
+
+		newYamlData, err := marshalBlocks(blocks)
+		if err != nil {
+			return nil, fmt.Errorf("error marshalling blocks: %w", err)
+		}
+		report.Diff = lineDiff(blockFile, string(yamlData), string(newYamlData))
+		return blocks, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error writing block file: %w", err)
+	}
+	if patternsChanged {
+		cfg.Patterns[fileKey] = patterns
+	}
+
+	// Remove patterns whose block no longer exists in this file
+	var removedPatterns []string
+	for name, p := range cfg.Patterns[fileKey] {
+		if p.Block == "" {
+			continue
+		}
+		exists := false
+		for _, block := range blocks {
+			if cidrEqual(block.CIDR, p.Block) {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			removedPatterns = append(removedPatterns, name)
+		}
+	}
+	sort.Strings(removedPatterns)
+	for _, name := range removedPatterns {
+		report.Applied = append(report.Applied, fmt.Sprintf("Removed pattern '%s' referencing missing block %s", name, cfg.Patterns[fileKey][name].Block))
+		delete(cfg.Patterns[fileKey], name)
+		patternsChanged = true
+		report.Diff += fmt.Sprintf("--- patterns.%s\n- %s\n", fileKey, name)
+	}
+
+	if patternsChanged {
+		if err := config.WriteConfig(cfg); err != nil {
+			return nil, fmt.Errorf("error writing configuration: %w", err)
+		}
+	}
+
+	logger.Debug("Applied %d fixes to block file %s", len(report.Applied), fileKey)
+	return report, nil
+}
+
+// lineDiff returns a minimal line-based diff between two texts.
+// Unchanged lines are prefixed with two spaces, removed lines with "- "
+// and added lines with "+ ".
+func lineDiff(name, before, after string) string {
+	a := strings.Split(strings.TrimSuffix(before, "\n"), "\n")
+	b := strings.Split(strings.TrimSuffix(after, "\n"), "\n")
+
+	// Longest common subsequence table
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", name, name)
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			fmt.Fprintf(&sb, "  %s\n", a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			fmt.Fprintf(&sb, "- %s\n", a[i])
+			i++
+		default:
+			fmt.Fprintf(&sb, "+ %s\n", b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		fmt.Fprintf(&sb, "- %s\n", a[i])
+	}
+	for ; j < len(b); j++ {
+		fmt.Fprintf(&sb, "+ %s\n", b[j])
+	}
+	return sb.String()
+}
+
+// PrintFixReport displays the fixes applied to a block file and the resulting diff
+func PrintFixReport(report *FixReport) {
+	if len(report.Applied) == 0 {
+		fmt.Printf("No automatic fixes needed for block file '%s'.\n", report.FileKey)
+		return
+	}
+
+	fmt.Printf("Applied %d fix(es) to block file '%s':\n", len(report.Applied), report.FileKey)
+	for _, fix := range report.Applied {
+		fmt.Printf("  - %s\n", fix)
+	}
+	if report.Diff != "" {
+		fmt.Printf("\n%s\n", report.Diff)
+	}
+}
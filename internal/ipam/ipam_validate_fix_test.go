@@ -0,0 +1,107 @@
+package ipam
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFixBlockFile(t *testing.T) {
+	tempDir := t.TempDir()
+	blockFile := filepath.Join(tempDir, "default.yaml")
+	blocks := []Block{
+		{
+			CIDR:        "10.0.0.0/16",
+			Description: "test block",
+			Subnets: []Subnet{
+				{CIDR: "10.0.2.0/24", Name: "db", Region: "us-east1"},
+				{CIDR: "10.0.1.7/24", Name: "app", Region: "us-east1"},
+				{CIDR: "10.0.2.0/24", Name: "db", Region: "us-east1"},
+			},
+		},
+	}
+	yamlData, err := marshalBlocks(blocks)
+	require.NoError(t, err)
+	require.NoError(t, writeYAMLFile(blockFile, yamlData))
+
+	cfg := &config.Config{
+		BlockFiles: map[string]string{"default": blockFile},
+		ConfigFile: filepath.Join(tempDir, "ipam-config.yaml"),
+		Patterns: map[string]map[string]config.Pattern{
+			"default": {
+				"valid":  {CIDRSize: 24, Block: "10.0.0.0/16"},
+				"orphan": {CIDRSize: 24, Block: "172.16.0.0/16"},
+			},
+		},
+	}
+
+	results, err := ValidateBlockFile(cfg, "default")
+	require.NoError(t, err)
+	fixable := 0
+	for _, r := range results.Results {
+		if r.Fixable {
+			fixable++
+		}
+	}
+	assert.Equal(t, 4, fixable, "canonical, duplicate, order and reference findings should be fixable")
+
+	report, err := FixBlockFile(cfg, "default")
+	require.NoError(t, err)
+	assert.Len(t, report.Applied, 4)
+	assert.Contains(t, report.Diff, "+     - cidr: 10.0.1.0/24")
+
+	_, ok := cfg.Patterns["default"]["orphan"]
+	assert.False(t, ok)
+	_, ok = cfg.Patterns["default"]["valid"]
+	assert.True(t, ok)
+
+	results, err = ValidateBlockFile(cfg, "default")
+	require.NoError(t, err)
+	assert.Equal(t, 0, results.ErrorCount)
+	assert.Equal(t, 0, results.WarningCount)
+
+	// A second run has nothing left to fix
+	report, err = FixBlockFile(cfg, "default")
+	require.NoError(t, err)
+	assert.Empty(t, report.Applied)
+}
+
+func TestFixBlockFileRetry(t *testing.T) {
+	unsorted := []Subnet{
+		{CIDR: "10.0.2.0/24", Name: "db", Region: "us-east1"},
+		{CIDR: "10.0.1.0/24", Name: "app", Region: "us-east1"},
+	}
+	cfg, server := newS3Config(t, map[string][]Block{
+		"dev": {{CIDR: "10.0.0.0/16", Description: "Development", Subnets: unsorted}},
+	})
+
+	// Another writer adds a subnet between our read and our write
+	competing := true
+	server.BeforePut = func(bucket, key string) {
+		if competing {
+			competing = false
+			yamlData, err := marshalBlocks([]Block{{CIDR: "10.0.0.0/16", Description: "Development",
+				Subnets: append(unsorted, Subnet{CIDR: "10.0.3.0/24", Name: "other", Region: "us-east1"})}})
+			require.NoError(t, err)
+			server.SetObject(bucket, key, yamlData)
+		}
+	}
+
+	report, err := FixBlockFile(cfg, "dev")
+	require.NoError(t, err)
+	assert.Equal(t, 1, server.Conflicts)
+	assert.Equal(t, []string{"Sorted subnets of block 10.0.0.0/16 by address"}, report.Applied)
+
+	// The diff is taken against the blocks the fix was applied to
+	assert.Contains(t, report.Diff, "        name: other\n")
+	assert.NotContains(t, report.Diff, "+       name: other")
+	assert.Len(t, storedBlocks(t, server, "dev")[0].Subnets, 3)
+}
+
+func TestLineDiff(t *testing.T) {
+	diff := lineDiff("f", "a\nb\nc\n", "a\nc\nd\n")
+	assert.Equal(t, "--- f\n+++ f\n  a\n- b\n  c\n+ d\n", diff)
+}
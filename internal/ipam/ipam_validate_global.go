@@ -0,0 +1,190 @@
+package ipam
+
+import (
+	"fmt"
+	"net/netip"
+	"sort"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/iprange"
+	"github.com/lugnut42/openipam/internal/logger"
+)
+
+// indexedBlock is a block together with the block file key it was loaded from
+type indexedBlock struct {
+	FileKey string
+	Block   Block
+	Prefix  netip.Prefix
+}
+
+// indexedSubnet is a subnet together with its parent block and block file key
+type indexedSubnet struct {
+	FileKey   string
+	BlockCIDR string
+	Subnet    Subnet
+	Prefix    netip.Prefix
+}
+
+// SortedFileKeys returns the configured block file keys in a stable order
+func SortedFileKeys(cfg *config.Config) []string {
+	fileKeys := make([]string, 0, len(cfg.BlockFiles))
+	for fileKey := range cfg.BlockFiles {
+		fileKeys = append(fileKeys, fileKey)
+	}
+	sort.Strings(fileKeys)
+	return fileKeys
+}
+
+// ValidateCrossFile validates the relationships between block files. It indexes
+// every block and subnet across all file keys and reports overlaps between
+// files, subnet names used in more than one file, and patterns whose block is
+// defined under a different file key. Block files that cannot be read or
+// parsed are skipped; they are reported by ValidateBlockFile.
+func ValidateCrossFile(cfg *config.Config) (*ValidationResults, error) {
+	results := &ValidationResults{
+		Filename: "(all block files)",
+		Results:  []ValidationResult{},
+	}
+
+	var blocks []indexedBlock
+	var subnets []indexedSubnet
+
+	for _, fileKey := range SortedFileKeys(cfg) {
+		fileBlocks, err := loadBlocks(cfg, fileKey)
+		if err != nil {
+			logger.Debug("Skipping block file %s in cross-file validation: %v", fileKey, err)
+			continue
+		}
+
+		for _, block := range fileBlocks {
+			blockPrefix, err := iprange.ParsePrefix(block.CIDR)
+			if err != nil {
+				continue // Invalid CIDRs are reported by ValidateBlockFile
+			}
+			blocks = append(blocks, indexedBlock{FileKey: fileKey, Block: block, Prefix: blockPrefix})
+
+			for _, subnet := range block.Subnets {
+				subnetPrefix, err := iprange.ParsePrefix(subnet.CIDR)
+				if err != nil {
+					continue
+				}
+				subnets = append(subnets, indexedSubnet{FileKey: fileKey, BlockCIDR: block.CIDR, Subnet: subnet, Prefix: subnetPrefix})
+			}
+		}
+	}
+
+	// Blocks overlapping blocks in other files
+	blockIndex := &prefixTrie[int]{}
+	for i, b := range blocks {
+		blockIndex.insert(b.Prefix, i)
+	}
+	for i, a := range blocks {
+		for _, j := range overlapPositions(blockIndex, a.Prefix) {
+			b := blocks[j]
+			if j <= i || a.FileKey == b.FileKey {
+				continue
+			}
+			results.Results = append(results.Results, ValidationResult{
+				Type:        "error",
+				File:        a.FileKey,
+				Category:    "overlap",
+				Description: fmt.Sprintf("Block %s overlaps with block %s in file %s", a.Block.CIDR, b.Block.CIDR, b.FileKey),
+				Location:    fmt.Sprintf("%s:blocks.%s", a.FileKey, a.Block.CIDR),
+			})
+		}
+	}
+
+	// Subnets overlapping subnets in other files, and names reused across files
+	subnetIndex := &prefixTrie[int]{}
+	for i, sub := range subnets {
+		subnetIndex.insert(sub.Prefix, i)
+	}
+	namesByFile := make(map[string]map[string]bool)
+	for i, a := range subnets {
+		for _, j := range overlapPositions(subnetIndex, a.Prefix) {
+			b := subnets[j]
+			if j <= i || a.FileKey == b.FileKey {
+				continue
+			}
+			results.Results = append(results.Results, ValidationResult{
+				Type:        "error",
+				File:        a.FileKey,
+				Category:    "overlap",
+				Description: fmt.Sprintf("Subnet %s overlaps with subnet %s in file %s", a.Subnet.CIDR, b.Subnet.CIDR, b.FileKey),
+				Location:    fmt.Sprintf("%s:blocks.%s.subnets.%s", a.FileKey, a.BlockCIDR, a.Subnet.CIDR),
+			})
+		}
+
+		if a.Subnet.Name == "" {
+			continue
+		}
+		if namesByFile[a.Subnet.Name] == nil {
+			namesByFile[a.Subnet.Name] = make(map[string]bool)
+		}
+		namesByFile[a.Subnet.Name][a.FileKey] = true
+	}
+
+	names := make([]string, 0, len(namesByFile))
+	for name, files := range namesByFile {
+		if len(files) > 1 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var files []string
+		for fileKey := range namesByFile[name] {
+			files = append(files, fileKey)
+		}
+		sort.Strings(files)
+		results.Results = append(results.Results, ValidationResult{
+			Type:        "warning",
+			File:        files[0],
+			Category:    "duplicate",
+			Description: fmt.Sprintf("Subnet name '%s' is used in multiple block files: %v", name, files),
+			Location:    fmt.Sprintf("subnets.%s", name),
+		})
+	}
+
+	// Patterns whose block lives under a different file key
+	patternFileKeys := make([]string, 0, len(cfg.Patterns))
+	for fileKey := range cfg.Patterns {
+		patternFileKeys = append(patternFileKeys, fileKey)
+	}
+	sort.Strings(patternFileKeys)
+	for _, fileKey := range patternFileKeys {
+		patternNames := make([]string, 0, len(cfg.Patterns[fileKey]))
+		for name := range cfg.Patterns[fileKey] {
+			patternNames = append(patternNames, name)
+		}
+		sort.Strings(patternNames)
+
+		for _, name := range patternNames {
+			p := cfg.Patterns[fileKey][name]
+			if p.Block == "" {
+				continue
+			}
+			for _, b := range blocks {
+				if b.FileKey != fileKey && cidrEqual(b.Block.CIDR, p.Block) {
+					results.Results = append(results.Results, ValidationResult{
+						Type:        "error",
+						File:        fileKey,
+						Category:    "reference",
+						Description: fmt.Sprintf("Pattern '%s' references block %s which is defined in file %s", name, p.Block, b.FileKey),
+						Location:    fmt.Sprintf("patterns.%s.%s", fileKey, name),
+					})
+				}
+			}
+		}
+	}
+
+	for _, r := range results.Results {
+		if r.Type == "error" {
+			results.ErrorCount++
+		} else if r.Type == "warning" {
+			results.WarningCount++
+		}
+	}
+
+	return results, nil
+}
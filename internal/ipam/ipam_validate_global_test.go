@@ -0,0 +1,62 @@
+package ipam
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCrossFile(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string][]Block{
+		"dev": {
+			{
+				CIDR:        "10.0.0.0/16",
+				Description: "dev",
+				Subnets:     []Subnet{{CIDR: "10.0.1.0/24", Name: "app", Region: "us-east1"}},
+			},
+		},
+		"prod": {
+			{
+				CIDR:        "10.0.128.0/17",
+				Description: "prod, hand-edited to overlap dev",
+				Subnets:     []Subnet{{CIDR: "10.0.129.0/24", Name: "app", Region: "us-east1"}},
+			},
+			{CIDR: "172.16.0.0/16", Description: "prod"},
+		},
+	}
+
+	cfg := &config.Config{
+		BlockFiles: map[string]string{},
+		Patterns: map[string]map[string]config.Pattern{
+			"dev": {"misplaced": {CIDRSize: 24, Block: "172.16.0.0/16"}},
+		},
+	}
+	for fileKey, blocks := range files {
+		path := filepath.Join(tempDir, fileKey+".yaml")
+		yamlData, err := marshalBlocks(blocks)
+		require.NoError(t, err)
+		require.NoError(t, writeYAMLFile(path, yamlData))
+		cfg.BlockFiles[fileKey] = path
+	}
+
+	results, err := ValidateCrossFile(cfg)
+	require.NoError(t, err)
+
+	categories := map[string]int{}
+	for _, r := range results.Results {
+		categories[r.Category]++
+	}
+	assert.Equal(t, 1, categories["overlap"], "dev and prod blocks overlap")
+	assert.Equal(t, 1, categories["duplicate"], "subnet name 'app' is used in both files")
+	assert.Equal(t, 1, categories["reference"], "pattern in dev references a prod block")
+	assert.Equal(t, 2, results.ErrorCount)
+	assert.Equal(t, 1, results.WarningCount)
+
+	// The aggregated validation fails on cross-file errors alone
+	err = ValidateAllBlockFiles(cfg)
+	assert.Error(t, err)
+}
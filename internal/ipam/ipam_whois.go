@@ -0,0 +1,120 @@
+package ipam
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/lugnut42/openipam/internal/iprange"
+	"github.com/lugnut42/openipam/internal/logger"
+)
+
+// Status of an address in a WhoisResult
+const (
+	WhoisAllocated   = "allocated"   // within a subnet
+	WhoisUnallocated = "unallocated" // within a block but no subnet
+	WhoisUnmanaged   = "unmanaged"   // outside all blocks
+)
+
+// WhoisResult is the most specific allocation containing an IP address
+type WhoisResult struct {
+	Address string
+	Status  string
+
+	// FileKey and Block are set unless the address is unmanaged
+	FileKey string
+	Block   *Block
+
+	// Subnet is set for allocated addresses
+	Subnet *Subnet
+
+	// FreeRange is the largest free CIDR of the block containing an
+	// unallocated address
+	FreeRange string
+}
+
+// Whois returns the block and subnet containing an IP address across all
+// block files. IPv4-mapped IPv6 addresses are looked up as IPv4 addresses.
+func Whois(cfg *config.Config, address string) (*WhoisResult, error) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(address))
+	if err != nil {
+		return nil, fmt.Errorf("invalid IP address: %s", address)
+	}
+	addr = addr.Unmap()
+	result := &WhoisResult{Address: addr.String(), Status: WhoisUnmanaged}
+
+	index := &prefixTrie[indexedBlock]{}
+	for _, fileKey := range SortedFileKeys(cfg) {
+		blocks, err := loadBlocks(cfg, fileKey)
+		if err != nil {
+			return nil, fmt.Errorf("error reading block file %s: %w", fileKey, err)
+		}
+		for _, block := range blocks {
+			prefix, err := iprange.ParsePrefix(block.CIDR)
+			if err != nil {
+				logger.Debug("Skipping block %s in %s: %v", block.CIDR, fileKey, err)
+				continue
+			}
+			index.insert(prefix, indexedBlock{FileKey: fileKey, Block: block, Prefix: prefix})
+		}
+	}
+
+	entry, ok := index.lookup(addr)
+	if !ok {
+		return result, nil
+	}
+	block := entry.Value.Block
+	result.FileKey = entry.Value.FileKey
+	result.Block = &block
+
+	subnets := subnetTrie(block.Subnets)
+	if match, ok := subnets.lookup(addr); ok {
+		result.Status = WhoisAllocated
+		result.Subnet = &block.Subnets[match.Value]
+		return result, nil
+	}
+
+	result.Status = WhoisUnallocated
+	for _, free := range subnets.free(entry.Prefix) {
+		if free.Contains(addr) {
+			result.FreeRange = free.String()
+			break
+		}
+	}
+	return result, nil
+}
+
+// PrintWhois prints a whois result
+func PrintWhois(result *WhoisResult) error {
+	if result.Status == WhoisUnmanaged {
+		fmt.Printf("%s is outside all managed space\n", result.Address)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Address:\t", result.Address)
+	fmt.Fprintln(w, "Status:\t", result.Status)
+	fmt.Fprintln(w, "File Key:\t", result.FileKey)
+	fmt.Fprintln(w, "Block CIDR:\t", result.Block.CIDR)
+	if result.Block.Description != "" {
+		fmt.Fprintln(w, "Block Description:\t", result.Block.Description)
+	}
+	if subnet := result.Subnet; subnet != nil {
+		fmt.Fprintln(w, "Subnet CIDR:\t", subnet.CIDR)
+		fmt.Fprintln(w, "Name:\t", subnet.Name)
+		fmt.Fprintln(w, "Region:\t", subnet.Region)
+		if len(subnet.Tags) > 0 {
+			fmt.Fprintln(w, "Tags:\t", formatTags(subnet.Tags))
+		}
+	} else {
+		fmt.Fprintln(w, "Free Range:\t", result.FreeRange)
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("error flushing writer: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package ipam
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/lugnut42/openipam/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWhois(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{BlockFiles: map[string]string{
+		"dev":  filepath.Join(dir, "dev.yaml"),
+		"prod": filepath.Join(dir, "prod.yaml"),
+	}}
+	files := map[string][]Block{
+		"dev": {{CIDR: "10.20.0.0/16", Description: "Development", Subnets: []Subnet{
+			{CIDR: "10.20.0.0/22", Name: "gke", Region: "us-west1"},
+			{CIDR: "10.20.3.0/24", Name: "gke-pods", Region: "us-west1", Tags: map[string]string{"team": "platform"}},
+		}}},
+		"prod": {{CIDR: "2001:db8::/32", Subnets: []Subnet{{CIDR: "2001:db8:1::/48", Name: "edge"}}}},
+	}
+	for fileKey, blocks := range files {
+		yamlData, err := marshalBlocks(blocks)
+		require.NoError(t, err)
+		require.NoError(t, writeYAMLFile(cfg.BlockFiles[fileKey], yamlData))
+	}
+
+	// The most specific subnet wins
+	result, err := Whois(cfg, "10.20.3.17")
+	require.NoError(t, err)
+	assert.Equal(t, WhoisAllocated, result.Status)
+	assert.Equal(t, "dev", result.FileKey)
+	assert.Equal(t, "10.20.0.0/16", result.Block.CIDR)
+	assert.Equal(t, "gke-pods", result.Subnet.Name)
+	assert.Equal(t, "platform", result.Subnet.Tags["team"])
+
+	result, err = Whois(cfg, "::ffff:10.20.1.1")
+	require.NoError(t, err)
+	assert.Equal(t, "10.20.1.1", result.Address)
+	assert.Equal(t, "gke", result.Subnet.Name)
+
+	result, err = Whois(cfg, "10.20.200.1")
+	require.NoError(t, err)
+	assert.Equal(t, WhoisUnallocated, result.Status)
+	assert.Nil(t, result.Subnet)
+	assert.Equal(t, "10.20.128.0/17", result.FreeRange)
+
+	result, err = Whois(cfg, "2001:db8:1::10")
+	require.NoError(t, err)
+	assert.Equal(t, "prod", result.FileKey)
+	assert.Equal(t, "edge", result.Subnet.Name)
+
+	result, err = Whois(cfg, "192.168.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, WhoisUnmanaged, result.Status)
+	assert.Nil(t, result.Block)
+
+	_, err = Whois(cfg, "10.20.3.0/24")
+	assert.EqualError(t, err, "invalid IP address: 10.20.3.0/24")
+}
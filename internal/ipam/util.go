@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -69,12 +70,34 @@ func unmarshalBlocks(yamlData []byte) ([]Block, error) {
 									s.Region = regionStr
 								}
 							}
+
+							if renumberable, ok := subnet["renumberable"].(bool); ok {
+								s.Renumberable = renumberable
+							}
+
+							if tags, ok := subnet["tags"].(map[string]interface{}); ok && len(tags) > 0 {
+								s.Tags = make(map[string]string, len(tags))
+								for key, value := range tags {
+									s.Tags[key] = fmt.Sprint(value)
+								}
+							}
+
+							// Handle the creation time if present
+							switch createdAt := subnet["created_at"].(type) {
+							case time.Time:
+								s.CreatedAt = createdAt
+							case string:
+								if t, err := time.Parse(time.RFC3339, createdAt); err == nil {
+									s.CreatedAt = t
+								}
+							}
 							
 							subnets[i] = s
 						}
 
 					}
-					blocks = append(blocks, Block{CIDR: cidr, Description: description, Subnets: subnets})
+					provider, _ := block["provider"].(string)
+					blocks = append(blocks, Block{CIDR: cidr, Description: description, Subnets: subnets, Provider: provider})
 
 				}
 			}
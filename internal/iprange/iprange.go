@@ -0,0 +1,154 @@
+// Package iprange is the address arithmetic of OpenIPAM, built on net/netip:
+// parsing CIDRs into canonical prefixes, prefix bounds and sizes, address
+// offsets, and splitting address ranges into CIDRs. IPv4-mapped IPv6 prefixes
+// such as ::ffff:10.0.0.0/104 are treated as the IPv4 prefix they map
+// (10.0.0.0/8), so that every network has exactly one representation.
+package iprange
+
+import (
+	"fmt"
+	"math/big"
+	"math/bits"
+	"net/netip"
+	"strings"
+)
+
+// ParsePrefix parses a CIDR, ignoring surrounding whitespace. Host bits are
+// cleared and IPv4-mapped IPv6 prefixes are unmapped.
+func ParsePrefix(s string) (netip.Prefix, error) {
+	p, err := netip.ParsePrefix(strings.TrimSpace(s))
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid CIDR address: %s", s)
+	}
+	return Unmap(p).Masked(), nil
+}
+
+// Unmap returns the IPv4 prefix of an IPv4-mapped IPv6 prefix that lies
+// within ::ffff:0:0/96, and any other prefix unchanged
+func Unmap(p netip.Prefix) netip.Prefix {
+	if !p.Addr().Is4In6() || p.Bits() < 96 {
+		return p
+	}
+	return netip.PrefixFrom(p.Addr().Unmap(), p.Bits()-96)
+}
+
+// Last returns the last address of a prefix
+func Last(p netip.Prefix) netip.Addr {
+	b := p.Masked().Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// Size returns the number of addresses of a prefix, zero if it is invalid
+func Size(p netip.Prefix) *big.Int {
+	if !p.IsValid() {
+		return new(big.Int)
+	}
+	return new(big.Int).Lsh(big.NewInt(1), uint(p.Addr().BitLen()-p.Bits()))
+}
+
+// Covers reports whether inner lies entirely within outer
+func Covers(outer, inner netip.Prefix) bool {
+	return outer.Bits() <= inner.Bits() && outer.Contains(inner.Addr())
+}
+
+// Halves splits a prefix into its lower and upper half. The prefix must be
+// shorter than the address length.
+func Halves(p netip.Prefix) (netip.Prefix, netip.Prefix) {
+	p = p.Masked()
+	b := p.Addr().AsSlice()
+	b[p.Bits()/8] |= 0x80 >> (p.Bits() % 8)
+	upper, _ := netip.AddrFromSlice(b)
+	return netip.PrefixFrom(p.Addr(), p.Bits()+1), netip.PrefixFrom(upper, p.Bits()+1)
+}
+
+// Bit returns bit i of an address, counting from the most significant bit
+func Bit(addr netip.Addr, i int) int {
+	b := addr.AsSlice()
+	return int(b[i/8]>>(7-i%8)) & 1
+}
+
+// CommonBits returns how many leading bits two prefixes of the same family
+// share, at most the length of the shorter prefix
+func CommonBits(a, b netip.Prefix) int {
+	limit := min(a.Bits(), b.Bits())
+	x, y := a.Addr().AsSlice(), b.Addr().AsSlice()
+	n := 0
+	for i := 0; i < len(x) && n < limit; i++ {
+		if x[i] != y[i] {
+			n += bits.LeadingZeros8(x[i] ^ y[i])
+			break
+		}
+		n += 8
+	}
+	return min(n, limit)
+}
+
+// Offset returns the distance from one address to another of the same family;
+// it is negative if to comes before from
+func Offset(from, to netip.Addr) *big.Int {
+	return new(big.Int).Sub(toInt(to), toInt(from))
+}
+
+// Add returns the address n addresses after addr, and false if that is beyond
+// the address space of its family
+func Add(addr netip.Addr, n *big.Int) (netip.Addr, bool) {
+	sum := new(big.Int).Add(toInt(addr), n)
+	b := make([]byte, addr.BitLen()/8)
+	if sum.Sign() < 0 || sum.BitLen() > len(b)*8 {
+		return netip.Addr{}, false
+	}
+	next, _ := netip.AddrFromSlice(sum.FillBytes(b))
+	return next, true
+}
+
+func toInt(addr netip.Addr) *big.Int {
+	return new(big.Int).SetBytes(addr.AsSlice())
+}
+
+// Range is an inclusive range of addresses of one family
+type Range struct {
+	First, Last netip.Addr
+}
+
+// RangeOf returns the addresses of a prefix as a range
+func RangeOf(p netip.Prefix) Range {
+	return Range{First: p.Masked().Addr(), Last: Last(p)}
+}
+
+// Contains reports whether addr lies within the range
+func (r Range) Contains(addr netip.Addr) bool {
+	return r.First.Compare(addr) <= 0 && addr.Compare(r.Last) <= 0
+}
+
+// Prefixes returns the fewest CIDRs that cover exactly the range, in address
+// order. It is empty if Last comes before First or the families differ.
+func (r Range) Prefixes() []netip.Prefix {
+	if !r.First.IsValid() || r.First.BitLen() != r.Last.BitLen() || r.Last.Less(r.First) {
+		return nil
+	}
+
+	var prefixes []netip.Prefix
+	for start := r.First; ; {
+		// Grow the prefix while start stays its first address and it ends within the range
+		bitLen := start.BitLen()
+		p := netip.PrefixFrom(start, bitLen)
+		for p.Bits() > 0 {
+			wider := netip.PrefixFrom(start, p.Bits()-1)
+			if wider.Masked().Addr() != start || r.Last.Less(Last(wider)) {
+				break
+			}
+			p = wider
+		}
+		prefixes = append(prefixes, p)
+
+		last := Last(p)
+		if last == r.Last {
+			return prefixes
+		}
+		start = last.Next()
+	}
+}
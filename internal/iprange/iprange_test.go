@@ -0,0 +1,294 @@
+package iprange
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"net/netip"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePrefix(t *testing.T) {
+	testCases := []struct {
+		cidr     string
+		expected string
+	}{
+		{cidr: "10.0.0.0/8", expected: "10.0.0.0/8"},
+		{cidr: " 10.0.0.0/8\n", expected: "10.0.0.0/8"},
+		{cidr: "192.168.1.1/24", expected: "192.168.1.0/24"},
+		{cidr: "192.168.1.0/16", expected: "192.168.0.0/16"},
+		{cidr: "2001:db8:0:0::1/64", expected: "2001:db8::/64"},
+		{cidr: "::ffff:10.0.0.0/104", expected: "10.0.0.0/8"},
+		{cidr: "::ffff:192.168.1.7/120", expected: "192.168.1.0/24"},
+		{cidr: "::ffff:0:0/96", expected: "0.0.0.0/0"},
+		{cidr: "::ffff:0:0/95", expected: "::fffe:0:0/95"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.cidr, func(t *testing.T) {
+			p, err := ParsePrefix(tc.cidr)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, p.String())
+		})
+	}
+
+	_, err := ParsePrefix("10.0.0.256/24")
+	assert.EqualError(t, err, "invalid CIDR address: 10.0.0.256/24")
+}
+
+func TestPrefixBounds(t *testing.T) {
+	p := netip.MustParsePrefix("10.0.1.0/24")
+	assert.Equal(t, "10.0.1.255", Last(p).String())
+	assert.Equal(t, "256", Size(p).String())
+	assert.Equal(t, "2001:db8:ffff:ffff:ffff:ffff:ffff:ffff", Last(netip.MustParsePrefix("2001:db8::/32")).String())
+	assert.Equal(t, "79228162514264337593543950336", Size(netip.MustParsePrefix("2001:db8::/32")).String())
+	assert.Equal(t, "0", Size(netip.Prefix{}).String())
+
+	lower, upper := Halves(p)
+	assert.Equal(t, "10.0.1.0/25", lower.String())
+	assert.Equal(t, "10.0.1.128/25", upper.String())
+
+	assert.True(t, Covers(p, netip.MustParsePrefix("10.0.1.128/25")))
+	assert.False(t, Covers(netip.MustParsePrefix("10.0.1.128/25"), p))
+	assert.Equal(t, 23, CommonBits(p, netip.MustParsePrefix("10.0.0.0/24")))
+}
+
+func TestAdd(t *testing.T) {
+	testCases := []struct {
+		start    string
+		step     int64
+		expected string
+	}{
+		{start: "192.168.1.1", step: 1, expected: "192.168.1.2"},
+		{start: "192.168.1.255", step: 1, expected: "192.168.2.0"},
+		{start: "192.168.255.255", step: 1, expected: "192.169.0.0"},
+		{start: "192.168.1.1", step: 10, expected: "192.168.1.11"},
+		{start: "192.168.1.250", step: 10, expected: "192.168.2.4"},
+		{start: "192.168.1.1", step: 65535, expected: "192.169.1.0"},
+		{start: "10.0.1.0", step: -256, expected: "10.0.0.0"},
+		{start: "2001:db8::ffff", step: 1, expected: "2001:db8::1:0"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s+%d", tc.start, tc.step), func(t *testing.T) {
+			addr, ok := Add(netip.MustParseAddr(tc.start), big.NewInt(tc.step))
+			require.True(t, ok)
+			assert.Equal(t, tc.expected, addr.String())
+			assert.Equal(t, tc.step, Offset(netip.MustParseAddr(tc.start), addr).Int64())
+		})
+	}
+
+	// Addresses do not wrap around
+	_, ok := Add(netip.MustParseAddr("255.255.255.255"), big.NewInt(1))
+	assert.False(t, ok)
+	_, ok = Add(netip.MustParseAddr("0.0.0.0"), big.NewInt(-1))
+	assert.False(t, ok)
+}
+
+func TestRangePrefixes(t *testing.T) {
+	testCases := []struct {
+		first, last string
+		expected    []string
+	}{
+		// The first CIDR is limited by the alignment of the first address
+		{first: "10.0.0.1", last: "10.0.1.255", expected: []string{
+			"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/30", "10.0.0.8/29", "10.0.0.16/28",
+			"10.0.0.32/27", "10.0.0.64/26", "10.0.0.128/25", "10.0.1.0/24",
+		}},
+		{first: "10.0.1.0", last: "10.0.3.255", expected: []string{"10.0.1.0/24", "10.0.2.0/23"}},
+		{first: "0.0.0.0", last: "255.255.255.255", expected: []string{"0.0.0.0/0"}},
+		{first: "2001:db8::", last: "2001:db8::2", expected: []string{"2001:db8::/127", "2001:db8::2/128"}},
+		{first: "10.0.0.2", last: "10.0.0.1", expected: nil},
+		{first: "10.0.0.1", last: "2001:db8::", expected: nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.first+"-"+tc.last, func(t *testing.T) {
+			r := Range{First: netip.MustParseAddr(tc.first), Last: netip.MustParseAddr(tc.last)}
+			var got []string
+			for _, p := range r.Prefixes() {
+				got = append(got, p.String())
+			}
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+
+	r := RangeOf(netip.MustParsePrefix("10.0.0.0/24"))
+	assert.True(t, r.Contains(netip.MustParseAddr("10.0.0.255")))
+	assert.False(t, r.Contains(netip.MustParseAddr("10.0.1.0")))
+}
+
+// The properties below check the netip implementations against the net.IP
+// helpers they replaced, on random IPv4 prefixes.
+
+// randomPrefix turns random numbers into a masked IPv4 prefix and its net.IPNet
+func randomPrefix(addr uint32, bits uint8) (netip.Prefix, *net.IPNet) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], addr)
+	p := netip.PrefixFrom(netip.AddrFrom4(b), int(bits%33)).Masked()
+	_, ipNet, _ := net.ParseCIDR(p.String())
+	return p, ipNet
+}
+
+func TestLastMatchesLegacy(t *testing.T) {
+	property := func(addr uint32, bits uint8) bool {
+		p, ipNet := randomPrefix(addr, bits)
+		return Last(p).String() == legacyLastIP(ipNet).String() &&
+			Size(p).Cmp(legacyAddressCount(ipNet)) == 0
+	}
+	require.NoError(t, quick.Check(property, nil))
+}
+
+func TestOverlapsMatchesLegacy(t *testing.T) {
+	property := func(addrA, addrB uint32, bitsA, bitsB uint8) bool {
+		a, netA := randomPrefix(addrA, bitsA)
+		// Share the leading bits often enough to produce overlaps
+		b, netB := randomPrefix(addrA^(addrB>>(bitsB%33)), bitsB)
+		return a.Overlaps(b) == legacyCheckCIDROverlap(netA, netB) &&
+			Covers(a, b) == (netA.Contains(netB.IP) && netA.Contains(legacyLastIP(netB)))
+	}
+	require.NoError(t, quick.Check(property, nil))
+}
+
+func TestAddMatchesLegacy(t *testing.T) {
+	property := func(addr uint32, step uint16) bool {
+		p, ipNet := randomPrefix(addr, 32)
+		next, ok := Add(p.Addr(), big.NewInt(int64(step)))
+		legacy := legacyNextIPWithStep(ipNet.IP, int(step))
+		if uint64(addr)+uint64(step) > math.MaxUint32 {
+			return !ok // The legacy helper wrapped around
+		}
+		return ok && next.String() == legacy.String()
+	}
+	require.NoError(t, quick.Check(property, nil))
+}
+
+func TestPrefixesMatchesLegacy(t *testing.T) {
+	property := func(first uint32, length uint16) bool {
+		if uint64(first)+uint64(length) > math.MaxUint32 {
+			return true
+		}
+		start, startNet := randomPrefix(first, 32)
+		end, endNet := randomPrefix(first+uint32(length), 32)
+		var got []string
+		for _, p := range (Range{First: start.Addr(), Last: end.Addr()}).Prefixes() {
+			got = append(got, p.String())
+		}
+		// The legacy helper took an exclusive end
+		legacyEnd := legacyNextIPWithStep(endNet.IP, 1)
+		if bytes.Equal(legacyEnd, net.IPv4zero.To4()) {
+			return true
+		}
+		return fmt.Sprint(got) == fmt.Sprint(legacyCIDRsInRange(startNet.IP, legacyEnd, 0))
+	}
+	require.NoError(t, quick.Check(property, nil))
+}
+
+// IPv4-mapped IPv6 prefixes parse to the IPv4 prefix they map
+func TestMappedMatchesIPv4(t *testing.T) {
+	property := func(addr uint32, bits uint8) bool {
+		p, _ := randomPrefix(addr, bits)
+		mapped, err := ParsePrefix(fmt.Sprintf("::ffff:%s/%d", p.Addr(), p.Bits()+96))
+		return err == nil && mapped == p
+	}
+	require.NoError(t, quick.Check(property, nil))
+}
+
+// Legacy net.IP helpers, kept as the reference for the properties above
+
+func legacyLastIP(network *net.IPNet) net.IP {
+	ip := make(net.IP, len(network.IP))
+	copy(ip, network.IP)
+	for i := range ip {
+		ip[i] |= ^network.Mask[i]
+	}
+	return ip
+}
+
+func legacyAddressCount(ipNet *net.IPNet) *big.Int {
+	ones, bits := ipNet.Mask.Size()
+	return new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+}
+
+func legacyCompareIP(a, b net.IP) int {
+	for i := range a {
+		if a[i] < b[i] {
+			return -1
+		}
+		if a[i] > b[i] {
+			return 1
+		}
+	}
+	return 0
+}
+
+func legacyCheckCIDROverlap(cidr1, cidr2 *net.IPNet) bool {
+	net1 := cidr1.IP.Mask(cidr1.Mask)
+	net2 := cidr2.IP.Mask(cidr2.Mask)
+	broadcast1 := legacyLastIP(cidr1)
+	broadcast2 := legacyLastIP(cidr2)
+	if cidr1.Contains(net2) || cidr1.Contains(broadcast2) ||
+		cidr2.Contains(net1) || cidr2.Contains(broadcast1) {
+		return true
+	}
+	return legacyCompareIP(net1, broadcast2) <= 0 && legacyCompareIP(broadcast1, net2) >= 0
+}
+
+func legacyNextIPWithStep(ip net.IP, step int) net.IP {
+	newIP := make(net.IP, len(ip))
+	copy(newIP, ip)
+	for i := len(newIP) - 1; i >= 0; i-- {
+		sum := int(newIP[i]) + (step % 256)
+		newIP[i] = byte(sum % 256)
+		step = (step / 256) + (sum / 256)
+		if step == 0 {
+			break
+		}
+	}
+	return newIP
+}
+
+func legacyIsIPAligned(ip net.IP, mask net.IPMask) bool {
+	masked := make(net.IP, len(ip))
+	copy(masked, ip)
+	masked = masked.Mask(mask)
+	return ip.Equal(masked)
+}
+
+func legacyMaxCIDRSize(start, end net.IP, maxPrefix int) int {
+	size := 32
+	if !legacyIsIPAligned(start, net.CIDRMask(31, 32)) {
+		return 32
+	}
+	for size > maxPrefix {
+		candidate := size - 1
+		ones := math.Pow(2, float64(32-candidate))
+		if !legacyIsIPAligned(start, net.CIDRMask(candidate, 32)) {
+			break
+		}
+		endIP := legacyNextIPWithStep(start, int(ones)-1)
+		if bytes.Compare(endIP, end) >= 0 {
+			break
+		}
+		size = candidate
+	}
+	return size
+}
+
+func legacyCIDRsInRange(start, end net.IP, maxPrefix int) []string {
+	var cidrs []string
+	for bytes.Compare(start, end) < 0 {
+		maxSize := legacyMaxCIDRSize(start, end, maxPrefix)
+		cidrs = append(cidrs, fmt.Sprintf("%s/%d", start.String(), maxSize))
+		ones := math.Pow(2, float64(32-maxSize))
+		start = legacyNextIPWithStep(start, int(ones))
+	}
+	return cidrs
+}
@@ -0,0 +1,277 @@
+// Package s3 is a minimal client for S3-compatible object storage. It supports
+// what OpenIPAM needs to keep its files in a bucket: reading an object with its
+// ETag and writing it conditionally with If-Match or If-None-Match, signed with
+// AWS Signature Version 4.
+package s3
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when an object does not exist
+var ErrNotFound = errors.New("object not found")
+
+// ErrPreconditionFailed is returned when a conditional write fails because the
+// object was changed, created or deleted since it was read
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// Error is an error response from the server
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: HTTP %d", e.StatusCode)
+	}
+	return fmt.Sprintf("s3: %s: %s (HTTP %d)", e.Code, e.Message, e.StatusCode)
+}
+
+// Options configure a Client
+type Options struct {
+	// Endpoint is the base URL of the service; defaults to AWS S3 in Region
+	Endpoint string
+	// Region is the signing region; defaults to us-east-1
+	Region string
+	Bucket string
+	// PathStyle addresses the bucket as endpoint/bucket/key instead of
+	// bucket.endpoint/key; most S3-compatible servers such as MinIO need it
+	PathStyle bool
+
+	// Requests are anonymous when AccessKey is empty
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+
+	// HTTPClient defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// Client reads and writes the objects of a bucket
+type Client struct {
+	opts Options
+	now  func() time.Time
+}
+
+// New returns a client for the bucket of opts
+func New(opts Options) *Client {
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.Endpoint == "" {
+		opts.Endpoint = "https://s3." + opts.Region + ".amazonaws.com"
+	}
+	opts.Endpoint = strings.TrimRight(opts.Endpoint, "/")
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	return &Client{opts: opts, now: time.Now}
+}
+
+// Get returns the content and ETag of an object
+func (c *Client) Get(key string) ([]byte, string, error) {
+	resp, err := c.do(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("s3: error reading %s: %w", key, err)
+	}
+	return data, resp.Header.Get("ETag"), nil
+}
+
+// Put writes an object unconditionally and returns its new ETag
+func (c *Client) Put(key string, data []byte) (string, error) {
+	return c.put(key, data, nil)
+}
+
+// PutIfMatch writes an object only if its current ETag is etag, or, when etag is
+// empty, only if it does not exist yet. It returns the new ETag, or
+// ErrPreconditionFailed when the object was changed in the meantime.
+func (c *Client) PutIfMatch(key string, data []byte, etag string) (string, error) {
+	header := http.Header{}
+	if etag == "" {
+		header.Set("If-None-Match", "*")
+	} else {
+		header.Set("If-Match", etag)
+	}
+	return c.put(key, data, header)
+}
+
+func (c *Client) put(key string, data []byte, header http.Header) (string, error) {
+	resp, err := c.do(http.MethodPut, key, data, header)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Header.Get("ETag"), nil
+}
+
+// objectURL returns the URL of an object
+func (c *Client) objectURL(key string) (*url.URL, error) {
+	base, err := url.Parse(c.opts.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("s3: invalid endpoint %q: %w", c.opts.Endpoint, err)
+	}
+	u := *base
+	if c.opts.PathStyle {
+		u.Path = strings.TrimRight(base.Path, "/") + "/" + c.opts.Bucket + "/" + key
+	} else {
+		u.Host = c.opts.Bucket + "." + base.Host
+		u.Path = strings.TrimRight(base.Path, "/") + "/" + key
+	}
+	u.RawPath = encodePath(u.Path)
+	return &u, nil
+}
+
+// do sends a signed request and turns error responses into errors
+func (c *Client) do(method, key string, body []byte, header http.Header) (*http.Response, error) {
+	u, err := c.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("s3: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.ContentLength = int64(len(body))
+	}
+	c.sign(req, body)
+
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3: %s %s: %w", method, key, err)
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("s3: %s: %w", key, ErrNotFound)
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		// S3 answers 409 ConditionalRequestConflict when a concurrent
+		// conditional write to the same key is in progress
+		return nil, fmt.Errorf("s3: %s: %w", key, ErrPreconditionFailed)
+	}
+
+	s3Err := &Error{StatusCode: resp.StatusCode}
+	var xmlErr struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10)); err == nil && xml.Unmarshal(data, &xmlErr) == nil {
+		s3Err.Code = xmlErr.Code
+		s3Err.Message = xmlErr.Message
+	}
+	return nil, s3Err
+}
+
+// sign adds the AWS Signature Version 4 headers to a request. The host header,
+// the range header and every x-amz-* header are signed.
+func (c *Client) sign(req *http.Request, body []byte) {
+	if c.opts.AccessKey == "" {
+		return
+	}
+
+	now := c.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.opts.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.opts.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "range" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + c.opts.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+c.opts.SecretKey), date)
+	key = hmacSHA256(key, c.opts.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.opts.AccessKey, scope, signedHeaders, signature))
+}
+
+// encodePath percent-encodes every byte of a path except unreserved characters
+// and slashes, as required for the canonical URI of S3 requests
+func encodePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		ch := path[i]
+		if ch >= 'A' && ch <= 'Z' || ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' || ch == '/' {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,112 @@
+// Package s3test provides an in-memory S3-compatible server for tests. It
+// supports GET and PUT of objects with ETags and If-Match/If-None-Match
+// conditional writes, addressed path-style.
+package s3test
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// Server is an in-memory bucket store
+type Server struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	objects map[string][]byte // by bucket/key
+
+	// BeforePut, when set, is called before a PUT is evaluated, without the
+	// server lock held; tests use it to simulate a concurrent writer
+	BeforePut func(bucket, key string)
+
+	// Conflicts counts the conditional writes rejected with 412
+	Conflicts int
+}
+
+// NewServer starts a server; close it with Close
+func NewServer() *Server {
+	s := &Server{objects: make(map[string][]byte)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// ETag returns the ETag of content, quoted as servers return it
+func ETag(data []byte) string {
+	sum := md5.Sum(data) // #nosec G401 -- ETags of single-part uploads are MD5 digests
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// Object returns the content of an object
+func (s *Server) Object(bucket, key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[bucket+"/"+key]
+	return data, ok
+}
+
+// SetObject stores an object directly
+func (s *Server) SetObject(bucket, key string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[bucket+"/"+key] = data
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	if !strings.Contains(name, "/") {
+		writeError(w, http.StatusBadRequest, "InvalidRequest", "object key required")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		data, ok := s.objects[name]
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		w.Header().Set("ETag", ETag(data))
+		_, _ = w.Write(data)
+
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		if s.BeforePut != nil {
+			bucket, key, _ := strings.Cut(name, "/")
+			s.BeforePut(bucket, key)
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		current, exists := s.objects[name]
+		ifMatch := r.Header.Get("If-Match")
+		ifNoneMatch := r.Header.Get("If-None-Match")
+		if (ifMatch != "" && (!exists || ETag(current) != ifMatch)) || (ifNoneMatch == "*" && exists) {
+			s.Conflicts++
+			writeError(w, http.StatusPreconditionFailed, "PreconditionFailed", "At least one of the pre-conditions you specified did not hold")
+			return
+		}
+		s.objects[name] = data
+		w.Header().Set("ETag", ETag(data))
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed.")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<Error><Code>%s</Code><Message>%s</Message></Error>", code, message)
+}
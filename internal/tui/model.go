@@ -0,0 +1,469 @@
+package tui
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	internal "github.com/lugnut42/openipam/internal/ipam"
+	openipam "github.com/lugnut42/openipam/pkg/ipam"
+)
+
+// screen is a level of the browser: block files, the blocks of a file, or the
+// subnets and free ranges of a block
+type screen int
+
+const (
+	screenFiles screen = iota
+	screenBlocks
+	screenSubnets
+)
+
+// mode is what keys currently do
+type mode int
+
+const (
+	modeBrowse mode = iota
+	modeConfirmDelete
+	modeRename
+	modePickPattern
+)
+
+const barWidth = 20
+
+// row is a selectable line of a screen
+type row struct {
+	key    string // file key, block CIDR or subnet CIDR
+	label  string
+	ratio  float64
+	bar    bool
+	subnet *openipam.Subnet // set for subnet rows
+}
+
+// model is the state of the TUI. It reads and changes blocks through a
+// Manager, so that changes are committed like those of the other commands.
+type model struct {
+	mgr *openipam.Manager
+
+	screen  screen
+	mode    mode
+	fileKey string
+	block   string
+	rows    []row
+	free    []string
+	cursor  int
+	cursors map[screen]int // cursor positions of the screens above the current one
+
+	patterns      []string
+	patternCursor int
+	input         string
+
+	message string
+	height  int
+	quit    bool
+}
+
+func newModel(mgr *openipam.Manager) *model {
+	m := &model{mgr: mgr, cursors: make(map[screen]int), height: 24}
+	m.reload()
+	return m
+}
+
+// reload reads the rows of the current screen
+func (m *model) reload() {
+	var err error
+	switch m.screen {
+	case screenFiles:
+		m.rows, err = m.fileRows()
+	case screenBlocks:
+		m.rows, err = m.blockRows()
+	case screenSubnets:
+		m.rows, m.free, err = m.subnetRows()
+	}
+	if err != nil {
+		m.rows = nil
+		m.message = "Error: " + err.Error()
+	}
+	if m.cursor >= len(m.rows) {
+		m.cursor = len(m.rows) - 1
+	}
+	if m.cursor < 0 {
+		m.cursor = 0
+	}
+}
+
+func (m *model) fileRows() ([]row, error) {
+	var fileKeys []string
+	for fileKey := range m.mgr.Config().BlockFiles {
+		fileKeys = append(fileKeys, fileKey)
+	}
+	sort.Strings(fileKeys)
+
+	var rows []row
+	for _, fileKey := range fileKeys {
+		entries, err := m.mgr.ListBlocks(fileKey)
+		if err != nil {
+			rows = append(rows, row{key: fileKey, label: fmt.Sprintf("%-16s  error: %v", fileKey, err)})
+			continue
+		}
+		total, allocated := new(big.Int), new(big.Int)
+		for _, entry := range entries {
+			if report, err := m.mgr.Utilization(entry.Block.CIDR, fileKey); err == nil {
+				total.Add(total, report.TotalIPs)
+				allocated.Add(allocated, report.AllocatedIPs)
+			}
+		}
+		rows = append(rows, row{
+			key:   fileKey,
+			label: fmt.Sprintf("%-16s  %d blocks", fileKey, len(entries)),
+			ratio: ratio(allocated, total),
+			bar:   total.Sign() > 0,
+		})
+	}
+	return rows, nil
+}
+
+func (m *model) blockRows() ([]row, error) {
+	entries, err := m.mgr.ListBlocks(m.fileKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []row
+	for _, entry := range entries {
+		block := entry.Block
+		r := row{key: block.CIDR, label: fmt.Sprintf("%-20s  %3d subnets  %s", block.CIDR, len(block.Subnets), block.Description)}
+		if report, err := m.mgr.Utilization(block.CIDR, m.fileKey); err == nil {
+			r.ratio, r.bar = report.UtilizationRatio, true
+		}
+		rows = append(rows, r)
+	}
+	return rows, nil
+}
+
+func (m *model) subnetRows() ([]row, []string, error) {
+	block, err := m.mgr.GetBlock(m.block, m.fileKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	report, err := m.mgr.Utilization(m.block, m.fileKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	shares := make(map[string]float64)
+	for _, s := range report.Subnets {
+		shares[s.CIDR] = s.BlockShare
+	}
+
+	var rows []row
+	for i := range block.Subnets {
+		subnet := &block.Subnets[i]
+		rows = append(rows, row{
+			key:    subnet.CIDR,
+			label:  fmt.Sprintf("%-20s  %-24s  %s", subnet.CIDR, subnet.Name, subnet.Region),
+			ratio:  shares[subnet.CIDR],
+			bar:    true,
+			subnet: subnet,
+		})
+	}
+
+	free, err := m.mgr.AvailableCIDRs(m.block, m.fileKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rows, free, nil
+}
+
+// update applies a key to the model
+func (m *model) update(key string) {
+	if key == "ctrl+c" {
+		m.quit = true
+		return
+	}
+
+	switch m.mode {
+	case modeConfirmDelete:
+		m.mode = modeBrowse
+		if key == "y" || key == "Y" {
+			subnet := m.rows[m.cursor].subnet
+			if err := m.mgr.DeleteSubnet(subnet.CIDR); err != nil {
+				m.message = "Error: " + err.Error()
+			} else {
+				m.message = fmt.Sprintf("Deleted subnet %s (%s)", subnet.CIDR, subnet.Name)
+			}
+			m.reload()
+		} else {
+			m.message = "Delete cancelled"
+		}
+		return
+
+	case modeRename:
+		switch key {
+		case "enter":
+			m.mode = modeBrowse
+			subnet := m.rows[m.cursor].subnet
+			if warnings, err := m.mgr.RenameSubnet(subnet.CIDR, m.input); err != nil {
+				m.message = "Error: " + err.Error()
+			} else {
+				m.message = withWarnings(fmt.Sprintf("Renamed subnet %s to %s", subnet.CIDR, strings.TrimSpace(m.input)), warnings)
+			}
+			m.reload()
+		case "esc":
+			m.mode = modeBrowse
+			m.message = "Rename cancelled"
+		case "ctrl+u":
+			m.input = ""
+		case "backspace":
+			if len(m.input) > 0 {
+				runes := []rune(m.input)
+				m.input = string(runes[:len(runes)-1])
+			}
+		default:
+			if len([]rune(key)) == 1 {
+				m.input += key
+			}
+		}
+		return
+
+	case modePickPattern:
+		switch key {
+		case "up", "k":
+			if m.patternCursor > 0 {
+				m.patternCursor--
+			}
+		case "down", "j":
+			if m.patternCursor < len(m.patterns)-1 {
+				m.patternCursor++
+			}
+		case "enter":
+			m.mode = modeBrowse
+			name := m.patterns[m.patternCursor]
+			subnet, warnings, err := m.mgr.AllocateFromPattern(name, m.fileKey)
+			if err != nil {
+				m.message = "Error: " + err.Error()
+			} else {
+				m.message = withWarnings(fmt.Sprintf("Allocated subnet %s (%s) from pattern %s", subnet.CIDR, subnet.Name, name), warnings)
+			}
+			m.reload()
+		case "esc", "q", "backspace":
+			m.mode = modeBrowse
+		}
+		return
+	}
+
+	m.message = ""
+	switch key {
+	case "q":
+		m.quit = true
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < len(m.rows)-1 {
+			m.cursor++
+		}
+	case "home", "g":
+		m.cursor = 0
+	case "end", "G":
+		m.cursor = max(len(m.rows)-1, 0)
+	case "enter", "right", "l":
+		m.open()
+	case "esc", "backspace", "left", "h":
+		m.back()
+	case "a":
+		m.pickPattern()
+	case "r":
+		if subnet := m.selectedSubnet(); subnet != nil {
+			m.mode = modeRename
+			m.input = subnet.Name
+		}
+	case "d":
+		if m.selectedSubnet() != nil {
+			m.mode = modeConfirmDelete
+		}
+	case "R":
+		m.reload()
+		m.message = "Reloaded"
+	}
+}
+
+// open descends into the selected file or block
+func (m *model) open() {
+	if len(m.rows) == 0 || m.screen == screenSubnets {
+		return
+	}
+	selected := m.rows[m.cursor].key
+	m.cursors[m.screen] = m.cursor
+	if m.screen == screenFiles {
+		m.fileKey = selected
+	} else {
+		m.block = selected
+	}
+	m.screen++
+	m.cursor = 0
+	m.reload()
+}
+
+// back returns to the screen above
+func (m *model) back() {
+	if m.screen == screenFiles {
+		return
+	}
+	m.screen--
+	m.cursor = m.cursors[m.screen]
+	m.reload()
+}
+
+func (m *model) selectedSubnet() *openipam.Subnet {
+	if m.screen != screenSubnets || len(m.rows) == 0 {
+		return nil
+	}
+	return m.rows[m.cursor].subnet
+}
+
+// pickPattern lists the patterns allocating from the current or selected block
+func (m *model) pickPattern() {
+	var blockCIDR string
+	switch {
+	case m.screen == screenSubnets:
+		blockCIDR = m.block
+	case m.screen == screenBlocks && len(m.rows) > 0:
+		blockCIDR = m.rows[m.cursor].key
+	default:
+		return
+	}
+
+	m.patterns = nil
+	for name, pattern := range m.mgr.ListPatterns(m.fileKey) {
+		if internal.CanonicalCIDR(pattern.Block) == internal.CanonicalCIDR(blockCIDR) {
+			m.patterns = append(m.patterns, name)
+		}
+	}
+	if len(m.patterns) == 0 {
+		m.message = fmt.Sprintf("No patterns allocate from block %s", blockCIDR)
+		return
+	}
+	sort.Strings(m.patterns)
+	m.patternCursor = 0
+	m.mode = modePickPattern
+}
+
+// view renders the model as lines of text
+func (m *model) view() string {
+	var b strings.Builder
+	title := "OpenIPAM"
+	if m.screen >= screenBlocks {
+		title += "  ›  " + m.fileKey
+	}
+	if m.screen == screenSubnets {
+		title += "  ›  " + m.block
+	}
+	b.WriteString(bold(title) + "\n\n")
+
+	lines := []string{}
+	selected := -1
+	for i, r := range m.rows {
+		line := r.label
+		if r.bar {
+			line = fmt.Sprintf("%s  %s", bar(r.ratio), line)
+		}
+		if i == m.cursor {
+			selected = len(lines)
+		}
+		lines = append(lines, line)
+	}
+	if len(m.rows) == 0 {
+		lines = append(lines, "  (empty)")
+	}
+	if m.screen == screenSubnets {
+		lines = append(lines, "", bold("Free ranges"))
+		if len(m.free) == 0 {
+			lines = append(lines, "  (none)")
+		}
+		for _, cidr := range m.free {
+			lines = append(lines, "  "+cidr)
+		}
+	}
+
+	// Scroll so that the selected row stays visible
+	visible := max(m.height-6, 3)
+	start := 0
+	if selected >= visible {
+		start = selected - visible + 1
+	}
+	for i := start; i < len(lines) && i < start+visible; i++ {
+		if i == selected && m.mode != modePickPattern {
+			b.WriteString(reverse("> "+lines[i]) + "\n")
+		} else {
+			b.WriteString("  " + lines[i] + "\n")
+		}
+	}
+
+	b.WriteString("\n")
+	switch m.mode {
+	case modeConfirmDelete:
+		subnet := m.rows[m.cursor].subnet
+		b.WriteString(fmt.Sprintf("Delete subnet %s (%s)? [y/N] ", subnet.CIDR, subnet.Name))
+	case modeRename:
+		b.WriteString(fmt.Sprintf("New name for %s: %s█  (enter to save, ctrl+u to clear, esc to cancel)", m.rows[m.cursor].key, m.input))
+	case modePickPattern:
+		b.WriteString(bold("Allocate from pattern") + "  (enter to allocate, esc to cancel)\n")
+		for i, name := range m.patterns {
+			if i == m.patternCursor {
+				b.WriteString(reverse("> "+name) + "\n")
+			} else {
+				b.WriteString("  " + name + "\n")
+			}
+		}
+	default:
+		if m.message != "" {
+			b.WriteString(m.message + "\n")
+		}
+		b.WriteString(m.help())
+	}
+	return b.String()
+}
+
+func (m *model) help() string {
+	switch m.screen {
+	case screenFiles:
+		return "↑/↓ move  enter open  R reload  q quit"
+	case screenBlocks:
+		return "↑/↓ move  enter open  a allocate from pattern  esc back  R reload  q quit"
+	default:
+		return "↑/↓ move  a allocate from pattern  r rename  d delete  esc back  R reload  q quit"
+	}
+}
+
+// withWarnings appends the policy warnings of an operation to its status message
+func withWarnings(message string, warnings []string) string {
+	if len(warnings) == 0 {
+		return message
+	}
+	return message + " (warning: " + strings.Join(warnings, "; ") + ")"
+}
+
+// bar renders a utilization ratio as a bar with a percentage
+func bar(ratio float64) string {
+	filled := int(ratio*barWidth + 0.5)
+	filled = min(max(filled, 0), barWidth)
+	return fmt.Sprintf("[%s%s] %5.1f%%", strings.Repeat("█", filled), strings.Repeat("░", barWidth-filled), ratio*100)
+}
+
+func ratio(part, total *big.Int) float64 {
+	if total.Sign() == 0 {
+		return 0
+	}
+	r, _ := new(big.Rat).SetFrac(part, total).Float64()
+	return r
+}
+
+func bold(s string) string {
+	return "\x1b[1m" + s + "\x1b[0m"
+}
+
+func reverse(s string) string {
+	return "\x1b[7m" + s + "\x1b[0m"
+}
@@ -0,0 +1,106 @@
+// Package tui is the interactive terminal interface of OpenIPAM: a browser of
+// block files, blocks and subnets with utilization bars and free ranges, from
+// which subnets can be allocated from patterns, renamed and deleted.
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	openipam "github.com/lugnut42/openipam/pkg/ipam"
+	"golang.org/x/term"
+)
+
+// Run runs the TUI on a terminal until the user quits
+func Run(mgr *openipam.Manager, in *os.File, out io.Writer) error {
+	fd := int(in.Fd())
+	if !term.IsTerminal(fd) {
+		return errors.New("ipam tui requires an interactive terminal")
+	}
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("error setting up terminal: %w", err)
+	}
+	defer term.Restore(fd, state)
+
+	// Switch to the alternate screen and hide the cursor while running
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+
+	m := newModel(mgr)
+	buf := make([]byte, 64)
+	for !m.quit {
+		if _, height, err := term.GetSize(fd); err == nil && height > 0 {
+			m.height = height
+		}
+		// Raw mode does not translate newlines
+		fmt.Fprint(out, "\x1b[H\x1b[2J"+strings.ReplaceAll(m.view(), "\n", "\r\n"))
+
+		n, err := in.Read(buf)
+		if err != nil {
+			return err
+		}
+		for _, key := range decodeKeys(buf[:n]) {
+			m.update(key)
+			if m.quit {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// escapeKeys are the escape sequences of the keys the TUI uses
+var escapeKeys = map[string]string{
+	"\x1b[A": "up", "\x1b[B": "down", "\x1b[C": "right", "\x1b[D": "left",
+	"\x1bOA": "up", "\x1bOB": "down", "\x1bOC": "right", "\x1bOD": "left",
+	"\x1b[H": "home", "\x1b[F": "end", "\x1b[1~": "home", "\x1b[4~": "end",
+}
+
+// decodeKeys turns the bytes read from a raw terminal into key names: named
+// keys such as "up", "enter" and "esc", or the typed character
+func decodeKeys(b []byte) []string {
+	var keys []string
+	s := string(b)
+	for len(s) > 0 {
+		if s[0] == 0x1b {
+			matched := false
+			for seq, key := range escapeKeys {
+				if strings.HasPrefix(s, seq) {
+					keys = append(keys, key)
+					s = s[len(seq):]
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				keys = append(keys, "esc")
+				s = s[1:]
+			}
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s)
+		switch r {
+		case '\r', '\n':
+			keys = append(keys, "enter")
+		case 0x7f, 0x08:
+			keys = append(keys, "backspace")
+		case 0x03:
+			keys = append(keys, "ctrl+c")
+		case 0x15:
+			keys = append(keys, "ctrl+u")
+		default:
+			if r >= 0x20 && r != utf8.RuneError {
+				keys = append(keys, string(r))
+			}
+		}
+		s = s[size:]
+	}
+	return keys
+}
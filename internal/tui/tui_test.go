@@ -0,0 +1,110 @@
+package tui
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	openipam "github.com/lugnut42/openipam/pkg/ipam"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestModel(t *testing.T) (*model, *openipam.Manager) {
+	dir := t.TempDir()
+	dev := filepath.Join(dir, "dev.yaml")
+	require.NoError(t, os.WriteFile(dev, []byte(`- cidr: 10.0.0.0/22
+  description: Development
+  subnets:
+  - cidr: 10.0.0.0/24
+    name: app
+    region: us-east1
+`), 0644))
+	prod := filepath.Join(dir, "prod.yaml")
+	require.NoError(t, os.WriteFile(prod, []byte("[]"), 0644))
+
+	cfg := &openipam.Config{
+		BlockFiles: map[string]string{"dev": dev, "prod": prod},
+		Patterns: map[string]map[string]openipam.Pattern{
+			"dev": {"web": {CIDRSize: 24, Environment: "dev", Region: "us-west1", Block: "10.0.0.0/22"}},
+		},
+	}
+	mgr, err := openipam.NewManager(openipam.NewConfigStore(cfg))
+	require.NoError(t, err)
+	return newModel(mgr), mgr
+}
+
+func press(m *model, keys ...string) {
+	for _, key := range keys {
+		m.update(key)
+	}
+}
+
+func TestBrowse(t *testing.T) {
+	m, _ := newTestModel(t)
+	require.Len(t, m.rows, 2)
+	assert.Contains(t, m.view(), "dev               1 blocks")
+	assert.Contains(t, m.view(), "[█████░░░░░░░░░░░░░░░]  25.0%")
+
+	press(m, "enter")
+	assert.Equal(t, screenBlocks, m.screen)
+	assert.Contains(t, m.view(), "OpenIPAM  ›  dev")
+	assert.Contains(t, m.view(), "10.0.0.0/22             1 subnets  Development")
+
+	press(m, "enter")
+	assert.Equal(t, screenSubnets, m.screen)
+	view := m.view()
+	assert.Contains(t, view, "10.0.0.0/24           app")
+	assert.Contains(t, view, "Free ranges\x1b[0m\n    10.0.1.0/24\n    10.0.2.0/23\n")
+
+	// Going back restores the cursor of the screen above
+	press(m, "esc", "esc", "down", "enter", "esc")
+	assert.Equal(t, screenFiles, m.screen)
+	assert.Equal(t, 1, m.cursor)
+
+	press(m, "q")
+	assert.True(t, m.quit)
+}
+
+func TestAllocateRenameDelete(t *testing.T) {
+	m, mgr := newTestModel(t)
+	press(m, "enter", "enter")
+
+	// Allocate from the pattern of the block
+	press(m, "a")
+	require.Equal(t, modePickPattern, m.mode)
+	assert.Equal(t, []string{"web"}, m.patterns)
+	press(m, "enter")
+	assert.Contains(t, m.message, "Allocated subnet 10.0.1.0/24")
+	require.Len(t, m.rows, 2)
+	assert.Equal(t, []string{"10.0.2.0/23"}, m.free)
+
+	// Rename the new subnet
+	press(m, "down", "r")
+	require.Equal(t, modeRename, m.mode)
+	press(m, "ctrl+u", "f", "r", "o", "n", "x", "backspace", "t", "enter")
+	entry, err := mgr.GetSubnet("10.0.1.0/24")
+	require.NoError(t, err)
+	assert.Equal(t, "front", entry.Subnet.Name)
+
+	// Deleting needs confirmation
+	press(m, "d")
+	assert.Contains(t, m.view(), "Delete subnet 10.0.1.0/24 (front)? [y/N]")
+	press(m, "n")
+	assert.Equal(t, "Delete cancelled", m.message)
+	assert.Len(t, m.rows, 2)
+
+	press(m, "d", "y")
+	assert.Len(t, m.rows, 1)
+	_, err = mgr.GetSubnet("10.0.1.0/24")
+	assert.ErrorIs(t, err, openipam.ErrNotFound)
+
+	// Subnet actions do nothing outside a block
+	press(m, "esc", "esc", "d", "r")
+	assert.Equal(t, modeBrowse, m.mode)
+}
+
+func TestDecodeKeys(t *testing.T) {
+	assert.Equal(t, []string{"up", "down", "enter", "esc", "q", "backspace", "ctrl+c", "é", "ctrl+u"},
+		decodeKeys([]byte("\x1b[A\x1bOB\r\x1bq\x7f\x03é\x15")))
+}
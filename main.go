@@ -9,7 +9,7 @@ import (
 func main() {
 	if err := cmd.Execute(); err != nil {
 		// Error is already logged and printed to stderr by Execute()
-		// Just exit with non-zero status
-		os.Exit(1)
+		// Exit with the status for its failure class
+		os.Exit(cmd.ExitCode(err))
 	}
 }
\ No newline at end of file
@@ -0,0 +1,400 @@
+package ipam
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/lugnut42/openipam/internal/config"
+	internal "github.com/lugnut42/openipam/internal/ipam"
+)
+
+// Manager performs IPAM operations against a configuration loaded from a Store.
+// Blocks and subnets are stored in the block files referenced by the
+// configuration; patterns are stored in the configuration itself.
+type Manager struct {
+	store Store
+	cfg   *Config
+}
+
+// SubnetFilter narrows the subnets returned by ListSubnets. Empty fields match everything.
+type SubnetFilter struct {
+	BlockCIDR string
+	Region    string
+}
+
+// NewManager loads the configuration from store and returns a Manager for it
+func NewManager(store Store) (*Manager, error) {
+	cfg, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	return &Manager{store: store, cfg: cfg}, nil
+}
+
+// Config returns the configuration the Manager operates on
+func (m *Manager) Config() *Config {
+	return m.cfg
+}
+
+// AddBlock adds a block to the block file with the given key. The provider,
+// such as "aws", "azure" or "gcp", may be empty; it determines the addresses
+// reserved in each subnet. Blocks in public address space are rejected unless
+// allowPublic is set. The returned warnings describe accepted blocks that may
+// still be a mistake.
+func (m *Manager) AddBlock(cidr, description, provider, fileKey string, allowPublic bool) ([]string, error) {
+	warnings, err := internal.AddBlock(m.cfg, cidr, description, provider, fileKey, allowPublic)
+	if err != nil {
+		return nil, err
+	}
+	return warnings, m.commit(fmt.Sprintf("ipam: add block %s to %s", internal.CanonicalCIDR(cidr), fileKey), fileKey)
+}
+
+// DeleteBlock deletes a block. Blocks that contain subnets are only deleted with force.
+func (m *Manager) DeleteBlock(cidr, fileKey string, force bool) error {
+	if err := internal.DeleteBlock(m.cfg, cidr, force, fileKey); err != nil {
+		return err
+	}
+	return m.commit(fmt.Sprintf("ipam: delete block %s from %s", internal.CanonicalCIDR(cidr), fileKey), fileKey)
+}
+
+// ListBlocks returns the blocks of the given block files, or of all block files
+// when no file key is given
+func (m *Manager) ListBlocks(fileKey ...string) ([]BlockEntry, error) {
+	return internal.FindBlocks(m.cfg, fileKey...)
+}
+
+// GetBlock returns a block with its utilization stats
+func (m *Manager) GetBlock(cidr, fileKey string) (*Block, error) {
+	return internal.FindBlock(m.cfg, cidr, fileKey)
+}
+
+// AvailableCIDRs returns the unallocated ranges of a block
+func (m *Manager) AvailableCIDRs(blockCIDR, fileKey string) ([]string, error) {
+	return internal.AvailableCIDRs(m.cfg, blockCIDR, fileKey)
+}
+
+// Utilization returns the utilization report of a block
+func (m *Manager) Utilization(blockCIDR, fileKey string) (*UtilizationReport, error) {
+	return internal.CalculateBlockUtilization(m.cfg, blockCIDR, fileKey)
+}
+
+// FileUtilization returns the utilization reports of every block of a block file
+func (m *Manager) FileUtilization(fileKey string) ([]UtilizationReport, error) {
+	return internal.CalculateAllBlocksUtilization(m.cfg, fileKey)
+}
+
+// Forecast projects when a block runs out of capacity from the allocations made within window
+func (m *Manager) Forecast(blockCIDR, fileKey string, window time.Duration) (*ForecastReport, error) {
+	return internal.ForecastBlock(m.cfg, blockCIDR, fileKey, window)
+}
+
+// CheckThresholds returns the blocks over threshold percent utilization or
+// without room for one of their patterns. An empty blockCIDR checks every block
+// of the block file, and an empty fileKey checks every block file.
+func (m *Manager) CheckThresholds(blockCIDR, fileKey string, threshold float64) ([]ThresholdViolation, error) {
+	return internal.CheckUtilizationThresholds(m.cfg, fileKey, blockCIDR, threshold)
+}
+
+// PlanDefrag computes subnet moves that consolidate the free space of a block.
+// With onlyRenumberable, subnets not flagged as renumberable stay in place.
+func (m *Manager) PlanDefrag(blockCIDR, fileKey string, onlyRenumberable bool) (*DefragPlan, error) {
+	return internal.PlanDefrag(m.cfg, blockCIDR, fileKey, onlyRenumberable)
+}
+
+// ApplyDefrag renumbers the subnets of a plan; every move must be renumberable
+func (m *Manager) ApplyDefrag(plan *DefragPlan) error {
+	if err := internal.ApplyDefragPlan(m.cfg, plan); err != nil {
+		return err
+	}
+	return m.commit(fmt.Sprintf("ipam: renumber %d subnets in block %s", len(plan.Moves), plan.BlockCIDR), plan.FileKey)
+}
+
+// BlockMap lays out the address space of a block
+func (m *Manager) BlockMap(blockCIDR, fileKey string) (*BlockMap, error) {
+	return internal.BuildBlockMap(m.cfg, blockCIDR, fileKey)
+}
+
+// WriteBlockMap renders a block map as an "svg" image or "html" page
+func WriteBlockMap(w io.Writer, blockMap *BlockMap, format string) error {
+	return internal.WriteBlockMap(w, blockMap, format)
+}
+
+// WriteMetrics writes the utilization and validation metrics of all block files
+// in the Prometheus text exposition format
+func (m *Manager) WriteMetrics(w io.Writer) error {
+	return internal.WriteMetrics(w, m.cfg)
+}
+
+// WriteMetricsFile atomically writes the metrics of all block files to path,
+// for the node_exporter textfile collector
+func (m *Manager) WriteMetricsFile(path string) error {
+	return internal.WriteMetricsFile(path, m.cfg)
+}
+
+// MetricsHandler serves the metrics of all block files over HTTP
+func (m *Manager) MetricsHandler() http.Handler {
+	return internal.MetricsHandler(m.cfg)
+}
+
+// CreateSubnet allocates a specific subnet within a block. The returned
+// warnings are the warning-level policies the subnet violates.
+func (m *Manager) CreateSubnet(blockCIDR, subnetCIDR, name, region string) (*SubnetEntry, []string, error) {
+	warnings, err := internal.CreateSubnet(m.cfg, blockCIDR, subnetCIDR, name, region)
+	if err != nil {
+		return nil, nil, err
+	}
+	entry, err := internal.FindSubnet(m.cfg, subnetCIDR)
+	if err != nil {
+		return nil, nil, err
+	}
+	message := fmt.Sprintf("ipam: create subnet %s (%s) in block %s", entry.Subnet.CIDR, entry.Subnet.Name, entry.BlockCIDR)
+	return entry, warnings, m.commit(message, entry.FileKey)
+}
+
+// AllocateFromPattern allocates the next free subnet that fits a pattern. The
+// returned warnings are the warning-level policies the subnet violates.
+func (m *Manager) AllocateFromPattern(patternName, fileKey string) (*Subnet, []string, error) {
+	subnet, warnings, err := internal.AllocateSubnetFromPattern(m.cfg, patternName, fileKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	message := fmt.Sprintf("ipam: allocate subnet %s (%s) in block %s from pattern %s",
+		subnet.CIDR, subnet.Name, m.cfg.Patterns[fileKey][patternName].Block, patternName)
+	return subnet, warnings, m.commit(message, fileKey)
+}
+
+// DeleteSubnet deletes a subnet
+func (m *Manager) DeleteSubnet(subnetCIDR string) error {
+	entry, err := internal.FindSubnet(m.cfg, subnetCIDR)
+	if err != nil {
+		return err
+	}
+	if err := internal.DeleteSubnet(m.cfg, subnetCIDR, true); err != nil {
+		return err
+	}
+	message := fmt.Sprintf("ipam: delete subnet %s (%s) from block %s", entry.Subnet.CIDR, entry.Subnet.Name, entry.BlockCIDR)
+	return m.commit(message, entry.FileKey)
+}
+
+// RenameSubnet changes the name of a subnet. The returned warnings are the
+// warning-level policies the new name violates.
+func (m *Manager) RenameSubnet(subnetCIDR, name string) ([]string, error) {
+	entry, err := internal.FindSubnet(m.cfg, subnetCIDR)
+	if err != nil {
+		return nil, err
+	}
+	warnings, err := internal.RenameSubnet(m.cfg, subnetCIDR, name)
+	if err != nil {
+		return nil, err
+	}
+	message := fmt.Sprintf("ipam: rename subnet %s from %s to %s", entry.Subnet.CIDR, entry.Subnet.Name, name)
+	return warnings, m.commit(message, entry.FileKey)
+}
+
+// ListSubnets returns the subnets matching filter
+func (m *Manager) ListSubnets(filter SubnetFilter) ([]SubnetEntry, error) {
+	return internal.FindSubnets(m.cfg, filter.BlockCIDR, filter.Region)
+}
+
+// GetSubnet returns the subnet with the given CIDR
+func (m *Manager) GetSubnet(subnetCIDR string) (*SubnetEntry, error) {
+	return internal.FindSubnet(m.cfg, subnetCIDR)
+}
+
+// Whois returns the most specific block and subnet containing an IP address
+func (m *Manager) Whois(address string) (*WhoisResult, error) {
+	return internal.Whois(m.cfg, address)
+}
+
+// Search returns the blocks, subnets and patterns of all block files matching
+// a query such as "type:subnet region:us-* tag:team=data prefix:20-24"
+func (m *Manager) Search(query string) ([]SearchResult, error) {
+	return internal.Search(m.cfg, query)
+}
+
+// CreatePattern adds a pattern for a block file and saves the configuration
+func (m *Manager) CreatePattern(name string, pattern Pattern, fileKey string) error {
+	if err := internal.InsertPattern(m.cfg, name, pattern, fileKey); err != nil {
+		return err
+	}
+	if err := m.store.Save(m.cfg); err != nil {
+		return err
+	}
+	return m.commit(fmt.Sprintf("ipam: create pattern %s for %s", name, fileKey))
+}
+
+// UpdatePattern replaces the settings of a pattern and saves the configuration.
+// Subnets already allocated from the pattern are not changed.
+func (m *Manager) UpdatePattern(name string, pattern Pattern, fileKey string) error {
+	if err := internal.UpdatePattern(m.cfg, name, pattern, fileKey); err != nil {
+		return err
+	}
+	if err := m.store.Save(m.cfg); err != nil {
+		return err
+	}
+	return m.commit(fmt.Sprintf("ipam: update pattern %s in %s", name, fileKey))
+}
+
+// GetPattern returns a pattern of a block file
+func (m *Manager) GetPattern(name, fileKey string) (*Pattern, error) {
+	return internal.FindPattern(m.cfg, name, fileKey)
+}
+
+// ListPatterns returns the patterns of a block file keyed by name
+func (m *Manager) ListPatterns(fileKey string) map[string]Pattern {
+	patterns := make(map[string]Pattern, len(m.cfg.Patterns[fileKey]))
+	for name, pattern := range m.cfg.Patterns[fileKey] {
+		patterns[name] = pattern
+	}
+	return patterns
+}
+
+// DeletePattern removes a pattern and saves the configuration
+func (m *Manager) DeletePattern(name, fileKey string) error {
+	if err := internal.RemovePattern(m.cfg, name, fileKey); err != nil {
+		return err
+	}
+	if err := m.store.Save(m.cfg); err != nil {
+		return err
+	}
+	return m.commit(fmt.Sprintf("ipam: delete pattern %s from %s", name, fileKey))
+}
+
+// FileKeys returns the block file keys of the configuration in sorted order
+func (m *Manager) FileKeys() []string {
+	return internal.SortedFileKeys(m.cfg)
+}
+
+// ListBlockFiles returns the block file keys of the configuration with their
+// number of blocks, subnets and patterns
+func (m *Manager) ListBlockFiles() []BlockFileInfo {
+	return internal.ListBlockFiles(m.cfg)
+}
+
+// AddBlockFile adds a block file key, with an empty block file next to the
+// configuration file, and saves the configuration. It returns the block file path.
+func (m *Manager) AddBlockFile(fileKey string) (string, error) {
+	blockFile, err := internal.AddBlockFile(m.cfg, fileKey)
+	if err != nil {
+		return "", err
+	}
+	if err := m.store.Save(m.cfg); err != nil {
+		return "", fmt.Errorf("error updating configuration: %w", err)
+	}
+	return blockFile, m.commit(fmt.Sprintf("ipam: add block file %s", fileKey), fileKey)
+}
+
+// RemoveBlockFile removes a block file key from the configuration and saves it.
+// Keys referenced by patterns or policies are only removed, together with
+// them, with force. The blocks of the key are not deleted.
+func (m *Manager) RemoveBlockFile(fileKey string, force bool) error {
+	if err := internal.RemoveBlockFile(m.cfg, fileKey, force); err != nil {
+		return err
+	}
+	if err := m.store.Save(m.cfg); err != nil {
+		return err
+	}
+	return m.commit(fmt.Sprintf("ipam: remove block file %s", fileKey))
+}
+
+// RenameBlockFile renames a block file key together with its patterns,
+// policies and stored blocks, and saves the configuration
+func (m *Manager) RenameBlockFile(oldKey, newKey string) error {
+	oldPath, err := internal.RenameBlockFile(m.cfg, oldKey, newKey, m.store.Save)
+	if err != nil {
+		return err
+	}
+	if err := internal.CommitMove(m.cfg, fmt.Sprintf("ipam: rename block file %s to %s", oldKey, newKey), oldPath, newKey); err != nil {
+		return fmt.Errorf("change saved but not committed: %w", err)
+	}
+	return nil
+}
+
+// SetConfig changes a setting of the configuration, such as git.auto_commit,
+// and saves it
+func (m *Manager) SetConfig(key, value string) error {
+	if err := m.cfg.Set(key, value); err != nil {
+		return err
+	}
+	if err := m.store.Save(m.cfg); err != nil {
+		return err
+	}
+	return m.commit(fmt.Sprintf("ipam: set %s to %q", key, value))
+}
+
+// History returns the commits that changed a block or subnet, newest first
+func (m *Manager) History(cidr string) ([]HistoryEntry, error) {
+	return internal.History(m.cfg, cidr)
+}
+
+// commit records a change in the local git repository when git auto-commit is
+// enabled. The block files of fileKeys and the configuration file are committed.
+func (m *Manager) commit(message string, fileKeys ...string) error {
+	if err := internal.CommitChange(m.cfg, message, fileKeys...); err != nil {
+		return fmt.Errorf("change saved but not committed: %w", err)
+	}
+	return nil
+}
+
+// Validate validates a block file
+func (m *Manager) Validate(fileKey string) (*ValidationResults, error) {
+	return internal.ValidateBlockFile(m.cfg, fileKey)
+}
+
+// ValidateAll validates every block file in key order and returns their results
+// together with the results of the checks between block files
+func (m *Manager) ValidateAll() ([]FileValidation, *ValidationResults, error) {
+	return internal.ValidateAll(m.cfg)
+}
+
+// FixBlockFile applies the safe fixes for the validation findings of a block
+// file, such as non-canonical CIDRs and duplicate subnet entries
+func (m *Manager) FixBlockFile(fileKey string) (*FixReport, error) {
+	report, err := internal.FixBlockFile(m.cfg, fileKey)
+	if err != nil || len(report.Applied) == 0 {
+		return report, err
+	}
+	return report, m.commit(fmt.Sprintf("ipam: apply %d validation fixes to %s", len(report.Applied), fileKey), fileKey)
+}
+
+// NormalizeBlockFile rewrites the CIDRs of a block file, and the pattern block
+// references of its key, in canonical form
+func (m *Manager) NormalizeBlockFile(fileKey string) (*FixReport, error) {
+	report, err := internal.NormalizeBlockFile(m.cfg, fileKey)
+	if err != nil || len(report.Applied) == 0 {
+		return report, err
+	}
+	return report, m.commit(fmt.Sprintf("ipam: normalize %d CIDRs in %s", len(report.Applied), fileKey), fileKey)
+}
+
+// MigrateToSQLite imports the YAML block files of the given keys, or of all
+// block files, into the SQLite database at path and switches the configuration
+// to the sqlite storage backend
+func (m *Manager) MigrateToSQLite(path string, fileKeys ...string) (*ImportReport, error) {
+	report, err := internal.ImportToSQLite(m.cfg, path, fileKeys...)
+	if err != nil {
+		return nil, err
+	}
+	m.cfg.Storage = config.StorageSettings{Backend: internal.BackendSQLite, Path: path}
+	if err := m.store.Save(m.cfg); err != nil {
+		return nil, fmt.Errorf("error writing configuration: %w", err)
+	}
+	return report, m.commit("ipam: switch storage to " + internal.BackendSQLite)
+}
+
+// MigrateToS3 uploads every block file and the configuration to a bucket and
+// switches the configuration to the s3 storage backend
+func (m *Manager) MigrateToS3(settings S3Settings) (*ImportReport, error) {
+	report, blockFiles, err := internal.ExportToS3(m.cfg, settings)
+	if err != nil {
+		return nil, err
+	}
+	m.cfg.BlockFiles = blockFiles
+	m.cfg.Storage = config.StorageSettings{Backend: internal.BackendS3, S3: settings}
+	if err := m.store.Save(m.cfg); err != nil {
+		return nil, fmt.Errorf("error writing configuration: %w", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,192 @@
+package ipam
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	tempDir := t.TempDir()
+	blockFile := filepath.Join(tempDir, "default.yaml")
+	require.NoError(t, os.WriteFile(blockFile, []byte("[]"), 0644))
+
+	cfg := &Config{
+		BlockFiles: map[string]string{"default": blockFile},
+		ConfigFile: filepath.Join(tempDir, "ipam-config.yaml"),
+	}
+	store := NewConfigStore(cfg)
+	require.NoError(t, store.Save(cfg))
+
+	mgr, err := NewManager(NewFileStore(cfg.ConfigFile))
+	require.NoError(t, err)
+	return mgr
+}
+
+func TestManagerAllocateFromPattern(t *testing.T) {
+	mgr := newTestManager(t)
+
+	_, err := mgr.AddBlock("10.0.0.0/23", "test block", "", "default", false)
+	require.NoError(t, err)
+	require.NoError(t, mgr.CreatePattern("app", Pattern{CIDRSize: 24, Environment: "dev", Region: "us-east1", Block: "10.0.0.0/23"}, "default"))
+
+	first, _, err := mgr.AllocateFromPattern("app", "default")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.0/24", first.CIDR)
+
+	second, _, err := mgr.AllocateFromPattern("app", "default")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.0/24", second.CIDR)
+
+	_, _, err = mgr.AllocateFromPattern("app", "default")
+	assert.True(t, errors.Is(err, ErrExhausted))
+	var exhausted *ExhaustedError
+	require.True(t, errors.As(err, &exhausted))
+	assert.Equal(t, 24, exhausted.RequestedPrefix)
+
+	entries, err := mgr.ListSubnets(SubnetFilter{Region: "us-east1"})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "default", entries[0].FileKey)
+	assert.Equal(t, "10.0.0.0/23", entries[0].BlockCIDR)
+
+	// Patterns are saved through the store
+	reloaded, err := NewManager(NewFileStore(mgr.Config().ConfigFile))
+	require.NoError(t, err)
+	pattern, err := reloaded.GetPattern("app", "default")
+	require.NoError(t, err)
+	assert.Equal(t, 24, pattern.CIDRSize)
+}
+
+func TestManagerUpdatePattern(t *testing.T) {
+	mgr := newTestManager(t)
+
+	_, err := mgr.AddBlock("10.0.0.0/23", "test block", "", "default", false)
+	require.NoError(t, err)
+	require.NoError(t, mgr.CreatePattern("app", Pattern{CIDRSize: 24, Environment: "dev", Block: "10.0.0.0/23"}, "default"))
+
+	pattern, err := mgr.GetPattern("app", "default")
+	require.NoError(t, err)
+	pattern.Strategy = StrategyLastFit
+	pattern.NameTemplate = "{env}-app-{index}"
+	pattern.MaxSubnets = 1
+	require.NoError(t, mgr.UpdatePattern("app", *pattern, "default"))
+
+	subnet, _, err := mgr.AllocateFromPattern("app", "default")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.0/24", subnet.CIDR)
+	assert.Equal(t, "dev-app-1", subnet.Name)
+	assert.Equal(t, map[string]string{TagPattern: "app", TagEnvironment: "dev"}, subnet.Tags)
+
+	_, _, err = mgr.AllocateFromPattern("app", "default")
+	assert.ErrorContains(t, err, "maximum of 1 subnets")
+
+	assert.True(t, errors.Is(mgr.UpdatePattern("missing", *pattern, "default"), ErrNotFound))
+}
+
+func TestManagerErrors(t *testing.T) {
+	mgr := newTestManager(t)
+	_, err := mgr.AddBlock("10.0.0.0/16", "test block", "", "default", false)
+	require.NoError(t, err)
+
+	_, err = mgr.AddBlock("10.0.1.0/24", "overlapping", "", "default", false)
+	assert.True(t, errors.Is(err, ErrOverlap))
+	var overlap *OverlapError
+	require.True(t, errors.As(err, &overlap))
+	assert.Equal(t, "10.0.0.0/16", overlap.Existing)
+
+	_, _, err = mgr.CreateSubnet("10.0.0.0/16", "10.0.1.0/24", "app", "us-east1")
+	require.NoError(t, err)
+	_, _, err = mgr.CreateSubnet("10.0.0.0/16", "10.0.1.128/25", "db", "us-east1")
+	assert.True(t, errors.Is(err, ErrOverlap))
+
+	_, err = mgr.GetSubnet("10.0.2.0/24")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	_, err = mgr.GetBlock("192.168.0.0/16", "default")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	_, _, err = mgr.AllocateFromPattern("missing", "default")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	assert.NoError(t, mgr.DeleteSubnet("10.0.1.0/24"))
+	assert.True(t, errors.Is(mgr.DeleteSubnet("10.0.1.0/24"), ErrNotFound))
+}
+
+func TestManagerGitAutoCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	mgr := newTestManager(t)
+	repo := filepath.Dir(mgr.Config().ConfigFile)
+	require.NoError(t, exec.Command("git", "-C", repo, "init", "--quiet").Run())
+	mgr.Config().Git.AutoCommit = true
+
+	_, err := mgr.AddBlock("10.0.0.0/16", "test block", "", "default", false)
+	require.NoError(t, err)
+	require.NoError(t, mgr.CreatePattern("app", Pattern{CIDRSize: 24, Region: "us-east1", Block: "10.0.0.0/16"}, "default"))
+	subnet, _, err := mgr.AllocateFromPattern("app", "default")
+	require.NoError(t, err)
+	require.NoError(t, mgr.DeleteSubnet(subnet.CIDR))
+	blockFile, err := mgr.AddBlockFile("prod")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(repo, "blocks", "prod.yaml"), blockFile)
+
+	entries, err := mgr.History("10.0.0.0/16")
+	require.NoError(t, err)
+	messages := make([]string, len(entries))
+	for i, entry := range entries {
+		messages[i] = entry.Message
+	}
+	// The pattern is found by its block reference in the configuration file
+	assert.ElementsMatch(t, []string{
+		"ipam: add block 10.0.0.0/16 to default",
+		"ipam: create pattern app for default",
+		"ipam: allocate subnet 10.0.0.0/24 (app-10.0.0.0) in block 10.0.0.0/16 from pattern app",
+		"ipam: delete subnet 10.0.0.0/24 (app-10.0.0.0) from block 10.0.0.0/16",
+	}, messages)
+
+	out, err := exec.Command("git", "-C", repo, "status", "--porcelain").Output()
+	require.NoError(t, err)
+	assert.Empty(t, string(out))
+}
+
+func TestManagerFixBlockFile(t *testing.T) {
+	mgr := newTestManager(t)
+	require.NoError(t, os.WriteFile(mgr.Config().BlockFiles["default"], []byte(`- cidr: 10.0.0.0/16
+  description: test block
+  subnets:
+  - cidr: 10.0.2.0/24
+    name: b
+  - cidr: 10.0.1.7/24
+    name: a
+`), 0644))
+
+	report, err := mgr.FixBlockFile("default")
+	require.NoError(t, err)
+	assert.Len(t, report.Applied, 2)
+
+	entries, err := mgr.ListSubnets(SubnetFilter{})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "10.0.1.0/24", entries[0].Subnet.CIDR)
+
+	files, crossResults, err := mgr.ValidateAll()
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "default", files[0].FileKey)
+	require.NoError(t, files[0].Err)
+	assert.NotNil(t, files[0].Results)
+	assert.Zero(t, crossResults.ErrorCount)
+}
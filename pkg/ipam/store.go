@@ -0,0 +1,68 @@
+package ipam
+
+import (
+	"fmt"
+
+	"github.com/lugnut42/openipam/internal/config"
+)
+
+// Store loads and saves the OpenIPAM configuration
+type Store interface {
+	Load() (*Config, error)
+	Save(cfg *Config) error
+}
+
+// FileStore is a Store backed by a configuration file on disk
+type FileStore struct {
+	Path string
+}
+
+// NewFileStore returns a Store that reads and writes the configuration file at path
+func NewFileStore(path string) *FileStore {
+	return &FileStore{Path: path}
+}
+
+// Load reads the configuration file
+func (s *FileStore) Load() (*Config, error) {
+	cfg, err := config.LoadConfig(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error loading config file: %w", err)
+	}
+	return cfg, nil
+}
+
+// Save writes the configuration back to the file it was loaded from
+func (s *FileStore) Save(cfg *Config) error {
+	if cfg.ConfigFile == "" {
+		cfg.ConfigFile = s.Path
+	}
+	return config.WriteConfig(cfg)
+}
+
+// ConfigStore is a Store wrapping an already loaded configuration
+type ConfigStore struct {
+	cfg *Config
+}
+
+// NewConfigStore returns a Store for a configuration that is already in memory.
+// Save writes the configuration to cfg.ConfigFile when it is set.
+func NewConfigStore(cfg *Config) *ConfigStore {
+	return &ConfigStore{cfg: cfg}
+}
+
+// Load returns the wrapped configuration
+func (s *ConfigStore) Load() (*Config, error) {
+	if s.cfg == nil {
+		return nil, fmt.Errorf("no configuration loaded")
+	}
+	return s.cfg, nil
+}
+
+// Save replaces the wrapped configuration and writes it to its config file, if any
+func (s *ConfigStore) Save(cfg *Config) error {
+	s.cfg = cfg
+	if cfg.ConfigFile == "" {
+		return nil
+	}
+	return config.WriteConfig(cfg)
+}
@@ -0,0 +1,125 @@
+// Package ipam is the public Go API of OpenIPAM. It exposes the block, subnet
+// and pattern operations of the ipam command line tool as a library that
+// returns values instead of printing them, so that other Go programs can
+// embed OpenIPAM without shelling out to the binary.
+//
+// A Manager is created from a Store that loads and saves the configuration:
+//
+//	store := ipam.NewFileStore("/etc/openipam/ipam-config.yaml")
+//	mgr, err := ipam.NewManager(store)
+//	if err != nil {
+//		return err
+//	}
+//	subnet, _, err := mgr.AllocateFromPattern("dev-gke-uswest", "default")
+//	if errors.Is(err, ipam.ErrExhausted) {
+//		// the block has no room left for the pattern's subnet size
+//	}
+package ipam
+
+import (
+	"github.com/lugnut42/openipam/internal/config"
+	internal "github.com/lugnut42/openipam/internal/ipam"
+)
+
+// Config is the OpenIPAM configuration: block file locations, patterns and policies
+type Config = config.Config
+
+// Pattern describes a recurring subnet allocation
+type Pattern = config.Pattern
+
+// Policy is an organizational rule checked on validation and subnet creation
+type Policy = config.Policy
+
+// Block is an IP address block and its subnets
+type Block = internal.Block
+
+// Subnet is a subnet allocated within a block
+type Subnet = internal.Subnet
+
+// BlockFileInfo summarizes a block file key of the configuration
+type BlockFileInfo = internal.BlockFileInfo
+
+// BlockEntry is a block together with the block file key it was loaded from
+type BlockEntry = internal.BlockEntry
+
+// SubnetEntry is a subnet together with its parent block and block file key
+type SubnetEntry = internal.SubnetEntry
+
+// UtilizationReport holds the utilization statistics of a block
+type UtilizationReport = internal.UtilizationReport
+
+// SubnetUtilization is a subnet's share of its block in a UtilizationReport
+type SubnetUtilization = internal.SubnetUtilization
+
+// ForecastReport projects when a block runs out of capacity
+type ForecastReport = internal.ForecastReport
+
+// ThresholdViolation describes a block over a utilization threshold
+type ThresholdViolation = internal.ThresholdViolation
+
+// DefragPlan is a set of subnet moves that consolidates the free space of a block
+type DefragPlan = internal.DefragPlan
+
+// HistoryEntry is a commit that changed a block or subnet
+type HistoryEntry = internal.HistoryEntry
+
+// WhoisResult is the block and subnet containing an IP address
+type WhoisResult = internal.WhoisResult
+
+// SearchResult is a block, subnet or pattern matching a search query
+type SearchResult = internal.SearchResult
+
+// BlockMap is the layout of a block's address space for rendering
+type BlockMap = internal.BlockMap
+
+// ValidationResults holds the results of validating a block file
+type ValidationResults = internal.ValidationResults
+
+// FileValidation is the validation of one block file returned by ValidateAll
+type FileValidation = internal.FileValidation
+
+// FixReport describes the fixes applied to a block file
+type FixReport = internal.FixReport
+
+// ImportReport counts the blocks and subnets copied by a storage migration
+type ImportReport = internal.ImportReport
+
+// S3Settings locates the bucket of the s3 storage backend
+type S3Settings = config.S3Settings
+
+// Allocation strategies of a Pattern
+const (
+	StrategyFirstFit = internal.StrategyFirstFit
+	StrategyBestFit  = internal.StrategyBestFit
+	StrategyLastFit  = internal.StrategyLastFit
+)
+
+// Tags set on the subnets allocated from a pattern
+const (
+	TagPattern     = internal.TagPattern
+	TagEnvironment = internal.TagEnvironment
+)
+
+// Status of an address in a WhoisResult
+const (
+	WhoisAllocated   = internal.WhoisAllocated
+	WhoisUnallocated = internal.WhoisUnallocated
+	WhoisUnmanaged   = internal.WhoisUnmanaged
+)
+
+// Errors returned by Manager operations. Use errors.Is to test for them.
+var (
+	ErrNotFound  = internal.ErrNotFound
+	ErrOverlap   = internal.ErrOverlap
+	ErrExhausted = internal.ErrExhausted
+)
+
+// NotFoundError reports a missing block file, block, subnet or pattern. It matches ErrNotFound.
+type NotFoundError = internal.NotFoundError
+
+// OverlapError reports the requested and the existing CIDR of an overlap. It matches ErrOverlap.
+type OverlapError = internal.OverlapError
+
+// ExhaustedError reports the requested prefix and the largest free range of a
+// block that cannot fit an allocation. It matches ErrExhausted.
+type ExhaustedError = internal.ExhaustedError
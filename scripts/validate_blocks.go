@@ -3,26 +3,20 @@ package main
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 
 	"github.com/lugnut42/openipam/internal/config"
 	"github.com/lugnut42/openipam/internal/ipam"
 )
 
 func main() {
-	// Set up the config file path
-	homeDir, err := os.UserHomeDir()
+	// Locate the config file the same way ipam does, from IPAM_PROFILE,
+	// IPAM_CONFIG_PATH or the configuration directories
+	loc, err := config.Locate("", "")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error getting home directory: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error locating config: %v\n", err)
 		os.Exit(1)
 	}
-
-	configPath := filepath.Join(homeDir, ".openipam", "ipam-config.yaml")
-
-	// Override with IPAM_CONFIG_PATH environment variable if set
-	if envPath := os.Getenv("IPAM_CONFIG_PATH"); envPath != "" {
-		configPath = filepath.Join(envPath, "ipam-config.yaml")
-	}
+	configPath := loc.Path
 
 	// Load the configuration
 	fmt.Printf("Loading config from: %s\n", configPath)
@@ -32,9 +26,6 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Set the config in the ipam package
-	ipam.SetConfig(cfg)
-
 	// Process command line arguments
 	args := os.Args[1:]
 	validateAll := false